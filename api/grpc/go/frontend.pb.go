@@ -101,6 +101,233 @@ func (x *ListResponse) GetEndpoints() []*PluginEndpoint {
 	return nil
 }
 
+// BatchRequest is a list of calls that are made in a single request. Each call is authorized individually.
+type BatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Calls are the calls to make. The method of each call is in the 'action:path' form used by Call.
+	Calls []*EndpointRequestMessage `protobuf:"bytes,1,rep,name=calls,proto3" json:"calls,omitempty"`
+	// Parallel runs the calls at the same time instead of one after another.
+	Parallel bool `protobuf:"varint,2,opt,name=parallel,proto3" json:"parallel,omitempty"`
+	// StopOnError skips the remaining calls once a call fails.
+	StopOnError   bool `protobuf:"varint,3,opt,name=stop_on_error,json=stopOnError,proto3" json:"stop_on_error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_frontend_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_frontend_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_frontend_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchRequest) GetCalls() []*EndpointRequestMessage {
+	if x != nil {
+		return x.Calls
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetParallel() bool {
+	if x != nil {
+		return x.Parallel
+	}
+	return false
+}
+
+func (x *BatchRequest) GetStopOnError() bool {
+	if x != nil {
+		return x.StopOnError
+	}
+	return false
+}
+
+// BatchResponse contains a result for each call in the batch in the same order as the calls.
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*BatchResult         `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_frontend_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_frontend_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_frontend_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchResponse) GetResults() []*BatchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// BatchResult is the result of a single call in a batch.
+type BatchResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Index is the position of the call in the batch.
+	Index int32 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	// Method is the method of the call.
+	Method string `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	// Response is the response returned by the endpoint if the call succeeded.
+	Response *EndpointResponse `protobuf:"bytes,3,opt,name=response,proto3" json:"response,omitempty"`
+	// Error is the error message if the call failed.
+	Error string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// Code is the error code if the call failed.
+	Code string `protobuf:"bytes,5,opt,name=code,proto3" json:"code,omitempty"`
+	// Details holds additional information about the error.
+	Details map[string]string `protobuf:"bytes,6,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Retryable is true if the call may succeed if it is retried.
+	Retryable bool `protobuf:"varint,7,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	// Skipped is true if the call wasn't made because an earlier call failed.
+	Skipped bool `protobuf:"varint,8,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	// DurationMs is how long the call took in milliseconds.
+	DurationMs    int64 `protobuf:"varint,9,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResult) Reset() {
+	*x = BatchResult{}
+	mi := &file_frontend_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResult) ProtoMessage() {}
+
+func (x *BatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_frontend_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResult.ProtoReflect.Descriptor instead.
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return file_frontend_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchResult) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *BatchResult) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *BatchResult) GetResponse() *EndpointResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *BatchResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BatchResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *BatchResult) GetDetails() map[string]string {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+func (x *BatchResult) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *BatchResult) GetSkipped() bool {
+	if x != nil {
+		return x.Skipped
+	}
+	return false
+}
+
+func (x *BatchResult) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
 var File_frontend_proto protoreflect.FileDescriptor
 
 const file_frontend_proto_rawDesc = "" +
@@ -108,10 +335,33 @@ const file_frontend_proto_rawDesc = "" +
 	"\x0efrontend.proto\x12\bfrontend\x1a\fplugin.proto\"\r\n" +
 	"\vListRequest\"D\n" +
 	"\fListResponse\x124\n" +
-	"\tendpoints\x18\x01 \x03(\v2\x16.plugin.PluginEndpointR\tendpoints2\x90\x01\n" +
+	"\tendpoints\x18\x01 \x03(\v2\x16.plugin.PluginEndpointR\tendpoints\"\x84\x01\n" +
+	"\fBatchRequest\x124\n" +
+	"\x05calls\x18\x01 \x03(\v2\x1e.plugin.EndpointRequestMessageR\x05calls\x12\x1a\n" +
+	"\bparallel\x18\x02 \x01(\bR\bparallel\x12\"\n" +
+	"\rstop_on_error\x18\x03 \x01(\bR\vstopOnError\"@\n" +
+	"\rBatchResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.frontend.BatchResultR\aresults\"\xee\x02\n" +
+	"\vBatchResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x124\n" +
+	"\bresponse\x18\x03 \x01(\v2\x18.plugin.EndpointResponseR\bresponse\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x12\n" +
+	"\x04code\x18\x05 \x01(\tR\x04code\x12<\n" +
+	"\adetails\x18\x06 \x03(\v2\".frontend.BatchResult.DetailsEntryR\adetails\x12\x1c\n" +
+	"\tretryable\x18\a \x01(\bR\tretryable\x12\x18\n" +
+	"\askipped\x18\b \x01(\bR\askipped\x12\x1f\n" +
+	"\vduration_ms\x18\t \x01(\x03R\n" +
+	"durationMs\x1a:\n" +
+	"\fDetailsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\x9f\x02\n" +
 	"\x0eAdapterService\x125\n" +
 	"\x04List\x12\x15.frontend.ListRequest\x1a\x16.frontend.ListResponse\x12G\n" +
-	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessageB,Z*github.com/bgrewell/dtac-agent/api/grpc/gob\x06proto3"
+	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage\x12O\n" +
+	"\n" +
+	"CallStream\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage0\x01\x12<\n" +
+	"\tBatchCall\x12\x16.frontend.BatchRequest\x1a\x17.frontend.BatchResponseB,Z*github.com/bgrewell/dtac-agent/api/grpc/gob\x06proto3"
 
 var (
 	file_frontend_proto_rawDescOnce sync.Once
@@ -125,25 +375,38 @@ func file_frontend_proto_rawDescGZIP() []byte {
 	return file_frontend_proto_rawDescData
 }
 
-var file_frontend_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_frontend_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_frontend_proto_goTypes = []any{
 	(*ListRequest)(nil),             // 0: frontend.ListRequest
 	(*ListResponse)(nil),            // 1: frontend.ListResponse
-	(*PluginEndpoint)(nil),          // 2: plugin.PluginEndpoint
-	(*EndpointRequestMessage)(nil),  // 3: plugin.EndpointRequestMessage
-	(*EndpointResponseMessage)(nil), // 4: plugin.EndpointResponseMessage
+	(*BatchRequest)(nil),            // 2: frontend.BatchRequest
+	(*BatchResponse)(nil),           // 3: frontend.BatchResponse
+	(*BatchResult)(nil),             // 4: frontend.BatchResult
+	nil,                             // 5: frontend.BatchResult.DetailsEntry
+	(*PluginEndpoint)(nil),          // 6: plugin.PluginEndpoint
+	(*EndpointRequestMessage)(nil),  // 7: plugin.EndpointRequestMessage
+	(*EndpointResponse)(nil),        // 8: plugin.EndpointResponse
+	(*EndpointResponseMessage)(nil), // 9: plugin.EndpointResponseMessage
 }
 var file_frontend_proto_depIdxs = []int32{
-	2, // 0: frontend.ListResponse.endpoints:type_name -> plugin.PluginEndpoint
-	0, // 1: frontend.AdapterService.List:input_type -> frontend.ListRequest
-	3, // 2: frontend.AdapterService.Call:input_type -> plugin.EndpointRequestMessage
-	1, // 3: frontend.AdapterService.List:output_type -> frontend.ListResponse
-	4, // 4: frontend.AdapterService.Call:output_type -> plugin.EndpointResponseMessage
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	6, // 0: frontend.ListResponse.endpoints:type_name -> plugin.PluginEndpoint
+	7, // 1: frontend.BatchRequest.calls:type_name -> plugin.EndpointRequestMessage
+	4, // 2: frontend.BatchResponse.results:type_name -> frontend.BatchResult
+	8, // 3: frontend.BatchResult.response:type_name -> plugin.EndpointResponse
+	5, // 4: frontend.BatchResult.details:type_name -> frontend.BatchResult.DetailsEntry
+	0, // 5: frontend.AdapterService.List:input_type -> frontend.ListRequest
+	7, // 6: frontend.AdapterService.Call:input_type -> plugin.EndpointRequestMessage
+	7, // 7: frontend.AdapterService.CallStream:input_type -> plugin.EndpointRequestMessage
+	2, // 8: frontend.AdapterService.BatchCall:input_type -> frontend.BatchRequest
+	1, // 9: frontend.AdapterService.List:output_type -> frontend.ListResponse
+	9, // 10: frontend.AdapterService.Call:output_type -> plugin.EndpointResponseMessage
+	9, // 11: frontend.AdapterService.CallStream:output_type -> plugin.EndpointResponseMessage
+	3, // 12: frontend.AdapterService.BatchCall:output_type -> frontend.BatchResponse
+	9, // [9:13] is the sub-list for method output_type
+	5, // [5:9] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_frontend_proto_init() }
@@ -158,7 +421,7 @@ func file_frontend_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_frontend_proto_rawDesc), len(file_frontend_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,8 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AdapterService_List_FullMethodName = "/frontend.AdapterService/List"
-	AdapterService_Call_FullMethodName = "/frontend.AdapterService/Call"
+	AdapterService_List_FullMethodName       = "/frontend.AdapterService/List"
+	AdapterService_Call_FullMethodName       = "/frontend.AdapterService/Call"
+	AdapterService_CallStream_FullMethodName = "/frontend.AdapterService/CallStream"
+	AdapterService_BatchCall_FullMethodName  = "/frontend.AdapterService/BatchCall"
 )
 
 // AdapterServiceClient is the client API for AdapterService service.
@@ -29,6 +31,8 @@ const (
 type AdapterServiceClient interface {
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
 	Call(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (*EndpointResponseMessage, error)
+	CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error)
+	BatchCall(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
 }
 
 type adapterServiceClient struct {
@@ -59,12 +63,43 @@ func (c *adapterServiceClient) Call(ctx context.Context, in *EndpointRequestMess
 	return out, nil
 }
 
+func (c *adapterServiceClient) CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AdapterService_ServiceDesc.Streams[0], AdapterService_CallStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EndpointRequestMessage, EndpointResponseMessage]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AdapterService_CallStreamClient = grpc.ServerStreamingClient[EndpointResponseMessage]
+
+func (c *adapterServiceClient) BatchCall(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, AdapterService_BatchCall_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AdapterServiceServer is the server API for AdapterService service.
 // All implementations must embed UnimplementedAdapterServiceServer
 // for forward compatibility.
 type AdapterServiceServer interface {
 	List(context.Context, *ListRequest) (*ListResponse, error)
 	Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error)
+	CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error
+	BatchCall(context.Context, *BatchRequest) (*BatchResponse, error)
 	mustEmbedUnimplementedAdapterServiceServer()
 }
 
@@ -81,6 +116,12 @@ func (UnimplementedAdapterServiceServer) List(context.Context, *ListRequest) (*L
 func (UnimplementedAdapterServiceServer) Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
 }
+func (UnimplementedAdapterServiceServer) CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method CallStream not implemented")
+}
+func (UnimplementedAdapterServiceServer) BatchCall(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCall not implemented")
+}
 func (UnimplementedAdapterServiceServer) mustEmbedUnimplementedAdapterServiceServer() {}
 func (UnimplementedAdapterServiceServer) testEmbeddedByValue()                        {}
 
@@ -138,6 +179,35 @@ func _AdapterService_Call_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AdapterService_CallStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EndpointRequestMessage)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdapterServiceServer).CallStream(m, &grpc.GenericServerStream[EndpointRequestMessage, EndpointResponseMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AdapterService_CallStreamServer = grpc.ServerStreamingServer[EndpointResponseMessage]
+
+func _AdapterService_BatchCall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServiceServer).BatchCall(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdapterService_BatchCall_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServiceServer).BatchCall(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AdapterService_ServiceDesc is the grpc.ServiceDesc for AdapterService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +223,17 @@ var AdapterService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Call",
 			Handler:    _AdapterService_Call_Handler,
 		},
+		{
+			MethodName: "BatchCall",
+			Handler:    _AdapterService_BatchCall_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CallStream",
+			Handler:       _AdapterService_CallStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "frontend.proto",
 }
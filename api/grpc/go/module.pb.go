@@ -339,10 +339,12 @@ const file_module_proto_rawDesc = "" +
 	"\n" +
 	"expires_in\x18\x03 \x01(\x03R\texpiresIn\x12\x1d\n" +
 	"\n" +
-	"token_type\x18\x04 \x01(\tR\ttokenType2\xe0\x02\n" +
+	"token_type\x18\x04 \x01(\tR\ttokenType2\xb1\x03\n" +
 	"\rModuleService\x12I\n" +
 	"\bRegister\x12\x1d.module.ModuleRegisterRequest\x1a\x1e.module.ModuleRegisterResponse\x12G\n" +
-	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage\x12:\n" +
+	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage\x12O\n" +
+	"\n" +
+	"CallStream\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage0\x01\x12:\n" +
 	"\rLoggingStream\x12\x13.plugin.LoggingArgs\x1a\x12.plugin.LogMessage0\x01\x12;\n" +
 	"\fRequestToken\x12\x14.module.TokenRequest\x1a\x15.module.TokenResponse\x12B\n" +
 	"\fRefreshToken\x12\x1b.module.TokenRefreshRequest\x1a\x15.module.TokenResponseB,Z*github.com/bgrewell/dtac-agent/api/grpc/gob\x06proto3"
@@ -376,16 +378,18 @@ var file_module_proto_depIdxs = []int32{
 	5, // 0: module.ModuleRegisterResponse.endpoints:type_name -> plugin.PluginEndpoint
 	0, // 1: module.ModuleService.Register:input_type -> module.ModuleRegisterRequest
 	6, // 2: module.ModuleService.Call:input_type -> plugin.EndpointRequestMessage
-	7, // 3: module.ModuleService.LoggingStream:input_type -> plugin.LoggingArgs
-	2, // 4: module.ModuleService.RequestToken:input_type -> module.TokenRequest
-	3, // 5: module.ModuleService.RefreshToken:input_type -> module.TokenRefreshRequest
-	1, // 6: module.ModuleService.Register:output_type -> module.ModuleRegisterResponse
-	8, // 7: module.ModuleService.Call:output_type -> plugin.EndpointResponseMessage
-	9, // 8: module.ModuleService.LoggingStream:output_type -> plugin.LogMessage
-	4, // 9: module.ModuleService.RequestToken:output_type -> module.TokenResponse
-	4, // 10: module.ModuleService.RefreshToken:output_type -> module.TokenResponse
-	6, // [6:11] is the sub-list for method output_type
-	1, // [1:6] is the sub-list for method input_type
+	6, // 3: module.ModuleService.CallStream:input_type -> plugin.EndpointRequestMessage
+	7, // 4: module.ModuleService.LoggingStream:input_type -> plugin.LoggingArgs
+	2, // 5: module.ModuleService.RequestToken:input_type -> module.TokenRequest
+	3, // 6: module.ModuleService.RefreshToken:input_type -> module.TokenRefreshRequest
+	1, // 7: module.ModuleService.Register:output_type -> module.ModuleRegisterResponse
+	8, // 8: module.ModuleService.Call:output_type -> plugin.EndpointResponseMessage
+	8, // 9: module.ModuleService.CallStream:output_type -> plugin.EndpointResponseMessage
+	9, // 10: module.ModuleService.LoggingStream:output_type -> plugin.LogMessage
+	4, // 11: module.ModuleService.RequestToken:output_type -> module.TokenResponse
+	4, // 12: module.ModuleService.RefreshToken:output_type -> module.TokenResponse
+	7, // [7:13] is the sub-list for method output_type
+	1, // [1:7] is the sub-list for method input_type
 	1, // [1:1] is the sub-list for extension type_name
 	1, // [1:1] is the sub-list for extension extendee
 	0, // [0:1] is the sub-list for field type_name
@@ -21,6 +21,7 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	ModuleService_Register_FullMethodName      = "/module.ModuleService/Register"
 	ModuleService_Call_FullMethodName          = "/module.ModuleService/Call"
+	ModuleService_CallStream_FullMethodName    = "/module.ModuleService/CallStream"
 	ModuleService_LoggingStream_FullMethodName = "/module.ModuleService/LoggingStream"
 	ModuleService_RequestToken_FullMethodName  = "/module.ModuleService/RequestToken"
 	ModuleService_RefreshToken_FullMethodName  = "/module.ModuleService/RefreshToken"
@@ -32,6 +33,7 @@ const (
 type ModuleServiceClient interface {
 	Register(ctx context.Context, in *ModuleRegisterRequest, opts ...grpc.CallOption) (*ModuleRegisterResponse, error)
 	Call(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (*EndpointResponseMessage, error)
+	CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error)
 	LoggingStream(ctx context.Context, in *LoggingArgs, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogMessage], error)
 	RequestToken(ctx context.Context, in *TokenRequest, opts ...grpc.CallOption) (*TokenResponse, error)
 	RefreshToken(ctx context.Context, in *TokenRefreshRequest, opts ...grpc.CallOption) (*TokenResponse, error)
@@ -65,9 +67,28 @@ func (c *moduleServiceClient) Call(ctx context.Context, in *EndpointRequestMessa
 	return out, nil
 }
 
+func (c *moduleServiceClient) CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ModuleService_ServiceDesc.Streams[0], ModuleService_CallStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EndpointRequestMessage, EndpointResponseMessage]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_CallStreamClient = grpc.ServerStreamingClient[EndpointResponseMessage]
+
 func (c *moduleServiceClient) LoggingStream(ctx context.Context, in *LoggingArgs, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogMessage], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &ModuleService_ServiceDesc.Streams[0], ModuleService_LoggingStream_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &ModuleService_ServiceDesc.Streams[1], ModuleService_LoggingStream_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +131,7 @@ func (c *moduleServiceClient) RefreshToken(ctx context.Context, in *TokenRefresh
 type ModuleServiceServer interface {
 	Register(context.Context, *ModuleRegisterRequest) (*ModuleRegisterResponse, error)
 	Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error)
+	CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error
 	LoggingStream(*LoggingArgs, grpc.ServerStreamingServer[LogMessage]) error
 	RequestToken(context.Context, *TokenRequest) (*TokenResponse, error)
 	RefreshToken(context.Context, *TokenRefreshRequest) (*TokenResponse, error)
@@ -129,6 +151,9 @@ func (UnimplementedModuleServiceServer) Register(context.Context, *ModuleRegiste
 func (UnimplementedModuleServiceServer) Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
 }
+func (UnimplementedModuleServiceServer) CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method CallStream not implemented")
+}
 func (UnimplementedModuleServiceServer) LoggingStream(*LoggingArgs, grpc.ServerStreamingServer[LogMessage]) error {
 	return status.Errorf(codes.Unimplemented, "method LoggingStream not implemented")
 }
@@ -195,6 +220,17 @@ func _ModuleService_Call_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ModuleService_CallStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EndpointRequestMessage)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ModuleServiceServer).CallStream(m, &grpc.GenericServerStream[EndpointRequestMessage, EndpointResponseMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_CallStreamServer = grpc.ServerStreamingServer[EndpointResponseMessage]
+
 func _ModuleService_LoggingStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(LoggingArgs)
 	if err := stream.RecvMsg(m); err != nil {
@@ -267,6 +303,11 @@ var ModuleService_ServiceDesc = grpc.ServiceDesc{
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CallStream",
+			Handler:       _ModuleService_CallStream_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "LoggingStream",
 			Handler:       _ModuleService_LoggingStream_Handler,
@@ -508,8 +508,14 @@ type PluginEndpoint struct {
 	ExpectedBodySchema string `protobuf:"bytes,9,opt,name=expected_body_schema,json=expectedBodySchema,proto3" json:"expected_body_schema,omitempty"`
 	// ExpectedOutputSchema defines the JSON Schema for the expected output structure in the response.
 	ExpectedOutputSchema string `protobuf:"bytes,10,opt,name=expected_output_schema,json=expectedOutputSchema,proto3" json:"expected_output_schema,omitempty"`
-	unknownFields        protoimpl.UnknownFields
-	sizeCache            protoimpl.SizeCache
+	// Streaming indicates that the endpoint produces a stream of responses and must be invoked using CallStream.
+	Streaming bool `protobuf:"varint,11,opt,name=streaming,proto3" json:"streaming,omitempty"`
+	// TimeoutMs is the default timeout in milliseconds applied to calls to this endpoint. Zero means no timeout.
+	TimeoutMs int64 `protobuf:"varint,12,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// Async indicates that calls to this endpoint always run asynchronously as jobs.
+	Async         bool `protobuf:"varint,13,opt,name=async,proto3" json:"async,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PluginEndpoint) Reset() {
@@ -612,6 +618,27 @@ func (x *PluginEndpoint) GetExpectedOutputSchema() string {
 	return ""
 }
 
+func (x *PluginEndpoint) GetStreaming() bool {
+	if x != nil {
+		return x.Streaming
+	}
+	return false
+}
+
+func (x *PluginEndpoint) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *PluginEndpoint) GetAsync() bool {
+	if x != nil {
+		return x.Async
+	}
+	return false
+}
+
 // Logging arguments which for now is empty
 type LoggingArgs struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -814,7 +841,7 @@ const file_plugin_proto_rawDesc = "" +
 	"\x06config\x18\x01 \x01(\tR\x06config\x12%\n" +
 	"\x0edefault_secure\x18\x02 \x01(\bR\rdefaultSecure\"H\n" +
 	"\x10RegisterResponse\x124\n" +
-	"\tendpoints\x18\x01 \x03(\v2\x16.plugin.PluginEndpointR\tendpoints\"\xad\x03\n" +
+	"\tendpoints\x18\x01 \x03(\v2\x16.plugin.PluginEndpointR\tendpoints\"\x80\x04\n" +
 	"\x0ePluginEndpoint\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
 	"\x06action\x18\x02 \x01(\tR\x06action\x12 \n" +
@@ -827,7 +854,11 @@ const file_plugin_proto_rawDesc = "" +
 	"\x1aexpected_parameters_schema\x18\b \x01(\tR\x18expectedParametersSchema\x120\n" +
 	"\x14expected_body_schema\x18\t \x01(\tR\x12expectedBodySchema\x124\n" +
 	"\x16expected_output_schema\x18\n" +
-	" \x01(\tR\x14expectedOutputSchema\"\r\n" +
+	" \x01(\tR\x14expectedOutputSchema\x12\x1c\n" +
+	"\tstreaming\x18\v \x01(\bR\tstreaming\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\f \x01(\x03R\ttimeoutMs\x12\x14\n" +
+	"\x05async\x18\r \x01(\bR\x05async\"\r\n" +
 	"\vLoggingArgs\"2\n" +
 	"\bLogField\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
@@ -842,10 +873,12 @@ const file_plugin_proto_rawDesc = "" +
 	"\x04INFO\x10\x01\x12\v\n" +
 	"\aWARNING\x10\x02\x12\t\n" +
 	"\x05ERROR\x10\x03\x12\t\n" +
-	"\x05FATAL\x10\x042\xd3\x01\n" +
+	"\x05FATAL\x10\x042\xa4\x02\n" +
 	"\rPluginService\x12=\n" +
 	"\bRegister\x12\x17.plugin.RegisterRequest\x1a\x18.plugin.RegisterResponse\x12G\n" +
-	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage\x12:\n" +
+	"\x04Call\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage\x12O\n" +
+	"\n" +
+	"CallStream\x12\x1e.plugin.EndpointRequestMessage\x1a\x1f.plugin.EndpointResponseMessage0\x01\x12:\n" +
 	"\rLoggingStream\x12\x13.plugin.LoggingArgs\x1a\x12.plugin.LogMessage0\x01B,Z*github.com/bgrewell/dtac-agent/api/grpc/gob\x06proto3"
 
 var (
@@ -900,12 +933,14 @@ var file_plugin_proto_depIdxs = []int32{
 	5,  // 14: plugin.EndpointResponse.ParametersEntry.value:type_name -> plugin.StringList
 	6,  // 15: plugin.PluginService.Register:input_type -> plugin.RegisterRequest
 	1,  // 16: plugin.PluginService.Call:input_type -> plugin.EndpointRequestMessage
-	9,  // 17: plugin.PluginService.LoggingStream:input_type -> plugin.LoggingArgs
-	7,  // 18: plugin.PluginService.Register:output_type -> plugin.RegisterResponse
-	2,  // 19: plugin.PluginService.Call:output_type -> plugin.EndpointResponseMessage
-	11, // 20: plugin.PluginService.LoggingStream:output_type -> plugin.LogMessage
-	18, // [18:21] is the sub-list for method output_type
-	15, // [15:18] is the sub-list for method input_type
+	1,  // 17: plugin.PluginService.CallStream:input_type -> plugin.EndpointRequestMessage
+	9,  // 18: plugin.PluginService.LoggingStream:input_type -> plugin.LoggingArgs
+	7,  // 19: plugin.PluginService.Register:output_type -> plugin.RegisterResponse
+	2,  // 20: plugin.PluginService.Call:output_type -> plugin.EndpointResponseMessage
+	2,  // 21: plugin.PluginService.CallStream:output_type -> plugin.EndpointResponseMessage
+	11, // 22: plugin.PluginService.LoggingStream:output_type -> plugin.LogMessage
+	19, // [19:23] is the sub-list for method output_type
+	15, // [15:19] is the sub-list for method input_type
 	15, // [15:15] is the sub-list for extension type_name
 	15, // [15:15] is the sub-list for extension extendee
 	0,  // [0:15] is the sub-list for field type_name
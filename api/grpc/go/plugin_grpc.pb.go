@@ -21,6 +21,7 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	PluginService_Register_FullMethodName      = "/plugin.PluginService/Register"
 	PluginService_Call_FullMethodName          = "/plugin.PluginService/Call"
+	PluginService_CallStream_FullMethodName    = "/plugin.PluginService/CallStream"
 	PluginService_LoggingStream_FullMethodName = "/plugin.PluginService/LoggingStream"
 )
 
@@ -30,6 +31,7 @@ const (
 type PluginServiceClient interface {
 	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 	Call(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (*EndpointResponseMessage, error)
+	CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error)
 	LoggingStream(ctx context.Context, in *LoggingArgs, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogMessage], error)
 }
 
@@ -61,9 +63,28 @@ func (c *pluginServiceClient) Call(ctx context.Context, in *EndpointRequestMessa
 	return out, nil
 }
 
+func (c *pluginServiceClient) CallStream(ctx context.Context, in *EndpointRequestMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointResponseMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PluginService_ServiceDesc.Streams[0], PluginService_CallStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EndpointRequestMessage, EndpointResponseMessage]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginService_CallStreamClient = grpc.ServerStreamingClient[EndpointResponseMessage]
+
 func (c *pluginServiceClient) LoggingStream(ctx context.Context, in *LoggingArgs, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogMessage], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &PluginService_ServiceDesc.Streams[0], PluginService_LoggingStream_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &PluginService_ServiceDesc.Streams[1], PluginService_LoggingStream_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +107,7 @@ type PluginService_LoggingStreamClient = grpc.ServerStreamingClient[LogMessage]
 type PluginServiceServer interface {
 	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
 	Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error)
+	CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error
 	LoggingStream(*LoggingArgs, grpc.ServerStreamingServer[LogMessage]) error
 	mustEmbedUnimplementedPluginServiceServer()
 }
@@ -103,6 +125,9 @@ func (UnimplementedPluginServiceServer) Register(context.Context, *RegisterReque
 func (UnimplementedPluginServiceServer) Call(context.Context, *EndpointRequestMessage) (*EndpointResponseMessage, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
 }
+func (UnimplementedPluginServiceServer) CallStream(*EndpointRequestMessage, grpc.ServerStreamingServer[EndpointResponseMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method CallStream not implemented")
+}
 func (UnimplementedPluginServiceServer) LoggingStream(*LoggingArgs, grpc.ServerStreamingServer[LogMessage]) error {
 	return status.Errorf(codes.Unimplemented, "method LoggingStream not implemented")
 }
@@ -163,6 +188,17 @@ func _PluginService_Call_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PluginService_CallStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EndpointRequestMessage)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PluginServiceServer).CallStream(m, &grpc.GenericServerStream[EndpointRequestMessage, EndpointResponseMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginService_CallStreamServer = grpc.ServerStreamingServer[EndpointResponseMessage]
+
 func _PluginService_LoggingStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(LoggingArgs)
 	if err := stream.RecvMsg(m); err != nil {
@@ -191,6 +227,11 @@ var PluginService_ServiceDesc = grpc.ServiceDesc{
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CallStream",
+			Handler:       _PluginService_CallStream_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "LoggingStream",
 			Handler:       _PluginService_LoggingStream_Handler,
@@ -124,7 +124,7 @@ class RegisterResponse(_message.Message):
     def __init__(self, endpoints: _Optional[_Iterable[_Union[PluginEndpoint, _Mapping]]] = ...) -> None: ...
 
 class PluginEndpoint(_message.Message):
-    __slots__ = ["path", "action", "description", "secure", "auth_group", "expected_metadata_schema", "expected_headers_schema", "expected_parameters_schema", "expected_body_schema", "expected_output_schema"]
+    __slots__ = ["path", "action", "description", "secure", "auth_group", "expected_metadata_schema", "expected_headers_schema", "expected_parameters_schema", "expected_body_schema", "expected_output_schema", "streaming", "timeout_ms", "async"]
     PATH_FIELD_NUMBER: _ClassVar[int]
     ACTION_FIELD_NUMBER: _ClassVar[int]
     DESCRIPTION_FIELD_NUMBER: _ClassVar[int]
@@ -135,6 +135,9 @@ class PluginEndpoint(_message.Message):
     EXPECTED_PARAMETERS_SCHEMA_FIELD_NUMBER: _ClassVar[int]
     EXPECTED_BODY_SCHEMA_FIELD_NUMBER: _ClassVar[int]
     EXPECTED_OUTPUT_SCHEMA_FIELD_NUMBER: _ClassVar[int]
+    STREAMING_FIELD_NUMBER: _ClassVar[int]
+    TIMEOUT_MS_FIELD_NUMBER: _ClassVar[int]
+    ASYNC_FIELD_NUMBER: _ClassVar[int]
     path: str
     action: str
     description: str
@@ -145,7 +148,10 @@ class PluginEndpoint(_message.Message):
     expected_parameters_schema: str
     expected_body_schema: str
     expected_output_schema: str
-    def __init__(self, path: _Optional[str] = ..., action: _Optional[str] = ..., description: _Optional[str] = ..., secure: bool = ..., auth_group: _Optional[str] = ..., expected_metadata_schema: _Optional[str] = ..., expected_headers_schema: _Optional[str] = ..., expected_parameters_schema: _Optional[str] = ..., expected_body_schema: _Optional[str] = ..., expected_output_schema: _Optional[str] = ...) -> None: ...
+    streaming: bool
+    timeout_ms: int
+    async: bool
+    def __init__(self, path: _Optional[str] = ..., action: _Optional[str] = ..., description: _Optional[str] = ..., secure: bool = ..., auth_group: _Optional[str] = ..., expected_metadata_schema: _Optional[str] = ..., expected_headers_schema: _Optional[str] = ..., expected_parameters_schema: _Optional[str] = ..., expected_body_schema: _Optional[str] = ..., expected_output_schema: _Optional[str] = ..., streaming: bool = ..., timeout_ms: _Optional[int] = ..., async: bool = ...) -> None: ...
 
 class LoggingArgs(_message.Message):
     __slots__ = []
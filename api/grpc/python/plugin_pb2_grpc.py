@@ -24,6 +24,11 @@ class PluginServiceStub(object):
                 request_serializer=plugin__pb2.EndpointRequestMessage.SerializeToString,
                 response_deserializer=plugin__pb2.EndpointResponseMessage.FromString,
                 )
+        self.CallStream = channel.unary_stream(
+                '/plugin.PluginService/CallStream',
+                request_serializer=plugin__pb2.EndpointRequestMessage.SerializeToString,
+                response_deserializer=plugin__pb2.EndpointResponseMessage.FromString,
+                )
         self.LoggingStream = channel.unary_stream(
                 '/plugin.PluginService/LoggingStream',
                 request_serializer=plugin__pb2.LoggingArgs.SerializeToString,
@@ -46,6 +51,12 @@ class PluginServiceServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def CallStream(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
     def LoggingStream(self, request, context):
         """Missing associated documentation comment in .proto file."""
         context.set_code(grpc.StatusCode.UNIMPLEMENTED)
@@ -65,6 +76,11 @@ def add_PluginServiceServicer_to_server(servicer, server):
                     request_deserializer=plugin__pb2.EndpointRequestMessage.FromString,
                     response_serializer=plugin__pb2.EndpointResponseMessage.SerializeToString,
             ),
+            'CallStream': grpc.unary_stream_rpc_method_handler(
+                    servicer.CallStream,
+                    request_deserializer=plugin__pb2.EndpointRequestMessage.FromString,
+                    response_serializer=plugin__pb2.EndpointResponseMessage.SerializeToString,
+            ),
             'LoggingStream': grpc.unary_stream_rpc_method_handler(
                     servicer.LoggingStream,
                     request_deserializer=plugin__pb2.LoggingArgs.FromString,
@@ -114,6 +130,23 @@ class PluginService(object):
             options, channel_credentials,
             insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
 
+    @staticmethod
+    def CallStream(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_stream(request, target, '/plugin.PluginService/CallStream',
+            plugin__pb2.EndpointRequestMessage.SerializeToString,
+            plugin__pb2.EndpointResponseMessage.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
     @staticmethod
     def LoggingStream(request,
             target,
@@ -4,30 +4,41 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/bgrewell/dtac-agent/internal/adapters/graphql"
 	"github.com/bgrewell/dtac-agent/internal/adapters/grpc"
+	"github.com/bgrewell/dtac-agent/internal/adapters/json"
+	"github.com/bgrewell/dtac-agent/internal/adapters/mqtt"
 	"github.com/bgrewell/dtac-agent/internal/adapters/rest"
+	"github.com/bgrewell/dtac-agent/internal/adapters/websocket"
 	"github.com/bgrewell/dtac-agent/internal/authn"
 	"github.com/bgrewell/dtac-agent/internal/authndb"
 	"github.com/bgrewell/dtac-agent/internal/authz"
 	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/batch"
 	"github.com/bgrewell/dtac-agent/internal/config"
 	"github.com/bgrewell/dtac-agent/internal/config/authorization"
 	"github.com/bgrewell/dtac-agent/internal/controller"
 	"github.com/bgrewell/dtac-agent/internal/diag"
 	"github.com/bgrewell/dtac-agent/internal/endpoints"
 	"github.com/bgrewell/dtac-agent/internal/hardware"
+	"github.com/bgrewell/dtac-agent/internal/health"
 	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/idempotency"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/jobs"
 	"github.com/bgrewell/dtac-agent/internal/middleware"
 	"github.com/bgrewell/dtac-agent/internal/module"
 	"github.com/bgrewell/dtac-agent/internal/network"
 	"github.com/bgrewell/dtac-agent/internal/plugin"
+	"github.com/bgrewell/dtac-agent/internal/query"
+	"github.com/bgrewell/dtac-agent/internal/reload"
 	"github.com/bgrewell/dtac-agent/internal/system"
 	"github.com/bgrewell/dtac-agent/internal/validation"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"os"
 	"runtime"
 )
@@ -71,6 +82,20 @@ func Setup(params AdapterParams) {
 	params.Controller.Logger.Debug("prioritizing middleware")
 	middlewares = middleware.Sort(middlewares)
 
+	// Find the reload subsystem and gate the subsystems that can be toggled while running, this has to happen before
+	// the middleware is chained so the gate runs after authentication and authorization
+	var reloader *reload.Subsystem
+	for _, subsystem := range params.Subsystems {
+		if rs, ok := subsystem.(*reload.Subsystem); ok {
+			reloader = rs
+		}
+	}
+	if reloader != nil {
+		for _, subsystem := range params.Subsystems {
+			reloader.Gate(subsystem)
+		}
+	}
+
 	// Register middleware
 	params.Controller.Logger.Debug("registering middleware", zap.Int("count", len(middlewares)))
 	for _, subsystem := range params.Subsystems {
@@ -86,6 +111,19 @@ func Setup(params AdapterParams) {
 		params.Controller.EndpointList.AddEndpoints(subsystem.Endpoints())
 	}
 
+	// Register health checks
+	params.Controller.Logger.Debug("registering health checks")
+	for _, subsystem := range params.Subsystems {
+		if hs, ok := subsystem.(*health.Subsystem); ok {
+			for _, sub := range params.Subsystems {
+				if checker, ok := sub.(interfaces.HealthChecker); ok && sub.Enabled() {
+					params.Controller.Logger.Debug("found health checker", zap.String("name", sub.Name()))
+					hs.AddChecker(sub.Name(), checker)
+				}
+			}
+		}
+	}
+
 	// Setup authorization policies
 	params.Controller.Logger.Debug("setting up authorization policies")
 	for _, subsystem := range params.Subsystems {
@@ -97,7 +135,14 @@ func Setup(params AdapterParams) {
 		}
 	}
 
-	// Setup API Adapters
+	// Setup API Adapters, adapters that are disabled in the configuration are nil
+	adapters := make([]interfaces.APIAdapter, 0, len(params.Adapters))
+	for _, adapter := range params.Adapters {
+		if adapter != nil {
+			adapters = append(adapters, adapter)
+		}
+	}
+	params.Adapters = adapters
 	params.Controller.Logger.Debug("setting up API adapters", zap.Int("count", len(params.Adapters)))
 	for _, adapter := range params.Adapters {
 		params.Controller.Logger.Debug("registering adapter")
@@ -108,9 +153,29 @@ func Setup(params AdapterParams) {
 		}
 	}
 
+	// Register the components that apply configuration changes live
+	if reloader != nil {
+		params.Controller.Logger.Debug("registering reloadable components")
+		for _, subsystem := range params.Subsystems {
+			if r, ok := subsystem.(interfaces.Reloadable); ok && subsystem.Enabled() {
+				reloader.Add(subsystem.Name(), r)
+			}
+		}
+		for _, adapter := range params.Adapters {
+			if r, ok := adapter.(interfaces.Reloadable); ok {
+				reloader.Add(adapter.Name(), r)
+			}
+		}
+	}
+
 	// Set up the Fx lifecycle controller
 	params.LC.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
+			if reloader != nil {
+				if err := reloader.Watch(); err != nil {
+					params.Controller.Logger.Error("failed to watch configuration", zap.Error(err))
+				}
+			}
 			for _, adapter := range params.Adapters {
 				params.Controller.Logger.Debug("starting adapter", zap.String("name", adapter.Name()))
 				err := adapter.Start(ctx)
@@ -122,6 +187,14 @@ func Setup(params AdapterParams) {
 		},
 
 		OnStop: func(ctx context.Context) error {
+			// Stop the background work of the subsystems, such as watching the configuration
+			for _, subsystem := range params.Subsystems {
+				if closer, ok := subsystem.(io.Closer); ok {
+					if err := closer.Close(); err != nil {
+						params.Controller.Logger.Error("failed to close subsystem", zap.String("name", subsystem.Name()), zap.Error(err))
+					}
+				}
+			}
 			for _, adapter := range params.Adapters {
 				params.Controller.Logger.Debug("stopping adapter", zap.String("name", adapter.Name()))
 				err := adapter.Stop(ctx)
@@ -151,12 +224,14 @@ func AsAdapter(f any) any {
 		fx.ResultTags(`group:"adapters"`))
 }
 
-// NewLogger returns a new instance of the zap.Logger
-func NewLogger() (*zap.Logger, error) {
+// NewLogger returns a new instance of the zap.Logger along with its level, which is set from the configuration by the
+// reload subsystem
+func NewLogger() (*zap.Logger, zap.AtomicLevel, error) {
 	zapCFG := zap.NewDevelopmentConfig()
 	zapCFG.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	zapCFG.DisableStacktrace = true
-	return zapCFG.Build()
+	logger, err := zapCFG.Build()
+	return logger, zapCFG.Level, err
 }
 
 func main() {
@@ -177,26 +252,38 @@ func main() {
 		}),
 		// Set up the providers
 		fx.Provide(
-			NewLogger,                               // Structured Logger
-			config.NewConfiguration,                 // Configuration
-			basic.NewTLSInfo,                        // Tls Cert Handler
-			rest.NewJSONResponseFormatter,           // Response Formatter
-			endpoints.NewEndpointList,               // Endpoint List
-			NewController,                           // Wrapper around common subsystem input components
-			authndb.NewAuthDB,                       // Authentication database
-			AsAdapter(rest.NewAdapter),              // Rest API Interface
-			AsAdapter(grpc.NewAdapter),              // gRPC API Interface
-			AsSubsystem(basic.NewHomePageSubsystem), // Homepage handler
-			AsSubsystem(basic.NewEchoSubsystem),     // Demo Subsystem
-			AsSubsystem(diag.NewSubsystem),          // Diagnostic Subsystem
-			AsSubsystem(authn.NewSubsystem),         // Authentication Subsystem
-			AsSubsystem(authz.NewSubsystem),         // Authorization Subsystem
-			AsSubsystem(plugin.NewSubsystem),        // Plugin Subsystem
-			AsSubsystem(module.NewSubsystem),        // Module Subsystem
-			AsSubsystem(network.NewSubsystem),       // Network Subsystem
-			AsSubsystem(hardware.NewSubsystem),      // Hardware Subsystem
-			AsSubsystem(system.NewSubsystem),        // System Subsystem
-			AsSubsystem(validation.NewSubsystem),    // Validation Subsystem
+			NewLogger,                                  // Structured Logger
+			config.NewConfiguration,                    // Configuration
+			basic.NewTLSInfo,                           // Tls Cert Handler
+			rest.NewJSONResponseFormatter,              // Response Formatter
+			endpoints.NewEndpointList,                  // Endpoint List
+			NewController,                              // Wrapper around common subsystem input components
+			authndb.NewAuthDB,                          // Authentication database
+			AsAdapter(rest.NewAdapter),                 // Rest API Interface
+			AsAdapter(rest.NewUnixAdapter),             // Unix Socket API Interface
+			AsAdapter(grpc.NewAdapter),                 // gRPC API Interface
+			AsAdapter(json.NewAdapter),                 // JSON-RPC API Interface
+			AsAdapter(websocket.NewAdapter),            // WebSocket API Interface
+			AsAdapter(mqtt.NewAdapter),                 // MQTT API Interface
+			AsAdapter(graphql.NewAdapter),              // GraphQL API Interface
+			AsSubsystem(basic.NewHomePageSubsystem),    // Homepage handler
+			AsSubsystem(basic.NewEchoSubsystem),        // Demo Subsystem
+			AsSubsystem(diag.NewSubsystem),             // Diagnostic Subsystem
+			AsSubsystem(authn.NewSubsystem),            // Authentication Subsystem
+			AsSubsystem(authz.NewSubsystem),            // Authorization Subsystem
+			AsSubsystem(plugin.NewSubsystem),           // Plugin Subsystem
+			AsSubsystem(module.NewSubsystem),           // Module Subsystem
+			AsSubsystem(network.NewSubsystem),          // Network Subsystem
+			AsSubsystem(hardware.NewSubsystem),         // Hardware Subsystem
+			AsSubsystem(system.NewSubsystem),           // System Subsystem
+			AsSubsystem(validation.NewSubsystem),       // Validation Subsystem
+			AsSubsystem(validation.NewOutputSubsystem), // Output Validation Subsystem
+			AsSubsystem(query.NewSubsystem),            // Query Subsystem
+			AsSubsystem(idempotency.NewSubsystem),      // Idempotency Subsystem
+			AsSubsystem(jobs.NewSubsystem),             // Jobs Subsystem
+			AsSubsystem(batch.NewSubsystem),            // Batch Subsystem
+			AsSubsystem(health.NewSubsystem),           // Health Subsystem
+			AsSubsystem(reload.NewSubsystem),           // Configuration Reload Subsystem
 		),
 		// Invoke any functions needed to initialize everything. The empty anonymous functions are
 		// used to ensure that the providers that return that type are initialized.
@@ -10,6 +10,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/bgrewell/dtac-agent/cmd/cli/consts"
@@ -20,6 +22,7 @@ import (
 type tokenDetails struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	MFARequired  bool   `json:"mfa_required"`
 }
 
 // NewTokenCmd returns a new instance of the token command.
@@ -40,19 +43,27 @@ func NewTokenCmd() *cobra.Command {
 				return
 			}
 
+			// The tokens are taken out of the response object when the agent wrapped them in one
 			var response rest.ResponseWrapper
 			err := json.Unmarshal(body, &response)
 			if err != nil {
 				cmd.ErrOrStderr().Write([]byte("Failed to unmarshal response: " + err.Error()))
 				return
 			}
+			if len(response.Response) > 0 {
+				body = response.Response
+			}
 
 			var tokens tokenDetails
-			err = json.Unmarshal(response.Response, &tokens)
+			err = json.Unmarshal(body, &tokens)
 			if err != nil {
 				cmd.ErrOrStderr().Write([]byte("Failed to unmarshal access token: " + err.Error()))
 				return
 			}
+			if tokens.MFARequired {
+				cmd.ErrOrStderr().Write([]byte("Error: the user has mfa enabled, log in through the API with a code instead"))
+				return
+			}
 
 			cmd.OutOrStdout().Write([]byte(tokens.AccessToken))
 		},
@@ -101,11 +112,29 @@ func getTokens(cmd *cobra.Command, cfg *config.Configuration) ([]byte, bool) {
 		}
 	}
 
+	// Once the admin password has been changed through the API the agent no longer applies auth.pass, logging in with
+	// it would only count as a failed attempt
+	if _, err := os.Stat(filepath.Join(filepath.Dir(config.DBName), config.AdminPasswordChangedFile)); err == nil {
+		cmd.ErrOrStderr().Write([]byte("Error: the admin password has been changed through the API and auth.pass is no longer used, log in through the API instead"))
+		return nil, !ok
+	}
+
+	// A password generated by the agent is kept in a file next to the database rather than in the configuration
+	password := cfg.Auth.Pass
+	if password == "" || password == config.GeneratePasswordMarker {
+		generated, err := os.ReadFile(filepath.Join(filepath.Dir(config.DBName), config.AdminPasswordFile))
+		if err != nil {
+			cmd.ErrOrStderr().Write([]byte("Error: the generated admin password isn't available, set auth.pass to the admin password: " + err.Error()))
+			return nil, !ok
+		}
+		password = strings.TrimSpace(string(generated))
+	}
+
 	port := cfg.APIs.REST.Port
 	apiEndpoint := fmt.Sprintf("%s://localhost:%d/auth/login", scheme, port)
 	data := map[string]string{
 		"username": cfg.Auth.User,
-		"password": cfg.Auth.Pass,
+		"password": password,
 	}
 	payload, err := json.Marshal(data)
 	if err != nil {
@@ -1,6 +1,7 @@
 package iperfplugin
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,6 @@ import (
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"github.com/bgrewell/dtac-agent/pkg/plugins"
 	"github.com/bgrewell/dtac-agent/pkg/plugins/utility"
-	"net/http"
 	_ "net/http/pprof" // Used for remote debugging of the plugin
 	"reflect"
 	"strconv"
@@ -113,38 +113,7 @@ func (p *IperfPlugin) Register(request *api.RegisterRequest, reply *api.Register
 	p.iperfController = c
 
 	// Declare our endpoint(s)
-	authz := endpoint.AuthGroupOperator.String()
-	endpoints := []*endpoint.Endpoint{
-		endpoint.NewEndpoint("server/start", endpoint.ActionCreate, "this endpoint starts a iperf server", p.CreateIperfServer, request.DefaultSecure, authz,
-			endpoint.WithParameters(&IperfServerStartRequest{}),
-			endpoint.WithOutput(&iperf.Server{}),
-		),
-		endpoint.NewEndpoint("client/start", endpoint.ActionCreate, "this endpoint starts a iperf client", p.CreateIperfClient, request.DefaultSecure, authz,
-			endpoint.WithParameters(&IperfClientStartRequest{}),
-			endpoint.WithOutput(&iperf.Client{}),
-		),
-		endpoint.NewEndpoint("reset", endpoint.ActionDelete, "this endpoint resets the iperf server and client", p.ResetIperf, request.DefaultSecure, authz),
-		endpoint.NewEndpoint("server/stop", endpoint.ActionDelete, "this endpoint stops a iperf server", p.StopIperfServer, request.DefaultSecure, authz,
-			endpoint.WithParameters(&IperfTestIDRequest{}),
-		),
-		endpoint.NewEndpoint("client/stop", endpoint.ActionDelete, "this endpoint stops a iperf client", p.StopIperfClient, request.DefaultSecure, authz,
-			endpoint.WithParameters(&IperfTestIDRequest{}),
-		),
-		endpoint.NewEndpoint("client/results", endpoint.ActionRead, "this endpoint gets the results of a iperf client", p.GetIperfClientResults, request.DefaultSecure, authz,
-			endpoint.WithParameters(&IperfTestIDRequest{}),
-		),
-		//r.GET("/iperf/server/results/:id", handlers.GetIperfServerTestResultsHandler)
-		// TODO: Not supported yet
-		//endpoint.NewEndpoint("server/results", endpoint.ActionRead, "this endpoint gets the results of a iperf server", p.GetIperfServerResults, request.DefaultSecure, authz,
-		//	endpoint.WithParameters(&IperfTestIDRequest{}),
-		//),
-		// TODO: Not supported yet because it is specific to the Gin REST implementation
-		//r.GET("/iperf/client/live/:id", handlers.GetIperfClientTestLiveHandler)
-		//endpoint.NewEndpoint("client/live", endpoint.ActionRead, "this endpoint gets the live results of a iperf client", p.GetIperfClientLive, request.DefaultSecure, authz,
-		//	endpoint.WithParameters(&IperfTestIDRequest{}),
-		//),
-		//r.GET("/iperf/client/results/:id", handlers.GetIperfClientTestResultsHandler)
-	}
+	endpoints := p.endpoints(request.DefaultSecure)
 
 	// Register them with the plugin
 	p.RegisterMethods(endpoints)
@@ -162,6 +131,35 @@ func (p *IperfPlugin) Register(request *api.RegisterRequest, reply *api.Register
 	return nil
 }
 
+// endpoints returns the endpoints of the plugin
+func (p *IperfPlugin) endpoints(secure bool) []*endpoint.Endpoint {
+	authz := endpoint.AuthGroupOperator.String()
+	return []*endpoint.Endpoint{
+		endpoint.NewEndpoint("server/start", endpoint.ActionCreate, "this endpoint starts a iperf server", p.CreateIperfServer, secure, authz,
+			endpoint.WithParameters(&IperfServerStartRequest{}),
+			endpoint.WithOutput(&iperf.Server{}),
+		),
+		endpoint.NewEndpoint("client/start", endpoint.ActionCreate, "this endpoint starts a iperf client", p.CreateIperfClient, secure, authz,
+			endpoint.WithParameters(&IperfClientStartRequest{}),
+			endpoint.WithOutput(&iperf.Client{}),
+		),
+		endpoint.NewEndpoint("reset", endpoint.ActionDelete, "this endpoint resets the iperf server and client", p.ResetIperf, secure, authz),
+		endpoint.NewTypedEndpoint("server/stop", endpoint.ActionDelete, "this endpoint stops a iperf server", p.StopIperfServer, secure, authz),
+		endpoint.NewTypedEndpoint("client/stop", endpoint.ActionDelete, "this endpoint stops a iperf client", p.StopIperfClient, secure, authz),
+		endpoint.NewTypedEndpoint("client/results", endpoint.ActionRead, "this endpoint gets the results of a iperf client", p.GetIperfClientResults, secure, authz),
+		//r.GET("/iperf/server/results/:id", handlers.GetIperfServerTestResultsHandler)
+		// TODO: Not supported yet
+		//endpoint.NewEndpoint("server/results", endpoint.ActionRead, "this endpoint gets the results of a iperf server", p.GetIperfServerResults, secure, authz,
+		//	endpoint.WithParameters(&IperfTestIDRequest{}),
+		//),
+		endpoint.NewStreamEndpoint("client/live", endpoint.ActionRead, "this endpoint streams the live results of a iperf client started with live=true", p.GetIperfClientLive, secure, authz,
+			endpoint.WithParameters(&IperfTestIDRequest{}),
+			endpoint.WithOutput(&iperf.StreamIntervalReport{}),
+		),
+		//r.GET("/iperf/client/results/:id", handlers.GetIperfClientTestResultsHandler)
+	}
+}
+
 // CreateIperfServer creates a new iperf server instance
 func (p *IperfPlugin) CreateIperfServer(in *endpoint.Request) (out *endpoint.Response, err error) {
 	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
@@ -187,17 +185,26 @@ func (p *IperfPlugin) CreateIperfServer(in *endpoint.Request) (out *endpoint.Res
 // CreateIperfClient creates a new iperf client instance
 func (p *IperfPlugin) CreateIperfClient(in *endpoint.Request) (out *endpoint.Response, err error) {
 	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
-		host := "127.0.0.1"
-		if hostVals, ok := in.Parameters["host"]; ok {
-			if len(hostVals) > 0 {
-				host = hostVals[0]
-			}
-		} else {
+		// The parameters are decoded into the struct the endpoint declares them with
+		var params IperfClientStartRequest
+		raw, err := json.Marshal(in.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+		if params.Host == nil {
 			return nil, errors.New("'host' is a required parameter")
 		}
+		host := "127.0.0.1"
+		if len(params.Host) > 0 {
+			host = params.Host[0]
+		}
 
 		var options *iperf.ClientOptions
-		if in.Body != nil {
+		if len(in.Body) > 0 {
+			options = &iperf.ClientOptions{}
 			err := json.Unmarshal(in.Body, options)
 			if err != nil {
 				return nil, err
@@ -214,20 +221,39 @@ func (p *IperfPlugin) CreateIperfClient(in *endpoint.Request) (out *endpoint.Res
 			cli.LoadOptions(options)
 			cli.SetHost(host)
 		}
-		// TODO: We don't support live option right now otherwise we would set json to false and SetModeLive()
+
+		// Live clients report interval results over a channel which is streamed by the client/live endpoint
+		var live <-chan *iperf.StreamIntervalReport
+		if len(params.Live) > 0 {
+			if enabled, _ := strconv.ParseBool(params.Live[0]); enabled {
+				live = cli.SetModeLive()
+			}
+		}
+
 		err = cli.Start()
 		if err != nil {
 			return nil, err
 		}
 
-		p.iperfClientLock.Lock()
-		p.iperfClients[cli.Id] = cli
-		p.iperfClientLock.Unlock()
+		p.addClient(cli, live)
 
 		return json.Marshal(cli)
 	}, "creates a new iperf client instance")
 }
 
+// addClient tracks a started client and its live results, if any. The client signals Done once the test completes and
+// only closes the live results after that signal has been received, so it is always drained here.
+func (p *IperfPlugin) addClient(cli *iperf.Client, live <-chan *iperf.StreamIntervalReport) {
+	p.iperfClientLock.Lock()
+	p.iperfClients[cli.Id] = cli
+	if live != nil {
+		p.iperfLiveResults[cli.Id] = live
+	}
+	p.iperfClientLock.Unlock()
+
+	go func() { <-cli.Done }()
+}
+
 // ResetIperf resets all iperf client and server test instances
 func (p *IperfPlugin) ResetIperf(in *endpoint.Request) (out *endpoint.Response, err error) {
 	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
@@ -256,47 +282,32 @@ func (p *IperfPlugin) ResetIperf(in *endpoint.Request) (out *endpoint.Response,
 }
 
 // StopIperfServer stops and iperf server test instance
-func (p *IperfPlugin) StopIperfServer(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
-		if id, ok := in.Parameters["id"]; ok {
-			if s, ok := p.iperfServers[id[0]]; ok {
-				s.Stop()
-				p.iperfServerLock.Lock()
-				delete(p.iperfServers, id[0])
-				p.iperfServerLock.Unlock()
-				_ = p.iperfController.StopServer(id[0])
-				return json.Marshal(s)
-			}
-
-			return nil, fmt.Errorf("the specified id %s was not found on the system", id)
-
-		}
-
-		return nil, errors.New("the parameter 'id' is required")
+func (p *IperfPlugin) StopIperfServer(ctx context.Context, in IperfTestID) (*iperf.Server, error) {
+	p.iperfServerLock.Lock()
+	s, ok := p.iperfServers[in.ID]
+	delete(p.iperfServers, in.ID)
+	p.iperfServerLock.Unlock()
+	if !ok {
+		return nil, endpoint.NotFoundError("the specified id %s was not found on the system", in.ID)
+	}
 
-	}, "stops and iperf server test instance")
+	s.Stop()
+	_ = p.iperfController.StopServer(in.ID)
+	return s, nil
 }
 
 // StopIperfClient stops an iperf client test instance
-func (p *IperfPlugin) StopIperfClient(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
-		if id, ok := in.Parameters["id"]; ok {
-			if c, ok := p.iperfClients[id[0]]; ok {
-				c.Stop()
-				report := c.Report()
-				p.iperfClientLock.Lock()
-				delete(p.iperfClients, id[0])
-				p.iperfClientLock.Unlock()
-				return json.Marshal(report)
-			}
-
-			return nil, fmt.Errorf("the specified id %s was not found on the system", id)
-
-		}
-
-		return nil, errors.New("the parameter 'id' is required")
+func (p *IperfPlugin) StopIperfClient(ctx context.Context, in IperfTestID) (*iperf.TestReport, error) {
+	p.iperfClientLock.Lock()
+	c, ok := p.iperfClients[in.ID]
+	delete(p.iperfClients, in.ID)
+	p.iperfClientLock.Unlock()
+	if !ok {
+		return nil, endpoint.NotFoundError("the specified id %s was not found on the system", in.ID)
+	}
 
-	}, "stops an iperf client test instance")
+	c.Stop()
+	return c.Report(), nil
 }
 
 // GetIperfServerResults gets iperf server test results
@@ -306,30 +317,48 @@ func (p *IperfPlugin) GetIperfServerResults(in *endpoint.Request) (out *endpoint
 	}, "gets iperf server test results")
 }
 
-// GetIperfClientLive gets iperf client test results lives
-func (p *IperfPlugin) GetIperfClientLive(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
-		return nil, errors.New("this method has not been implemented")
-	}, "gets iperf client test results lives")
-}
-
-// GetIperfClientResults gets iperf client test results
-func (p *IperfPlugin) GetIperfClientResults(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return utility.PluginHandleWrapper(in, func() ([]byte, error) {
-		if id, ok := in.Parameters["id"]; ok {
-			if c, ok := p.iperfClients[id[0]]; ok {
-				if c.Running {
-					return nil, errors.New("report not ready, test is still running")
-				}
-				report := c.Report()
-				return json.Marshal(report)
-			}
+// GetIperfClientLive streams iperf client interval results as they are reported until the test completes
+func (p *IperfPlugin) GetIperfClientLive(in *endpoint.Request, send endpoint.StreamSender) error {
+	id, ok := in.Parameters["id"]
+	if !ok || len(id) == 0 {
+		return errors.New("the parameter 'id' is required")
+	}
 
-			return nil, fmt.Errorf("the specified id %s was not found on the system", id)
+	p.iperfClientLock.Lock()
+	results, ok := p.iperfLiveResults[id[0]]
+	if ok {
+		// Only a single consumer can read the live results so remove them once they have been claimed
+		delete(p.iperfLiveResults, id[0])
+	}
+	p.iperfClientLock.Unlock()
+	if !ok {
+		return fmt.Errorf("no live results are available for the specified id %s", id[0])
+	}
 
+	for report := range results {
+		value, err := json.Marshal(report)
+		if err != nil {
+			return err
 		}
+		if err := send(&endpoint.Response{Value: value}); err != nil {
+			return err
+		}
+	}
 
-		return nil, errors.New("the parameter 'id' is required")
+	return nil
+}
+
+// GetIperfClientResults gets iperf client test results
+func (p *IperfPlugin) GetIperfClientResults(ctx context.Context, in IperfTestID) (*iperf.TestReport, error) {
+	p.iperfClientLock.Lock()
+	c, ok := p.iperfClients[in.ID]
+	p.iperfClientLock.Unlock()
+	if !ok {
+		return nil, endpoint.NotFoundError("the specified id %s was not found on the system", in.ID)
+	}
+	if c.Running {
+		return nil, endpoint.ConflictError("report not ready, test is still running")
+	}
 
-	}, "gets iperf client test results")
+	return c.Report(), nil
 }
@@ -0,0 +1,84 @@
+package iperfplugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BGrewell/go-iperf"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetIperfClientLiveFinishes(t *testing.T) {
+	p := NewIperfPlugin()
+	cli := &iperf.Client{Id: "test", Done: make(chan bool)}
+	results := make(chan *iperf.StreamIntervalReport, 2)
+	p.addClient(cli, results)
+
+	// Like go-iperf, report the intervals then signal Done before closing the live results
+	go func() {
+		results <- &iperf.StreamIntervalReport{Bytes: 1}
+		results <- &iperf.StreamIntervalReport{Bytes: 2}
+		cli.Done <- true
+		close(results)
+	}()
+
+	done := make(chan error)
+	var count int
+	go func() {
+		in := &endpoint.Request{Parameters: map[string][]string{"id": {"test"}}}
+		done <- p.GetIperfClientLive(in, func(*endpoint.Response) error {
+			count++
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("live stream didn't finish")
+	}
+}
+
+func TestGetIperfClientResults(t *testing.T) {
+	p := NewIperfPlugin()
+	p.RegisterMethods(p.endpoints(false))
+	p.iperfClients["done"] = &iperf.Client{Id: "done"}
+	p.iperfClients["running"] = &iperf.Client{Id: "running", Running: true}
+
+	tests := []struct {
+		name   string
+		params map[string][]string
+		code   endpoint.ErrorCode
+	}{
+		{name: "finished", params: map[string][]string{"id": {"done"}}},
+		{name: "running", params: map[string][]string{"id": {"running"}}, code: endpoint.ErrorCodeConflict},
+		{name: "unknown id", params: map[string][]string{"id": {"missing"}}, code: endpoint.ErrorCodeNotFound},
+		{name: "missing id", code: endpoint.ErrorCodeInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Calls go through the method map of the plugin, the same way the agent reaches them
+			out, err := p.Call("read:client/results", &endpoint.Request{Parameters: tt.params})
+			if tt.code != "" {
+				assert.Equal(t, tt.code, endpoint.ErrorCodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			// The test client never ran so it has no report
+			assert.JSONEq(t, "null", string(out.Value))
+		})
+	}
+
+	// The parameter schema is derived from the typed input
+	for _, ep := range p.endpoints(false) {
+		if ep.Path == "client/results" {
+			assert.Contains(t, ep.ExpectedParametersSchema, `"required": [
+    "id"
+  ]`)
+		}
+	}
+}
@@ -5,6 +5,11 @@ type IperfTestIDRequest struct {
 	ID []string `json:"id"`
 }
 
+// IperfTestID is the input of the typed endpoints that act on a single test instance
+type IperfTestID struct {
+	ID string `json:"-" param:"id,required"`
+}
+
 // IperfServerStartRequest is a struct that is used to validate server start requests
 type IperfServerStartRequest struct {
 	BindAddr []string `json:"bind_addr,omitempty"`
@@ -13,4 +18,5 @@ type IperfServerStartRequest struct {
 // IperfClientStartRequest is a struct that is used to validate client start requests
 type IperfClientStartRequest struct {
 	Host []string `json:"host"`
+	Live []string `json:"live,omitempty"`
 }
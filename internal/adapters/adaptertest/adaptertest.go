@@ -0,0 +1,57 @@
+package adaptertest
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// Factory is the NewAdapter function of an API adapter
+type Factory func(c *controller.Controller, tls *map[string]basic.TLSInfo) (interfaces.APIAdapter, error)
+
+// NewAdapter creates the adapter for the API configuration and registers the endpoints with it, the test fails if the
+// adapter can't be created
+func NewAdapter(t *testing.T, factory Factory, apis config.APIEntries, eps ...*endpoint.Endpoint) interfaces.APIAdapter {
+	t.Helper()
+	ctrl := &controller.Controller{Config: &config.Configuration{APIs: apis}, Logger: zap.NewNop()}
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := factory(ctrl, &tls)
+	require.NoError(t, err)
+	require.NotNil(t, adapter)
+	require.NoError(t, adapter.Register([]interfaces.Subsystem{&subsystem{endpoints: eps}}))
+	return adapter
+}
+
+// Slow is a handler that only returns once the request is cancelled
+func Slow(in *endpoint.Request) (*endpoint.Response, error) {
+	<-in.Context().Done()
+	return nil, in.Context().Err()
+}
+
+// Text is a handler that returns a value that isn't JSON
+func Text(in *endpoint.Request) (*endpoint.Response, error) {
+	return &endpoint.Response{Value: []byte("plain text")}, nil
+}
+
+// subsystem is an enabled subsystem with a fixed set of endpoints
+type subsystem struct {
+	endpoints []*endpoint.Endpoint
+}
+
+func (s *subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+func (s *subsystem) Enabled() bool {
+	return true
+}
+
+func (s *subsystem) Name() string {
+	return "test"
+}
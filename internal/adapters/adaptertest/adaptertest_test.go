@@ -0,0 +1,38 @@
+package adaptertest_test
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/adapters/adaptertest"
+	"github.com/bgrewell/dtac-agent/internal/adapters/graphql"
+	"github.com/bgrewell/dtac-agent/internal/adapters/json"
+	"github.com/bgrewell/dtac-agent/internal/adapters/mqtt"
+	"github.com/bgrewell/dtac-agent/internal/adapters/websocket"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewAdapterDisabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory adaptertest.Factory
+	}{
+		{name: "graphql", factory: graphql.NewAdapter},
+		{name: "json", factory: json.NewAdapter},
+		{name: "mqtt", factory: mqtt.NewAdapter},
+		{name: "websocket", factory: websocket.NewAdapter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := &controller.Controller{Config: &config.Configuration{}, Logger: zap.NewNop()}
+			tls := make(map[string]basic.TLSInfo)
+			adapter, err := tt.factory(ctrl, &tls)
+			assert.NoError(t, err)
+			assert.Nil(t, adapter)
+		})
+	}
+}
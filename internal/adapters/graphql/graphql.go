@@ -0,0 +1,249 @@
+package graphql
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRequestSize is the largest request body accepted by the server
+const maxRequestSize = 1 << 20
+
+// NewAdapter creates a new GraphQL adapter. The adapter is nil when the GraphQL API is not enabled.
+func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
+	// Check to see if the GraphQL API is enabled. If not there is no adapter to create
+	if !c.Config.APIs.GraphQL.Enabled {
+		return nil, nil
+	}
+
+	// Setup logger
+	name := "api/graphql"
+	logger := c.Logger.With(zap.String("module", name))
+
+	r := &Adapter{
+		controller: c,
+		logger:     logger,
+		tls:        tls,
+		name:       name,
+	}
+	return r, r.setup()
+}
+
+// Adapter is the GraphQL API adapter. The schema is generated from the endpoints when they are registered, read
+// endpoints are queries and the other actions are mutations, so clients can fetch the data of several endpoints in a
+// single request and select only the fields they need.
+type Adapter struct {
+	server     *http.Server
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	tls        *map[string]basic.TLSInfo
+	controller *controller.Controller
+	logger     *zap.Logger
+	schema     graphql.Schema
+	name       string
+}
+
+// Request is the body of a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Name returns the name of the GraphQL API adapter
+func (a *Adapter) Name() string {
+	return a.name
+}
+
+// Register builds the schema from the endpoints of the subsystems
+func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
+	var eps []*endpoint.Endpoint
+	for _, subsystem := range subsystems {
+		a.logger.Debug("registering subsystem", zap.String("subsystem", subsystem.Name()))
+		if subsystem.Enabled() {
+			for _, ep := range subsystem.Endpoints() {
+				a.logger.Debug("registering endpoint", zap.String("path", ep.Path), zap.Any("action", ep.Action))
+				eps = append(eps, ep)
+			}
+		}
+	}
+
+	a.schema, err = newSchema(eps)
+	if err != nil {
+		return fmt.Errorf("failed to build graphql schema: %w", err)
+	}
+	return nil
+}
+
+// Start starts the GraphQL API adapter
+func (a *Adapter) Start(ctx context.Context) (err error) {
+	ln, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	srvMsg := "starting GraphQL server"
+	if a.tlsConfig != nil {
+		ln = tls.NewListener(ln, a.tlsConfig)
+		srvMsg = "starting secure GraphQL server"
+	}
+	a.listener = ln
+
+	a.logger.Info(srvMsg, zap.String("addr", ln.Addr().String()))
+	go func() {
+		err := a.server.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Fatal("failed to start server", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the GraphQL API adapter
+func (a *Adapter) Stop(ctx context.Context) (err error) {
+	if a.listener == nil {
+		return nil
+	}
+	return a.server.Shutdown(ctx)
+}
+
+func (a *Adapter) setup() (err error) {
+	cfg := a.controller.Config.APIs.GraphQL
+	if err := mtls.Unsupported(cfg.TLS, "GraphQL"); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", a.serveHTTP)
+	a.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if cfg.TLS.Enabled {
+		profile, ok := (*a.tls)[cfg.TLS.Profile]
+		if !ok {
+			return errors.New("tls profile not found")
+		}
+		cert, err := tls.LoadX509KeyPair(profile.CertFilename, profile.KeyFilename)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS keys: %v", err)
+		}
+		a.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	return nil
+}
+
+// serveHTTP executes the GraphQL request posted to the server. The Authorization header is used for every endpoint
+// the request resolves, and the X-Request-Timeout header sets the deadline of each of the calls.
+func (a *Adapter) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.cors(w, r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		a.write(w, http.StatusBadRequest, errorResult(endpoint.InvalidArgumentError("invalid request: %v", err)))
+		return
+	}
+	timeout, err := endpoint.ParseTimeout(r.Header.Get(endpoint.HeaderRequestTimeout))
+	if err != nil {
+		a.write(w, http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	ctx := withCall(r.Context(), &call{auth: r.Header.Get("Authorization"), remote: helpers.RemoteHost(r.RemoteAddr), timeout: timeout})
+	result := graphql.Do(graphql.Params{
+		Schema:         a.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	a.write(w, http.StatusOK, result)
+}
+
+// ReloadKeys returns the settings the adapter applies live
+func (a *Adapter) ReloadKeys() []string {
+	return []string{"apis.graphql.allowed_origins"}
+}
+
+// Reload has nothing to do, the allowed origins are read from the configuration on every request
+func (a *Adapter) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	return nil, nil
+}
+
+// cors sets the CORS headers for requests from the allowed origins. It returns false if the request comes from an
+// origin that isn't allowed. Requests without an origin and same origin requests are always allowed.
+func (a *Adapter) cors(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	a.controller.Config.RLock()
+	origins := a.controller.Config.APIs.GraphQL.AllowedOrigins
+	a.controller.Config.RUnlock()
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+endpoint.HeaderRequestTimeout)
+			w.Header().Add("Vary", "Origin")
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Adapter) write(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		a.logger.Debug("failed to write response", zap.Error(err))
+	}
+}
+
+// NOTE:
+// Example testing from command line using curl
+//
+// Login and query several endpoints in one request with the returned token
+// curl -k -X POST https://127.0.0.1:8184/graphql -H 'Content-Type: application/json' -d '{"query": "mutation { createAuthLogin(body: {username: \"<username>\", password: \"<password>\"}) { access_token } }"}'
+// curl -k -X POST https://127.0.0.1:8184/graphql -H 'Content-Type: application/json' -H 'Authorization: Bearer <access_token>' -d '{"query": "{ hardwareCpu { modelName cores } hardwareMemory { total available } system { product_name } }"}'
+//
+// Call with path parameters, query parameters and a deadline
+// curl -k -X POST https://127.0.0.1:8184/graphql -H 'Content-Type: application/json' -H 'Authorization: Bearer <access_token>' -H 'X-Request-Timeout: 5s' -d '{"query": "query($id: String!) { authUsersById(id: $id) { username groups } hardwareDiskUsage(path: \"/\") { free } }", "variables": {"id": "1"}}'
+//
+// Print the generated schema
+// curl -k -X POST https://127.0.0.1:8184/graphql -H 'Content-Type: application/json' -d '{"query": "{ __schema { queryType { fields { name } } mutationType { fields { name } } } }"}'
@@ -0,0 +1,327 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/adapters/adaptertest"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cpuInfo struct {
+	Model string            `json:"model_name"`
+	Cores int               `json:"cores"`
+	Flags []string          `json:"flags"`
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+type userParameters struct {
+	Verbose bool     `json:"verbose,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type loginBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type treeNode struct {
+	Name     string     `json:"name"`
+	Children []treeNode `json:"children,omitempty"`
+}
+
+// testResult is the decoded response of the server
+type testResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newTestAdapter(t *testing.T, eps ...*endpoint.Endpoint) *Adapter {
+	t.Helper()
+	cpu := func(in *endpoint.Request) (*endpoint.Response, error) {
+		value, err := json.Marshal(cpuInfo{Model: "test", Cores: 8, Flags: []string{"sse", "avx"}, Extra: map[string]string{"a": "b"}})
+		return &endpoint.Response{Value: value}, err
+	}
+	whoami := func(in *endpoint.Request) (*endpoint.Response, error) {
+		auth := in.Metadata[types.ContextAuthHeader.String()]
+		if auth == "" {
+			return nil, endpoint.UnauthenticatedError("authorization header is missing")
+		}
+		value, err := json.Marshal(map[string]interface{}{
+			"auth":   auth,
+			"path":   in.Metadata[types.ContextResourcePath.String()],
+			"action": in.Metadata[types.ContextResourceAction.String()],
+			"params": in.Parameters,
+		})
+		return &endpoint.Response{Value: value}, err
+	}
+	tree := func(in *endpoint.Request) (*endpoint.Response, error) {
+		value, err := json.Marshal(treeNode{Name: "root", Children: []treeNode{{Name: "leaf"}}})
+		return &endpoint.Response{Value: value}, err
+	}
+	denied := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return nil, endpoint.PermissionDeniedError("not allowed").WithDetail("resource", "test/denied")
+	}
+	login := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: in.Body}, nil
+	}
+	stream := func(in *endpoint.Request, send endpoint.StreamSender) error { return nil }
+
+	if len(eps) == 0 {
+		eps = []*endpoint.Endpoint{
+			endpoint.NewEndpoint("test/cpu", endpoint.ActionRead, "cpu", cpu, false, "", endpoint.WithOutput(cpuInfo{})),
+			endpoint.NewEndpoint("test/users/{id}", endpoint.ActionRead, "whoami", whoami, true, "", endpoint.WithParameters(userParameters{})),
+			endpoint.NewEndpoint("test/tree", endpoint.ActionRead, "tree", tree, false, "", endpoint.WithOutput(treeNode{})),
+			endpoint.NewEndpoint("test/slow", endpoint.ActionRead, "slow", adaptertest.Slow, false, ""),
+			endpoint.NewEndpoint("test/denied", endpoint.ActionRead, "denied", denied, false, ""),
+			endpoint.NewEndpoint("test/text", endpoint.ActionRead, "text", adaptertest.Text, false, ""),
+			endpoint.NewEndpoint("test/login", endpoint.ActionCreate, "login", login, false, "", endpoint.WithBody(loginBody{})),
+			endpoint.NewEndpoint("test/users/{id}", endpoint.ActionDelete, "delete", whoami, true, ""),
+			endpoint.NewStreamEndpoint("test/stream", endpoint.ActionRead, "stream", stream, false, ""),
+		}
+	}
+	apis := config.APIEntries{GraphQL: config.GraphQLAPIEntry{
+		Enabled:        true,
+		AllowedOrigins: []string{"https://console.example.com"},
+	}}
+	return adaptertest.NewAdapter(t, NewAdapter, apis, eps...).(*Adapter)
+}
+
+// post sends the request to the adapter and returns the response
+func post(t *testing.T, a *Adapter, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	a.serveHTTP(w, r)
+	return w
+}
+
+func query(t *testing.T, a *Adapter, q string, variables map[string]interface{}, header http.Header) *testResult {
+	t.Helper()
+	body, err := json.Marshal(Request{Query: q, Variables: variables})
+	require.NoError(t, err)
+	w := post(t, a, string(body), header)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result testResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return &result
+}
+
+func TestPathName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "hardware/cpu", want: "hardwareCpu"},
+		{path: "/auth/users/{id}", want: "authUsersById"},
+		{path: "plugins/iperf-client/live_stats", want: "pluginsIperfClientLiveStats"},
+		{path: "v1.2/info", want: "v12Info"},
+		{path: "2fa/setup", want: "_2faSetup"},
+		{path: "/", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, pathName(tt.path))
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	a := newTestAdapter(t)
+	queries := a.schema.QueryType().Fields()
+	mutations := a.schema.MutationType().Fields()
+
+	tests := []struct {
+		name   string
+		fields graphql.FieldDefinitionMap
+		field  string
+		args   []string
+		typ    string
+	}{
+		{name: "object output", fields: queries, field: "testCpu", typ: "CpuInfo"},
+		{name: "recursive output", fields: queries, field: "testTree", typ: "TreeNode"},
+		{name: "path and query parameters", fields: queries, field: "testUsersById", args: []string{"id", "tags", "verbose"}, typ: "JSON"},
+		{name: "create mutation", fields: mutations, field: "createTestLogin", args: []string{"body"}, typ: "JSON"},
+		{name: "delete mutation", fields: mutations, field: "deleteTestUsersById", args: []string{"id"}, typ: "JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := tt.fields[tt.field]
+			require.True(t, ok, "field %s not found", tt.field)
+			assert.Equal(t, tt.typ, field.Type.Name())
+			var args []string
+			for _, arg := range field.Args {
+				args = append(args, arg.Name())
+			}
+			assert.ElementsMatch(t, tt.args, args)
+		})
+	}
+
+	assert.NotContains(t, queries, "testStream")
+	assert.Equal(t, "LoginBodyInput", mutations["createTestLogin"].Args[0].Type.Name())
+	cpu := a.schema.Type("CpuInfo").(*graphql.Object).Fields()
+	assert.Equal(t, "Float", cpu["cores"].Type.Name())
+	assert.Equal(t, "JSON", cpu["extra"].Type.Name())
+	assert.Equal(t, "[String]", cpu["flags"].Type.String())
+}
+
+func TestNewSchemaWithoutQueries(t *testing.T) {
+	create := func(in *endpoint.Request) (*endpoint.Response, error) { return &endpoint.Response{}, nil }
+	_, err := newSchema([]*endpoint.Endpoint{endpoint.NewEndpoint("test/items", endpoint.ActionCreate, "create", create, false, "")})
+	assert.Error(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	a := newTestAdapter(t)
+	auth := http.Header{"Authorization": []string{"Bearer token"}}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		header    http.Header
+		data      string
+		code      endpoint.ErrorCode
+	}{
+		{
+			name:  "field selection",
+			query: `{ testCpu { model_name cores } }`,
+			data:  `{"testCpu":{"model_name":"test","cores":8}}`,
+		},
+		{
+			name:  "multiple endpoints",
+			query: `{ testCpu { flags extra } testTree { name children { name } } testText }`,
+			data:  `{"testCpu":{"flags":["sse","avx"],"extra":{"a":"b"}},"testTree":{"name":"root","children":[{"name":"leaf"}]},"testText":"plain text"}`,
+		},
+		{
+			name:      "arguments",
+			query:     `query($id: String!) { testUsersById(id: $id, verbose: true, tags: ["a", "b"]) }`,
+			variables: map[string]interface{}{"id": "42"},
+			header:    auth,
+			data:      `{"testUsersById":{"auth":"Bearer token","path":"test/users/{id}","action":"read","params":{"id":["42"],"verbose":["true"],"tags":["a","b"]}}}`,
+		},
+		{
+			name:  "mutation",
+			query: `mutation { createTestLogin(body: {username: "admin", password: "secret"}) }`,
+			data:  `{"createTestLogin":{"username":"admin","password":"secret"}}`,
+		},
+		{
+			name:  "unauthenticated",
+			query: `{ testUsersById(id: "1") }`,
+			data:  `{"testUsersById":null}`,
+			code:  endpoint.ErrorCodeUnauthenticated,
+		},
+		{
+			name:  "error is per field",
+			query: `{ testDenied testCpu { cores } }`,
+			data:  `{"testDenied":null,"testCpu":{"cores":8}}`,
+			code:  endpoint.ErrorCodePermissionDenied,
+		},
+		{
+			name:   "deadline",
+			query:  `{ testSlow }`,
+			header: http.Header{endpoint.HeaderRequestTimeout: []string{"10ms"}},
+			data:   `{"testSlow":null}`,
+			code:   endpoint.ErrorCodeDeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := query(t, a, tt.query, tt.variables, tt.header)
+			assert.JSONEq(t, tt.data, string(result.Data))
+			if tt.code == "" {
+				assert.Empty(t, result.Errors)
+				return
+			}
+			require.Len(t, result.Errors, 1)
+			assert.Equal(t, string(tt.code), result.Errors[0].Extensions["code"])
+		})
+	}
+
+	result := query(t, a, `{ testDenied }`, nil, nil)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"resource": "test/denied"}, result.Errors[0].Extensions["details"])
+	assert.Equal(t, []interface{}{"testDenied"}, result.Errors[0].Path)
+}
+
+func TestConcurrentQuery(t *testing.T) {
+	// Each endpoint waits for the other to be called so the query only completes if they are resolved concurrently
+	var started sync.WaitGroup
+	started.Add(2)
+	wait := func(in *endpoint.Request) (*endpoint.Response, error) {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return &endpoint.Response{Value: []byte(`true`)}, nil
+		case <-time.After(5 * time.Second):
+			return nil, endpoint.UnavailableError("timed out waiting for the other call")
+		}
+	}
+	a := newTestAdapter(t,
+		endpoint.NewEndpoint("test/first", endpoint.ActionRead, "first", wait, false, ""),
+		endpoint.NewEndpoint("test/second", endpoint.ActionRead, "second", wait, false, ""),
+	)
+
+	result := query(t, a, `{ testFirst testSecond }`, nil, nil)
+	assert.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"testFirst":true,"testSecond":true}`, string(result.Data))
+}
+
+func TestServeHTTP(t *testing.T) {
+	a := newTestAdapter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		header http.Header
+		status int
+		origin string
+	}{
+		{name: "query", method: http.MethodPost, body: `{"query":"{ testText }"}`, status: http.StatusOK},
+		{name: "invalid request", method: http.MethodPost, body: `{"query":`, status: http.StatusBadRequest},
+		{name: "invalid timeout", method: http.MethodPost, body: `{"query":"{ testText }"}`, header: http.Header{endpoint.HeaderRequestTimeout: []string{"soon"}}, status: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "preflight", method: http.MethodOptions, header: http.Header{"Origin": []string{"https://console.example.com"}}, status: http.StatusNoContent, origin: "https://console.example.com"},
+		{name: "origin not allowed", method: http.MethodPost, body: `{"query":"{ testText }"}`, header: http.Header{"Origin": []string{"https://evil.example.com"}}, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/graphql", bytes.NewBufferString(tt.body))
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			a.serveHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
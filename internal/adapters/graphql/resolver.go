@@ -0,0 +1,284 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"sort"
+	"strings"
+	"time"
+)
+
+// callKey is the context key of the call options for the request
+type callKey struct{}
+
+// call holds the options from the HTTP request that apply to every endpoint it resolves
+type call struct {
+	auth    string
+	remote  string
+	timeout time.Duration
+}
+
+func withCall(ctx context.Context, c *call) context.Context {
+	return context.WithValue(ctx, callKey{}, c)
+}
+
+func callFrom(ctx context.Context) *call {
+	if c, ok := ctx.Value(callKey{}).(*call); ok {
+		return c
+	}
+	return &call{}
+}
+
+// field is a query or mutation field for an endpoint. Arguments are mapped back to the names of the path and query
+// parameters they came from since those may not be valid GraphQL names.
+type field struct {
+	ep         *endpoint.Endpoint
+	builder    *schemaBuilder
+	parameters map[string]string
+	body       graphql.Input
+}
+
+// resolveError is an endpoint error returned to the client with its code in the extensions of the GraphQL error
+type resolveError struct {
+	err *endpoint.Error
+}
+
+func newResolveError(err error) *resolveError {
+	return &resolveError{err: endpoint.AsError(err)}
+}
+
+// Error returns the error message
+func (e *resolveError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the endpoint error
+func (e *resolveError) Unwrap() error {
+	return e.err
+}
+
+// Extensions returns the code, details and retryable flag of the error
+func (e *resolveError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.err.Code}
+	if len(e.err.Details) > 0 {
+		ext["details"] = e.err.Details
+	}
+	if e.err.Retryable {
+		ext["retryable"] = true
+	}
+	return ext
+}
+
+// errorResult returns the result for a request that failed before it could be executed
+func errorResult(err error) *graphql.Result {
+	e := newResolveError(err)
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{{
+		Message:    e.Error(),
+		Locations:  []location.SourceLocation{},
+		Extensions: e.Extensions(),
+	}}}
+}
+
+// newSchema builds the schema from the endpoints. Read endpoints are queries named after their path, for example
+// read:hardware/cpu is hardwareCpu, and the other actions are mutations prefixed with the action such as
+// createAuthLogin. Streaming endpoints aren't included.
+func newSchema(eps []*endpoint.Endpoint) (graphql.Schema, error) {
+	// Sort the endpoints so the generated names don't depend on the order the subsystems were registered in
+	sorted := make([]*endpoint.Endpoint, 0, len(eps))
+	for _, ep := range eps {
+		if !ep.Streaming {
+			sorted = append(sorted, ep)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Action < sorted[j].Action
+	})
+
+	b := newSchemaBuilder()
+	queries := graphql.Fields{}
+	mutations := graphql.Fields{}
+	for _, ep := range sorted {
+		name := pathName(ep.Path)
+		fields := queries
+		if ep.Action != endpoint.ActionRead {
+			name = ep.Action.String() + exportedName(name)
+			fields = mutations
+		}
+		if name == "" {
+			continue
+		}
+		name = uniqueName(fields, name)
+		fields[name] = b.field(ep, name, ep.Action == endpoint.ActionRead)
+	}
+	if len(queries) == 0 {
+		return graphql.Schema{}, errors.New("no queries, at least one read endpoint is required")
+	}
+
+	cfg := graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queries}),
+	}
+	if len(mutations) > 0 {
+		cfg.Mutation = graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutations})
+	}
+	return graphql.NewSchema(cfg)
+}
+
+// field creates the field for the endpoint. Path parameters are required arguments, the properties of the parameters
+// schema are optional arguments and the body, if the endpoint takes one, is passed in the body argument.
+func (b *schemaBuilder) field(ep *endpoint.Endpoint, name string, deferred bool) *graphql.Field {
+	f := &field{ep: ep, builder: b, parameters: make(map[string]string)}
+	args := graphql.FieldConfigArgument{}
+
+	for _, param := range ep.PathParameterNames() {
+		arg := uniqueName(args, fieldName(param))
+		args[arg] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+		f.parameters[arg] = param
+	}
+
+	doc, props := b.properties(ep.ExpectedParametersSchema)
+	for _, param := range sortedKeys(props) {
+		arg := fieldName(param)
+		if _, ok := args[arg]; ok || arg == "body" {
+			continue
+		}
+		description, _ := mapValue(props[param])["description"].(string)
+		args[arg] = &graphql.ArgumentConfig{Type: b.input(doc, props[param], exportedName(name)+typeName(param)), Description: description}
+		f.parameters[arg] = param
+	}
+
+	if ep.ExpectedBodySchema != "" || ep.Action == endpoint.ActionCreate || ep.Action == endpoint.ActionWrite {
+		f.body = b.inputType(ep.ExpectedBodySchema, exportedName(name)+"Input")
+		args["body"] = &graphql.ArgumentConfig{Type: f.body}
+	}
+
+	return &graphql.Field{
+		Type:        b.outputType(ep.ExpectedOutputSchema, exportedName(name)+"Result"),
+		Description: ep.Description,
+		Args:        args,
+		Resolve:     f.resolver(deferred),
+	}
+}
+
+// resolver returns the resolver that calls the endpoint. Deferred resolvers call the endpoint in the background and
+// return a thunk so the fields of a query are resolved concurrently, mutations are resolved one after another.
+func (f *field) resolver(deferred bool) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if !deferred {
+			return f.resolve(p)
+		}
+		var value interface{}
+		var err error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			value, err = f.resolve(p)
+		}()
+		return func() (interface{}, error) {
+			<-done
+			if err != nil {
+				// Errors returned by thunks lose their extensions, graphql-go formats them before adding the location,
+				// so the located error is raised the same way graphql-go raises its own errors from thunks
+				panic(graphql.NewLocatedErrorWithPath(err, graphql.FieldASTsToNodeASTs(p.Info.FieldASTs), p.Info.Path.AsArray()))
+			}
+			return value, nil
+		}, nil
+	}
+}
+
+// resolve calls the endpoint with the arguments of the field and decodes its value
+func (f *field) resolve(p graphql.ResolveParams) (interface{}, error) {
+	c := callFrom(p.Context)
+	in := &endpoint.Request{
+		Metadata:   make(map[string]string),
+		Headers:    make(map[string][]string),
+		Parameters: make(map[string][]string),
+	}
+	for arg, value := range p.Args {
+		if param, ok := f.parameters[arg]; ok {
+			in.Parameters[param] = values(value)
+		}
+	}
+	if value, ok := p.Args["body"]; ok && f.body != nil {
+		body, err := json.Marshal(f.builder.convertInput(f.body, value))
+		if err != nil {
+			return nil, newResolveError(endpoint.InvalidArgumentError("invalid body: %v", err))
+		}
+		in.Body = body
+	}
+	if c.auth != "" {
+		in.Metadata[types.ContextAuthHeader.String()] = c.auth
+	}
+	if c.remote != "" {
+		in.Metadata[types.ContextRemoteAddr.String()] = c.remote
+	}
+	in.Metadata[types.ContextResourceAction.String()] = f.ep.Action.String()
+	in.Metadata[types.ContextResourcePath.String()] = f.ep.Path
+
+	ctx, cancel := f.ep.CallContext(p.Context, c.timeout)
+	defer cancel()
+
+	out, err := f.ep.Function(in.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, newResolveError(endpoint.Errorf(endpoint.ErrorCodeDeadlineExceeded, "%s", ctxErr.Error()))
+		} else if ctxErr != nil {
+			return nil, newResolveError(endpoint.Errorf(endpoint.ErrorCodeCanceled, "%s", ctxErr.Error()))
+		}
+		return nil, newResolveError(err)
+	}
+	if out == nil || len(out.Value) == 0 {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(out.Value, &value); err != nil {
+		// Values that aren't JSON are returned as a string
+		return string(out.Value), nil
+	}
+	return value, nil
+}
+
+// values converts an argument to parameter values. Lists are passed as multiple values of the parameter.
+func values(value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	if list, ok := value.([]interface{}); ok {
+		out := make([]string, 0, len(list))
+		for _, v := range list {
+			out = append(out, format(v))
+		}
+		return out
+	}
+	return []string{format(value)}
+}
+
+// pathName returns the path as a field name, for example 'auth/users/{id}' is authUsersById
+func pathName(path string) string {
+	var sb strings.Builder
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"); name != segment {
+			segment = "by_" + name
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			if sb.Len() == 0 {
+				sb.WriteString(strings.ToLower(word[:1]) + word[1:])
+			} else {
+				sb.WriteString(exportedName(word))
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return fieldName(sb.String())
+}
@@ -0,0 +1,455 @@
+package graphql
+
+import (
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSON is the scalar used for values whose schema can't be expressed as a GraphQL type, such as maps, values of any
+// type and endpoints without a schema. Values are passed through as they are.
+var JSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value",
+	Serialize:   func(value interface{}) interface{} { return value },
+	ParseValue:  func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return literal(valueAST)
+	},
+})
+
+// schemaBuilder converts the JSON schemas of the endpoints into GraphQL types. Types are shared between endpoints
+// when their definitions are the same, definitions with the same name but different contents get a numeric suffix.
+type schemaBuilder struct {
+	defs        map[string]interface{}
+	outputs     map[string]graphql.Output
+	inputs      map[string]graphql.Input
+	inputFields map[string]map[string]string
+}
+
+// schemaDoc is a single JSON schema document along with the types created for its definitions
+type schemaDoc struct {
+	defs    map[string]interface{}
+	outputs map[string]graphql.Output
+	inputs  map[string]graphql.Input
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	b := &schemaBuilder{
+		defs:        make(map[string]interface{}),
+		outputs:     make(map[string]graphql.Output),
+		inputs:      make(map[string]graphql.Input),
+		inputFields: make(map[string]map[string]string),
+	}
+	// Reserve the names of the built in types so definitions with the same name are renamed
+	for _, name := range []string{"Query", "Mutation", "Subscription", "String", "Int", "Float", "Boolean", "ID", "JSON"} {
+		b.defs[name] = nil
+	}
+	return b
+}
+
+// parse decodes the JSON schema. An empty schema, or one that can't be decoded, returns nil which maps to JSON.
+func (b *schemaBuilder) parse(schema string) (*schemaDoc, interface{}) {
+	doc := &schemaDoc{
+		defs:    make(map[string]interface{}),
+		outputs: make(map[string]graphql.Output),
+		inputs:  make(map[string]graphql.Input),
+	}
+	if schema == "" {
+		return doc, nil
+	}
+	var root interface{}
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return doc, nil
+	}
+	if m, ok := root.(map[string]interface{}); ok {
+		if defs, ok := m["$defs"].(map[string]interface{}); ok {
+			doc.defs = defs
+		}
+	}
+	return doc, root
+}
+
+// outputType returns the GraphQL type of values matching the schema. The name is used for inline objects.
+func (b *schemaBuilder) outputType(schema string, name string) graphql.Output {
+	doc, root := b.parse(schema)
+	return b.output(doc, root, name)
+}
+
+// inputType returns the GraphQL input type of values matching the schema. The name is used for inline objects.
+func (b *schemaBuilder) inputType(schema string, name string) graphql.Input {
+	doc, root := b.parse(schema)
+	return b.input(doc, root, name)
+}
+
+// properties returns the properties of the object described by the schema, following a reference at the root
+func (b *schemaBuilder) properties(schema string) (*schemaDoc, map[string]interface{}) {
+	doc, root := b.parse(schema)
+	node := doc.resolve(root)
+	props, _ := node["properties"].(map[string]interface{})
+	return doc, props
+}
+
+func (b *schemaBuilder) output(doc *schemaDoc, node interface{}, name string) graphql.Output {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return JSON
+	}
+	if def, ok := reference(m); ok {
+		if t, ok := doc.outputs[def]; ok {
+			return t
+		}
+		defNode, ok := doc.defs[def].(map[string]interface{})
+		if !ok {
+			return JSON
+		}
+		if !isObject(defNode) {
+			t := b.output(doc, defNode, typeName(def))
+			doc.outputs[def] = t
+			return t
+		}
+		name, exists := b.define(typeName(def), defNode)
+		if !exists {
+			b.outputs[name] = b.object(doc, defNode, name)
+		}
+		doc.outputs[def] = b.outputs[name]
+		return b.outputs[name]
+	}
+
+	switch schemaType(m) {
+	case "string":
+		return graphql.String
+	case "integer", "number":
+		// GraphQL integers are 32 bit so integers are returned as floats to hold values such as byte counts
+		return graphql.Float
+	case "boolean":
+		return graphql.Boolean
+	case "array":
+		return graphql.NewList(b.output(doc, m["items"], name+"Item"))
+	case "object":
+		if !isObject(m) {
+			return JSON
+		}
+		name, _ = b.define(name, nil)
+		b.outputs[name] = b.object(doc, m, name)
+		return b.outputs[name]
+	}
+	return JSON
+}
+
+func (b *schemaBuilder) input(doc *schemaDoc, node interface{}, name string) graphql.Input {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return JSON
+	}
+	if def, ok := reference(m); ok {
+		if t, ok := doc.inputs[def]; ok {
+			return t
+		}
+		defNode, ok := doc.defs[def].(map[string]interface{})
+		if !ok {
+			return JSON
+		}
+		if !isObject(defNode) {
+			t := b.input(doc, defNode, typeName(def)+"Input")
+			doc.inputs[def] = t
+			return t
+		}
+		name, exists := b.define(typeName(def)+"Input", defNode)
+		if !exists {
+			b.inputs[name] = b.inputObject(doc, defNode, name)
+		}
+		doc.inputs[def] = b.inputs[name]
+		return b.inputs[name]
+	}
+
+	switch schemaType(m) {
+	case "string":
+		return graphql.String
+	case "integer", "number":
+		return graphql.Float
+	case "boolean":
+		return graphql.Boolean
+	case "array":
+		return graphql.NewList(b.input(doc, m["items"], name+"Item"))
+	case "object":
+		if !isObject(m) {
+			return JSON
+		}
+		name, _ = b.define(name, nil)
+		b.inputs[name] = b.inputObject(doc, m, name)
+		return b.inputs[name]
+	}
+	return JSON
+}
+
+// object creates the object type for the schema. The fields are created when the schema is built so types can refer
+// to themselves, each field resolves the original property since names are changed to be valid GraphQL names.
+func (b *schemaBuilder) object(doc *schemaDoc, m map[string]interface{}, name string) *graphql.Object {
+	description, _ := m["description"].(string)
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:        name,
+		Description: description,
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := graphql.Fields{}
+			for _, prop := range sortedKeys(m["properties"].(map[string]interface{})) {
+				node := m["properties"].(map[string]interface{})[prop]
+				field := uniqueName(fields, fieldName(prop))
+				description, _ := mapValue(node)["description"].(string)
+				fields[field] = &graphql.Field{
+					Type:        b.output(doc, node, name+typeName(prop)),
+					Description: description,
+					Resolve:     property(prop),
+				}
+			}
+			return fields
+		}),
+	})
+}
+
+// inputObject creates the input object type for the schema. Values are converted back to the original property names
+// by convertInput before they are passed to the endpoint.
+func (b *schemaBuilder) inputObject(doc *schemaDoc, m map[string]interface{}, name string) *graphql.InputObject {
+	description, _ := m["description"].(string)
+	props := make(map[string]string)
+	b.inputFields[name] = props
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        name,
+		Description: description,
+		Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap {
+			fields := graphql.InputObjectConfigFieldMap{}
+			for _, prop := range sortedKeys(m["properties"].(map[string]interface{})) {
+				node := m["properties"].(map[string]interface{})[prop]
+				field := uniqueName(fields, fieldName(prop))
+				props[field] = prop
+				description, _ := mapValue(node)["description"].(string)
+				fields[field] = &graphql.InputObjectFieldConfig{
+					Type:        b.input(doc, node, name+typeName(prop)),
+					Description: description,
+				}
+			}
+			return fields
+		}),
+	})
+}
+
+// define returns the name to use for a type with the definition. If a type with the same name and definition already
+// exists its name is returned with exists set. Inline types have no definition and always get a new name.
+func (b *schemaBuilder) define(name string, def interface{}) (string, bool) {
+	candidate := name
+	for idx := 2; ; idx++ {
+		existing, ok := b.defs[candidate]
+		if !ok {
+			b.defs[candidate] = def
+			return candidate, false
+		}
+		if def != nil && existing != nil && reflect.DeepEqual(existing, def) {
+			return candidate, true
+		}
+		candidate = name + strconv.Itoa(idx)
+	}
+}
+
+// resolve follows a reference at the root of the schema to its definition
+func (d *schemaDoc) resolve(node interface{}) map[string]interface{} {
+	m := mapValue(node)
+	if def, ok := reference(m); ok {
+		return mapValue(d.defs[def])
+	}
+	return m
+}
+
+// property returns the resolver for the property of an object
+func property(name string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if m, ok := p.Source.(map[string]interface{}); ok {
+			return m[name], nil
+		}
+		return nil, nil
+	}
+}
+
+// convertInput converts the value of an input type back to the property names of its schema. Input objects are
+// passed to resolvers keyed by their GraphQL field names.
+func (b *schemaBuilder) convertInput(t graphql.Input, value interface{}) interface{} {
+	switch t := t.(type) {
+	case *graphql.NonNull:
+		return b.convertInput(t.OfType, value)
+	case *graphql.List:
+		values, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		out := make([]interface{}, len(values))
+		for idx, v := range values {
+			out[idx] = b.convertInput(t.OfType, v)
+		}
+		return out
+	case *graphql.InputObject:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		fields := t.Fields()
+		props := b.inputFields[t.Name()]
+		out := make(map[string]interface{}, len(m))
+		for name, v := range m {
+			field, ok := fields[name]
+			if !ok {
+				continue
+			}
+			out[props[name]] = b.convertInput(field.Type, v)
+		}
+		return out
+	}
+	return value
+}
+
+// literal converts a value in a query to its Go value
+func literal(valueAST ast.Value) interface{} {
+	switch v := valueAST.(type) {
+	case *ast.StringValue:
+		return v.Value
+	case *ast.EnumValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.IntValue:
+		n, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	case *ast.FloatValue:
+		n, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	case *ast.ListValue:
+		values := make([]interface{}, len(v.Values))
+		for idx, value := range v.Values {
+			values[idx] = literal(value)
+		}
+		return values
+	case *ast.ObjectValue:
+		values := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			values[field.Name.Value] = literal(field.Value)
+		}
+		return values
+	}
+	return nil
+}
+
+// reference returns the name of the definition the node refers to
+func reference(m map[string]interface{}) (string, bool) {
+	ref, ok := m["$ref"].(string)
+	if !ok || !strings.HasPrefix(ref, "#/$defs/") {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, "#/$defs/"), true
+}
+
+// schemaType returns the type of the node. Nullable types such as ["string", "null"] return the non null type.
+func schemaType(m map[string]interface{}) string {
+	switch t := m["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// isObject returns true if the node is an object with known properties. Objects without properties, such as maps,
+// are returned as JSON.
+func isObject(m map[string]interface{}) bool {
+	props, ok := m["properties"].(map[string]interface{})
+	return schemaType(m) == "object" && ok && len(props) > 0
+}
+
+func mapValue(node interface{}) map[string]interface{} {
+	m, _ := node.(map[string]interface{})
+	return m
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldName returns the name as a valid GraphQL name by replacing any characters that aren't allowed
+func fieldName(name string) string {
+	var sb strings.Builder
+	for idx, r := range name {
+		switch {
+		case r == '_' || (r < unicode.MaxASCII && (unicode.IsLetter(r) || (unicode.IsDigit(r) && idx > 0))):
+			sb.WriteRune(r)
+		case unicode.IsDigit(r) && r < unicode.MaxASCII:
+			sb.WriteRune('_')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+// typeName returns the definition name as a GraphQL type name
+func typeName(name string) string {
+	return exportedName(fieldName(name))
+}
+
+// exportedName returns the name with its first letter in upper case
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// uniqueName returns the name, with a numeric suffix if it is already used in the map
+func uniqueName[T any](m map[string]T, name string) string {
+	candidate := name
+	for idx := 2; ; idx++ {
+		if _, ok := m[candidate]; !ok {
+			return candidate
+		}
+		candidate = name + strconv.Itoa(idx)
+	}
+}
+
+// format converts a value to the string form used for parameters
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
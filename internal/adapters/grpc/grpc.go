@@ -6,8 +6,12 @@ import (
 	"fmt"
 	api "github.com/bgrewell/dtac-agent/api/grpc/go"
 	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/batch"
 	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/idempotency"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
 	"github.com/bgrewell/dtac-agent/internal/types"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"github.com/bgrewell/dtac-agent/pkg/plugins/utility"
@@ -15,12 +19,20 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"net"
+	"strings"
+	"time"
 )
 
+// DefaultHealthInterval is used when the configured health interval can't be parsed
+const DefaultHealthInterval = 10 * time.Second
+
 // NewAdapter creates a new gRPC adapter
 func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
 	// Check to see if the JSON-RPC API is enabled. If not return an error that it is disabled
@@ -51,6 +63,11 @@ type Adapter struct {
 	controller *controller.Controller
 	logger     *zap.Logger
 	endpoints  map[string]*endpoint.Endpoint
+	executor   *batch.Executor
+	health     *health.Server
+	reporter   interfaces.HealthReporter
+	certs      *mtls.Mapper
+	cancel     context.CancelFunc
 	name       string
 }
 
@@ -64,6 +81,9 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 	// Iterate over the subsystems and register each of the endpoints
 	for _, subsystem := range subsystems {
 		a.logger.Debug("registering subsystem", zap.String("subsystem", subsystem.Name()))
+		if reporter, ok := subsystem.(interfaces.HealthReporter); ok {
+			a.reporter = reporter
+		}
 		if subsystem.Enabled() {
 			for _, ep := range subsystem.Endpoints() {
 				a.logger.Debug("registering endpoint", zap.String("path", ep.Path), zap.Any("action", ep.Action))
@@ -72,6 +92,7 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 			}
 		}
 	}
+	a.executor = batch.NewExecutor(a.endpoints)
 
 	return nil
 }
@@ -79,6 +100,9 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 // Start starts the gRPC API adapter
 func (a *Adapter) Start(ctx context.Context) (err error) {
 	a.logger.Info("starting gRPC API server", zap.String("addr", a.listener.Addr().String()))
+	var healthCtx context.Context
+	healthCtx, a.cancel = context.WithCancel(context.Background())
+	go a.watchHealth(healthCtx)
 	go func() {
 		err := a.server.Serve(a.listener)
 		if err != nil {
@@ -91,10 +115,63 @@ func (a *Adapter) Start(ctx context.Context) (err error) {
 
 // Stop stops the gRPC API adapter
 func (a *Adapter) Stop(ctx context.Context) (err error) {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.health.Shutdown()
 	a.server.GracefulStop()
 	return nil
 }
 
+// watchHealth keeps the status of the gRPC health service up to date until the context is canceled. The overall
+// service, named "", is serving while the agent is ready and each health check is reported as a service of its own so
+// clients can watch a single component, for example 'plugin/iperf'.
+func (a *Adapter) watchHealth(ctx context.Context) {
+	if a.reporter == nil {
+		a.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		return
+	}
+
+	interval := DefaultHealthInterval
+	if cfg := a.controller.Config.Health.Interval; cfg != "" {
+		if parsed, err := time.ParseDuration(cfg); err != nil || parsed <= 0 {
+			a.logger.Error("invalid health interval, using default", zap.String("interval", cfg), zap.Error(err))
+		} else {
+			interval = parsed
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		a.updateHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateHealth sets the status of the health service from the health checks
+func (a *Adapter) updateHealth(ctx context.Context) {
+	ready, checks := a.reporter.Ready(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	a.health.SetServingStatus("", servingStatus(ready))
+	for _, check := range checks {
+		a.health.SetServingStatus(check.Name, servingStatus(check.Status == interfaces.HealthStatusUp))
+	}
+}
+
+func servingStatus(up bool) healthpb.HealthCheckResponse_ServingStatus {
+	if up {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
 // List implements the List RPC
 func (a *Adapter) List(ctx context.Context, in *api.ListRequest) (*api.ListResponse, error) {
 	// Implement your logic here
@@ -111,12 +188,120 @@ func (a *Adapter) List(ctx context.Context, in *api.ListRequest) (*api.ListRespo
 
 // Call implements the Call RPC
 func (a *Adapter) Call(ctx context.Context, in *api.EndpointRequestMessage) (*api.EndpointResponseMessage, error) {
-	// Implement your logic for the Call RPC
 	a.logger.Info("call request received", zap.Any("request", in))
 
+	ep, request, err := a.prepareCall(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := ep.CallContext(ctx, 0)
+	defer cancel()
+	request = request.WithContext(ctx)
+
+	// Streaming endpoints can only be served by CallStream
+	if ep.Streaming {
+		return nil, status.Error(codes.FailedPrecondition, endpoint.ErrStreamingEndpoint.Error())
+	}
+
+	response, err := ep.Function(request)
+	if err != nil {
+		return nil, callError(ctx, err)
+	}
+	message := api.EndpointResponseMessage{Response: utility.EndpointResponseToAPIEndpointResponse(response)}
+	return &message, nil
+}
+
+// CallStream implements the CallStream RPC. Streaming endpoints send each message as it is produced, unary endpoints
+// send their single response before the stream is closed.
+func (a *Adapter) CallStream(in *api.EndpointRequestMessage, stream api.AdapterService_CallStreamServer) error {
+	a.logger.Info("call stream request received", zap.Any("request", in))
+
+	ep, request, err := a.prepareCall(stream.Context(), in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ep.CallContext(stream.Context(), 0)
+	defer cancel()
+	request = request.WithContext(ctx)
+
+	if !ep.Streaming {
+		response, err := ep.Function(request)
+		if err != nil {
+			return callError(ctx, err)
+		}
+		return stream.Send(&api.EndpointResponseMessage{Id: 1, Response: utility.EndpointResponseToAPIEndpointResponse(response)})
+	}
+
+	var id int32
+	err = ep.Stream(request, func(out *endpoint.Response) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id++
+		return stream.Send(&api.EndpointResponseMessage{Id: id, Response: utility.EndpointResponseToAPIEndpointResponse(out)})
+	})
+	if err != nil {
+		return callError(ctx, err)
+	}
+
+	return nil
+}
+
+// BatchCall implements the BatchCall RPC. Each call goes through the endpoint's middleware so it is authenticated and
+// authorized individually. A failed call doesn't fail the RPC, its error is returned in its result instead.
+func (a *Adapter) BatchCall(ctx context.Context, in *api.BatchRequest) (*api.BatchResponse, error) {
+	a.logger.Info("batch call request received", zap.Int("calls", len(in.GetCalls())))
+
+	calls := make([]batch.Call, len(in.GetCalls()))
+	for idx, call := range in.GetCalls() {
+		action, path, _ := strings.Cut(call.GetMethod(), ":")
+		calls[idx] = batch.Call{Action: action, Path: path}
+		if call.GetRequest() != nil {
+			calls[idx].Request = utility.APIEndpointRequestToEndpointRequest(call.GetRequest())
+		}
+	}
+
+	results, err := a.executor.Run(ctx, calls, a.incomingMetadata(ctx), batch.Options{Parallel: in.GetParallel(), StopOnError: in.GetStopOnError()})
+	if err != nil {
+		return nil, callError(ctx, err)
+	}
+
+	response := &api.BatchResponse{Results: make([]*api.BatchResult, len(results))}
+	for idx, result := range results {
+		r := &api.BatchResult{
+			Index:      int32(result.Index),
+			Method:     result.Method,
+			Skipped:    result.Skipped,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+		if result.Response != nil {
+			r.Response = utility.EndpointResponseToAPIEndpointResponse(result.Response)
+		}
+		if result.Error != nil {
+			r.Error = result.Error.Message
+			r.Code = result.Error.Code.String()
+			r.Details = result.Error.Details
+			r.Retryable = result.Error.Retryable
+		}
+		response.Results[idx] = r
+	}
+	return response, nil
+}
+
+// callError converts an error returned by an endpoint into a gRPC status error using the error's code. If the call's
+// context has been canceled or its deadline exceeded the matching status code is returned instead.
+func callError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return endpoint.AsError(err).GRPCStatus().Err()
+}
+
+// prepareCall looks up the requested endpoint and builds the endpoint request for it
+func (a *Adapter) prepareCall(ctx context.Context, in *api.EndpointRequestMessage) (*endpoint.Endpoint, *endpoint.Request, error) {
 	// Ensure request and method have been passed
 	if in == nil || in.GetMethod() == "" || in.GetRequest() == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid request")
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid request")
 	}
 
 	// Get the input
@@ -126,44 +311,82 @@ func (a *Adapter) Call(ctx context.Context, in *api.EndpointRequestMessage) (*ap
 	// Ensure that metadata wasn't passed in since it's only to be used internally. Due to a desire to keep things simple
 	// the plugin types were used here instead of creating new types for the API. Because of that metadata could be
 	// populated even though it's not documented. This is a temporary solution until the API is refactored.
-	request.Metadata = make(map[string]string)
+	request.Metadata = a.incomingMetadata(ctx)
 
-	// Pull authentication metadata from the request (gRPC metadata not EndpointRequest metadata)
+	// An idempotency key may also be passed as gRPC metadata instead of a request header
 	if meta, ok := metadata.FromIncomingContext(ctx); ok {
-		if token := meta.Get("authorization"); len(token) > 0 {
-			request.Metadata[types.ContextAuthHeader.String()] = token[0]
+		if key := meta.Get(strings.ToLower(idempotency.HeaderIdempotencyKey)); len(key) > 0 {
+			if request.Headers == nil {
+				request.Headers = make(map[string][]string)
+			}
+			request.Headers[idempotency.HeaderIdempotencyKey] = key[:1]
 		}
 	}
 
-	if ep, ok := a.endpoints[method]; ok {
-		request.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
-		request.Metadata[types.ContextResourcePath.String()] = ep.Path
+	// Find the endpoint, matching templated paths such as 'read:auth/users/1' to 'read:auth/users/{id}'
+	key, params, ok := endpoint.MatchMethod(a.endpoints, method)
+	if !ok {
+		return nil, nil, status.Error(codes.NotFound, "method not found")
+	}
+	ep := a.endpoints[key]
+	request.SetPathParameters(params)
 
-		err := ep.ValidateRequest(request)
-		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, err.Error())
-		}
+	request.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+	request.Metadata[types.ContextResourcePath.String()] = ep.Path
 
-		response, err := ep.Function(request)
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
-		}
-		message := api.EndpointResponseMessage{Response: utility.EndpointResponseToAPIEndpointResponse(response)}
-		return &message, nil
+	err := ep.ValidateRequest(request)
+	if err != nil {
+		return nil, nil, endpoint.AsError(err).GRPCStatus().Err()
 	}
 
-	return nil, status.Error(codes.NotFound, "method not found")
+	return ep, request, nil
+}
+
+// incomingMetadata returns the endpoint metadata for the authentication metadata in the request (gRPC metadata not
+// EndpointRequest metadata), the address and the client certificate of the connection
+func (a *Adapter) incomingMetadata(ctx context.Context) map[string]string {
+	md := make(map[string]string)
+	if meta, ok := metadata.FromIncomingContext(ctx); ok {
+		if token := meta.Get("authorization"); len(token) > 0 {
+			md[types.ContextAuthHeader.String()] = token[0]
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if ok && p.Addr != nil {
+		if remote := helpers.RemoteHost(p.Addr.String()); remote != "" {
+			md[types.ContextRemoteAddr.String()] = remote
+		}
+	}
+	if ok && a.certs != nil {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			identity, err := a.certs.Peer(&info.State)
+			if err != nil {
+				a.logger.Warn("failed to identify client certificate", zap.Error(err))
+			} else if identity != "" {
+				md[types.ContextAuthPeer.String()] = identity
+			}
+		}
+	}
+	return md
 }
 
 func (a *Adapter) setup() (err error) {
 	var opts []grpc.ServerOption
 
 	// Check if TLS is enabled in the configuration
-	if a.controller.Config.APIs.GRPC.TLS.Enabled {
+	if selection := a.controller.Config.APIs.GRPC.TLS; selection.Enabled {
 		// Load server's certificate and private key
-		if cfg, ok := (*a.tls)[a.controller.Config.APIs.GRPC.TLS.Profile]; ok {
-			creds, err := credentials.NewServerTLSFromFile(cfg.CertFilename, cfg.KeyFilename)
-			if err != nil {
+		if cfg, ok := (*a.tls)[selection.Profile]; ok {
+			var creds credentials.TransportCredentials
+			if selection.ClientAuth.Enabled {
+				// Clients presenting a verified certificate are identified by it
+				tlsConfig, err := mtls.ServerConfig(selection, cfg)
+				if err != nil {
+					return err
+				}
+				creds = credentials.NewTLS(tlsConfig)
+				a.certs = mtls.NewMapper(selection.ClientAuth.Mappings, a.controller.AuthDB.ViewUserByUsername)
+			} else if creds, err = credentials.NewServerTLSFromFile(cfg.CertFilename, cfg.KeyFilename); err != nil {
 				return fmt.Errorf("failed to load TLS keys: %v", err)
 			}
 			opts = append(opts, grpc.Creds(creds))
@@ -181,6 +404,11 @@ func (a *Adapter) setup() (err error) {
 	// Register server
 	api.RegisterAdapterServiceServer(a.server, a)
 
+	// Register the standard health service, the agent isn't serving until the health checks have run
+	a.health = health.NewServer()
+	a.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(a.server, a.health)
+
 	// If reflection is enabled, register the reflection service
 	if a.controller.Config.APIs.GRPC.Reflection {
 		a.logger.Debug("registering gRPC reflection service")
@@ -205,3 +433,19 @@ func (a *Adapter) setup() (err error) {
 //
 // Call to secured diag/
 // grpcurl -insecure -H 'Authorization: <access_token_from_above_request>' -d '{"method": "read:diag/", "request": {"headers": {}, "parameters": {}, "body": [] }}' 127.0.0.1:8181 frontend.AdapterService.Call | jq -r .response.value | base64 -d | jq
+//
+// Call to a streaming endpoint
+// grpcurl -insecure -H 'Authorization: <access_token_from_above_request>' -d '{"method": "read:plugins/iperf/client/live", "request": {"parameters": {"id": {"values": ["<client_id>"]}}}}' 127.0.0.1:8181 frontend.AdapterService.CallStream
+//
+// Create call that is safe to retry
+// grpcurl -insecure -H 'Authorization: <access_token_from_above_request>' -H 'Idempotency-Key: <unique_key>' -d '{"method": "create:network/route", "request": {"body": "<base64 encoded route json blob>"}}' 127.0.0.1:8181 frontend.AdapterService.Call
+//
+// Call with a client deadline (sent as grpc-timeout and applied to the endpoint and any plugin it calls)
+// grpcurl -insecure -max-time 5 -H 'Authorization: <access_token_from_above_request>' -d '{"method": "read:diag/", "request": {}}' 127.0.0.1:8181 frontend.AdapterService.Call
+//
+// Check the readiness of the agent, or the health of a single component
+// grpcurl -insecure 127.0.0.1:8181 grpc.health.v1.Health/Check
+// grpcurl -insecure -d '{"service": "plugin/iperf"}' 127.0.0.1:8181 grpc.health.v1.Health/Check
+//
+// Batch of calls made in parallel
+// grpcurl -insecure -H 'Authorization: <access_token_from_above_request>' -d '{"parallel": true, "calls": [{"method": "read:hardware/cpu", "request": {}}, {"method": "read:network/routes", "request": {}}]}' 127.0.0.1:8181 frontend.AdapterService.BatchCall
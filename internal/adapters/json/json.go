@@ -1,56 +1,75 @@
 package json
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/bgrewell/dtac-agent/internal/basic"
 	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
+	"io"
 	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// NewAdapter creates a new JSON-RPC adapter
+const (
+	// sniffTimeout is how long a new connection has to send its first bytes before it is closed
+	sniffTimeout = 10 * time.Second
+	// maxMessageSize is the maximum size of a JSON-RPC message sent over HTTP
+	maxMessageSize = 16 << 20
+)
+
+// NewAdapter creates a new JSON-RPC adapter. The adapter is nil when the JSON-RPC API is not enabled.
 func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
-	// Check to see if the JSON-RPC API is enabled. If not return an error that it is disabled
+	// Check to see if the JSON-RPC API is enabled. If not there is no adapter to create
 	if !c.Config.APIs.JSON.Enabled {
-		return nil, errors.New("json-rpc api is not enabled")
+		return nil, nil
 	}
 
 	// Setup logger
 	name := "api/json"
 	logger := c.Logger.With(zap.String("module", name))
 
-	// Setup gin logging
-	//gin.SetMode(gin.ReleaseMode)
-	//router := gin.New()
-	//router.Use(ginZapLoggerMiddleware(logger))
-
 	r := &Adapter{
 		controller: c,
-		// router:     router,
-		logger: logger,
-		tls:    tls,
-		name:   name,
-		//formatter:  NewJSONResponseFormatter(c.Config, logger),
+		logger:     logger,
+		tls:        tls,
+		name:       name,
+		endpoints:  make(map[string]*endpoint.Endpoint),
+		conns:      make(map[net.Conn]struct{}),
 	}
 	return r, r.setup()
 }
 
-// Adapter is the JSON-RPC API adapter
+// Adapter is the JSON-RPC API adapter. Requests are accepted over HTTP(S) POST requests and over raw TCP (or TLS)
+// connections carrying a stream of JSON-RPC messages, both on the same port.
 type Adapter struct {
 	server     *http.Server
+	listener   net.Listener
+	http       *connListener
+	tlsConfig  *tls.Config
 	tls        *map[string]basic.TLSInfo
 	controller *controller.Controller
 	logger     *zap.Logger
+	endpoints  map[string]*endpoint.Endpoint
 	name       string
-	srvMsg     string
-	srvFunc    func(net.Listener) error
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mu         sync.Mutex
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup
 }
 
-// Name returns the name of the REST API adapter
+// Name returns the name of the JSON-RPC API adapter
 func (a *Adapter) Name() string {
 	return a.name
 }
@@ -63,23 +82,8 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 		if subsystem.Enabled() {
 			for _, ep := range subsystem.Endpoints() {
 				a.logger.Debug("registering endpoint", zap.String("path", ep.Path), zap.Any("action", ep.Action))
-				var method string
-				switch ep.Action {
-				case endpoint.ActionRead:
-					method = http.MethodGet
-				case endpoint.ActionWrite:
-					method = http.MethodPut
-				case endpoint.ActionCreate:
-					method = http.MethodPost
-				case endpoint.ActionDelete:
-					method = http.MethodDelete
-				default:
-					return errors.New("invalid action")
-				}
-
-				_ = method
-
-				//a.shim(method, ep)
+				method := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+				a.endpoints[method] = ep
 			}
 		}
 	}
@@ -87,169 +91,281 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 	return nil
 }
 
-// Start starts the REST API adapter
+// Start starts the JSON-RPC API adapter
 func (a *Adapter) Start(ctx context.Context) (err error) {
 	ln, err := net.Listen("tcp", a.server.Addr)
 	if err != nil {
 		return err
 	}
 
-	a.logger.Info(a.srvMsg, zap.String("addr", a.server.Addr))
+	srvMsg := "starting JSON-RPC server"
+	if a.tlsConfig != nil {
+		ln = tls.NewListener(ln, a.tlsConfig)
+		srvMsg = "starting JSON-RPC server with TLS"
+	}
+	a.listener = ln
+	a.http = newConnListener(ln.Addr())
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+
+	a.logger.Info(srvMsg, zap.String("addr", ln.Addr().String()))
 	go func() {
-		err := a.srvFunc(ln)
-		if err != nil {
+		err := a.server.Serve(a.http)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 			a.logger.Fatal("failed to start server", zap.Error(err))
 		}
 	}()
+	go a.accept()
 
 	return nil
 }
 
-// Stop stops the REST API adapter
+// Stop stops the JSON-RPC API adapter
 func (a *Adapter) Stop(ctx context.Context) (err error) {
-	return a.server.Shutdown(ctx)
+	if a.listener == nil {
+		return nil
+	}
+	a.cancel()
+	err = a.listener.Close()
+	if shutdownErr := a.server.Shutdown(ctx); shutdownErr != nil {
+		err = shutdownErr
+	}
+
+	// Close the raw connections, any calls in progress have already been canceled
+	a.mu.Lock()
+	for conn := range a.conns {
+		conn.Close()
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
 }
 
 func (a *Adapter) setup() (err error) {
-	return errors.New("this adapter has not been implemented yet")
+	if err := mtls.Unsupported(a.controller.Config.APIs.JSON.TLS, "JSON-RPC"); err != nil {
+		return err
+	}
+
+	a.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", a.controller.Config.APIs.JSON.Port),
+		Handler:           http.HandlerFunc(a.serveHTTP),
+		ReadHeaderTimeout: sniffTimeout,
+	}
+
+	if a.controller.Config.APIs.JSON.TLS.Enabled {
+		cfg, ok := (*a.tls)[a.controller.Config.APIs.JSON.TLS.Profile]
+		if !ok {
+			return errors.New("tls profile not found")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFilename, cfg.KeyFilename)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS keys: %v", err)
+		}
+		a.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"http/1.1"}}
+	}
+
+	return nil
 }
 
+// accept accepts new connections and hands them off to the raw or HTTP handler
+func (a *Adapter) accept() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				a.logger.Error("failed to accept connection", zap.Error(err))
+			}
+			a.http.Close()
+			return
+		}
+		go a.sniff(conn)
+	}
+}
+
+// sniff looks at the first bytes sent on the connection. Connections starting with a JSON object or array carry raw
+// JSON-RPC messages, everything else is passed on to the HTTP server.
+func (a *Adapter) sniff(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	raw := false
+sniffing:
+	for n := 1; n <= reader.Size(); n++ {
+		peeked, err := reader.Peek(n)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		switch peeked[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{', '[':
+			raw = true
+		}
+		break sniffing
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	buffered := &bufferedConn{Conn: conn, reader: reader}
+	if raw {
+		a.serveConn(buffered)
+		return
+	}
+	if !a.http.push(buffered) {
+		conn.Close()
+	}
+}
+
+// serveConn reads JSON-RPC messages from a raw connection and writes each response on its own line. The connection
+// is closed when a message can't be parsed since the rest of the stream can't be trusted.
+func (a *Adapter) serveConn(conn net.Conn) {
+	a.mu.Lock()
+	if a.ctx.Err() != nil {
+		a.mu.Unlock()
+		conn.Close()
+		return
+	}
+	a.conns[conn] = struct{}{}
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.conns, conn)
+		a.mu.Unlock()
+		conn.Close()
+		a.wg.Done()
+	}()
+
+	opts := callOptions{remote: helpers.RemoteHost(conn.RemoteAddr().String())}
+	decoder := json.NewDecoder(conn)
+	for {
+		var message json.RawMessage
+		if err := decoder.Decode(&message); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				_, _ = conn.Write(append(encode(errorResponse(nil, endpoint.JSONRPCParseError, "parse error")), '\n'))
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				a.logger.Debug("failed to read message", zap.Error(err))
+			}
+			return
+		}
+
+		if response := a.handle(a.ctx, message, opts); response != nil {
+			if _, err := conn.Write(append(response, '\n')); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveHTTP handles JSON-RPC messages sent as the body of a POST request
+func (a *Adapter) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts := callOptions{auth: r.Header.Get("Authorization"), remote: helpers.RemoteHost(r.RemoteAddr)}
+	timeout, err := endpoint.ParseTimeout(r.Header.Get(endpoint.HeaderRequestTimeout))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.timeout = timeout
+
+	message, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	response := a.handle(r.Context(), message, opts)
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(response)
+}
+
+// bufferedConn is a connection whose first bytes have already been read into the reader
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffered bytes before reading from the connection
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// connListener is a listener that returns connections pushed to it by the adapter which allows the HTTP server to
+// share the port with the raw connections
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// newConnListener creates a new listener with the address of the underlying listener
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// push hands the connection to the listener, false is returned if the listener is closed
+func (l *connListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// Accept waits for the next connection to be pushed to the listener
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the address of the underlying listener
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// NOTE:
+// Example testing from command line
 //
-//func (a *Adapter) setup() (err error) {
-//	// Create a new http server
-//	a.server = &http.Server{Addr: fmt.Sprintf(":%d", a.controller.Config.APIs.REST.Port), Handler: a.router}
-//
-//	// Set up the serve function
-//	a.srvFunc = a.server.Serve
-//	a.srvMsg = "starting HTTP server"
-//	if a.controller.Config.APIs.REST.TLS.Enabled {
-//		if cfg, ok := (*a.tls)[a.controller.Config.APIs.REST.TLS.Profile]; ok {
-//			wrapper := func(l net.Listener) error {
-//				return a.server.ServeTLS(l, cfg.CertFilename, cfg.KeyFilename)
-//			}
-//			a.srvFunc = wrapper
-//			a.srvMsg = "starting HTTPS server"
-//			return nil
-//		}
-//
-//		return errors.New("tls profile not found")
-//
-//	}
-//
-//	return nil
-//}
-//
-//func (a *Adapter) shim(method string, ep *endpoint.Endpoint) {
-//	a.router.Handle(method, ep.Path, func(c *gin.Context) {
-//		in, err := a.createInputArgs(c)
-//		if err != nil {
-//			a.logger.Error("failed to create input args", zap.Error(err))
-//			a.formatter.WriteError(c, err)
-//			return
-//		}
-//
-//		// TODO: Look at moving validation somewhere central so API's don't have to do it
-//		//err = ep.ValidateArgs(in)
-//		//if err != nil {
-//		//	a.logger.Error("failed to validate input args", zap.Error(err))
-//		//	a.formatter.WriteError(c, err)
-//		//	return
-//		//}
-//		//
-//		//// TODO: Look at moving validation somewhere central so API's don't have to do it
-//		//// TODO: Look at deserialization of body and storage in a central manner to ease endpoint dup code
-//		//err = ep.ValidateBody(in)
-//		//if err != nil {
-//		//	a.logger.Error("failed to validate input body", zap.Error(err))
-//		//	a.formatter.WriteError(c, err)
-//		//	return
-//		//}
-//
-//		// If this is a secured endpoint check for the authorization header
-//		if ep.Secure {
-//			auth := c.GetHeader("Authorization")
-//			if auth == "" {
-//				a.formatter.WriteUnauthorizedError(c, errors.New("authorization header is missing"))
-//				return
-//			}
-//			in.Metadata[types.ContextAuthHeader.String()] = auth
-//		}
-//
-//		// Add additional context
-//		in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
-//		in.Metadata[types.ContextResourcePath.String()] = ep.Path
-//
-//		out, err := ep.Function(in)
-//		if err != nil {
-//			a.logger.Error("failed to execute endpoint", zap.Error(err))
-//			a.formatter.WriteError(c, err)
-//			return
-//		}
-//
-//		// Set headers from out.Headers into gin.Context
-//		for headerKey, headerValues := range out.Headers {
-//			for _, headerValue := range headerValues {
-//				c.Header(headerKey, headerValue)
-//			}
-//		}
-//
-//		// If timing information is present then write it out
-//		if et, ok := out.Metadata[types.ContextExecDuration.String()]; ok {
-//			duration, err := time.ParseDuration(et)
-//			if err != nil {
-//				duration = -1
-//			}
-//			a.formatter.WriteResponse(c, duration, out.Value)
-//		} else {
-//			a.formatter.WriteResponse(c, -1, out.Value)
-//		}
-//
-//	})
-//}
-//
-//func (a *Adapter) createInputArgs(ctx *gin.Context) (*endpoint.Request, error) {
-//	input := &endpoint.Request{
-//		Metadata:   make(map[string]string),
-//		Headers:    make(map[string][]string),
-//		Parameters: make(map[string][]string),
-//		Body:       nil,
-//	}
-//
-//	// Populate headers
-//	for k, v := range ctx.Request.Header {
-//		input.Headers[k] = v
-//	}
-//
-//	// Populate query parameters
-//	for k, v := range ctx.Request.URL.Query() {
-//		input.Parameters[k] = v
-//	}
-//
-//	// Read request body
-//	body, err := io.ReadAll(ctx.Request.Body)
-//	if err != nil {
-//		return nil, err
-//	}
-//	input.Body = body
+// Login over HTTPS
+// curl -k -d '{"jsonrpc": "2.0", "id": 1, "method": "create:auth/login", "params": {"body": {"username": "<username>", "password": "<password>"}}}' https://127.0.0.1:8182/
 //
-//	return input, nil
-//}
+// Call to secured diag/ with the token in the Authorization header
+// curl -k -H 'Authorization: <access_token_from_above_request>' -d '{"jsonrpc": "2.0", "id": 2, "method": "read:diag/"}' https://127.0.0.1:8182/
 //
-//// Custom middleware for Gin that uses Zap logger
-//func ginZapLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
-//	return func(c *gin.Context) {
-//		// Start timer
-//		start := time.Now()
+// Call with path and query parameters
+// curl -k -H 'Authorization: <access_token_from_above_request>' -d '{"jsonrpc": "2.0", "id": 3, "method": "read:auth/users/1", "params": {"parameters": {"verbose": true}}}' https://127.0.0.1:8182/
 //
-//		// Process request
-//		c.Next()
+// Batch of calls, the notification (no id) is executed without a response
+// curl -k -H 'Authorization: <access_token_from_above_request>' -d '[{"jsonrpc": "2.0", "id": 4, "method": "read:hardware/cpu"}, {"jsonrpc": "2.0", "method": "create:network/route", "params": {"body": {}}}]' https://127.0.0.1:8182/
 //
-//		// Log request details
-//		logger.Info("Request",
-//			zap.String("method", c.Request.Method),
-//			zap.String("path", c.Request.URL.Path),
-//			zap.Int("status", c.Writer.Status()),
-//			zap.Duration("duration", time.Since(start)),
-//		)
-//	}
-//}
+// Call over a raw TLS connection with the token in the auth member
+// echo '{"jsonrpc": "2.0", "id": 5, "method": "read:diag/", "auth": "<access_token>"}' | openssl s_client -quiet -connect 127.0.0.1:8182
@@ -0,0 +1,232 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/adapters/adaptertest"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoResult is the value returned by the echo endpoint used in the tests
+type echoResult struct {
+	Auth       string              `json:"auth"`
+	Parameters map[string][]string `json:"parameters"`
+	Body       json.RawMessage     `json:"body"`
+}
+
+func newTestAdapter(t *testing.T) *Adapter {
+	t.Helper()
+	echo := func(in *endpoint.Request) (*endpoint.Response, error) {
+		value, err := json.Marshal(echoResult{
+			Auth:       in.Metadata[types.ContextAuthHeader.String()],
+			Parameters: in.Parameters,
+			Body:       in.Body,
+		})
+		return &endpoint.Response{Value: value}, err
+	}
+	fail := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return nil, endpoint.Errorf(endpoint.ErrorCodeNotFound, "route not found").WithDetail("id", "7")
+	}
+	stream := func(in *endpoint.Request, send endpoint.StreamSender) error { return nil }
+
+	return adaptertest.NewAdapter(t, NewAdapter, config.APIEntries{JSON: config.JSONAPIEntry{Enabled: true}},
+		endpoint.NewEndpoint("test/echo", endpoint.ActionRead, "echo", echo, false, ""),
+		endpoint.NewEndpoint("test/echo/{id}", endpoint.ActionCreate, "echo", echo, false, ""),
+		endpoint.NewEndpoint("test/fail", endpoint.ActionRead, "fail", fail, false, ""),
+		endpoint.NewEndpoint("test/text", endpoint.ActionRead, "text", adaptertest.Text, false, ""),
+		endpoint.NewStreamEndpoint("test/stream", endpoint.ActionRead, "stream", stream, false, ""),
+	).(*Adapter)
+}
+
+func decodeResponse(t *testing.T, data []byte) *Response {
+	t.Helper()
+	var response Response
+	require.NoError(t, json.Unmarshal(data, &response))
+	return &response
+}
+
+func TestHandle(t *testing.T) {
+	a := newTestAdapter(t)
+
+	tests := []struct {
+		name    string
+		message string
+		code    int
+		result  string
+	}{
+		{name: "call", message: `{"jsonrpc":"2.0","id":1,"method":"read:test/text"}`, result: `"plain text"`},
+		{name: "string id", message: `{"jsonrpc":"2.0","id":"abc","method":"read:test/text"}`, result: `"plain text"`},
+		{name: "parse error", message: `{"jsonrpc":"2.0",`, code: endpoint.JSONRPCParseError},
+		{name: "wrong version", message: `{"jsonrpc":"1.0","id":1,"method":"read:test/text"}`, code: endpoint.JSONRPCInvalidRequest},
+		{name: "not an object", message: `42`, code: endpoint.JSONRPCInvalidRequest},
+		{name: "empty batch", message: `[]`, code: endpoint.JSONRPCInvalidRequest},
+		{name: "unknown method", message: `{"jsonrpc":"2.0","id":1,"method":"read:test/missing"}`, code: endpoint.JSONRPCMethodNotFound},
+		{name: "invalid params", message: `{"jsonrpc":"2.0","id":1,"method":"read:test/echo","params":{"parameters":{"a":{}}}}`, code: endpoint.JSONRPCInvalidParams},
+		{name: "streaming", message: `{"jsonrpc":"2.0","id":1,"method":"read:test/stream"}`, code: endpoint.JSONRPCInvalidRequest},
+		{name: "endpoint error", message: `{"jsonrpc":"2.0","id":1,"method":"read:test/fail"}`, code: endpoint.JSONRPCNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := decodeResponse(t, a.handle(context.Background(), []byte(tt.message), callOptions{}))
+			assert.Equal(t, Version, response.JSONRPC)
+			if tt.code != 0 {
+				require.NotNil(t, response.Error)
+				assert.Equal(t, tt.code, response.Error.Code)
+				assert.Nil(t, response.Result)
+				return
+			}
+			assert.Nil(t, response.Error)
+			assert.JSONEq(t, tt.result, string(response.Result))
+		})
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+	a := newTestAdapter(t)
+
+	message := `{"jsonrpc":"2.0","id":7,"method":"create:test/echo/42","params":{"parameters":{"verbose":true,"tags":["a","b"]},"body":{"name":"test"}}}`
+	response := decodeResponse(t, a.handle(context.Background(), []byte(message), callOptions{auth: "Bearer header"}))
+	require.Nil(t, response.Error)
+	assert.JSONEq(t, `7`, string(response.ID))
+
+	var result echoResult
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.Equal(t, "Bearer header", result.Auth)
+	assert.Equal(t, []string{"42"}, result.Parameters["id"])
+	assert.Equal(t, []string{"true"}, result.Parameters["verbose"])
+	assert.Equal(t, []string{"a", "b"}, result.Parameters["tags"])
+	assert.JSONEq(t, `{"name":"test"}`, string(result.Body))
+
+	// The auth member takes precedence over the transport's authorization
+	message = `{"jsonrpc":"2.0","id":8,"method":"read:test/echo","auth":"Bearer member"}`
+	response = decodeResponse(t, a.handle(context.Background(), []byte(message), callOptions{auth: "Bearer header"}))
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.Equal(t, "Bearer member", result.Auth)
+}
+
+func TestHandleErrorData(t *testing.T) {
+	a := newTestAdapter(t)
+
+	response := decodeResponse(t, a.handle(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"read:test/fail"}`), callOptions{}))
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "route not found", response.Error.Message)
+	require.NotNil(t, response.Error.Data)
+	assert.Equal(t, endpoint.ErrorCodeNotFound.String(), response.Error.Data.Code)
+	assert.Equal(t, map[string]string{"id": "7"}, response.Error.Data.Details)
+}
+
+func TestHandleBatch(t *testing.T) {
+	a := newTestAdapter(t)
+
+	message := `[
+		{"jsonrpc":"2.0","id":1,"method":"read:test/text"},
+		{"jsonrpc":"2.0","method":"read:test/text"},
+		{"jsonrpc":"2.0","id":2,"method":"read:test/fail"},
+		{"jsonrpc":"2.0","method":"read:test/fail"},
+		1
+	]`
+	var responses []Response
+	require.NoError(t, json.Unmarshal(a.handle(context.Background(), []byte(message), callOptions{}), &responses))
+	require.Len(t, responses, 3)
+	assert.JSONEq(t, `1`, string(responses[0].ID))
+	assert.Nil(t, responses[0].Error)
+	assert.JSONEq(t, `2`, string(responses[1].ID))
+	assert.Equal(t, endpoint.JSONRPCNotFound, responses[1].Error.Code)
+	assert.JSONEq(t, `null`, string(responses[2].ID))
+	assert.Equal(t, endpoint.JSONRPCInvalidRequest, responses[2].Error.Code)
+
+	// Notifications never get a response
+	assert.Nil(t, a.handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"read:test/text"}`), callOptions{}))
+	assert.Nil(t, a.handle(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"read:test/fail"}]`), callOptions{}))
+}
+
+func TestServeHTTP(t *testing.T) {
+	a := newTestAdapter(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"read:test/echo"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	a.serveHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var result echoResult
+	require.NoError(t, json.Unmarshal(decodeResponse(t, w.Body.Bytes()).Result, &result))
+	assert.Equal(t, "Bearer token", result.Auth)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","method":"read:test/echo"}`))
+	w = httptest.NewRecorder()
+	a.serveHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	a.serveHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestStartServesHTTPAndTCP(t *testing.T) {
+	a := newTestAdapter(t)
+	a.server.Addr = "127.0.0.1:0"
+	require.NoError(t, a.Start(context.Background()))
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, a.Stop(ctx))
+	}()
+	addr := a.listener.Addr().String()
+
+	// HTTP clients share the port with raw connections
+	resp, err := http.Post("http://"+addr+"/", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"read:test/text"}`))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.JSONEq(t, `"plain text"`, string(decodeResponse(t, buf.Bytes()).Result))
+
+	// Raw connections can send several messages and get one response per line
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("\n" + `{"jsonrpc":"2.0","method":"read:test/text"}` + "\n" +
+		`{"jsonrpc":"2.0","id":1,"method":"read:test/echo","auth":"Bearer raw"}` + "\n" +
+		`[{"jsonrpc":"2.0","id":2,"method":"read:test/text"}]` + "\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	require.NoError(t, err)
+	var result echoResult
+	require.NoError(t, json.Unmarshal(decodeResponse(t, line).Result, &result))
+	assert.Equal(t, "Bearer raw", result.Auth)
+
+	line, err = reader.ReadBytes('\n')
+	require.NoError(t, err)
+	var responses []Response
+	require.NoError(t, json.Unmarshal(line, &responses))
+	require.Len(t, responses, 1)
+	assert.JSONEq(t, `2`, string(responses[0].ID))
+
+	// Malformed messages close the connection after a parse error
+	_, err = conn.Write([]byte(`{"jsonrpc":}` + "\n"))
+	require.NoError(t, err)
+	line, err = reader.ReadBytes('\n')
+	require.NoError(t, err)
+	assert.Equal(t, endpoint.JSONRPCParseError, decodeResponse(t, line).Error.Code)
+	_, err = reader.ReadBytes('\n')
+	assert.Error(t, err)
+}
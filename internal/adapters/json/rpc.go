@@ -0,0 +1,263 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+// Version is the JSON-RPC version supported by the adapter
+const Version = "2.0"
+
+// Request is a JSON-RPC request. A request without an id is a notification which is executed without a response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	// Auth is the value of the authorization header to use for the call, it takes precedence over the HTTP
+	// Authorization header and is the only way to authenticate calls made over a raw TCP connection
+	Auth string `json:"auth,omitempty"`
+}
+
+// Params are the parameters of a JSON-RPC request which hold the endpoint request
+type Params struct {
+	Headers    map[string]Values `json:"headers,omitempty"`
+	Parameters map[string]Values `json:"parameters,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+}
+
+// Values are the values of a header or parameter. A single value can be passed instead of an array and numbers and
+// booleans are converted to strings.
+type Values []string
+
+// UnmarshalJSON decodes a single value or an array of values
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		raw = []json.RawMessage{data}
+	}
+
+	values := make(Values, 0, len(raw))
+	for _, item := range raw {
+		item = bytes.TrimSpace(item)
+		switch {
+		case len(item) > 0 && item[0] == '"':
+			var s string
+			if err := json.Unmarshal(item, &s); err != nil {
+				return err
+			}
+			values = append(values, s)
+		case len(item) > 0 && (item[0] == '{' || item[0] == '['):
+			return errors.New("values must be strings, numbers or booleans")
+		case bytes.Equal(item, []byte("null")):
+			values = append(values, "")
+		default:
+			values = append(values, string(item))
+		}
+	}
+	*v = values
+	return nil
+}
+
+// Response is a JSON-RPC response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+// ErrorData holds the endpoint error information attached to a JSON-RPC error
+type ErrorData struct {
+	Code      string            `json:"code"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+}
+
+// callOptions are the transport specific options applied to every call in a message
+type callOptions struct {
+	auth    string
+	remote  string
+	timeout time.Duration
+}
+
+// handle processes a JSON-RPC message which is either a single request or a batch of requests. The encoded response
+// is returned, or nil if there is nothing to return because the message only contained notifications.
+func (a *Adapter) handle(ctx context.Context, message []byte, opts callOptions) []byte {
+	message = bytes.TrimSpace(message)
+	if len(message) > 0 && message[0] == '[' {
+		var requests []json.RawMessage
+		if err := json.Unmarshal(message, &requests); err != nil {
+			return encode(errorResponse(nil, endpoint.JSONRPCParseError, "parse error"))
+		}
+		if len(requests) == 0 {
+			return encode(errorResponse(nil, endpoint.JSONRPCInvalidRequest, "invalid request: empty batch"))
+		}
+
+		responses := make([]*Response, 0, len(requests))
+		for _, request := range requests {
+			if response := a.call(ctx, request, opts); response != nil {
+				responses = append(responses, response)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encode(responses)
+	}
+
+	if !json.Valid(message) {
+		return encode(errorResponse(nil, endpoint.JSONRPCParseError, "parse error"))
+	}
+	if response := a.call(ctx, message, opts); response != nil {
+		return encode(response)
+	}
+	return nil
+}
+
+// call executes a single JSON-RPC request. Nil is returned for notifications.
+func (a *Adapter) call(ctx context.Context, message json.RawMessage, opts callOptions) *Response {
+	var request Request
+	if err := json.Unmarshal(message, &request); err != nil {
+		return errorResponse(nil, endpoint.JSONRPCInvalidRequest, "invalid request")
+	}
+	if request.JSONRPC != Version || request.Method == "" {
+		return errorResponse(request.ID, endpoint.JSONRPCInvalidRequest, "invalid request")
+	}
+
+	value, err := a.execute(ctx, &request, opts)
+
+	// Notifications never get a response, even when they fail
+	if request.ID == nil {
+		if err != nil {
+			a.logger.Debug("notification failed", zap.String("method", request.Method), zap.Error(err))
+		}
+		return nil
+	}
+
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return &Response{JSONRPC: Version, Error: rpcErr, ID: request.ID}
+		}
+		e := endpoint.AsError(err)
+		return &Response{
+			JSONRPC: Version,
+			Error: &Error{
+				Code:    e.Code.JSONRPCCode(),
+				Message: e.Message,
+				Data:    &ErrorData{Code: e.Code.String(), Details: e.Details, Retryable: e.Retryable},
+			},
+			ID: request.ID,
+		}
+	}
+	return &Response{JSONRPC: Version, Result: value, ID: request.ID}
+}
+
+// execute calls the endpoint for the request and returns its value
+func (a *Adapter) execute(ctx context.Context, request *Request, opts callOptions) (json.RawMessage, error) {
+	// Find the endpoint, matching templated paths such as 'read:auth/users/1' to 'read:auth/users/{id}'
+	key, pathParams, ok := endpoint.MatchMethod(a.endpoints, request.Method)
+	if !ok {
+		return nil, &Error{Code: endpoint.JSONRPCMethodNotFound, Message: "method not found"}
+	}
+	ep := a.endpoints[key]
+	if ep.Streaming {
+		return nil, &Error{Code: endpoint.JSONRPCInvalidRequest, Message: endpoint.ErrStreamingEndpoint.Error()}
+	}
+
+	var params Params
+	if len(request.Params) > 0 && !bytes.Equal(request.Params, []byte("null")) {
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &Error{Code: endpoint.JSONRPCInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+
+	in := &endpoint.Request{
+		Metadata:   make(map[string]string),
+		Headers:    make(map[string][]string),
+		Parameters: make(map[string][]string),
+		Body:       params.Body,
+	}
+	for name, values := range params.Headers {
+		in.Headers[name] = values
+	}
+	for name, values := range params.Parameters {
+		in.Parameters[name] = values
+	}
+	in.SetPathParameters(pathParams)
+
+	auth := opts.auth
+	if request.Auth != "" {
+		auth = request.Auth
+	}
+	if auth != "" {
+		in.Metadata[types.ContextAuthHeader.String()] = auth
+	}
+	if opts.remote != "" {
+		in.Metadata[types.ContextRemoteAddr.String()] = opts.remote
+	}
+	in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+	in.Metadata[types.ContextResourcePath.String()] = ep.Path
+
+	ctx, cancel := ep.CallContext(ctx, opts.timeout)
+	defer cancel()
+
+	out, err := ep.Function(in.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, endpoint.Errorf(endpoint.ErrorCodeDeadlineExceeded, "%s", ctxErr.Error())
+		} else if ctxErr != nil {
+			return nil, endpoint.Errorf(endpoint.ErrorCodeCanceled, "%s", ctxErr.Error())
+		}
+		return nil, err
+	}
+	return result(out), nil
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// result converts the value of the endpoint response into the JSON-RPC result. Values that aren't JSON are returned
+// as a string.
+func result(out *endpoint.Response) json.RawMessage {
+	if out == nil || len(bytes.TrimSpace(out.Value)) == 0 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(out.Value) {
+		return out.Value
+	}
+	encoded, _ := json.Marshal(string(out.Value))
+	return encoded
+}
+
+// errorResponse creates an error response for a request that could not be executed
+func errorResponse(id json.RawMessage, code int, message string) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &Response{JSONRPC: Version, Error: &Error{Code: code, Message: message}, ID: id}
+}
+
+// encode marshals the response. Responses only contain raw JSON and strings so marshalling can't fail.
+func encode(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,200 @@
+package mqtt
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// testBroker is a minimal MQTT 3.1.1 broker used to test the adapter. It supports QoS 0 and 1, retained messages and
+// wills, which is all the adapter uses, and delivers every message at QoS 0.
+type testBroker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[*brokerClient]struct{}
+	retained map[string]*packets.PublishPacket
+	wg       sync.WaitGroup
+}
+
+// brokerClient is a connection to the test broker
+type brokerClient struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string
+	will    *packets.PublishPacket
+}
+
+// newTestBroker starts a broker on a random local port which is closed when the test ends
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{
+		listener: ln,
+		clients:  make(map[*brokerClient]struct{}),
+		retained: make(map[string]*packets.PublishPacket),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	t.Cleanup(b.close)
+	return b
+}
+
+// url returns the url clients use to connect to the broker
+func (b *testBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) close() {
+	b.listener.Close()
+	b.mu.Lock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *testBroker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go b.serve(&brokerClient{conn: conn})
+	}
+}
+
+func (b *testBroker) serve(c *brokerClient) {
+	defer b.wg.Done()
+	b.mu.Lock()
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+
+	clean := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		c.conn.Close()
+		if !clean && c.will != nil {
+			b.route(c.will)
+		}
+	}()
+
+	for {
+		packet, err := packets.ReadPacket(c.conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				will.TopicName = p.WillTopic
+				will.Payload = p.WillMessage
+				will.Retain = p.WillRetain
+				c.will = will
+			}
+			c.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = p.Qoss
+			b.mu.Lock()
+			c.filters = append(c.filters, p.Topics...)
+			var retained []*packets.PublishPacket
+			for topic, msg := range b.retained {
+				for _, filter := range p.Topics {
+					if match(filter, topic) {
+						retained = append(retained, msg)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			c.write(ack)
+			for _, msg := range retained {
+				c.deliver(msg)
+			}
+		case *packets.UnsubscribePacket:
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			c.write(ack)
+		case *packets.PublishPacket:
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				c.write(ack)
+			}
+			b.route(p)
+		case *packets.PingreqPacket:
+			c.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			clean = true
+			return
+		}
+	}
+}
+
+// route delivers the message to the subscribed clients and keeps it if it is retained
+func (b *testBroker) route(msg *packets.PublishPacket) {
+	b.mu.Lock()
+	if msg.Retain {
+		b.retained[msg.TopicName] = msg
+	}
+	var subscribers []*brokerClient
+	for c := range b.clients {
+		for _, filter := range c.filters {
+			if match(filter, msg.TopicName) {
+				subscribers = append(subscribers, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range subscribers {
+		c.deliver(msg)
+	}
+}
+
+// deliver sends the message to the client at QoS 0
+func (c *brokerClient) deliver(msg *packets.PublishPacket) {
+	out := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	out.TopicName = msg.TopicName
+	out.Payload = msg.Payload
+	out.Retain = msg.Retain
+	c.write(out)
+}
+
+func (c *brokerClient) write(packet packets.ControlPacket) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := packet.Write(c.conn); err != nil && !errors.Is(err, net.ErrClosed) {
+		c.conn.Close()
+	}
+}
+
+// match returns true if the topic matches the filter, which may contain + and # wildcards
+func match(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for idx, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if idx >= len(topicLevels) || (level != "+" && level != topicLevels[idx]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
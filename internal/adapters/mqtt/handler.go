@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// Message is a request published by a client to <topic_prefix>/<agent_id>/req/<reply>. The response is published to
+// <topic_prefix>/<agent_id>/res/<reply> with the same id so clients can match it to the request, the reply levels are
+// chosen by the client, for example its client id. The token is the JWT used to authenticate the call.
+type Message struct {
+	ID      string   `json:"id"`
+	Method  string   `json:"method"`
+	Token   string   `json:"token,omitempty"`
+	Request *Request `json:"request,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+// Request holds the headers, parameters and body passed to the endpoint
+type Request struct {
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Parameters map[string][]string `json:"parameters,omitempty"`
+	Body       json.RawMessage     `json:"body,omitempty"`
+}
+
+// Response is the result of a request or a value published on a schedule, which also carries the method it came from
+type Response struct {
+	ID        string              `json:"id,omitempty"`
+	Method    string              `json:"method,omitempty"`
+	Value     json.RawMessage     `json:"value,omitempty"`
+	Headers   map[string][]string `json:"headers,omitempty"`
+	Error     *endpoint.Error     `json:"error,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// handle calls the endpoint for the request published to the topic and publishes the response
+func (a *Adapter) handle(topic string, payload []byte) {
+	reply := a.topic("res") + strings.TrimPrefix(topic, a.topic("req"))
+
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		a.send(reply, &Response{Error: endpoint.InvalidArgumentError("invalid message: %v", err)})
+		return
+	}
+
+	out, err := a.call(&msg)
+	if err != nil {
+		a.send(reply, &Response{ID: msg.ID, Error: endpoint.AsError(err)})
+		return
+	}
+	a.send(reply, &Response{ID: msg.ID, Value: helpers.ResponseValue(out), Headers: out.Headers})
+}
+
+// call calls the endpoint for the message
+func (a *Adapter) call(msg *Message) (*endpoint.Response, error) {
+	// Find the endpoint, matching templated paths such as 'read:auth/users/1' to 'read:auth/users/{id}'
+	key, pathParams, ok := endpoint.MatchMethod(a.endpoints, msg.Method)
+	if !ok {
+		return nil, endpoint.Errorf(endpoint.ErrorCodeNotFound, "method '%s' not found", msg.Method)
+	}
+	ep := a.endpoints[key]
+	if ep.Streaming {
+		return nil, endpoint.InvalidArgumentError("%s", endpoint.ErrStreamingEndpoint)
+	}
+	timeout, err := endpoint.ParseTimeout(msg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &endpoint.Request{
+		Metadata:   make(map[string]string),
+		Headers:    make(map[string][]string),
+		Parameters: make(map[string][]string),
+	}
+	if msg.Request != nil {
+		for name, values := range msg.Request.Headers {
+			in.Headers[name] = values
+		}
+		for name, values := range msg.Request.Parameters {
+			in.Parameters[name] = values
+		}
+		in.Body = msg.Request.Body
+	}
+	in.SetPathParameters(pathParams)
+	if token := msg.Token; token != "" {
+		if !helpers.HasAuthScheme(token) {
+			token = "Bearer " + token
+		}
+		in.Metadata[types.ContextAuthHeader.String()] = token
+	}
+
+	return a.invoke(a.ctx, ep, in, timeout)
+}
+
+// invoke calls the endpoint with the deadline for the call
+func (a *Adapter) invoke(ctx context.Context, ep *endpoint.Endpoint, in *endpoint.Request, timeout time.Duration) (*endpoint.Response, error) {
+	in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+	in.Metadata[types.ContextResourcePath.String()] = ep.Path
+
+	return helpers.CallEndpoint(ctx, ep, in, timeout)
+}
+
+// publish publishes the values of the endpoint until the adapter is stopped. Read endpoints are called at the
+// interval, streaming endpoints publish each value as it is produced and are restarted if they fail. Nothing is
+// published until the agent first connects to the broker.
+func (a *Adapter) publish(pub *publication) {
+	select {
+	case <-a.ctx.Done():
+		return
+	case <-a.connected:
+	}
+
+	key, pathParams, _ := endpoint.MatchMethod(a.endpoints, pub.method)
+	ep := a.endpoints[key]
+	logger := a.logger.With(zap.String("method", pub.method), zap.String("topic", pub.topic))
+
+	request := func() *endpoint.Request {
+		in := &endpoint.Request{
+			Metadata:   make(map[string]string),
+			Headers:    make(map[string][]string),
+			Parameters: make(map[string][]string),
+		}
+		for name, values := range pub.parameters {
+			in.Parameters[name] = values
+		}
+		in.SetPathParameters(pathParams)
+		if peer := a.publisher(logger); peer != "" {
+			in.Metadata[types.ContextAuthPeer.String()] = peer
+		}
+		return in
+	}
+
+	for {
+		if ep.Streaming {
+			in := request()
+			in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+			in.Metadata[types.ContextResourcePath.String()] = ep.Path
+			ctx, cancel := ep.CallContext(a.ctx, 0)
+			err := ep.Stream(in.WithContext(ctx), func(out *endpoint.Response) error {
+				a.send(pub.topic, &Response{Method: pub.method, Value: helpers.ResponseValue(out), Headers: out.Headers})
+				return nil
+			})
+			cancel()
+			if err != nil && a.ctx.Err() == nil {
+				logger.Warn("published stream failed", zap.Error(err))
+				a.send(pub.topic, &Response{Method: pub.method, Error: endpoint.AsError(err)})
+			}
+		} else {
+			out, err := a.invoke(a.ctx, ep, request(), 0)
+			if err != nil && a.ctx.Err() == nil {
+				a.send(pub.topic, &Response{Method: pub.method, Error: endpoint.AsError(err)})
+			} else if err == nil {
+				a.send(pub.topic, &Response{Method: pub.method, Value: helpers.ResponseValue(out), Headers: out.Headers})
+			}
+		}
+
+		wait := pub.interval
+		if ep.Streaming {
+			wait = restartDelay
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// publisher returns the user, encoded as JSON, that scheduled publications are called as. An empty string is
+// returned if no user is configured, in which case only endpoints that aren't secured can be published.
+func (a *Adapter) publisher(logger *zap.Logger) string {
+	username := a.controller.Config.APIs.MQTT.PublishUser
+	if username == "" {
+		return ""
+	}
+	u, err := a.lookupUser(username)
+	if err != nil {
+		logger.Warn("failed to find publish user", zap.String("user", username), zap.Error(err))
+		return ""
+	}
+
+	// The password isn't needed, and shouldn't be carried around, to authorize the user
+	u.Password = ""
+	data, err := json.Marshal(u)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// send publishes the response to the topic. Responses are dropped while the agent is disconnected from the broker
+// since the client that made the request has no way to know when it will reconnect.
+func (a *Adapter) send(topic string, response *Response) {
+	if !a.client.IsConnectionOpen() {
+		a.logger.Debug("not connected, dropping message", zap.String("topic", topic), zap.String("id", response.ID))
+		return
+	}
+	response.Timestamp = time.Now().UTC()
+	data, err := json.Marshal(response)
+	if err != nil {
+		a.logger.Error("failed to encode message", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+	token := a.client.Publish(topic, a.qos, false, data)
+	if !token.WaitTimeout(publishTimeout) {
+		a.logger.Warn("timed out publishing message", zap.String("topic", topic), zap.String("id", response.ID))
+	} else if err := token.Error(); err != nil {
+		a.logger.Warn("failed to publish message", zap.String("topic", topic), zap.String("id", response.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,323 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// publishTimeout is how long to wait for the broker to acknowledge a publication
+	publishTimeout = 10 * time.Second
+	// disconnectWait is how long, in milliseconds, the client waits for outstanding work when disconnecting
+	disconnectWait = 250
+	// restartDelay is how long to wait before restarting a streaming publication that ended
+	restartDelay = 10 * time.Second
+	// statusOnline and statusOffline are the retained values of the status topic
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// NewAdapter creates a new MQTT adapter. The adapter is nil when the MQTT API is not enabled.
+func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
+	// Check to see if the MQTT API is enabled. If not there is no adapter to create
+	if !c.Config.APIs.MQTT.Enabled {
+		return nil, nil
+	}
+
+	// Setup logger
+	name := "api/mqtt"
+	logger := c.Logger.With(zap.String("module", name))
+
+	r := &Adapter{
+		controller: c,
+		logger:     logger,
+		tls:        tls,
+		name:       name,
+		endpoints:  make(map[string]*endpoint.Endpoint),
+		lookupUser: c.AuthDB.ViewUserByUsername,
+	}
+	return r, r.setup()
+}
+
+// Adapter is the MQTT API adapter. Rather than listening for connections the agent connects out to a broker, which
+// lets agents behind NAT be reached, and serves the requests published to its request topics. See handler for the
+// format of the messages.
+type Adapter struct {
+	client       paho.Client
+	options      *paho.ClientOptions
+	tls          *map[string]basic.TLSInfo
+	controller   *controller.Controller
+	logger       *zap.Logger
+	endpoints    map[string]*endpoint.Endpoint
+	publications []*publication
+	lookupUser   func(username string) (*authndb.User, error)
+	name         string
+	base         string
+	qos          byte
+	ctx          context.Context
+	cancel       context.CancelFunc
+	connected    chan struct{}
+	connectOnce  sync.Once
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+}
+
+// publication is an endpoint whose values are published on a schedule
+type publication struct {
+	method     string
+	interval   time.Duration
+	topic      string
+	parameters map[string][]string
+}
+
+// Name returns the name of the MQTT API adapter
+func (a *Adapter) Name() string {
+	return a.name
+}
+
+// Register registers the subsystems with the API adapter
+func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
+	// Iterate over the subsystems and register each of the endpoints
+	for _, subsystem := range subsystems {
+		a.logger.Debug("registering subsystem", zap.String("subsystem", subsystem.Name()))
+		if subsystem.Enabled() {
+			for _, ep := range subsystem.Endpoints() {
+				a.logger.Debug("registering endpoint", zap.String("path", ep.Path), zap.Any("action", ep.Action))
+				method := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+				a.endpoints[method] = ep
+			}
+		}
+	}
+
+	return nil
+}
+
+// Start starts the MQTT API adapter. The connection to the broker is made in the background and retried until it
+// succeeds so an unreachable broker doesn't hold up the agent.
+func (a *Adapter) Start(ctx context.Context) (err error) {
+	// Check the publications now that the endpoints are registered so mistakes in the configuration are caught early
+	for _, pub := range a.publications {
+		key, _, ok := endpoint.MatchMethod(a.endpoints, pub.method)
+		if !ok {
+			return fmt.Errorf("published method '%s' not found", pub.method)
+		}
+		ep := a.endpoints[key]
+		if !ep.Streaming && (ep.Action != endpoint.ActionRead || pub.interval <= 0) {
+			return fmt.Errorf("published method '%s' must be a streaming endpoint or a read endpoint with an interval", pub.method)
+		}
+	}
+
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.connected = make(chan struct{})
+	a.client = paho.NewClient(a.options)
+	a.logger.Info("connecting to MQTT broker", zap.Strings("brokers", brokers(a.options)), zap.String("topic", a.topic("req", "#")))
+	a.client.Connect()
+
+	for _, pub := range a.publications {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.publish(pub)
+		}()
+	}
+
+	return nil
+}
+
+// Stop stops the MQTT API adapter
+func (a *Adapter) Stop(ctx context.Context) (err error) {
+	if a.client == nil {
+		return nil
+	}
+
+	// Cancel the calls in progress and wait for them to reply before disconnecting
+	a.mu.Lock()
+	a.cancel()
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	if a.client.IsConnectionOpen() {
+		token := a.client.Publish(a.topic("status"), a.qos, true, statusOffline)
+		token.WaitTimeout(publishTimeout)
+	}
+	a.client.Disconnect(disconnectWait)
+	return nil
+}
+
+func (a *Adapter) setup() (err error) {
+	cfg := a.controller.Config.APIs.MQTT
+	if cfg.Broker == "" {
+		return errors.New("mqtt broker is not set")
+	}
+	if err := mtls.Unsupported(cfg.TLS, "MQTT"); err != nil {
+		return err
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return fmt.Errorf("invalid mqtt qos %d", cfg.QoS)
+	}
+	a.qos = byte(cfg.QoS)
+
+	// The agent id defaults to the hostname and is a single level of the topics so it can't contain separators or
+	// wildcards
+	agentID := cfg.AgentID
+	if agentID == "" {
+		if agentID, err = os.Hostname(); err != nil {
+			return fmt.Errorf("failed to get hostname for the agent id: %w", err)
+		}
+	}
+	if strings.ContainsAny(agentID, "/+#") {
+		return fmt.Errorf("invalid agent id '%s'", agentID)
+	}
+	a.base = strings.Trim(cfg.TopicPrefix, "/") + "/" + agentID
+	a.base = strings.TrimPrefix(a.base, "/")
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "dtac-" + agentID
+	}
+
+	a.options = paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(a.topic("status"), statusOffline, a.qos, true).
+		SetOnConnectHandler(a.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			a.logger.Warn("lost connection to MQTT broker", zap.Error(err))
+		})
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := a.tlsConfig(cfg.TLS.Profile)
+		if err != nil {
+			return err
+		}
+		a.options.SetTLSConfig(tlsConfig)
+	}
+
+	for _, entry := range cfg.Publish {
+		pub := &publication{method: entry.Method, topic: entry.Topic, parameters: entry.Parameters}
+		if entry.Interval != "" {
+			if pub.interval, err = time.ParseDuration(entry.Interval); err != nil {
+				return fmt.Errorf("invalid interval for published method '%s': %w", entry.Method, err)
+			}
+		}
+		if pub.topic == "" {
+			_, path, _ := strings.Cut(entry.Method, ":")
+			pub.topic = a.topic("telemetry", strings.Trim(path, "/"))
+		}
+		a.publications = append(a.publications, pub)
+	}
+
+	return nil
+}
+
+// tlsConfig returns the TLS configuration used to connect to the broker. The certificate of the profile is presented
+// to the broker and its CA is trusted along with the system roots.
+func (a *Adapter) tlsConfig(profile string) (*tls.Config, error) {
+	cfg, ok := (*a.tls)[profile]
+	if !ok {
+		return nil, errors.New("tls profile not found")
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.CertFilename != "" && cfg.KeyFilename != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFilename, cfg.KeyFilename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS keys: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFilename != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := os.ReadFile(cfg.CAFilename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS CA: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("failed to load TLS CA: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// onConnect subscribes to the request topics and marks the agent online. It is called after every connection to the
+// broker since subscriptions don't survive a reconnect.
+func (a *Adapter) onConnect(client paho.Client) {
+	a.logger.Info("connected to MQTT broker")
+
+	token := client.Subscribe(a.topic("req", "#"), a.qos, a.onMessage)
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		a.logger.Error("failed to subscribe to request topics", zap.Error(token.Error()))
+		return
+	}
+	token = client.Publish(a.topic("status"), a.qos, true, statusOnline)
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		a.logger.Warn("failed to publish status", zap.Error(token.Error()))
+	}
+	a.connectOnce.Do(func() { close(a.connected) })
+}
+
+// onMessage handles each request in its own goroutine so a slow call doesn't hold up the others
+func (a *Adapter) onMessage(_ paho.Client, msg paho.Message) {
+	a.mu.Lock()
+	if a.ctx.Err() != nil {
+		a.mu.Unlock()
+		return
+	}
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	go func() {
+		defer a.wg.Done()
+		a.handle(msg.Topic(), msg.Payload())
+	}()
+}
+
+// topic returns the topic below the agent's base topic made up of the levels
+func (a *Adapter) topic(levels ...string) string {
+	return strings.Join(append([]string{a.base}, levels...), "/")
+}
+
+// brokers returns the urls of the brokers in the options for logging
+func brokers(options *paho.ClientOptions) []string {
+	var servers []string
+	for _, server := range options.Servers {
+		servers = append(servers, server.Redacted())
+	}
+	return servers
+}
+
+// NOTE:
+// Example testing from command line using the mosquitto clients
+//
+// Watch the responses and telemetry published by the agent
+// mosquitto_sub -h <broker> -t 'dtac/<agent_id>/res/#' -t 'dtac/<agent_id>/telemetry/#' -t 'dtac/<agent_id>/status' -v
+//
+// Login and call a secured endpoint with the returned token, responses are published to dtac/<agent_id>/res/cli
+// mosquitto_pub -h <broker> -t 'dtac/<agent_id>/req/cli' -m '{"id": "1", "method": "create:auth/login", "request": {"body": {"username": "<username>", "password": "<password>"}}}'
+// mosquitto_pub -h <broker> -t 'dtac/<agent_id>/req/cli' -m '{"id": "2", "method": "read:diag/", "token": "<access_token>"}'
+//
+// Call with path and query parameters and a deadline
+// mosquitto_pub -h <broker> -t 'dtac/<agent_id>/req/cli' -m '{"id": "3", "method": "read:auth/users/1", "token": "<access_token>", "request": {"parameters": {"verbose": ["true"]}}, "timeout": "5s"}'
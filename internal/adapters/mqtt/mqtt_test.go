@@ -0,0 +1,374 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/adapters/adaptertest"
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestAdapter(t *testing.T, cfg config.MQTTAPIEntry) *Adapter {
+	t.Helper()
+	whoami := func(in *endpoint.Request) (*endpoint.Response, error) {
+		value, err := json.Marshal(map[string]interface{}{
+			"auth": in.Metadata[types.ContextAuthHeader.String()],
+			"peer": in.Metadata[types.ContextAuthPeer.String()],
+			"id":   in.Parameters["id"],
+		})
+		return &endpoint.Response{Value: value}, err
+	}
+	stream := func(in *endpoint.Request, send endpoint.StreamSender) error {
+		for idx := 1; idx <= 3; idx++ {
+			if err := send(&endpoint.Response{Value: []byte{'0' + byte(idx)}}); err != nil {
+				return err
+			}
+		}
+		<-in.Context().Done()
+		return nil
+	}
+	create := func(in *endpoint.Request) (*endpoint.Response, error) { return &endpoint.Response{}, nil }
+
+	cfg.Enabled = true
+	a := adaptertest.NewAdapter(t, NewAdapter, config.APIEntries{MQTT: cfg},
+		endpoint.NewEndpoint("test/whoami", endpoint.ActionRead, "whoami", whoami, true, ""),
+		endpoint.NewEndpoint("test/users/{id}", endpoint.ActionRead, "whoami", whoami, true, ""),
+		endpoint.NewEndpoint("test/slow", endpoint.ActionRead, "slow", adaptertest.Slow, false, ""),
+		endpoint.NewEndpoint("test/items", endpoint.ActionCreate, "create", create, false, ""),
+		endpoint.NewStreamEndpoint("test/stream", endpoint.ActionRead, "stream", stream, false, ""),
+	).(*Adapter)
+	a.lookupUser = func(username string) (*authndb.User, error) {
+		return &authndb.User{Username: username, Password: "secret", Groups: []string{"operators"}}, nil
+	}
+	return a
+}
+
+// startTestAdapter starts the adapter and waits for it to come online
+func startTestAdapter(t *testing.T, a *Adapter, client *testClient) {
+	t.Helper()
+	require.NoError(t, a.Start(context.Background()))
+	t.Cleanup(func() { _ = a.Stop(context.Background()) })
+	assert.Equal(t, statusOnline, string(client.next(t, "dtac/agent1/status")))
+}
+
+// testClient is a client of the broker that collects the messages published to the topics it subscribes to
+type testClient struct {
+	client   paho.Client
+	messages chan paho.Message
+	pending  []paho.Message
+}
+
+func newTestClient(t *testing.T, broker *testBroker, filters ...string) *testClient {
+	t.Helper()
+	c := &testClient{messages: make(chan paho.Message, 100)}
+	c.client = paho.NewClient(paho.NewClientOptions().AddBroker(broker.url()).SetClientID("test"))
+	token := c.client.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	t.Cleanup(func() { c.client.Disconnect(0) })
+
+	for _, filter := range filters {
+		token := c.client.Subscribe(filter, 1, func(_ paho.Client, msg paho.Message) { c.messages <- msg })
+		require.True(t, token.WaitTimeout(5*time.Second))
+		require.NoError(t, token.Error())
+	}
+	return c
+}
+
+// next returns the payload of the next message published to the topic, messages on other topics are kept for later
+func (c *testClient) next(t *testing.T, topic string) []byte {
+	t.Helper()
+	for idx, msg := range c.pending {
+		if msg.Topic() == topic {
+			c.pending = append(c.pending[:idx], c.pending[idx+1:]...)
+			return msg.Payload()
+		}
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-c.messages:
+			if msg.Topic() == topic {
+				return msg.Payload()
+			}
+			c.pending = append(c.pending, msg)
+		case <-timeout:
+			t.Fatalf("timed out waiting for a message on %s", topic)
+			return nil
+		}
+	}
+}
+
+// response returns the next response published to the topic
+func (c *testClient) response(t *testing.T, topic string) *Response {
+	t.Helper()
+	var response Response
+	require.NoError(t, json.Unmarshal(c.next(t, topic), &response))
+	return &response
+}
+
+func (c *testClient) publish(t *testing.T, topic string, payload string) {
+	t.Helper()
+	token := c.client.Publish(topic, 1, false, payload)
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.MQTTAPIEntry
+		wantErr string
+		topic   string
+	}{
+		{
+			name:  "default publish topic",
+			cfg:   config.MQTTAPIEntry{Broker: "tcp://localhost:1883", AgentID: "agent1", TopicPrefix: "dtac", Publish: []config.MQTTPublishEntry{{Method: "read:hardware/cpu/", Interval: "1m"}}},
+			topic: "dtac/agent1/telemetry/hardware/cpu",
+		},
+		{
+			name:  "custom publish topic",
+			cfg:   config.MQTTAPIEntry{Broker: "tcp://localhost:1883", AgentID: "agent1", TopicPrefix: "/lab/dtac/", Publish: []config.MQTTPublishEntry{{Method: "read:hardware/cpu", Interval: "1m", Topic: "lab/cpu"}}},
+			topic: "lab/cpu",
+		},
+		{
+			name:    "missing broker",
+			cfg:     config.MQTTAPIEntry{AgentID: "agent1"},
+			wantErr: "broker is not set",
+		},
+		{
+			name:    "invalid qos",
+			cfg:     config.MQTTAPIEntry{Broker: "tcp://localhost:1883", AgentID: "agent1", QoS: 3},
+			wantErr: "invalid mqtt qos",
+		},
+		{
+			name:    "wildcard agent id",
+			cfg:     config.MQTTAPIEntry{Broker: "tcp://localhost:1883", AgentID: "lab/+"},
+			wantErr: "invalid agent id",
+		},
+		{
+			name:    "invalid interval",
+			cfg:     config.MQTTAPIEntry{Broker: "tcp://localhost:1883", AgentID: "agent1", Publish: []config.MQTTPublishEntry{{Method: "read:hardware/cpu", Interval: "often"}}},
+			wantErr: "invalid interval",
+		},
+		{
+			name:    "missing tls profile",
+			cfg:     config.MQTTAPIEntry{Broker: "ssl://localhost:8883", AgentID: "agent1", TLS: config.TLSSelection{Enabled: true, Profile: "missing"}},
+			wantErr: "tls profile not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Enabled = true
+			ctrl := &controller.Controller{Config: &config.Configuration{APIs: config.APIEntries{MQTT: tt.cfg}}, Logger: zap.NewNop()}
+			tls := make(map[string]basic.TLSInfo)
+			adapter, err := NewAdapter(ctrl, &tls)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			a := adapter.(*Adapter)
+			require.Len(t, a.publications, 1)
+			assert.Equal(t, tt.topic, a.publications[0].topic)
+		})
+	}
+}
+
+func TestRequests(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "dtac/agent1/status", "dtac/agent1/res/#")
+	a := newTestAdapter(t, config.MQTTAPIEntry{Broker: broker.url(), AgentID: "agent1", TopicPrefix: "dtac", QoS: 1})
+	startTestAdapter(t, a, client)
+
+	tests := []struct {
+		name      string
+		topic     string
+		message   string
+		reply     string
+		wantValue string
+		wantCode  endpoint.ErrorCode
+	}{
+		{
+			name:      "token without scheme",
+			topic:     "dtac/agent1/req/cli",
+			message:   `{"id": "1", "method": "read:test/whoami", "token": "abc"}`,
+			reply:     "dtac/agent1/res/cli",
+			wantValue: `{"auth":"Bearer abc","id":null,"peer":""}`,
+		},
+		{
+			name:      "token with scheme",
+			topic:     "dtac/agent1/req/cli",
+			message:   `{"id": "2", "method": "read:test/whoami", "token": "Bearer abc"}`,
+			reply:     "dtac/agent1/res/cli",
+			wantValue: `{"auth":"Bearer abc","id":null,"peer":""}`,
+		},
+		{
+			name:      "path and query parameters",
+			topic:     "dtac/agent1/req/cli/nested",
+			message:   `{"id": "3", "method": "read:test/users/42", "request": {"parameters": {"verbose": ["true"]}}}`,
+			reply:     "dtac/agent1/res/cli/nested",
+			wantValue: `{"auth":"","id":["42"],"peer":""}`,
+		},
+		{
+			name:      "peer metadata can't be injected",
+			topic:     "dtac/agent1/req",
+			message:   `{"id": "4", "method": "read:test/whoami", "request": {"headers": {"auth_peer": ["{\"username\":\"admin\"}"]}}}`,
+			reply:     "dtac/agent1/res",
+			wantValue: `{"auth":"","id":null,"peer":""}`,
+		},
+		{
+			name:     "unknown method",
+			topic:    "dtac/agent1/req/cli",
+			message:  `{"id": "5", "method": "read:test/missing"}`,
+			reply:    "dtac/agent1/res/cli",
+			wantCode: endpoint.ErrorCodeNotFound,
+		},
+		{
+			name:     "streaming endpoint",
+			topic:    "dtac/agent1/req/cli",
+			message:  `{"id": "6", "method": "read:test/stream"}`,
+			reply:    "dtac/agent1/res/cli",
+			wantCode: endpoint.ErrorCodeInvalidArgument,
+		},
+		{
+			name:     "deadline",
+			topic:    "dtac/agent1/req/cli",
+			message:  `{"id": "7", "method": "read:test/slow", "timeout": "10ms"}`,
+			reply:    "dtac/agent1/res/cli",
+			wantCode: endpoint.ErrorCodeDeadlineExceeded,
+		},
+		{
+			name:     "invalid timeout",
+			topic:    "dtac/agent1/req/cli",
+			message:  `{"id": "8", "method": "read:test/slow", "timeout": "soon"}`,
+			reply:    "dtac/agent1/res/cli",
+			wantCode: endpoint.ErrorCodeInvalidArgument,
+		},
+		{
+			name:     "invalid message",
+			topic:    "dtac/agent1/req/cli",
+			message:  `{"id": `,
+			reply:    "dtac/agent1/res/cli",
+			wantCode: endpoint.ErrorCodeInvalidArgument,
+		},
+	}
+
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.publish(t, tt.topic, tt.message)
+			response := client.response(t, tt.reply)
+			if tt.wantCode != "" {
+				require.NotNil(t, response.Error)
+				assert.Equal(t, tt.wantCode, response.Error.Code)
+				return
+			}
+			assert.Nil(t, response.Error)
+			assert.Equal(t, fmt.Sprint(idx+1), response.ID)
+			if tt.wantValue != "" {
+				assert.JSONEq(t, tt.wantValue, string(response.Value))
+			}
+			assert.False(t, response.Timestamp.IsZero())
+		})
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "dtac/agent1/status", "dtac/agent1/res/#")
+	a := newTestAdapter(t, config.MQTTAPIEntry{Broker: broker.url(), AgentID: "agent1", TopicPrefix: "dtac", QoS: 1})
+	startTestAdapter(t, a, client)
+
+	// A slow call doesn't hold up the calls made after it
+	client.publish(t, "dtac/agent1/req/cli", `{"id": "slow", "method": "read:test/slow", "timeout": "1s"}`)
+	client.publish(t, "dtac/agent1/req/cli", `{"id": "fast", "method": "create:test/items"}`)
+	assert.Equal(t, "fast", client.response(t, "dtac/agent1/res/cli").ID)
+	assert.Equal(t, "slow", client.response(t, "dtac/agent1/res/cli").ID)
+}
+
+func TestPublish(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "dtac/agent1/status", "dtac/agent1/telemetry/#", "lab/stream")
+	a := newTestAdapter(t, config.MQTTAPIEntry{
+		Broker:      broker.url(),
+		AgentID:     "agent1",
+		TopicPrefix: "dtac",
+		QoS:         1,
+		PublishUser: "telemetry",
+		Publish: []config.MQTTPublishEntry{
+			{Method: "read:test/users/7", Interval: "10ms"},
+			{Method: "read:test/stream", Topic: "lab/stream"},
+		},
+	})
+	startTestAdapter(t, a, client)
+
+	// Read endpoints are called at the interval as the publish user
+	for range 2 {
+		response := client.response(t, "dtac/agent1/telemetry/test/users/7")
+		assert.Equal(t, "read:test/users/7", response.Method)
+		var value struct {
+			ID   []string `json:"id"`
+			Peer string   `json:"peer"`
+		}
+		require.NoError(t, json.Unmarshal(response.Value, &value))
+		assert.Equal(t, []string{"7"}, value.ID)
+		var peer authndb.User
+		require.NoError(t, json.Unmarshal([]byte(value.Peer), &peer))
+		assert.Equal(t, "telemetry", peer.Username)
+		assert.Equal(t, []string{"operators"}, peer.Groups)
+		assert.Empty(t, peer.Password)
+	}
+
+	// Streaming endpoints publish each value as it is produced
+	for idx := 1; idx <= 3; idx++ {
+		response := client.response(t, "lab/stream")
+		assert.Equal(t, "read:test/stream", response.Method)
+		assert.Equal(t, fmt.Sprint(idx), string(response.Value))
+	}
+}
+
+func TestStartInvalidPublication(t *testing.T) {
+	tests := []struct {
+		name    string
+		publish config.MQTTPublishEntry
+		wantErr string
+	}{
+		{name: "unknown method", publish: config.MQTTPublishEntry{Method: "read:test/missing", Interval: "1s"}, wantErr: "not found"},
+		{name: "missing interval", publish: config.MQTTPublishEntry{Method: "read:test/whoami"}, wantErr: "with an interval"},
+		{name: "not a read endpoint", publish: config.MQTTPublishEntry{Method: "create:test/items", Interval: "1s"}, wantErr: "with an interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdapter(t, config.MQTTAPIEntry{Broker: "tcp://127.0.0.1:1", AgentID: "agent1", Publish: []config.MQTTPublishEntry{tt.publish}})
+			assert.ErrorContains(t, a.Start(context.Background()), tt.wantErr)
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "dtac/agent1/status")
+	a := newTestAdapter(t, config.MQTTAPIEntry{Broker: broker.url(), AgentID: "agent1", TopicPrefix: "dtac", QoS: 1})
+	startTestAdapter(t, a, client)
+
+	require.NoError(t, a.Stop(context.Background()))
+	assert.Equal(t, statusOffline, string(client.next(t, "dtac/agent1/status")))
+
+	// The status is retained so clients that connect later see it
+	late := newTestClient(t, broker, "dtac/agent1/status")
+	assert.Equal(t, statusOffline, string(late.next(t, "dtac/agent1/status")))
+}
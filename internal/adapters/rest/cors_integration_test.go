@@ -168,3 +168,39 @@ func TestCORSPreflightRequest(t *testing.T) {
 	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
 	assert.NotEmpty(t, w.Header().Get("Access-Control-Max-Age"))
 }
+
+func TestCORSReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := mockControllerWithCORS(false, []string{"*"})
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewAdapter(ctrl, &tls)
+	assert.NoError(t, err)
+	restAdapter := adapter.(*Adapter)
+	assert.Equal(t, []string{"apis.rest.cors"}, restAdapter.ReloadKeys())
+	restAdapter.router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "test"})
+	})
+
+	allowOrigin := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Origin", "https://frontend.example.com")
+		w := httptest.NewRecorder()
+		restAdapter.router.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	assert.Empty(t, allowOrigin())
+
+	// Enabling CORS takes effect without rebuilding the router
+	next := mockControllerWithCORS(true, []string{"https://frontend.example.com"}).Config
+	restart, err := restAdapter.Reload(next, []string{"apis.rest.cors.enabled"})
+	assert.NoError(t, err)
+	assert.Empty(t, restart)
+	assert.Equal(t, "https://frontend.example.com", allowOrigin())
+
+	// An invalid configuration leaves the current handler in place
+	next.APIs.REST.CORS.AllowedOrigins = []string{}
+	_, err = restAdapter.Reload(next, []string{"apis.rest.cors.allowed_origins"})
+	assert.Error(t, err)
+	assert.Equal(t, "https://frontend.example.com", allowOrigin())
+}
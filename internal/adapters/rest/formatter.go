@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,8 +23,24 @@ type ResponseWrapper struct {
 
 // ErrorResponse is the struct for the response
 type ErrorResponse struct {
-	Time string `json:"time"`
-	Err  string `json:"error"`
+	Time      string            `json:"time"`
+	Err       string            `json:"error"`
+	Code      string            `json:"code,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+}
+
+// NewErrorResponse creates the error response for the error. The code, details and retryable flag are taken from the
+// endpoint error if there is one, otherwise the error is reported as an internal error.
+func NewErrorResponse(err error) ErrorResponse {
+	e := endpoint.AsError(err)
+	return ErrorResponse{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Err:       err.Error(),
+		Code:      e.Code.String(),
+		Details:   e.Details,
+		Retryable: e.Retryable,
+	}
 }
 
 // ResponseFormatter is the interface for the response formatters used to write responses to the API service(s)
@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"reflect"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+const (
+	// MIMECBOR is the content type used for CBOR responses
+	MIMECBOR = "application/cbor"
+	// MIMEMsgPack is the content type used for MessagePack responses
+	MIMEMsgPack = "application/msgpack"
+)
+
+// Handles are safe for concurrent use once configured
+var (
+	cborHandle    = newCBORHandle()
+	msgpackHandle = newMsgPackHandle()
+)
+
+// NewCBORResponseFormatter creates a new instance of the CBOR response formatter
+func NewCBORResponseFormatter(cfg *config.Configuration, logger *zap.Logger) ResponseFormatter {
+	return NewEncodedResponseFormatter(cfg, logger, "cbor_formatter", MIMECBOR, codecMarshaler(cborHandle))
+}
+
+// NewMsgPackResponseFormatter creates a new instance of the MessagePack response formatter
+func NewMsgPackResponseFormatter(cfg *config.Configuration, logger *zap.Logger) ResponseFormatter {
+	return NewEncodedResponseFormatter(cfg, logger, "msgpack_formatter", MIMEMsgPack, codecMarshaler(msgpackHandle))
+}
+
+func newCBORHandle() *codec.CborHandle {
+	h := &codec.CborHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}
+
+func newMsgPackHandle() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	h.WriteExt = true
+	return h
+}
+
+// codecMarshaler returns a marshaler that encodes values using the codec handle
+func codecMarshaler(h codec.Handle) Marshaler {
+	return func(v interface{}) (out []byte, err error) {
+		err = codec.NewEncoderBytes(&out, h).Encode(v)
+		return out, err
+	}
+}
+
+// codecUnmarshal decodes a request body into a generic value using the codec handle
+func codecUnmarshal(h codec.Handle, data []byte) (v interface{}, err error) {
+	err = codec.NewDecoderBytes(data, h).Decode(&v)
+	return v, err
+}
@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Marshaler encodes a generic value (maps, slices and scalars as produced by decoding JSON) into a response format
+type Marshaler func(v interface{}) ([]byte, error)
+
+// NewEncodedResponseFormatter creates a new response formatter that writes the same response and error shapes as the
+// JSON response formatter but encoded using the marshaler
+func NewEncodedResponseFormatter(cfg *config.Configuration, logger *zap.Logger, name string, contentType string, marshal Marshaler) ResponseFormatter {
+	return &EncodedResponseFormatter{
+		cfg:         cfg,
+		logger:      logger.With(zap.String("module", name)),
+		contentType: contentType,
+		marshal:     marshal,
+	}
+}
+
+// EncodedResponseFormatter is the struct for response formatters that re-encode the JSON output of endpoints
+type EncodedResponseFormatter struct {
+	cfg         *config.Configuration
+	logger      *zap.Logger
+	contentType string
+	marshal     Marshaler
+}
+
+// WriteResponse writes a response in the formatter's encoding
+func (f *EncodedResponseFormatter) WriteResponse(c *gin.Context, duration time.Duration, obj []byte) {
+	value, err := decodeJSONValue(obj)
+	if err != nil {
+		f.WriteError(c, err)
+		return
+	}
+
+	out, err := f.marshal(map[string]interface{}{"response": value})
+	if err != nil {
+		f.WriteError(c, err)
+		return
+	}
+
+	c.Header("X-DTAC-Duration", duration.String())
+	c.Header("X-DTAC-Status", "success")
+	c.Header("X-DTAC-Time", time.Now().Format(time.RFC3339Nano))
+	c.Data(http.StatusOK, f.contentType, out)
+}
+
+// WriteError writes an error response in the formatter's encoding
+func (f *EncodedResponseFormatter) WriteError(c *gin.Context, err error) {
+	f.writeError(c, endpoint.ErrorCodeOf(err).HTTPStatus(), "error", NewErrorResponse(err))
+}
+
+// WriteNotImplementedError writes a not implemented error response in the formatter's encoding
+func (f *EncodedResponseFormatter) WriteNotImplementedError(c *gin.Context, err error) {
+	er := NewErrorResponse(err)
+	er.Code = endpoint.ErrorCodeUnimplemented.String()
+	f.writeError(c, http.StatusNotImplemented, "not-implemented", er)
+}
+
+// WriteUnauthorizedError writes an unauthorized error response in the formatter's encoding
+func (f *EncodedResponseFormatter) WriteUnauthorizedError(c *gin.Context, err error) {
+	er := NewErrorResponse(err)
+	er.Code = endpoint.ErrorCodeUnauthenticated.String()
+	f.writeError(c, http.StatusUnauthorized, "unauthorized", er)
+}
+
+// WriteNotFoundError writes a not found error response in the formatter's encoding
+func (f *EncodedResponseFormatter) WriteNotFoundError(c *gin.Context) {
+	er := ErrorResponse{
+		Time: time.Now().Format(time.RFC3339Nano),
+		Err:  "404 page not found",
+		Code: endpoint.ErrorCodeNotFound.String(),
+	}
+	f.writeError(c, http.StatusNotFound, "not-found", er)
+}
+
+// writeError encodes the error response. The error response is converted to a generic value using its JSON form so
+// that the field names match the JSON formatter.
+func (f *EncodedResponseFormatter) writeError(c *gin.Context, status int, execStatus string, er ErrorResponse) {
+	c.Header("X-Exec-Status", execStatus)
+	c.Header("X-Exec-Time", time.Now().Format(time.RFC3339Nano))
+
+	jerr, err := json.Marshal(er)
+	if err == nil {
+		var value interface{}
+		if value, err = decodeJSONValue(jerr); err == nil {
+			var out []byte
+			if out, err = f.marshal(value); err == nil {
+				c.Data(status, f.contentType, out)
+				c.Abort()
+				return
+			}
+		}
+	}
+
+	f.logger.Error("failed to encode error response", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "time": time.Now().Format(time.RFC3339Nano)})
+	c.Abort()
+}
+
+// decodeJSONValue decodes JSON into a generic value. Whole numbers are decoded as int64 so that they are encoded as
+// integers, and without losing precision, by formats that distinguish them from floating point numbers.
+func decodeJSONValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return convertNumbers(value), nil
+}
+
+// convertNumbers replaces the json.Number values in a decoded JSON value with int64 or float64 values
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for idx, item := range v {
+			v[idx] = convertNumbers(item)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
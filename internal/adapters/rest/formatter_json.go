@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
@@ -50,12 +51,11 @@ func (f *JSONResponseFormatter) WriteResponse(c *gin.Context, duration time.Dura
 	c.Data(http.StatusOK, gin.MIMEJSON, jout)
 }
 
-// WriteError writes an error response in JSON format
+// WriteError writes an error response in JSON format. The status code is derived from the error's code, errors that
+// don't carry a code are written as internal server errors.
 func (f *JSONResponseFormatter) WriteError(c *gin.Context, err error) {
-	er := ErrorResponse{
-		Time: time.Now().Format(time.RFC3339Nano),
-		Err:  err.Error(),
-	}
+	status := endpoint.ErrorCodeOf(err).HTTPStatus()
+	er := NewErrorResponse(err)
 	jerr, err := json.Marshal(er)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "time": time.Now().Format(time.RFC3339Nano)})
@@ -65,16 +65,14 @@ func (f *JSONResponseFormatter) WriteError(c *gin.Context, err error) {
 	c.Header("X-Exec-Status", "error")
 	c.Header("X-Exec-Time", time.Now().Format(time.RFC3339Nano))
 
-	c.Data(http.StatusInternalServerError, gin.MIMEJSON, jerr)
+	c.Data(status, gin.MIMEJSON, jerr)
 	c.Abort()
 }
 
 // WriteNotImplementedError writes a not implemented error response in JSON format
 func (f *JSONResponseFormatter) WriteNotImplementedError(c *gin.Context, err error) {
-	er := ErrorResponse{
-		Time: time.Now().Format(time.RFC3339Nano),
-		Err:  err.Error(),
-	}
+	er := NewErrorResponse(err)
+	er.Code = endpoint.ErrorCodeUnimplemented.String()
 
 	c.Header("X-Exec-Status", "not-implemented")
 	c.Header("X-Exec-Time", time.Now().Format(time.RFC3339Nano))
@@ -90,10 +88,8 @@ func (f *JSONResponseFormatter) WriteNotImplementedError(c *gin.Context, err err
 
 // WriteUnauthorizedError writes an unauthorized error response in JSON format
 func (f *JSONResponseFormatter) WriteUnauthorizedError(c *gin.Context, err error) {
-	er := ErrorResponse{
-		Time: time.Now().Format(time.RFC3339Nano),
-		Err:  err.Error(),
-	}
+	er := NewErrorResponse(err)
+	er.Code = endpoint.ErrorCodeUnauthenticated.String()
 
 	c.Header("X-Exec-Status", "unauthorized")
 	c.Header("X-Exec-Time", time.Now().Format(time.RFC3339Nano))
@@ -112,6 +108,7 @@ func (f *JSONResponseFormatter) WriteNotFoundError(c *gin.Context) {
 	er := ErrorResponse{
 		Time: time.Now().Format(time.RFC3339Nano),
 		Err:  "404 page not found",
+		Code: endpoint.ErrorCodeNotFound.String(),
 	}
 
 	c.Header("X-Exec-Status", "not-found")
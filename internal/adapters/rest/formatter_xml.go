@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// MIMEXML is the content type used for XML responses
+const MIMEXML = "application/xml"
+
+// NewXMLResponseFormatter creates a new instance of the XML response formatter
+func NewXMLResponseFormatter(cfg *config.Configuration, logger *zap.Logger) ResponseFormatter {
+	return NewEncodedResponseFormatter(cfg, logger, "xml_formatter", MIMEXML, marshalXML)
+}
+
+// marshalXML encodes a generic value as XML. Object keys become element names and array items are written as repeated
+// 'item' elements. An object with a single key is written with that key as the root element, anything else is
+// wrapped in a 'response' root element.
+func marshalXML(v interface{}) ([]byte, error) {
+	root := "response"
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		for key, value := range m {
+			root, v = key, value
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLElement(enc, root, v); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXMLElement writes the value as an element with the given name
+func encodeXMLElement(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := encodeXMLElement(enc, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case string:
+		if err := enc.EncodeToken(xml.CharData(value)); err != nil {
+			return err
+		}
+	case float64:
+		if err := enc.EncodeToken(xml.CharData(strconv.FormatFloat(value, 'f', -1, 64))); err != nil {
+			return err
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName converts an object key into a valid XML element name by replacing any characters that aren't allowed
+func xmlName(name string) string {
+	out := []rune(name)
+	for idx, r := range out {
+		valid := r == '_' || r == '-' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 0x7f
+		if !valid {
+			out[idx] = '_'
+		}
+	}
+	if len(out) == 0 || (out[0] >= '0' && out[0] <= '9') || out[0] == '-' || out[0] == '.' {
+		out = append([]rune{'_'}, out...)
+	}
+	return string(out)
+}
@@ -0,0 +1,21 @@
+package rest
+
+import (
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// MIMEYAML is the content type used for YAML responses
+const MIMEYAML = "application/yaml"
+
+// NewYAMLResponseFormatter creates a new instance of the YAML response formatter
+func NewYAMLResponseFormatter(cfg *config.Configuration, logger *zap.Logger) ResponseFormatter {
+	return NewEncodedResponseFormatter(cfg, logger, "yaml_formatter", MIMEYAML, yaml.Marshal)
+}
+
+// unmarshalYAML decodes a YAML request body into a generic value
+func unmarshalYAML(data []byte) (v interface{}, err error) {
+	err = yaml.Unmarshal(data, &v)
+	return v, err
+}
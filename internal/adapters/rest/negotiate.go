@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"encoding/json"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FormatParameter is the query parameter clients can use to select the response format instead of the Accept header
+const FormatParameter = "format"
+
+// formatMediaTypes maps the media types accepted by clients to the name of the format used to write the response
+var formatMediaTypes = map[string]string{
+	"*/*":                     "json",
+	"application/*":           "json",
+	gin.MIMEJSON:              "json",
+	MIMEYAML:                  "yaml",
+	"application/x-yaml":      "yaml",
+	"text/yaml":               "yaml",
+	"text/x-yaml":             "yaml",
+	MIMEXML:                   "xml",
+	"text/xml":                "xml",
+	MIMECBOR:                  "cbor",
+	MIMEMsgPack:               "msgpack",
+	"application/x-msgpack":   "msgpack",
+	"application/vnd.msgpack": "msgpack",
+}
+
+// NewNegotiatingResponseFormatter creates a response formatter that writes each response using the format requested
+// by the client. The format query parameter takes precedence over the Accept header and JSON is used when neither
+// selects a supported format.
+func NewNegotiatingResponseFormatter(cfg *config.Configuration, logger *zap.Logger) ResponseFormatter {
+	jsonFormatter := NewJSONResponseFormatter(cfg, logger)
+	return &NegotiatingResponseFormatter{
+		fallback: jsonFormatter,
+		formatters: map[string]ResponseFormatter{
+			"json":    jsonFormatter,
+			"yaml":    NewYAMLResponseFormatter(cfg, logger),
+			"xml":     NewXMLResponseFormatter(cfg, logger),
+			"cbor":    NewCBORResponseFormatter(cfg, logger),
+			"msgpack": NewMsgPackResponseFormatter(cfg, logger),
+		},
+	}
+}
+
+// NegotiatingResponseFormatter is the struct for the response formatter that selects the format per request
+type NegotiatingResponseFormatter struct {
+	fallback   ResponseFormatter
+	formatters map[string]ResponseFormatter
+}
+
+// WriteResponse writes a response in the requested format
+func (f *NegotiatingResponseFormatter) WriteResponse(c *gin.Context, duration time.Duration, obj []byte) {
+	f.formatter(c).WriteResponse(c, duration, obj)
+}
+
+// WriteError writes an error response in the requested format
+func (f *NegotiatingResponseFormatter) WriteError(c *gin.Context, err error) {
+	f.formatter(c).WriteError(c, err)
+}
+
+// WriteNotImplementedError writes a not implemented error response in the requested format
+func (f *NegotiatingResponseFormatter) WriteNotImplementedError(c *gin.Context, err error) {
+	f.formatter(c).WriteNotImplementedError(c, err)
+}
+
+// WriteUnauthorizedError writes an unauthorized error response in the requested format
+func (f *NegotiatingResponseFormatter) WriteUnauthorizedError(c *gin.Context, err error) {
+	f.formatter(c).WriteUnauthorizedError(c, err)
+}
+
+// WriteNotFoundError writes a not found error response in the requested format
+func (f *NegotiatingResponseFormatter) WriteNotFoundError(c *gin.Context) {
+	f.formatter(c).WriteNotFoundError(c)
+}
+
+// formatter returns the formatter for the format requested by the client
+func (f *NegotiatingResponseFormatter) formatter(c *gin.Context) ResponseFormatter {
+	if format := strings.ToLower(c.Query(FormatParameter)); format != "" {
+		if formatter, ok := f.formatters[format]; ok {
+			return formatter
+		}
+	}
+	for _, mediaType := range acceptedMediaTypes(c.GetHeader("Accept")) {
+		if formatter, ok := f.formatters[formatMediaTypes[mediaType]]; ok {
+			return formatter
+		}
+	}
+	return f.fallback
+}
+
+// acceptedMediaTypes parses an Accept header and returns the media types ordered by preference. Media types with a
+// quality of zero are not acceptable and are left out.
+func acceptedMediaTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		quality   float64
+	}
+	var types []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			types = append(types, accepted{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].quality > types[j].quality
+	})
+
+	mediaTypes := make([]string, len(types))
+	for idx, t := range types {
+		mediaTypes[idx] = t.mediaType
+	}
+	return mediaTypes
+}
+
+// decodeRequestBody converts a YAML, CBOR or MessagePack request body into JSON based on its content type so that it
+// can be validated and decoded by endpoints in the same way as a JSON body. Bodies with any other content type are
+// returned unchanged. XML bodies are rejected since XML doesn't carry the value types needed to convert it to JSON.
+func decodeRequestBody(contentType string, body []byte) ([]byte, error) {
+	if len(body) == 0 || contentType == "" {
+		return body, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, endpoint.InvalidArgumentError("invalid content type '%s': %w", contentType, err).WithDetail("header", "Content-Type")
+	}
+
+	var value interface{}
+	switch formatMediaTypes[mediaType] {
+	case "yaml":
+		value, err = unmarshalYAML(body)
+	case "cbor":
+		value, err = codecUnmarshal(cborHandle, body)
+	case "msgpack":
+		value, err = codecUnmarshal(msgpackHandle, body)
+	case "xml":
+		return nil, endpoint.InvalidArgumentError("xml request bodies are not supported").WithDetail("header", "Content-Type")
+	default:
+		return body, nil
+	}
+	if err != nil {
+		return nil, endpoint.InvalidArgumentError("failed to decode %s request body: %w", mediaType, err)
+	}
+
+	converted, err := json.Marshal(value)
+	if err != nil {
+		return nil, endpoint.InvalidArgumentError("failed to convert %s request body: %w", mediaType, err)
+	}
+	return converted, nil
+}
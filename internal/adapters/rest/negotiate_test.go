@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNegotiatedResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := mockControllerWithCORS(false, nil)
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewAdapter(ctrl, &tls)
+	require.NoError(t, err)
+	restAdapter := adapter.(*Adapter)
+
+	echo := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: in.Body}, nil
+	}
+	restAdapter.shim(http.MethodPost, endpoint.NewEndpoint("echo", endpoint.ActionCreate, "echo", echo, false, ""))
+
+	yamlBody, _ := yaml.Marshal(map[string]interface{}{"name": "eth0", "mtu": 1500})
+	var cborBody, msgpackBody []byte
+	require.NoError(t, codec.NewEncoderBytes(&cborBody, cborHandle).Encode(map[string]interface{}{"name": "eth0", "mtu": 1500}))
+	require.NoError(t, codec.NewEncoderBytes(&msgpackBody, msgpackHandle).Encode(map[string]interface{}{"name": "eth0", "mtu": 1500}))
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+		body        []byte
+		expectType  string
+		expectCode  int
+	}{
+		{name: "default json", url: "/echo", body: []byte(`{"name":"eth0","mtu":1500}`), expectType: gin.MIMEJSON, expectCode: http.StatusOK},
+		{name: "accept yaml", url: "/echo", accept: "application/yaml", contentType: "application/yaml", body: yamlBody, expectType: MIMEYAML, expectCode: http.StatusOK},
+		{name: "accept preference", url: "/echo", accept: "application/json;q=0.5, application/xml", body: []byte(`{"name":"eth0","mtu":1500}`), expectType: MIMEXML, expectCode: http.StatusOK},
+		{name: "format parameter", url: "/echo?format=cbor", accept: gin.MIMEJSON, contentType: MIMECBOR, body: cborBody, expectType: MIMECBOR, expectCode: http.StatusOK},
+		{name: "msgpack", url: "/echo", accept: MIMEMsgPack, contentType: MIMEMsgPack, body: msgpackBody, expectType: MIMEMsgPack, expectCode: http.StatusOK},
+		{name: "unsupported accept", url: "/echo", accept: "image/png", body: []byte(`{"name":"eth0","mtu":1500}`), expectType: gin.MIMEJSON, expectCode: http.StatusOK},
+		{name: "xml body", url: "/echo", accept: MIMEXML, contentType: MIMEXML, body: []byte(`<name>eth0</name>`), expectType: MIMEXML, expectCode: http.StatusBadRequest},
+		{name: "invalid cbor body", url: "/echo", accept: MIMEYAML, contentType: MIMECBOR, body: []byte{0xff, 0x00}, expectType: MIMEYAML, expectCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewReader(tt.body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			restAdapter.router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectCode, w.Code)
+			assert.Equal(t, tt.expectType, w.Header().Get("Content-Type"))
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+
+			var out struct {
+				Response struct {
+					Name string `json:"name" yaml:"name" codec:"name"`
+					MTU  int    `json:"mtu" yaml:"mtu" codec:"mtu"`
+				} `json:"response" yaml:"response" codec:"response"`
+			}
+			switch tt.expectType {
+			case MIMEYAML:
+				require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &out))
+			case MIMECBOR:
+				require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), cborHandle).Decode(&out))
+			case MIMEMsgPack:
+				require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&out))
+			case MIMEXML:
+				assert.Contains(t, w.Body.String(), "<response><mtu>1500</mtu><name>eth0</name></response>")
+				return
+			default:
+				require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), &codec.JsonHandle{}).Decode(&out))
+			}
+			assert.Equal(t, "eth0", out.Response.Name)
+			assert.Equal(t, 1500, out.Response.MTU)
+		})
+	}
+}
+
+func TestMarshalXML(t *testing.T) {
+	value, err := decodeJSONValue([]byte(`{"time":"now","error":"bad","details":{"0bad key":"x"},"items":[1,2.5,null,true]}`))
+	require.NoError(t, err)
+	out, err := marshalXML(value)
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response><details><_0bad_key>x</_0bad_key></details><error>bad</error><items><item>1</item><item>2.5</item><item></item><item>true</item></items><time>now</time></response>`,
+		string(out))
+}
@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+// peerCredentials returns the credentials of the process on the other end of a unix socket connection
+func peerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("connection is not a unix socket connection")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &PeerCredentials{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
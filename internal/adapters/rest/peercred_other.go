@@ -0,0 +1,13 @@
+//go:build !linux
+
+package rest
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials returns the credentials of the process on the other end of a unix socket connection
+func peerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
@@ -7,14 +7,20 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
 	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
+	"github.com/bgrewell/dtac-agent/internal/openapi"
 	"github.com/bgrewell/dtac-agent/internal/types"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
 	"io"
 	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,8 +31,23 @@ func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapte
 		return nil, errors.New("rest api is not enabled")
 	}
 
+	r := newAdapter(c, tls, "api/rest")
+
+	// Setup CORS middleware, the handler is rebuilt when the CORS configuration is reloaded
+	handler, err := r.newCORS(c.Config.APIs.REST.CORS)
+	if err != nil {
+		return nil, err
+	}
+	r.cors = &atomic.Pointer[gin.HandlerFunc]{}
+	r.cors.Store(&handler)
+	r.router.Use(r.corsMiddleware)
+
+	return r, r.setup()
+}
+
+// newAdapter creates the adapter with a router that hasn't had any endpoints registered yet
+func newAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo, name string) *Adapter {
 	// Setup logger
-	name := "api/rest"
 	logger := c.Logger.With(zap.String("module", name))
 
 	// Setup gin logging
@@ -34,40 +55,15 @@ func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapte
 	router := gin.New()
 	router.Use(ginZapLoggerMiddleware(logger))
 
-	// Setup CORS middleware if enabled
-	if c.Config.APIs.REST.CORS.Enabled {
-		corsConfig := cors.Config{
-			AllowMethods:     c.Config.APIs.REST.CORS.AllowedMethods,
-			AllowHeaders:     c.Config.APIs.REST.CORS.AllowedHeaders,
-			ExposeHeaders:    c.Config.APIs.REST.CORS.ExposedHeaders,
-			AllowCredentials: c.Config.APIs.REST.CORS.AllowCredentials,
-			MaxAge:           time.Duration(c.Config.APIs.REST.CORS.MaxAge) * time.Second,
-		}
-		
-		// Handle wildcard origins
-		if len(c.Config.APIs.REST.CORS.AllowedOrigins) == 1 && c.Config.APIs.REST.CORS.AllowedOrigins[0] == "*" {
-			corsConfig.AllowAllOrigins = true
-		} else {
-			corsConfig.AllowOrigins = c.Config.APIs.REST.CORS.AllowedOrigins
-		}
-		
-		router.Use(cors.New(corsConfig))
-		logger.Info("CORS middleware enabled",
-			zap.Strings("allowed_origins", c.Config.APIs.REST.CORS.AllowedOrigins),
-			zap.Strings("allowed_methods", c.Config.APIs.REST.CORS.AllowedMethods),
-		)
-	}
-
-	r := &Adapter{
+	return &Adapter{
 		controller:      c,
 		router:          router,
 		logger:          logger,
 		tls:             tls,
 		name:            name,
-		formatter:       NewJSONResponseFormatter(c.Config, logger),
+		formatter:       NewNegotiatingResponseFormatter(c.Config, logger),
 		registeredPaths: make(map[string]bool),
 	}
-	return r, r.setup()
 }
 
 // Adapter is the REST API adapter
@@ -80,8 +76,66 @@ type Adapter struct {
 	name            string
 	srvMsg          string
 	srvFunc         func(net.Listener) error
+	listen          func() (net.Listener, error)
 	formatter       ResponseFormatter
 	registeredPaths map[string]bool
+	cors            *atomic.Pointer[gin.HandlerFunc]
+	certs           *mtls.Mapper
+}
+
+// newCORS returns the CORS middleware for the configuration or nil if CORS is disabled
+func (a *Adapter) newCORS(cfg config.CORSConfig) (gin.HandlerFunc, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	corsConfig := cors.Config{
+		AllowMethods:     cfg.AllowedMethods,
+		AllowHeaders:     cfg.AllowedHeaders,
+		ExposeHeaders:    cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           time.Duration(cfg.MaxAge) * time.Second,
+	}
+
+	// Handle wildcard origins
+	if len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*" {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.AllowedOrigins
+	}
+	if err := corsConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cors configuration: %v", err)
+	}
+
+	a.logger.Info("CORS middleware enabled",
+		zap.Strings("allowed_origins", cfg.AllowedOrigins),
+		zap.Strings("allowed_methods", cfg.AllowedMethods),
+	)
+	return cors.New(corsConfig), nil
+}
+
+// corsMiddleware runs the current CORS handler, if CORS is enabled
+func (a *Adapter) corsMiddleware(ctx *gin.Context) {
+	if handler := *a.cors.Load(); handler != nil {
+		handler(ctx)
+	}
+}
+
+// ReloadKeys returns the settings the adapter applies live, only the REST API serves CORS
+func (a *Adapter) ReloadKeys() []string {
+	if a.cors == nil {
+		return nil
+	}
+	return []string{"apis.rest.cors"}
+}
+
+// Reload replaces the CORS handler with one built from the new configuration
+func (a *Adapter) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	handler, err := a.newCORS(cfg.APIs.REST.CORS)
+	if err != nil {
+		return nil, err
+	}
+	a.cors.Store(&handler)
+	return nil, nil
 }
 
 // Name returns the name of the REST API adapter
@@ -117,10 +171,15 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 		}
 	}
 
-	// Add swagger endpoint
+	// Add swagger endpoint. The document only describes the endpoints that are visible without authenticating, the
+	// complete document for a user is available from the diag/openapi endpoint.
 	a.router.GET("/swagger.json", func(c *gin.Context) {
-		endpoints := a.controller.EndpointList
-		swagger, err := GenerateSwaggerDocument(endpoints.Endpoints)
+		in, err := a.createInputArgs(c)
+		if err != nil {
+			a.formatter.WriteError(c, err)
+			return
+		}
+		swagger, err := openapi.Generate(a.controller.EndpointList.GetVisibleEndpoints(in))
 		if err != nil {
 			a.logger.Error("failed to generate swagger document", zap.Error(err))
 			a.formatter.WriteError(c, err)
@@ -134,15 +193,15 @@ func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
 
 // Start starts the REST API adapter
 func (a *Adapter) Start(ctx context.Context) (err error) {
-	ln, err := net.Listen("tcp", a.server.Addr)
+	ln, err := a.listen()
 	if err != nil {
 		return err
 	}
 
-	a.logger.Info(a.srvMsg, zap.String("addr", a.server.Addr))
+	a.logger.Info(a.srvMsg, zap.String("addr", ln.Addr().String()))
 	go func() {
 		err := a.srvFunc(ln)
-		if err != nil {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			a.logger.Fatal("failed to start server", zap.Error(err))
 		}
 	}()
@@ -158,12 +217,22 @@ func (a *Adapter) Stop(ctx context.Context) (err error) {
 func (a *Adapter) setup() (err error) {
 	// Create a new http server
 	a.server = &http.Server{Addr: fmt.Sprintf(":%d", a.controller.Config.APIs.REST.Port), Handler: a.router}
+	a.listen = func() (net.Listener, error) {
+		return net.Listen("tcp", a.server.Addr)
+	}
 
 	// Set up the serve function
 	a.srvFunc = a.server.Serve
 	a.srvMsg = "starting REST API HTTP server"
-	if a.controller.Config.APIs.REST.TLS.Enabled {
-		if cfg, ok := (*a.tls)[a.controller.Config.APIs.REST.TLS.Profile]; ok {
+	if selection := a.controller.Config.APIs.REST.TLS; selection.Enabled {
+		if cfg, ok := (*a.tls)[selection.Profile]; ok {
+			// Clients presenting a verified certificate are identified by it when client authentication is enabled
+			if selection.ClientAuth.Enabled {
+				if a.server.TLSConfig, err = mtls.ServerConfig(selection, cfg); err != nil {
+					return err
+				}
+				a.certs = mtls.NewMapper(selection.ClientAuth.Mappings, a.controller.AuthDB.ViewUserByUsername)
+			}
 			wrapper := func(l net.Listener) error {
 				return a.server.ServeTLS(l, cfg.CertFilename, cfg.KeyFilename)
 			}
@@ -188,7 +257,7 @@ func (a *Adapter) shim(method string, ep *endpoint.Endpoint) {
 		return
 	}
 
-	a.router.Handle(method, ep.Path, func(c *gin.Context) {
+	a.router.Handle(method, ginPath(ep.Path), func(c *gin.Context) {
 		in, err := a.createInputArgs(c)
 		if err != nil {
 			a.logger.Error("failed to create input args", zap.Error(err))
@@ -196,20 +265,39 @@ func (a *Adapter) shim(method string, ep *endpoint.Endpoint) {
 			return
 		}
 
-		// If this is a secured endpoint check for the authorization header
+		// If this is a secured endpoint check for the authorization header. Callers identified by the transport don't
+		// need one.
 		if ep.Secure {
 			auth := c.GetHeader("Authorization")
-			if auth == "" {
+			if auth != "" {
+				in.Metadata[types.ContextAuthHeader.String()] = auth
+			} else if _, ok := in.Metadata[types.ContextAuthPeer.String()]; !ok {
 				a.formatter.WriteUnauthorizedError(c, errors.New("authorization header is missing"))
 				return
 			}
-			in.Metadata[types.ContextAuthHeader.String()] = auth
 		}
 
 		// Add additional context
 		in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
 		in.Metadata[types.ContextResourcePath.String()] = ep.Path
 
+		// Bound the call by the endpoint's timeout and any deadline supplied by the client. The request context is
+		// canceled when the client disconnects which stops any work still in progress.
+		timeout, err := endpoint.ParseTimeout(c.GetHeader(endpoint.HeaderRequestTimeout))
+		if err != nil {
+			a.formatter.WriteError(c, err)
+			return
+		}
+		ctx, cancel := ep.CallContext(c.Request.Context(), timeout)
+		defer cancel()
+		in = in.WithContext(ctx)
+
+		// Streaming endpoints write their output incrementally
+		if ep.Streaming {
+			a.stream(c, ep, in)
+			return
+		}
+
 		out, err := ep.Function(in)
 		if err != nil {
 			a.logger.Error("failed to execute endpoint", zap.Error(err))
@@ -249,6 +337,24 @@ func (a *Adapter) createInputArgs(ctx *gin.Context) (*endpoint.Request, error) {
 		Body:       nil,
 	}
 
+	// Add the identity of the caller when it was established by the connection
+	if peer, ok := ctx.Request.Context().Value(peerContextKey{}).(string); ok && peer != "" {
+		input.Metadata[types.ContextAuthPeer.String()] = peer
+	}
+	if a.certs != nil && ctx.Request.TLS != nil {
+		peer, err := a.certs.Peer(ctx.Request.TLS)
+		if err != nil {
+			a.logger.Warn("failed to identify client certificate", zap.Error(err))
+		} else if peer != "" {
+			input.Metadata[types.ContextAuthPeer.String()] = peer
+		}
+	}
+
+	// Add the address the request came from
+	if remote := helpers.RemoteHost(ctx.Request.RemoteAddr); remote != "" {
+		input.Metadata[types.ContextRemoteAddr.String()] = remote
+	}
+
 	// Populate headers
 	for k, v := range ctx.Request.Header {
 		input.Headers[k] = v
@@ -259,16 +365,39 @@ func (a *Adapter) createInputArgs(ctx *gin.Context) (*endpoint.Request, error) {
 		input.Parameters[k] = v
 	}
 
+	// Populate path parameters
+	pathParams := make(map[string]string)
+	for _, param := range ctx.Params {
+		pathParams[param.Key] = param.Value
+	}
+	input.SetPathParameters(pathParams)
+
 	// Read request body
 	body, err := io.ReadAll(ctx.Request.Body)
 	if err != nil {
 		return nil, err
 	}
-	input.Body = body
+
+	// Convert binary and YAML bodies to JSON before they are validated
+	input.Body, err = decodeRequestBody(ctx.GetHeader("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
 
 	return input, nil
 }
 
+// ginPath converts templated path segments such as '{id}' into the ':id' form used by gin
+func ginPath(path string) string {
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2 {
+			segments[idx] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 // Custom middleware for Gin that uses Zap logger
 func ginZapLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,147 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShimPathParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := mockControllerWithCORS(false, nil)
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewAdapter(ctrl, &tls)
+	assert.NoError(t, err)
+	restAdapter := adapter.(*Adapter)
+
+	echo := func(in *endpoint.Request) (*endpoint.Response, error) {
+		value, err := json.Marshal(in.Parameters)
+		return &endpoint.Response{Value: value}, err
+	}
+	restAdapter.shim(http.MethodGet, endpoint.NewEndpoint("auth/users", endpoint.ActionRead, "list", echo, false, ""))
+	restAdapter.shim(http.MethodGet, endpoint.NewEndpoint("auth/users/{id}", endpoint.ActionRead, "get", echo, false, ""))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/users/42?id=7&verbose=true", nil)
+	w := httptest.NewRecorder()
+	restAdapter.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var out struct {
+		Response map[string][]string `json:"response"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	assert.Equal(t, []string{"42"}, out.Response["id"])
+	assert.Equal(t, []string{"true"}, out.Response["verbose"])
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/users", nil)
+	w = httptest.NewRecorder()
+	restAdapter.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestShimRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := mockControllerWithCORS(false, nil)
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewAdapter(ctrl, &tls)
+	assert.NoError(t, err)
+	restAdapter := adapter.(*Adapter)
+
+	wait := func(in *endpoint.Request) (*endpoint.Response, error) {
+		select {
+		case <-in.Context().Done():
+			return nil, in.Context().Err()
+		case <-time.After(5 * time.Second):
+			return &endpoint.Response{Value: []byte(`"done"`)}, nil
+		}
+	}
+	restAdapter.shim(http.MethodGet, endpoint.NewEndpoint("slow", endpoint.ActionRead, "slow", wait, false, ""))
+	restAdapter.shim(http.MethodGet, endpoint.NewEndpoint("bounded", endpoint.ActionRead, "bounded", wait, false, "", endpoint.WithTimeout(10*time.Millisecond)))
+
+	tests := []struct {
+		name    string
+		path    string
+		timeout string
+	}{
+		{name: "client deadline", path: "/slow", timeout: "10ms"},
+		{name: "endpoint timeout", path: "/bounded"},
+		{name: "longer client deadline", path: "/bounded", timeout: "1m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.timeout != "" {
+				req.Header.Set(endpoint.HeaderRequestTimeout, tt.timeout)
+			}
+			w := httptest.NewRecorder()
+			start := time.Now()
+			restAdapter.router.ServeHTTP(w, req)
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+			assert.Contains(t, w.Body.String(), context.DeadlineExceeded.Error())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(endpoint.HeaderRequestTimeout, "soon")
+	w := httptest.NewRecorder()
+	restAdapter.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid timeout")
+}
+
+func TestShimErrorResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctrl := mockControllerWithCORS(false, nil)
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewAdapter(ctrl, &tls)
+	assert.NoError(t, err)
+	restAdapter := adapter.(*Adapter)
+
+	tests := []struct {
+		name            string
+		err             error
+		expectStatus    int
+		expectCode      string
+		expectRetryable bool
+	}{
+		{name: "plain", err: errors.New("boom"), expectStatus: http.StatusInternalServerError, expectCode: "internal"},
+		{name: "not-found", err: endpoint.NotFoundError("user 7 not found"), expectStatus: http.StatusNotFound, expectCode: "not_found"},
+		{name: "denied", err: endpoint.PermissionDeniedError("nope"), expectStatus: http.StatusForbidden, expectCode: "permission_denied"},
+		{name: "conflict", err: endpoint.ConflictError("user already exists"), expectStatus: http.StatusConflict, expectCode: "conflict"},
+		{name: "unavailable", err: endpoint.UnavailableError("plugin restarting"), expectStatus: http.StatusServiceUnavailable, expectCode: "unavailable", expectRetryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fail := func(in *endpoint.Request) (*endpoint.Response, error) {
+				return nil, tt.err
+			}
+			restAdapter.shim(http.MethodGet, endpoint.NewEndpoint("errors/"+tt.name, endpoint.ActionRead, "error", fail, false, ""))
+
+			req := httptest.NewRequest(http.MethodGet, "/errors/"+tt.name, nil)
+			w := httptest.NewRecorder()
+			restAdapter.router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectStatus, w.Code)
+
+			var out ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+			assert.Equal(t, tt.expectCode, out.Code)
+			assert.Equal(t, tt.err.Error(), out.Err)
+			assert.Equal(t, tt.expectRetryable, out.Retryable)
+		})
+	}
+}
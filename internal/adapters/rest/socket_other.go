@@ -0,0 +1,23 @@
+//go:build !windows
+
+package rest
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes the changes to the umask of the process while sockets are created
+var umaskMu sync.Mutex
+
+// listenPrivate listens on the unix socket at the path. The socket is created under a umask that only lets its owner
+// connect, so clients can't get in before its mode and group are set. The umask is process wide, files created by
+// other goroutines in the meantime are restricted as well.
+func listenPrivate(path string) (net.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
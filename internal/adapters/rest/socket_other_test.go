@@ -0,0 +1,30 @@
+//go:build !windows
+
+package rest
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenPrivate(t *testing.T) {
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := listenPrivate(path)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The umask of the process is restored
+	assert.Equal(t, 0022, syscall.Umask(0022))
+}
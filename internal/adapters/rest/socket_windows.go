@@ -0,0 +1,8 @@
+package rest
+
+import "net"
+
+// listenPrivate listens on the unix socket at the path, access is controlled by the ACL of the directory on Windows
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MIMEEventStream is the content type used for server-sent events
+	MIMEEventStream = "text/event-stream"
+	// MIMENDJSON is the content type used for newline delimited JSON streams
+	MIMENDJSON = "application/x-ndjson"
+)
+
+// stream writes the output of a streaming endpoint to the client. If the client accepts text/event-stream the output
+// is written as server-sent events, otherwise each message is written as a single line of JSON (chunked JSON lines).
+// Errors that occur before the first message is written are returned using the response formatter, errors after that
+// point are written in-band since the status code has already been sent.
+func (a *Adapter) stream(c *gin.Context, ep *endpoint.Endpoint, in *endpoint.Request) {
+	sse := strings.Contains(c.GetHeader("Accept"), MIMEEventStream)
+	started := false
+
+	err := ep.Stream(in, func(out *endpoint.Response) error {
+		// Stop producing output if the client has gone away
+		if err := in.Context().Err(); err != nil {
+			return err
+		}
+
+		if !started {
+			for headerKey, headerValues := range out.Headers {
+				for _, headerValue := range headerValues {
+					c.Header(headerKey, headerValue)
+				}
+			}
+			if sse {
+				c.Header("Content-Type", MIMEEventStream)
+			} else {
+				c.Header("Content-Type", MIMENDJSON)
+			}
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+			started = true
+		}
+
+		var err error
+		if sse {
+			_, err = fmt.Fprintf(c.Writer, "data: %s\n\n", streamValue(out.Value))
+		} else {
+			_, err = fmt.Fprintf(c.Writer, "%s\n", streamValue(out.Value))
+		}
+		if err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	if err != nil {
+		a.logger.Error("failed to execute streaming endpoint", zap.Error(err))
+		if !started {
+			a.formatter.WriteError(c, err)
+			return
+		}
+		msg, _ := json.Marshal(NewErrorResponse(err))
+		if sse {
+			_, _ = fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", msg)
+		} else {
+			_, _ = fmt.Fprintf(c.Writer, "%s\n", msg)
+		}
+		c.Writer.Flush()
+		return
+	}
+
+	// A stream that produced no output still needs a successful status written
+	if !started {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// streamValue returns the value as a single line of JSON. Values that are not valid JSON are encoded as JSON strings.
+func streamValue(value []byte) []byte {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, value); err == nil {
+		return buf.Bytes()
+	}
+	encoded, _ := json.Marshal(string(value))
+	return encoded
+}
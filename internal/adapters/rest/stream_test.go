@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamingEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	counter := func(in *endpoint.Request, send endpoint.StreamSender) error {
+		for _, v := range []string{`{"n": 1}`, `{"n": 2}`, `{"n": 3}`} {
+			if err := send(&endpoint.Response{Value: []byte(v)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name         string
+		accept       string
+		gateErr      error
+		expectStatus int
+		expectType   string
+		expectBody   string
+	}{
+		{
+			name:         "chunked json lines by default",
+			expectStatus: http.StatusOK,
+			expectType:   MIMENDJSON,
+			expectBody:   "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n",
+		},
+		{
+			name:         "server-sent events when accepted",
+			accept:       MIMEEventStream,
+			expectStatus: http.StatusOK,
+			expectType:   MIMEEventStream,
+			expectBody:   "data: {\"n\":1}\n\ndata: {\"n\":2}\n\ndata: {\"n\":3}\n\n",
+		},
+		{
+			name:         "middleware error prevents stream",
+			gateErr:      errors.New("denied"),
+			expectStatus: http.StatusInternalServerError,
+			expectType:   gin.MIMEJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := mockControllerWithCORS(false, nil)
+			tls := make(map[string]basic.TLSInfo)
+			adapter, err := NewAdapter(ctrl, &tls)
+			assert.NoError(t, err)
+			restAdapter := adapter.(*Adapter)
+
+			ep := endpoint.NewStreamEndpoint("count", endpoint.ActionRead, "counts", counter, false, "")
+			if tt.gateErr != nil {
+				// Simulate a middleware that rejects the request
+				ep.Function = func(in *endpoint.Request) (*endpoint.Response, error) {
+					return nil, tt.gateErr
+				}
+			}
+			restAdapter.shim(http.MethodGet, ep)
+
+			req := httptest.NewRequest(http.MethodGet, "/count", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			restAdapter.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectStatus, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), tt.expectType)
+			if tt.expectBody != "" {
+				assert.Equal(t, tt.expectBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerUserPrefix is the prefix of the username given to unix socket callers that are identified by their OS group
+// rather than mapped to a DTAC user
+const PeerUserPrefix = "unix:"
+
+// peerContextKey is the key of the caller's identity in the context of requests made over a unix socket
+type peerContextKey struct{}
+
+// PeerCredentials are the credentials of the process on the other end of a unix socket connection
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// NewUnixAdapter creates a new adapter serving the REST API on a unix socket. Callers are identified by the
+// credentials of the connecting process, which are mapped to DTAC users and groups by the configuration, so local
+// tools don't need to handle tokens. The adapter is nil when the unix socket API is not enabled.
+func NewUnixAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
+	// Check to see if the unix socket API is enabled. If not there is no adapter to create
+	if !c.Config.APIs.Unix.Enabled {
+		return nil, nil
+	}
+
+	r := newAdapter(c, tls, "api/unix")
+	return r, r.setupUnix()
+}
+
+func (a *Adapter) setupUnix() (err error) {
+	cfg := a.controller.Config.APIs.Unix
+	if cfg.Path == "" {
+		return errors.New("unix socket path is not set")
+	}
+	mode := os.FileMode(0660)
+	if cfg.Mode != "" {
+		value, err := strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid unix socket mode '%s': %w", cfg.Mode, err)
+		}
+		mode = os.FileMode(value)
+	}
+	gid := -1
+	if cfg.Group != "" {
+		if gid, err = lookupGroupID(cfg.Group); err != nil {
+			return err
+		}
+	}
+
+	mapper := &peerMapper{
+		users:      cfg.Users,
+		groups:     cfg.Groups,
+		lookupUser: a.controller.AuthDB.ViewUserByUsername,
+	}
+
+	a.server = &http.Server{
+		Addr:              cfg.Path,
+		Handler:           a.router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, peerContextKey{}, a.identifyPeer(mapper, conn))
+		},
+	}
+	a.srvFunc = a.server.Serve
+	a.srvMsg = "starting REST API unix socket server"
+	a.listen = func() (net.Listener, error) {
+		return listenUnix(cfg.Path, mode, gid)
+	}
+
+	return nil
+}
+
+// identifyPeer returns the user, encoded as JSON, for the process on the other end of the connection. An empty string
+// is returned if the caller can't be identified, in which case it can still authenticate with a token.
+func (a *Adapter) identifyPeer(mapper *peerMapper, conn net.Conn) string {
+	creds, err := peerCredentials(conn)
+	if err != nil {
+		a.logger.Warn("failed to get peer credentials", zap.Error(err))
+		return ""
+	}
+	u, err := mapper.identify(creds)
+	if err != nil {
+		a.logger.Warn("failed to identify peer", zap.Uint32("uid", creds.UID), zap.Uint32("gid", creds.GID), zap.Error(err))
+		return ""
+	}
+	if u == nil {
+		a.logger.Debug("peer is not mapped to a user", zap.Uint32("uid", creds.UID), zap.Uint32("gid", creds.GID))
+		return ""
+	}
+	a.logger.Debug("identified peer", zap.Int32("pid", creds.PID), zap.Uint32("uid", creds.UID), zap.String("user", u.Username))
+
+	// The password isn't needed, and shouldn't be carried around, to authorize the user
+	u.Password = ""
+	data, err := json.Marshal(u)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// peerMapper maps the credentials of unix socket callers to DTAC users
+type peerMapper struct {
+	users      map[string]string
+	groups     map[string]string
+	lookupUser func(username string) (*authndb.User, error)
+}
+
+// identify returns the DTAC user for the credentials. OS users mapped to a DTAC user take precedence, otherwise a user
+// is created with the DTAC groups mapped from the caller's primary and supplementary OS groups. Nil is returned if
+// neither the user nor any of its groups are mapped.
+func (m *peerMapper) identify(creds *PeerCredentials) (*authndb.User, error) {
+	uid := strconv.FormatUint(uint64(creds.UID), 10)
+	osUser, err := user.LookupId(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{osUser.Username, uid} {
+		if username, ok := lookupKey(m.users, key); ok {
+			return m.lookupUser(username)
+		}
+	}
+
+	gids := []string{strconv.FormatUint(uint64(creds.GID), 10)}
+	if supplementary, err := osUser.GroupIds(); err == nil {
+		gids = append(gids, supplementary...)
+	}
+	var groups []string
+	for _, gid := range gids {
+		keys := []string{gid}
+		if g, err := user.LookupGroupId(gid); err == nil {
+			keys = append([]string{g.Name}, keys...)
+		}
+		for _, key := range keys {
+			if group, ok := lookupKey(m.groups, key); ok {
+				if !slices.Contains(groups, group) {
+					groups = append(groups, group)
+				}
+				break
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	return &authndb.User{Username: PeerUserPrefix + osUser.Username, Groups: groups}, nil
+}
+
+// lookupKey looks up the key in the mapping ignoring case since configuration keys are case-insensitive
+func lookupKey(mapping map[string]string, key string) (string, bool) {
+	for k, v := range mapping {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// lookupGroupID returns the id of the OS group with the name or numeric id
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// listenUnix listens on the unix socket at the path, removing a stale socket left behind by a previous run. The
+// socket is only accessible by its owner until it is given the mode and, if gid isn't -1, the group.
+func listenUnix(path string, mode os.FileMode, gid int) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if gid != -1 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// NOTE:
+// Example testing from command line
+//
+// Call a secured endpoint as the current user, no token is needed when the user or one of its groups is mapped
+// curl --unix-socket /run/dtac/agent.sock http://localhost/diag/
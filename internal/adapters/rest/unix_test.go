@@ -0,0 +1,198 @@
+//go:build linux
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockUnixConfig(path string, users, groups map[string]string) *config.Configuration {
+	return &config.Configuration{
+		APIs: config.APIEntries{
+			Unix: config.UnixAPIEntry{
+				Enabled: true,
+				Path:    path,
+				Mode:    "0600",
+				Users:   users,
+				Groups:  groups,
+			},
+		},
+	}
+}
+
+func TestNewUnixAdapterDisabled(t *testing.T) {
+	ctrl := mockControllerWithCORS(false, nil)
+	tls := make(map[string]basic.TLSInfo)
+	adapter, err := NewUnixAdapter(ctrl, &tls)
+	assert.NoError(t, err)
+	assert.Nil(t, adapter)
+}
+
+func TestPeerMapperIdentify(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	primary, err := user.LookupGroupId(current.Gid)
+	require.NoError(t, err)
+
+	creds := &PeerCredentials{PID: int32(os.Getpid()), UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+
+	tests := []struct {
+		name     string
+		users    map[string]string
+		groups   map[string]string
+		username string
+		groupsIn []string
+	}{
+		{
+			name:     "user mapped by name",
+			users:    map[string]string{current.Username: "admin"},
+			groups:   map[string]string{current.Gid: "operators"},
+			username: "admin",
+		},
+		{
+			name:     "user mapped by id",
+			users:    map[string]string{current.Uid: "admin"},
+			username: "admin",
+		},
+		{
+			name:     "group mapped by name",
+			groups:   map[string]string{primary.Name: "operators"},
+			username: PeerUserPrefix + current.Username,
+			groupsIn: []string{"operators"},
+		},
+		{
+			name:     "group mapped by id",
+			groups:   map[string]string{current.Gid: "operators"},
+			username: PeerUserPrefix + current.Username,
+			groupsIn: []string{"operators"},
+		},
+		{
+			name:   "not mapped",
+			users:  map[string]string{"nobody-" + current.Username: "admin"},
+			groups: map[string]string{"nogroup-" + primary.Name: "operators"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := &peerMapper{
+				users:  tt.users,
+				groups: tt.groups,
+				lookupUser: func(username string) (*authndb.User, error) {
+					return &authndb.User{Username: username, Password: "secret"}, nil
+				},
+			}
+			u, err := mapper.identify(creds)
+			require.NoError(t, err)
+			if tt.username == "" {
+				assert.Nil(t, u)
+				return
+			}
+			require.NotNil(t, u)
+			assert.Equal(t, tt.username, u.Username)
+			assert.Equal(t, tt.groupsIn, u.Groups)
+		})
+	}
+}
+
+func TestUnixAdapterPeerAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gid := os.Getgid()
+	tests := []struct {
+		name       string
+		groups     map[string]string
+		wantStatus int
+		wantPeer   bool
+	}{
+		{name: "mapped peer", groups: map[string]string{strconv.Itoa(gid): "operators"}, wantStatus: http.StatusOK, wantPeer: true},
+		{name: "unmapped peer", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.sock")
+			ctrl := mockControllerWithCORS(false, nil)
+			ctrl.Config = mockUnixConfig(path, nil, tt.groups)
+			tls := make(map[string]basic.TLSInfo)
+			adapter, err := NewUnixAdapter(ctrl, &tls)
+			require.NoError(t, err)
+			unixAdapter := adapter.(*Adapter)
+
+			echo := func(in *endpoint.Request) (*endpoint.Response, error) {
+				return &endpoint.Response{Value: []byte(in.Metadata[types.ContextAuthPeer.String()])}, nil
+			}
+			unixAdapter.shim(http.MethodGet, endpoint.NewEndpoint("whoami", endpoint.ActionRead, "whoami", echo, true, ""))
+
+			require.NoError(t, unixAdapter.Start(context.Background()))
+			defer unixAdapter.Stop(context.Background())
+
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+			}}
+			resp, err := client.Get("http://localhost/whoami")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if !tt.wantPeer {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			var out struct {
+				Response authndb.User `json:"response"`
+			}
+			require.NoError(t, json.Unmarshal(body, &out))
+			assert.Equal(t, []string{"operators"}, out.Response.Groups)
+			assert.Contains(t, out.Response.Username, PeerUserPrefix)
+		})
+	}
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "agent.sock")
+
+	ln, err := listenUnix(path, 0660, -1)
+	require.NoError(t, err)
+
+	// A socket that is still being served isn't replaced
+	_, err = listenUnix(path, 0660, -1)
+	assert.ErrorContains(t, err, "already in use")
+
+	// A socket left behind by a previous run is replaced
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	ln, err = listenUnix(path, 0660, -1)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	// Other files are left alone
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	_, err = listenUnix(path, 0660, -1)
+	assert.ErrorContains(t, err, "not a socket")
+}
@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// writeWait is the time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong message from the client
+	pongWait = 60 * time.Second
+	// pingPeriod is how often pings are sent to the client, it must be less than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize is the maximum size of a message read from the client
+	maxMessageSize = 16 << 20
+)
+
+// Message types sent by the client
+const (
+	// MessageCall calls an endpoint once, the result is returned in a result or error message
+	MessageCall = "call"
+	// MessageSubscribe subscribes to a streaming endpoint, or to a read endpoint which is called at the given interval.
+	// Each value is returned in an event message until the subscription completes, fails or is canceled.
+	MessageSubscribe = "subscribe"
+	// MessageCancel cancels the call or subscription with the same id
+	MessageCancel = "cancel"
+	// MessageAuth replaces the token used by the session, it is used to authenticate in-band and to refresh the token
+	// before it expires. Subscriptions use the new token from their next call.
+	MessageAuth = "auth"
+)
+
+// Message types sent by the server
+const (
+	// MessageResult holds the result of a call
+	MessageResult = "result"
+	// MessageEvent holds a value produced by a subscription
+	MessageEvent = "event"
+	// MessageError holds the error that ended a call or subscription, or that caused a message to be rejected
+	MessageError = "error"
+	// MessageComplete is sent when a subscription ends without an error
+	MessageComplete = "complete"
+	// MessageAck acknowledges auth and subscribe messages
+	MessageAck = "ack"
+)
+
+// ClientMessage is a message sent by the client. The id is chosen by the client and is used to match the messages
+// sent by the server to the call or subscription they belong to, so it must be unique among the calls and
+// subscriptions in progress on the connection.
+type ClientMessage struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Method   string   `json:"method,omitempty"`
+	Request  *Request `json:"request,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+	Interval string   `json:"interval,omitempty"`
+	Token    string   `json:"token,omitempty"`
+}
+
+// Request holds the headers, parameters and body passed to the endpoint
+type Request struct {
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Parameters map[string][]string `json:"parameters,omitempty"`
+	Body       json.RawMessage     `json:"body,omitempty"`
+}
+
+// ServerMessage is a message sent by the server
+type ServerMessage struct {
+	ID      string              `json:"id"`
+	Type    string              `json:"type"`
+	Value   json.RawMessage     `json:"value,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Error   *endpoint.Error     `json:"error,omitempty"`
+}
+
+// session is a single WebSocket connection. Messages are read one at a time and each call or subscription runs in its
+// own goroutine so a slow call doesn't hold up the others.
+type session struct {
+	adapter   *Adapter
+	conn      *websocket.Conn
+	logger    *zap.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	token     string
+	remote    string
+	ops       map[string]context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// newSession creates a new session for the connection using the token, if any, supplied when it was opened
+func newSession(a *Adapter, conn *websocket.Conn, token string) *session {
+	ctx, cancel := context.WithCancel(a.ctx)
+	return &session{
+		adapter: a,
+		conn:    conn,
+		logger:  a.logger.With(zap.String("remote", conn.RemoteAddr().String())),
+		ctx:     ctx,
+		cancel:  cancel,
+		token:   token,
+		remote:  helpers.RemoteHost(conn.RemoteAddr().String()),
+		ops:     make(map[string]context.CancelFunc),
+	}
+}
+
+// run reads messages until the connection is closed, then cancels any calls and subscriptions still in progress
+func (s *session) run() {
+	defer func() {
+		s.cancel()
+		s.wg.Wait()
+		s.conn.Close()
+	}()
+
+	s.conn.SetReadLimit(maxMessageSize)
+	_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go s.ping()
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.Debug("connection closed", zap.Error(err))
+			}
+			return
+		}
+
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendError("", endpoint.InvalidArgumentError("invalid message: %v", err))
+			continue
+		}
+		s.dispatch(&msg)
+	}
+}
+
+// dispatch handles a single message from the client
+func (s *session) dispatch(msg *ClientMessage) {
+	switch msg.Type {
+	case MessageCall:
+		s.start(msg, s.call)
+	case MessageSubscribe:
+		s.start(msg, s.subscribe)
+	case MessageCancel:
+		s.mu.Lock()
+		cancel, ok := s.ops[msg.ID]
+		s.mu.Unlock()
+		if !ok {
+			s.sendError(msg.ID, endpoint.Errorf(endpoint.ErrorCodeNotFound, "no call or subscription with id '%s'", msg.ID))
+			return
+		}
+		cancel()
+	case MessageAuth:
+		token := msg.Token
+		if token == "" {
+			s.sendError(msg.ID, endpoint.InvalidArgumentError("token is required"))
+			return
+		}
+		if !helpers.HasAuthScheme(token) {
+			token = "Bearer " + token
+		}
+		if err := s.verifyToken(token); err != nil {
+			s.sendError(msg.ID, err)
+			return
+		}
+		s.mu.Lock()
+		s.token = token
+		s.mu.Unlock()
+		s.send(&ServerMessage{ID: msg.ID, Type: MessageAck})
+	default:
+		s.sendError(msg.ID, endpoint.InvalidArgumentError("unknown message type '%s'", msg.Type))
+	}
+}
+
+// start runs the call or subscription in its own goroutine. It is registered under the message id until it
+// completes so it can be canceled.
+func (s *session) start(msg *ClientMessage, fn func(ctx context.Context, msg *ClientMessage)) {
+	if msg.ID == "" {
+		s.sendError("", endpoint.InvalidArgumentError("id is required"))
+		return
+	}
+
+	s.mu.Lock()
+	if _, exists := s.ops[msg.ID]; exists {
+		s.mu.Unlock()
+		s.sendError(msg.ID, endpoint.Errorf(endpoint.ErrorCodeConflict, "id '%s' is already in use", msg.ID))
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.ops[msg.ID] = cancel
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.ops, msg.ID)
+			s.mu.Unlock()
+			cancel()
+			s.wg.Done()
+		}()
+		fn(ctx, msg)
+	}()
+}
+
+// call calls the endpoint once and sends the result
+func (s *session) call(ctx context.Context, msg *ClientMessage) {
+	ep, in, err := s.prepare(msg)
+	if err != nil {
+		s.sendError(msg.ID, err)
+		return
+	}
+	if ep.Streaming {
+		s.sendError(msg.ID, endpoint.InvalidArgumentError("%s, use a subscription instead", endpoint.ErrStreamingEndpoint))
+		return
+	}
+	timeout, err := endpoint.ParseTimeout(msg.Timeout)
+	if err != nil {
+		s.sendError(msg.ID, err)
+		return
+	}
+
+	out, err := s.invoke(ctx, ep, in, timeout)
+	if err != nil {
+		s.sendError(msg.ID, err)
+		return
+	}
+	s.send(&ServerMessage{ID: msg.ID, Type: MessageResult, Value: helpers.ResponseValue(out), Headers: out.Headers})
+}
+
+// subscribe sends the values produced by a streaming endpoint, or calls a read endpoint at the requested interval,
+// until the subscription is canceled. Failed calls to a read endpoint end the subscription unless the error is
+// retryable.
+func (s *session) subscribe(ctx context.Context, msg *ClientMessage) {
+	ep, in, err := s.prepare(msg)
+	if err != nil {
+		s.sendError(msg.ID, err)
+		return
+	}
+
+	if ep.Streaming {
+		s.send(&ServerMessage{ID: msg.ID, Type: MessageAck})
+		ctx, cancel := ep.CallContext(ctx, 0)
+		defer cancel()
+		err := ep.Stream(s.authenticate(in).WithContext(ctx), func(out *endpoint.Response) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s.send(&ServerMessage{ID: msg.ID, Type: MessageEvent, Value: helpers.ResponseValue(out), Headers: out.Headers})
+			return nil
+		})
+		s.finish(ctx, msg.ID, err)
+		return
+	}
+
+	if ep.Action != endpoint.ActionRead {
+		s.sendError(msg.ID, endpoint.InvalidArgumentError("only read and streaming endpoints can be subscribed to"))
+		return
+	}
+	interval, err := time.ParseDuration(msg.Interval)
+	if err != nil || interval < s.adapter.minInterval {
+		s.sendError(msg.ID, endpoint.InvalidArgumentError("interval must be a duration of at least %s", s.adapter.minInterval).
+			WithDetail("field", "interval"))
+		return
+	}
+	timeout, err := endpoint.ParseTimeout(msg.Timeout)
+	if err != nil {
+		s.sendError(msg.ID, err)
+		return
+	}
+
+	s.send(&ServerMessage{ID: msg.ID, Type: MessageAck})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		out, err := s.invoke(ctx, ep, in, timeout)
+		if err != nil && (ctx.Err() != nil || !endpoint.AsError(err).Retryable) {
+			s.finish(ctx, msg.ID, err)
+			return
+		}
+		if err != nil {
+			s.sendError(msg.ID, err)
+		} else {
+			s.send(&ServerMessage{ID: msg.ID, Type: MessageEvent, Value: helpers.ResponseValue(out), Headers: out.Headers})
+		}
+
+		select {
+		case <-ctx.Done():
+			s.finish(ctx, msg.ID, nil)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finish sends the message that ends a subscription. Subscriptions that end because they were canceled complete
+// normally.
+func (s *session) finish(ctx context.Context, id string, err error) {
+	if err != nil && ctx.Err() == nil {
+		s.sendError(id, err)
+		return
+	}
+	s.send(&ServerMessage{ID: id, Type: MessageComplete})
+}
+
+// prepare finds the endpoint for the message and creates the request passed to it
+func (s *session) prepare(msg *ClientMessage) (*endpoint.Endpoint, *endpoint.Request, error) {
+	// Find the endpoint, matching templated paths such as 'read:auth/users/1' to 'read:auth/users/{id}'
+	key, pathParams, ok := endpoint.MatchMethod(s.adapter.endpoints, msg.Method)
+	if !ok {
+		return nil, nil, endpoint.Errorf(endpoint.ErrorCodeNotFound, "method '%s' not found", msg.Method)
+	}
+	ep := s.adapter.endpoints[key]
+
+	in := &endpoint.Request{
+		Metadata:   make(map[string]string),
+		Headers:    make(map[string][]string),
+		Parameters: make(map[string][]string),
+	}
+	if msg.Request != nil {
+		for name, values := range msg.Request.Headers {
+			in.Headers[name] = values
+		}
+		for name, values := range msg.Request.Parameters {
+			in.Parameters[name] = values
+		}
+		in.Body = msg.Request.Body
+	}
+	in.SetPathParameters(pathParams)
+	in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+	in.Metadata[types.ContextResourcePath.String()] = ep.Path
+
+	return ep, in, nil
+}
+
+// invoke calls the endpoint with the session's current token
+func (s *session) invoke(ctx context.Context, ep *endpoint.Endpoint, in *endpoint.Request, timeout time.Duration) (*endpoint.Response, error) {
+	return helpers.CallEndpoint(ctx, ep, s.authenticate(in), timeout)
+}
+
+// authenticate returns a copy of the request carrying the session's current token. A copy is used since the
+// middleware adds metadata to the request and subscriptions reuse it for every call.
+func (s *session) authenticate(in *endpoint.Request) *endpoint.Request {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+
+	out := in.WithContext(in.Context())
+	out.Metadata = make(map[string]string, len(in.Metadata)+1)
+	for key, value := range in.Metadata {
+		out.Metadata[key] = value
+	}
+	if token != "" {
+		out.Metadata[types.ContextAuthHeader.String()] = token
+	}
+	if s.remote != "" {
+		out.Metadata[types.ContextRemoteAddr.String()] = s.remote
+	}
+	return out
+}
+
+// verifyToken runs the token through the authentication middleware so that a bad token is reported in reply to the
+// auth message instead of by the next call. Only authentication errors are returned, whether the token may be used
+// for an endpoint is checked by each call.
+func (s *session) verifyToken(token string) error {
+	if s.adapter.authn == nil {
+		return nil
+	}
+	ep := endpoint.Endpoint{Secure: true, Function: func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{}, nil
+	}}
+	in := &endpoint.Request{Metadata: map[string]string{types.ContextAuthHeader.String(): token}}
+	if s.remote != "" {
+		in.Metadata[types.ContextRemoteAddr.String()] = s.remote
+	}
+	_, err := s.adapter.authn.Handler(ep)(in.WithContext(s.ctx))
+	if endpoint.ErrorCodeOf(err) == endpoint.ErrorCodeUnauthenticated {
+		return err
+	}
+	return nil
+}
+
+// send writes the message to the client. Writes are serialized since a connection supports one writer at a time.
+func (s *session) send(msg *ServerMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := s.conn.WriteJSON(msg); err != nil {
+		s.logger.Debug("failed to write message", zap.String("id", msg.ID), zap.Error(err))
+	}
+}
+
+// sendError writes an error message to the client
+func (s *session) sendError(id string, err error) {
+	s.send(&ServerMessage{ID: id, Type: MessageError, Error: endpoint.AsError(err)})
+}
+
+// ping sends pings to the client until the session ends so dead connections are detected
+func (s *session) ping() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close sends a close message and closes the connection which ends the session
+func (s *session) close(code int, reason string) {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.writeMu.Lock()
+		_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		s.writeMu.Unlock()
+		s.conn.Close()
+	})
+}
@@ -0,0 +1,260 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/internal/mtls"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewAdapter creates a new WebSocket adapter. The adapter is nil when the WebSocket API is not enabled.
+func NewAdapter(c *controller.Controller, tls *map[string]basic.TLSInfo) (adapter interfaces.APIAdapter, err error) {
+	// Check to see if the WebSocket API is enabled. If not there is no adapter to create
+	if !c.Config.APIs.WebSocket.Enabled {
+		return nil, nil
+	}
+
+	// Setup logger
+	name := "api/websocket"
+	logger := c.Logger.With(zap.String("module", name))
+
+	r := &Adapter{
+		controller: c,
+		logger:     logger,
+		tls:        tls,
+		name:       name,
+		endpoints:  make(map[string]*endpoint.Endpoint),
+		sessions:   make(map[*session]struct{}),
+	}
+	return r, r.setup()
+}
+
+// Adapter is the WebSocket API adapter. Each connection is a session that can make any number of concurrent calls
+// and subscriptions, see session for the details of the protocol.
+type Adapter struct {
+	server      *http.Server
+	listener    net.Listener
+	upgrader    websocket.Upgrader
+	tlsConfig   *tls.Config
+	tls         *map[string]basic.TLSInfo
+	controller  *controller.Controller
+	logger      *zap.Logger
+	endpoints   map[string]*endpoint.Endpoint
+	authn       middleware.Middleware
+	minInterval time.Duration
+	name        string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	sessions    map[*session]struct{}
+	wg          sync.WaitGroup
+}
+
+// Name returns the name of the WebSocket API adapter
+func (a *Adapter) Name() string {
+	return a.name
+}
+
+// Register registers the subsystems with the API adapter
+func (a *Adapter) Register(subsystems []interfaces.Subsystem) (err error) {
+	// Iterate over the subsystems and register each of the endpoints
+	for _, subsystem := range subsystems {
+		a.logger.Debug("registering subsystem", zap.String("subsystem", subsystem.Name()))
+
+		// The authentication middleware is kept to check the tokens sent in auth messages
+		if m, ok := subsystem.(middleware.Middleware); ok && subsystem.Enabled() {
+			if _, ok := subsystem.(middleware.AuthenticationMiddleware); ok {
+				a.authn = m
+			}
+		}
+		if subsystem.Enabled() {
+			for _, ep := range subsystem.Endpoints() {
+				a.logger.Debug("registering endpoint", zap.String("path", ep.Path), zap.Any("action", ep.Action))
+				method := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+				a.endpoints[method] = ep
+			}
+		}
+	}
+
+	return nil
+}
+
+// Start starts the WebSocket API adapter
+func (a *Adapter) Start(ctx context.Context) (err error) {
+	ln, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	srvMsg := "starting WebSocket server"
+	if a.tlsConfig != nil {
+		ln = tls.NewListener(ln, a.tlsConfig)
+		srvMsg = "starting secure WebSocket server"
+	}
+	a.listener = ln
+
+	a.logger.Info(srvMsg, zap.String("addr", ln.Addr().String()))
+	go func() {
+		err := a.server.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Fatal("failed to start server", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the WebSocket API adapter
+func (a *Adapter) Stop(ctx context.Context) (err error) {
+	if a.listener == nil {
+		return nil
+	}
+	a.cancel()
+	err = a.server.Shutdown(ctx)
+
+	// Hijacked connections aren't closed by the server so close the sessions as well
+	a.mu.Lock()
+	for s := range a.sessions {
+		s.close(websocket.CloseGoingAway, "server is shutting down")
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	return err
+}
+
+func (a *Adapter) setup() (err error) {
+	cfg := a.controller.Config.APIs.WebSocket
+	if err := mtls.Unsupported(cfg.TLS, "WebSocket"); err != nil {
+		return err
+	}
+
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           http.HandlerFunc(a.serveHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	a.upgrader = websocket.Upgrader{CheckOrigin: a.checkOrigin}
+
+	a.minInterval = time.Second
+	if cfg.MinInterval != "" {
+		if a.minInterval, err = time.ParseDuration(cfg.MinInterval); err != nil {
+			return fmt.Errorf("invalid minimum subscription interval: %w", err)
+		}
+	}
+
+	if cfg.TLS.Enabled {
+		profile, ok := (*a.tls)[cfg.TLS.Profile]
+		if !ok {
+			return errors.New("tls profile not found")
+		}
+		cert, err := tls.LoadX509KeyPair(profile.CertFilename, profile.KeyFilename)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS keys: %v", err)
+		}
+		a.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"http/1.1"}}
+	}
+
+	return nil
+}
+
+// serveHTTP upgrades the request to a WebSocket connection and runs the session until the connection is closed. The
+// session starts with the token from the Authorization header or the access_token query parameter, if either is set.
+func (a *Adapter) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written the error response
+		a.logger.Debug("failed to upgrade connection", zap.Error(err))
+		return
+	}
+
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		if value := r.URL.Query().Get("access_token"); value != "" {
+			token = "Bearer " + value
+		}
+	}
+
+	s := newSession(a, conn, token)
+	a.mu.Lock()
+	if a.ctx.Err() != nil {
+		a.mu.Unlock()
+		s.close(websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	a.sessions[s] = struct{}{}
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	s.run()
+
+	a.mu.Lock()
+	delete(a.sessions, s)
+	a.mu.Unlock()
+	a.wg.Done()
+}
+
+// ReloadKeys returns the settings the adapter applies live
+func (a *Adapter) ReloadKeys() []string {
+	return []string{"apis.websocket.allowed_origins"}
+}
+
+// Reload has nothing to do, the allowed origins are read from the configuration on every request
+func (a *Adapter) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	return nil, nil
+}
+
+// checkOrigin allows requests without an origin, same origin requests and requests from the allowed origins
+func (a *Adapter) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	a.controller.Config.RLock()
+	origins := a.controller.Config.APIs.WebSocket.AllowedOrigins
+	a.controller.Config.RUnlock()
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// NOTE:
+// Example testing from command line using websocat
+//
+// Connect with a token and call a secured endpoint
+// websocat -k -H 'Authorization: <access_token>' wss://127.0.0.1:8183/
+// {"id": "1", "type": "call", "method": "read:diag/"}
+//
+// Login in-band and use the returned token for the rest of the session (also used to refresh an expiring token)
+// {"id": "1", "type": "call", "method": "create:auth/login", "request": {"body": {"username": "<username>", "password": "<password>"}}}
+// {"id": "2", "type": "auth", "token": "<access_token_from_above_request>"}
+//
+// Call with path and query parameters and a deadline
+// {"id": "3", "type": "call", "method": "read:auth/users/1", "request": {"parameters": {"verbose": ["true"]}}, "timeout": "5s"}
+//
+// Re-invoke a read endpoint every 5 seconds until canceled
+// {"id": "4", "type": "subscribe", "method": "read:hardware/cpu", "interval": "5s"}
+// {"id": "4", "type": "cancel"}
+//
+// Subscribe to a streaming endpoint
+// {"id": "5", "type": "subscribe", "method": "read:plugins/iperf/client/live", "request": {"parameters": {"id": ["<client_id>"]}}}
@@ -0,0 +1,287 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/adapters/adaptertest"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdapter(t *testing.T) *Adapter {
+	t.Helper()
+	whoami := func(in *endpoint.Request) (*endpoint.Response, error) {
+		auth := in.Metadata[types.ContextAuthHeader.String()]
+		if auth == "" {
+			return nil, endpoint.Errorf(endpoint.ErrorCodeUnauthenticated, "authorization header is missing")
+		}
+		value, err := json.Marshal(map[string]interface{}{"auth": auth, "id": in.Parameters["id"]})
+		return &endpoint.Response{Value: value}, err
+	}
+	stream := func(in *endpoint.Request, send endpoint.StreamSender) error {
+		for idx := 1; idx <= 3; idx++ {
+			if err := send(&endpoint.Response{Value: []byte{'0' + byte(idx)}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	create := func(in *endpoint.Request) (*endpoint.Response, error) { return &endpoint.Response{}, nil }
+
+	apis := config.APIEntries{WebSocket: config.WebSocketAPIEntry{
+		Enabled:        true,
+		AllowedOrigins: []string{"https://console.example.com"},
+	}}
+	a := adaptertest.NewAdapter(t, NewAdapter, apis,
+		endpoint.NewEndpoint("test/whoami", endpoint.ActionRead, "whoami", whoami, true, ""),
+		endpoint.NewEndpoint("test/users/{id}", endpoint.ActionRead, "whoami", whoami, true, ""),
+		endpoint.NewEndpoint("test/slow", endpoint.ActionRead, "slow", adaptertest.Slow, false, ""),
+		endpoint.NewEndpoint("test/items", endpoint.ActionCreate, "create", create, false, ""),
+		endpoint.NewStreamEndpoint("test/stream", endpoint.ActionRead, "stream", stream, false, ""),
+	).(*Adapter)
+	a.minInterval = 10 * time.Millisecond
+	return a
+}
+
+// dial connects to the adapter and returns the connection
+func dial(t *testing.T, a *Adapter, header http.Header) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(a.serveHTTP))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", header)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func exchange(t *testing.T, conn *websocket.Conn, msg string) *ServerMessage {
+	t.Helper()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+	return read(t, conn)
+}
+
+func read(t *testing.T, conn *websocket.Conn) *ServerMessage {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg ServerMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return &msg
+}
+
+func TestCall(t *testing.T) {
+	a := newTestAdapter(t)
+	conn := dial(t, a, http.Header{"Authorization": []string{"Bearer connect"}})
+
+	tests := []struct {
+		name    string
+		message string
+		msgType string
+		code    endpoint.ErrorCode
+		value   string
+	}{
+		{name: "call", message: `{"id":"1","type":"call","method":"read:test/users/42"}`, msgType: MessageResult, value: `{"auth":"Bearer connect","id":["42"]}`},
+		{name: "empty value", message: `{"id":"1","type":"call","method":"create:test/items"}`, msgType: MessageResult},
+		{name: "unknown method", message: `{"id":"1","type":"call","method":"read:test/missing"}`, msgType: MessageError, code: endpoint.ErrorCodeNotFound},
+		{name: "streaming", message: `{"id":"1","type":"call","method":"read:test/stream"}`, msgType: MessageError, code: endpoint.ErrorCodeInvalidArgument},
+		{name: "deadline", message: `{"id":"1","type":"call","method":"read:test/slow","timeout":"10ms"}`, msgType: MessageError, code: endpoint.ErrorCodeDeadlineExceeded},
+		{name: "missing id", message: `{"type":"call","method":"read:test/whoami"}`, msgType: MessageError, code: endpoint.ErrorCodeInvalidArgument},
+		{name: "unknown type", message: `{"id":"1","type":"publish"}`, msgType: MessageError, code: endpoint.ErrorCodeInvalidArgument},
+		{name: "invalid message", message: `{"id":`, msgType: MessageError, code: endpoint.ErrorCodeInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := exchange(t, conn, tt.message)
+			assert.Equal(t, tt.msgType, msg.Type)
+			if tt.code != "" {
+				require.NotNil(t, msg.Error)
+				assert.Equal(t, tt.code, msg.Error.Code)
+				return
+			}
+			assert.Nil(t, msg.Error)
+			if tt.value != "" {
+				assert.JSONEq(t, tt.value, string(msg.Value))
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	a := newTestAdapter(t)
+	conn := dial(t, a, nil)
+
+	msg := exchange(t, conn, `{"id":"1","type":"call","method":"read:test/whoami"}`)
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, endpoint.ErrorCodeUnauthenticated, msg.Error.Code)
+
+	// Tokens without a scheme are sent as bearer tokens
+	msg = exchange(t, conn, `{"id":"2","type":"auth","token":"first"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+	msg = exchange(t, conn, `{"id":"3","type":"call","method":"read:test/whoami"}`)
+	assert.JSONEq(t, `{"auth":"Bearer first","id":null}`, string(msg.Value))
+
+	msg = exchange(t, conn, `{"id":"4","type":"auth","token":"Bearer second"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+	msg = exchange(t, conn, `{"id":"5","type":"call","method":"read:test/whoami"}`)
+	assert.JSONEq(t, `{"auth":"Bearer second","id":null}`, string(msg.Value))
+}
+
+// tokenAuthn is an authentication middleware that only accepts the token it was created with
+type tokenAuthn struct {
+	token string
+}
+
+func (m *tokenAuthn) Name() string                  { return "auth" }
+func (m *tokenAuthn) Priority() middleware.Priority { return middleware.PriorityAuthentication }
+func (m *tokenAuthn) Handler(ep endpoint.Endpoint) endpoint.Func {
+	return m.AuthenticationHandler(ep.Function)
+}
+func (m *tokenAuthn) AuthenticationHandler(next endpoint.Func) endpoint.Func {
+	return func(in *endpoint.Request) (*endpoint.Response, error) {
+		if in.Metadata[types.ContextAuthHeader.String()] != m.token {
+			return nil, endpoint.UnauthenticatedError("invalid token")
+		}
+		return next(in)
+	}
+}
+
+func TestAuthInvalidToken(t *testing.T) {
+	a := newTestAdapter(t)
+	a.authn = &tokenAuthn{token: "Bearer valid"}
+	conn := dial(t, a, nil)
+
+	// A token that doesn't authenticate is rejected and the session keeps its previous token
+	msg := exchange(t, conn, `{"id":"1","type":"auth","token":"valid"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+	msg = exchange(t, conn, `{"id":"2","type":"auth","token":"expired"}`)
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, endpoint.ErrorCodeUnauthenticated, msg.Error.Code)
+	msg = exchange(t, conn, `{"id":"3","type":"call","method":"read:test/whoami"}`)
+	assert.JSONEq(t, `{"auth":"Bearer valid","id":null}`, string(msg.Value))
+}
+
+func TestMultiplexedCalls(t *testing.T) {
+	a := newTestAdapter(t)
+	conn := dial(t, a, http.Header{"Authorization": []string{"Bearer connect"}})
+
+	// The slow call doesn't block the calls sent after it
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"slow","type":"call","method":"read:test/slow"}`)))
+	msg := exchange(t, conn, `{"id":"slow","type":"call","method":"read:test/whoami"}`)
+	assert.Equal(t, "slow", msg.ID)
+	assert.Equal(t, endpoint.ErrorCodeConflict, msg.Error.Code)
+	msg = exchange(t, conn, `{"id":"fast","type":"call","method":"read:test/whoami"}`)
+	assert.Equal(t, "fast", msg.ID)
+	assert.Equal(t, MessageResult, msg.Type)
+
+	msg = exchange(t, conn, `{"id":"slow","type":"cancel"}`)
+	assert.Equal(t, "slow", msg.ID)
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, endpoint.ErrorCodeCanceled, msg.Error.Code)
+
+	msg = exchange(t, conn, `{"id":"slow","type":"cancel"}`)
+	assert.Equal(t, endpoint.ErrorCodeNotFound, msg.Error.Code)
+}
+
+func TestSubscribe(t *testing.T) {
+	a := newTestAdapter(t)
+	conn := dial(t, a, http.Header{"Authorization": []string{"Bearer connect"}})
+
+	msg := exchange(t, conn, `{"id":"sub","type":"subscribe","method":"read:test/whoami","interval":"10ms"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+	for idx := 0; idx < 3; idx++ {
+		msg = read(t, conn)
+		assert.Equal(t, "sub", msg.ID)
+		assert.Equal(t, MessageEvent, msg.Type)
+	}
+
+	// Refreshing the token applies to the subscription's next call
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"auth","type":"auth","token":"Bearer refreshed"}`)))
+	for msg = read(t, conn); msg.ID != "sub" || !strings.Contains(string(msg.Value), "refreshed"); msg = read(t, conn) {
+	}
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"sub","type":"cancel"}`)))
+	for msg = read(t, conn); msg.Type == MessageEvent; msg = read(t, conn) {
+	}
+	assert.Equal(t, "sub", msg.ID)
+	assert.Equal(t, MessageComplete, msg.Type)
+
+	msg = exchange(t, conn, `{"id":"fast","type":"subscribe","method":"read:test/whoami","interval":"1ms"}`)
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, msg.Error.Code)
+	msg = exchange(t, conn, `{"id":"create","type":"subscribe","method":"create:test/items","interval":"1s"}`)
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, msg.Error.Code)
+}
+
+func TestSubscribeStream(t *testing.T) {
+	a := newTestAdapter(t)
+	conn := dial(t, a, nil)
+
+	msg := exchange(t, conn, `{"id":"stream","type":"subscribe","method":"read:test/stream"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+	for idx := 1; idx <= 3; idx++ {
+		msg = read(t, conn)
+		assert.Equal(t, MessageEvent, msg.Type)
+		assert.JSONEq(t, string(rune('0'+idx)), string(msg.Value))
+	}
+	msg = read(t, conn)
+	assert.Equal(t, MessageComplete, msg.Type)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	a := newTestAdapter(t)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "", allowed: true},
+		{origin: "https://console.example.com", allowed: true},
+		{origin: "http://agent.local:8183", allowed: true},
+		{origin: "https://evil.example.com", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://agent.local:8183/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			assert.Equal(t, tt.allowed, a.checkOrigin(req))
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	a := newTestAdapter(t)
+	a.server.Addr = "127.0.0.1:0"
+	require.NoError(t, a.Start(context.Background()))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+a.listener.Addr().String()+"/", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	msg := exchange(t, conn, `{"id":"stream","type":"subscribe","method":"read:test/whoami","interval":"1s"}`)
+	assert.Equal(t, MessageAck, msg.Type)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, a.Stop(ctx))
+
+	// The session is closed once the subscription has been canceled
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err.Error())
+}
@@ -0,0 +1,259 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+// APIKeyPrefix is the prefix of every API key, it tells keys apart from JWTs in the authorization header
+const APIKeyPrefix = "dtac_"
+
+// apiKeyTouchInterval limits how often the last used time of a key is written to the database
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyArgs is the struct for the API key arguments validation
+type APIKeyArgs struct {
+	Name      string   `json:"name"`                 // Name describing what the key is used for
+	UserID    int      `json:"user_id,omitempty"`    // Owner of the key, only admins can create keys for other users
+	ExpiresIn string   `json:"expires_in,omitempty"` // Duration until the key expires, such as 720h, or never
+	Paths     []string `json:"paths,omitempty"`      // Endpoint paths the key is restricted to, wildcards allowed
+	Actions   []string `json:"actions,omitempty"`    // Endpoint actions the key is restricted to
+}
+
+// APIKeyIDArgs is the struct for the arguments of requests about a single API key
+type APIKeyIDArgs struct {
+	ID string `json:"-" param:"id,required"`
+}
+
+// APIKeyOutput is the API key returned when it is created or rotated, this is the only time the key is shown
+type APIKeyOutput struct {
+	authndb.APIKey
+	Key string `json:"key"`
+}
+
+func (s *Subsystem) createAPIKey(ctx context.Context, args APIKeyArgs) (*APIKeyOutput, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	caller, admin := requestCaller(in)
+
+	if args.Name == "" {
+		return nil, endpoint.InvalidArgumentError("missing name")
+	}
+	if args.UserID == 0 {
+		args.UserID = caller.ID
+	}
+	if args.UserID != caller.ID && !admin {
+		return nil, endpoint.PermissionDeniedError("only admins can create api keys for other users")
+	}
+	if _, err := s.Controller.AuthDB.ViewUser(args.UserID); err != nil {
+		return nil, endpoint.InvalidArgumentError("api keys must be owned by a user in the database: %w", err)
+	}
+
+	key := &authndb.APIKey{
+		Name:      args.Name,
+		UserID:    args.UserID,
+		CreatedAt: time.Now(),
+	}
+	for _, p := range args.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, endpoint.InvalidArgumentError("invalid path '%s': %w", p, err)
+		}
+		key.Paths = append(key.Paths, strings.Trim(p, "/"))
+	}
+	for _, a := range args.Actions {
+		action, err := endpoint.ParseAction(a)
+		if err != nil {
+			return nil, endpoint.InvalidArgumentError("%w", err)
+		}
+		key.Actions = append(key.Actions, action.String())
+	}
+	if args.ExpiresIn != "" {
+		expiration, err := s.parseTokenExpiration(args.ExpiresIn)
+		if err != nil {
+			return nil, endpoint.InvalidArgumentError("invalid expires_in: %w", err)
+		}
+		if expiration > 0 {
+			expires := key.CreatedAt.Add(expiration)
+			key.ExpiresAt = &expires
+		}
+	}
+
+	// The ID is the public part of the key used to find it, the secret is only stored as a hash
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key.ID = hex.EncodeToString(id)
+	secret, err := s.newAPIKeySecret(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.UpdateAPIKey(key); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("api key created", zap.String("id", key.ID), zap.String("name", key.Name), zap.Int("user_id", key.UserID))
+	return apiKeyOutput(key, secret), nil
+}
+
+func (s *Subsystem) listAPIKeys(ctx context.Context, _ endpoint.Empty) ([]*authndb.APIKey, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	caller, admin := requestCaller(in)
+
+	all, err := s.Controller.AuthDB.SafeViewAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*authndb.APIKey, 0, len(all))
+	for _, key := range all {
+		if admin || key.UserID == caller.ID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *Subsystem) revokeAPIKey(ctx context.Context, args APIKeyIDArgs) (*authndb.APIKey, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	key, err := s.lookupAPIKey(in, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.DeleteAPIKey(key.ID); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("api key revoked", zap.String("id", key.ID), zap.String("name", key.Name), zap.Int("user_id", key.UserID))
+	key.Hash = ""
+	return key, nil
+}
+
+func (s *Subsystem) rotateAPIKey(ctx context.Context, args APIKeyIDArgs) (*APIKeyOutput, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	key, err := s.lookupAPIKey(in, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key keeps its ID and restrictions, the old secret stops working immediately
+	secret, err := s.newAPIKeySecret(key)
+	if err != nil {
+		return nil, err
+	}
+	rotated := time.Now()
+	key.RotatedAt = &rotated
+	if err := s.Controller.AuthDB.UpdateAPIKey(key); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("api key rotated", zap.String("id", key.ID), zap.String("name", key.Name), zap.Int("user_id", key.UserID))
+	return apiKeyOutput(key, secret), nil
+}
+
+// lookupAPIKey returns the key if it exists and is owned by the caller, admins can see every key
+func (s *Subsystem) lookupAPIKey(in *endpoint.Request, id string) (*authndb.APIKey, error) {
+	key, err := s.Controller.AuthDB.ViewAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if caller, admin := requestCaller(in); !admin && key.UserID != caller.ID {
+		return nil, endpoint.NotFoundError("api key %s not found", id)
+	}
+	return key, nil
+}
+
+// newAPIKeySecret sets the hash of a new secret on the key and returns the secret
+func (s *Subsystem) newAPIKeySecret(key *authndb.APIKey) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = hashAPIKeySecret(encoded)
+	return encoded, nil
+}
+
+// authorizeAPIKey returns the owner of the API key if the key is valid and permitted to access the requested resource
+func (s *Subsystem) authorizeAPIKey(token string, in *endpoint.Request) (*authndb.User, error) {
+	id, secret, _ := strings.Cut(strings.TrimPrefix(token, APIKeyPrefix), "_")
+	key, err := s.Controller.AuthDB.ViewAPIKey(id)
+	if err != nil {
+		s.Logger.Error("failed to find api key", zap.String("id", id), zap.Error(err))
+		return nil, endpoint.UnauthenticatedError("unable to authorize api key")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(key.Hash)) != 1 {
+		s.Logger.Error("invalid api key secret", zap.String("id", id))
+		return nil, endpoint.UnauthenticatedError("unable to authorize api key")
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		s.Logger.Error("expired api key used", zap.String("id", id))
+		return nil, endpoint.UnauthenticatedError("api key has expired")
+	}
+	if !apiKeyPermits(key, in.Metadata[types.ContextResourcePath.String()], in.Metadata[types.ContextResourceAction.String()]) {
+		return nil, endpoint.PermissionDeniedError("api key is not permitted to access this resource")
+	}
+
+	user, err := s.Controller.AuthDB.ViewUser(key.UserID)
+	if err != nil {
+		s.Logger.Error("failed to get api key owner", zap.String("id", id), zap.Int("user_id", key.UserID), zap.Error(err))
+		return nil, endpoint.UnauthenticatedError("unable to authorize api key")
+	}
+
+	if key.LastUsed == nil || now.Sub(*key.LastUsed) >= apiKeyTouchInterval {
+		if err := s.Controller.AuthDB.TouchAPIKey(key.ID, now); err != nil {
+			s.Logger.Warn("failed to record api key use", zap.String("id", id), zap.Error(err))
+		}
+	}
+	return user, nil
+}
+
+// apiKeyPermits returns true if the key's restrictions allow the endpoint path and action. A path restriction covers
+// the paths below it, so system covers system/info.
+func apiKeyPermits(key *authndb.APIKey, resource string, action string) bool {
+	if len(key.Actions) > 0 && !slices.Contains(key.Actions, action) {
+		return false
+	}
+	if len(key.Paths) == 0 {
+		return true
+	}
+	for p := strings.Trim(resource, "/"); p != "." && p != ""; p = path.Dir(p) {
+		for _, pattern := range key.Paths {
+			if matched, err := path.Match(pattern, p); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestCaller returns the authenticated user making the request and whether they are an admin
+func requestCaller(in *endpoint.Request) (caller authndb.User, admin bool) {
+	if in == nil {
+		return caller, false
+	}
+	_ = json.Unmarshal([]byte(in.Metadata[types.ContextAuthUser.String()]), &caller)
+	admin = slices.Contains(strings.Split(in.Metadata[types.ContextAuthRoles.String()], ","), endpoint.AuthGroupAdmin.String())
+	return caller, admin
+}
+
+func apiKeyOutput(key *authndb.APIKey, secret string) *APIKeyOutput {
+	out := &APIKeyOutput{APIKey: *key, Key: APIKeyPrefix + key.ID + "_" + secret}
+	out.Hash = ""
+	return out
+}
+
+func hashAPIKeySecret(secret string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
+}
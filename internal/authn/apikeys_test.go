@@ -0,0 +1,262 @@
+package authn
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestSubsystem returns an authn subsystem backed by a temporary database containing an admin and two users whose
+// password is "secret"
+func newTestSubsystem(t *testing.T) *Subsystem {
+	t.Helper()
+	db, err := authndb.OpenAuthDB(filepath.Join(t.TempDir(), "authn.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	if err := db.CreateUserWithID(&authndb.User{ID: -1, Username: "admin", Groups: []string{"admin"}}); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	for _, username := range []string{"ci", "other"} {
+		if err := db.CreateUser(&authndb.User{Username: username, Password: string(hash), Groups: []string{"user"}}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	s := &Subsystem{
+		Controller: &controller.Controller{Logger: zap.NewNop(), AuthDB: db, Config: &config.Configuration{}},
+		Logger:     zap.NewNop(),
+		enabled:    true,
+		name:       "auth",
+	}
+	s.register()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// callAs calls the endpoint as the user with the roles
+func callAs(t *testing.T, s *Subsystem, userID int, roles string, path string, action endpoint.Action, body interface{}) (*endpoint.Response, error) {
+	t.Helper()
+	in := &endpoint.Request{Metadata: map[string]string{types.ContextAuthRoles.String(): roles}, Parameters: map[string][]string{}}
+	if u, err := s.Controller.AuthDB.ViewUser(userID); err == nil {
+		userJSON, _ := json.Marshal(u)
+		in.Metadata[types.ContextAuthUser.String()] = string(userJSON)
+	}
+	if body != nil {
+		in.Body, _ = json.Marshal(body)
+	}
+	for _, ep := range s.endpoints {
+		template := strings.Split(ep.Path, "/")
+		segments := strings.Split(path, "/")
+		if ep.Action != action || len(template) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range template {
+			if strings.HasPrefix(template[i], "{") {
+				in.Parameters[strings.Trim(template[i], "{}")] = []string{segments[i]}
+			} else if template[i] != segments[i] {
+				match = false
+			}
+		}
+		if match {
+			return ep.Function(in)
+		}
+	}
+	t.Fatalf("No endpoint for %s %s", action, path)
+	return nil, nil
+}
+
+// authenticate runs the authentication middleware with the key for a request to the path and action
+func authenticate(s *Subsystem, key string, path string, action endpoint.Action) (string, error) {
+	var user string
+	next := func(in *endpoint.Request) (*endpoint.Response, error) {
+		user = in.Metadata[types.ContextAuthUser.String()]
+		return &endpoint.Response{}, nil
+	}
+	_, err := s.AuthenticationHandler(next)(&endpoint.Request{Metadata: map[string]string{
+		types.ContextAuthHeader.String():     "Bearer " + key,
+		types.ContextResourcePath.String():   path,
+		types.ContextResourceAction.String(): action.String(),
+	}})
+	return user, err
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestSubsystem(t)
+
+	out, err := callAs(t, s, 1, "user", "auth/apikeys", endpoint.ActionCreate, APIKeyArgs{
+		Name:      "ci",
+		ExpiresIn: "1h",
+		Paths:     []string{"system"},
+		Actions:   []string{"READ"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+	var created APIKeyOutput
+	if err := json.Unmarshal(out.Value, &created); err != nil {
+		t.Fatalf("Failed to decode api key: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, APIKeyPrefix+created.ID+"_") || created.Hash != "" || created.UserID != 1 || created.ExpiresAt == nil {
+		t.Errorf("Unexpected api key %+v", created)
+	}
+
+	user, err := authenticate(s, created.Key, "system/info", endpoint.ActionRead)
+	if err != nil {
+		t.Fatalf("Expected the key to authenticate, got %v", err)
+	}
+	if !strings.Contains(user, `"username":"ci"`) {
+		t.Errorf("Expected the owner of the key, got %s", user)
+	}
+	if key, _ := s.Controller.AuthDB.ViewAPIKey(created.ID); key.LastUsed == nil {
+		t.Errorf("Expected the last used time to be recorded")
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		path   string
+		action endpoint.Action
+		code   endpoint.ErrorCode
+	}{
+		{name: "path not permitted", key: created.Key, path: "auth/apikeys", action: endpoint.ActionRead, code: endpoint.ErrorCodePermissionDenied},
+		{name: "action not permitted", key: created.Key, path: "system/info", action: endpoint.ActionWrite, code: endpoint.ErrorCodePermissionDenied},
+		{name: "wrong secret", key: APIKeyPrefix + created.ID + "_secret", path: "system/info", action: endpoint.ActionRead, code: endpoint.ErrorCodeUnauthenticated},
+		{name: "unknown key", key: APIKeyPrefix + "missing", path: "system/info", action: endpoint.ActionRead, code: endpoint.ErrorCodeUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := authenticate(s, tt.key, tt.path, tt.action)
+			if code := endpoint.ErrorCodeOf(err); code != tt.code {
+				t.Errorf("Expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+
+	// Keys are only visible to their owner and admins
+	for _, tt := range []struct {
+		userID int
+		roles  string
+		count  int
+	}{{1, "user", 1}, {2, "user", 0}, {-1, "admin", 1}} {
+		out, err := callAs(t, s, tt.userID, tt.roles, "auth/apikeys", endpoint.ActionRead, nil)
+		if err != nil {
+			t.Fatalf("Failed to list api keys: %v", err)
+		}
+		var keys []*authndb.APIKey
+		if err := json.Unmarshal(out.Value, &keys); err != nil {
+			t.Fatalf("Failed to decode api keys: %v", err)
+		}
+		if len(keys) != tt.count || (len(keys) > 0 && keys[0].Hash != "") {
+			t.Errorf("User %d expected %d keys without hashes, got %+v", tt.userID, tt.count, keys)
+		}
+	}
+	if _, err := callAs(t, s, 2, "user", "auth/apikeys/"+created.ID+"/rotate", endpoint.ActionCreate, nil); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeNotFound {
+		t.Errorf("Expected another user's key to be not found, got %v", err)
+	}
+	if _, err := callAs(t, s, 2, "user", "auth/apikeys", endpoint.ActionCreate, APIKeyArgs{Name: "ci", UserID: 1}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodePermissionDenied {
+		t.Errorf("Expected creating a key for another user to be denied, got %v", err)
+	}
+
+	// Rotating replaces the secret immediately
+	out, err = callAs(t, s, 1, "user", "auth/apikeys/"+created.ID+"/rotate", endpoint.ActionCreate, nil)
+	if err != nil {
+		t.Fatalf("Failed to rotate api key: %v", err)
+	}
+	var rotated APIKeyOutput
+	if err := json.Unmarshal(out.Value, &rotated); err != nil {
+		t.Fatalf("Failed to decode api key: %v", err)
+	}
+	if rotated.ID != created.ID || rotated.Key == created.Key || rotated.RotatedAt == nil {
+		t.Errorf("Unexpected rotated api key %+v", rotated)
+	}
+	if _, err := authenticate(s, created.Key, "system/info", endpoint.ActionRead); err == nil {
+		t.Errorf("Expected the old key to be rejected after rotation")
+	}
+	if _, err := authenticate(s, rotated.Key, "system/info", endpoint.ActionRead); err != nil {
+		t.Errorf("Expected the rotated key to authenticate, got %v", err)
+	}
+
+	// Expired keys are rejected
+	key, _ := s.Controller.AuthDB.ViewAPIKey(created.ID)
+	expired := time.Now().Add(-time.Minute)
+	key.ExpiresAt = &expired
+	if err := s.Controller.AuthDB.UpdateAPIKey(key); err != nil {
+		t.Fatalf("Failed to update api key: %v", err)
+	}
+	if _, err := authenticate(s, rotated.Key, "system/info", endpoint.ActionRead); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected the expired key to be rejected, got %v", err)
+	}
+
+	// Revoked keys are removed
+	if _, err := callAs(t, s, -1, "admin", "auth/apikeys/"+created.ID, endpoint.ActionDelete, nil); err != nil {
+		t.Fatalf("Failed to revoke api key: %v", err)
+	}
+	if _, err := s.Controller.AuthDB.ViewAPIKey(created.ID); err == nil {
+		t.Errorf("Expected the revoked key to be deleted")
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	s := newTestSubsystem(t)
+
+	tests := []struct {
+		name string
+		args APIKeyArgs
+	}{
+		{name: "missing name", args: APIKeyArgs{}},
+		{name: "invalid action", args: APIKeyArgs{Name: "ci", Actions: []string{"execute"}}},
+		{name: "invalid path", args: APIKeyArgs{Name: "ci", Paths: []string{"system/["}}},
+		{name: "invalid expiration", args: APIKeyArgs{Name: "ci", ExpiresIn: "soon"}},
+		{name: "unknown owner", args: APIKeyArgs{Name: "ci", UserID: 42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := callAs(t, s, -1, "admin", "auth/apikeys", endpoint.ActionCreate, tt.args)
+			if code := endpoint.ErrorCodeOf(err); code != endpoint.ErrorCodeInvalidArgument {
+				t.Errorf("Expected %s, got %v", endpoint.ErrorCodeInvalidArgument, err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyPermits(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      authndb.APIKey
+		path     string
+		action   string
+		expected bool
+	}{
+		{name: "unrestricted", path: "system/info", action: "write", expected: true},
+		{name: "exact path", key: authndb.APIKey{Paths: []string{"system/info"}}, path: "system/info", action: "read", expected: true},
+		{name: "parent path", key: authndb.APIKey{Paths: []string{"system"}}, path: "system/cpu/usage", action: "read", expected: true},
+		{name: "wildcard", key: authndb.APIKey{Paths: []string{"plugins/*/status"}}, path: "plugins/hello/status", action: "read", expected: true},
+		{name: "other path", key: authndb.APIKey{Paths: []string{"system"}}, path: "systemd/units", action: "read", expected: false},
+		{name: "action", key: authndb.APIKey{Actions: []string{"read"}}, path: "system/info", action: "read", expected: true},
+		{name: "other action", key: authndb.APIKey{Paths: []string{"system"}, Actions: []string{"read"}}, path: "system/info", action: "delete", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if permits := apiKeyPermits(&tt.key, tt.path, tt.action); permits != tt.expected {
+				t.Errorf("apiKeyPermits() = %v, want %v", permits, tt.expected)
+			}
+		})
+	}
+}
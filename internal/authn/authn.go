@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt"
 	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
 	"github.com/bgrewell/dtac-agent/internal/controller"
 	"github.com/bgrewell/dtac-agent/internal/helpers"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
@@ -26,8 +27,9 @@ import (
 
 // AuthOutput is a struct to assist with describing the output format
 type AuthOutput struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	MFASetupRequired bool   `json:"mfa_setup_required,omitempty"` // The user has to enroll in mfa before anything else
 }
 
 // NewSubsystem creates a new authn subsystem
@@ -44,8 +46,12 @@ func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
 
 	if u, err := c.AuthDB.ViewUser(adminID); err != nil {
 		as.Logger.Warn("failed to get admin user from database. creating admin user", zap.Error(err))
+		password, err := as.adminPassword()
+		if err != nil {
+			as.Logger.Fatal("failed to generate admin password", zap.Error(err))
+		}
 		var hash []byte
-		hash, err = bcrypt.GenerateFromPassword([]byte(c.Config.Auth.Pass), bcrypt.DefaultCost)
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			as.Logger.Fatal("failed to update admin user", zap.Error(err))
 		}
@@ -59,6 +65,7 @@ func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
 		if err != nil {
 			as.Logger.Fatal("failed to create admin user", zap.Error(err))
 		}
+		as.markAdminPassword(false)
 	} else {
 		// Ensure user/pass hasn't changed in the config
 		if u.Username != c.Config.Auth.User {
@@ -69,10 +76,32 @@ func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
 				as.Logger.Fatal("failed to update admin user", zap.Error(err))
 			}
 		}
-		if err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(c.Config.Auth.Pass)); err != nil {
+
+		// The password in the config is applied until the admin changes it through the API. An admin still using the
+		// placeholder as its password gets a generated one.
+		matches := func(password string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+		}
+		placeholder := c.Config.Auth.Pass == "" || c.Config.Auth.Pass == config.GeneratePasswordMarker
+		update := false
+		switch {
+		case u.PasswordChangedAt != nil:
+			if !placeholder && !matches(c.Config.Auth.Pass) {
+				as.Logger.Info("ignoring auth.pass, the admin password has been changed through the api")
+			}
+		case placeholder:
+			update = matches(config.GeneratePasswordMarker)
+		default:
+			update = !matches(c.Config.Auth.Pass)
+		}
+		if update {
 			as.Logger.Info("updating admin user password")
+			password, err := as.adminPassword()
+			if err != nil {
+				as.Logger.Fatal("failed to generate admin password", zap.Error(err))
+			}
 			var hash []byte
-			hash, err = bcrypt.GenerateFromPassword([]byte(c.Config.Auth.Pass), bcrypt.DefaultCost)
+			hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 			if err != nil {
 				as.Logger.Fatal("failed to update admin user", zap.Error(err))
 			}
@@ -82,6 +111,7 @@ func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
 				as.Logger.Fatal("failed to update admin user", zap.Error(err))
 			}
 		}
+		as.markAdminPassword(u.PasswordChangedAt != nil)
 	}
 
 	as.register()
@@ -95,6 +125,8 @@ type Subsystem struct {
 	enabled    bool
 	name       string
 	endpoints  []*endpoint.Endpoint
+	breached   breachedList
+	done       chan struct{}
 }
 
 // register registers the authn subsystem
@@ -109,16 +141,71 @@ func (s *Subsystem) register() {
 
 	// Endpoints
 	authzGuest := endpoint.AuthGroupGuest.String()
+	authzUser := endpoint.AuthGroupUser.String()
 	authzOperator := endpoint.AuthGroupOperator.String()
 	authzAdmin := endpoint.AuthGroupAdmin.String()
 	s.endpoints = []*endpoint.Endpoint{
 		endpoint.NewEndpoint(fmt.Sprintf("%s/login", base), endpoint.ActionCreate, "login handler", s.loginHandler, false, authzGuest, endpoint.WithBody(authndb.UserArgs{}), endpoint.WithOutput(AuthOutput{})),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/refresh", base), endpoint.ActionCreate, "exchange a refresh token for new tokens", s.refreshHandler, false, authzGuest, endpoint.WithBody(RefreshArgs{}), endpoint.WithOutput(AuthOutput{})),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/login/mfa", base), endpoint.ActionCreate, "complete a login with an mfa code", s.loginMFAHandler, false, authzGuest, endpoint.WithBody(MFALoginArgs{}), endpoint.WithOutput(AuthOutput{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/logout", base), endpoint.ActionCreate, "revoke the tokens of the current session", s.logoutHandler, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/password", base), endpoint.ActionWrite, "change the password of the current user", s.changePassword, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/mfa", base), endpoint.ActionRead, "get the mfa status of the current user", s.mfaStatus, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/mfa/enroll", base), endpoint.ActionCreate, "start mfa enrollment", s.enrollMFA, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/mfa/verify", base), endpoint.ActionCreate, "verify a code to enable mfa", s.verifyMFA, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/mfa/recovery-codes", base), endpoint.ActionCreate, "regenerate mfa recovery codes", s.regenerateRecoveryCodes, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/mfa/disable", base), endpoint.ActionCreate, "disable mfa", s.disableMFA, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/sessions", base), endpoint.ActionRead, "list sessions", s.listSessions, true, authzGuest),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/sessions/{id}", base), endpoint.ActionDelete, "revoke session", s.deleteSession, true, authzGuest),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/users", base), endpoint.ActionRead, "list users", s.listUsers, true, authzOperator, endpoint.WithOutput([]authndb.User{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/user", base), endpoint.ActionRead, "get user by id", s.getUser, true, authzOperator, endpoint.WithOutput(authndb.User{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/users", base), endpoint.ActionCreate, "create user", s.createUser, true, authzAdmin, endpoint.WithBody(authndb.User{}), endpoint.WithOutput(authndb.User{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/user", base), endpoint.ActionWrite, "update user", s.updateUser, true, authzAdmin, endpoint.WithBody(authndb.User{}), endpoint.WithOutput(authndb.User{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/user", base), endpoint.ActionDelete, "delete user", s.deleteUser, true, authzAdmin),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/users/{id}", base), endpoint.ActionRead, "get user by id", s.getUser, true, authzOperator, endpoint.WithOutput(authndb.User{})),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/users/{id}", base), endpoint.ActionWrite, "update user", s.updateUser, true, authzAdmin, endpoint.WithBody(authndb.User{}), endpoint.WithOutput(authndb.User{})),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/users/{id}", base), endpoint.ActionDelete, "delete user", s.deleteUser, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/users/{id}/sessions", base), endpoint.ActionDelete, "revoke all sessions of a user", s.deleteUserSessions, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/users/{id}/mfa", base), endpoint.ActionDelete, "reset the mfa of a user", s.resetUserMFA, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/lockouts", base), endpoint.ActionRead, "list failed login lockouts", s.listLockouts, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/lockouts", base), endpoint.ActionDelete, "clear all lockouts", s.clearLockouts, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/lockouts/{key}", base), endpoint.ActionDelete, "clear lockout", s.clearLockout, true, authzAdmin),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/apikeys", base), endpoint.ActionCreate, "create api key", s.createAPIKey, true, authzUser),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/apikeys", base), endpoint.ActionRead, "list api keys", s.listAPIKeys, true, authzUser),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/apikeys/{id}", base), endpoint.ActionDelete, "revoke api key", s.revokeAPIKey, true, authzUser),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/apikeys/{id}/rotate", base), endpoint.ActionCreate, "rotate api key", s.rotateAPIKey, true, authzUser),
+	}
+
+	// Remove the tokens and lockouts that expired while the agent was stopped, then keep removing them in the
+	// background until the subsystem is closed
+	s.purgeTokens()
+	s.purgeLockouts()
+	s.done = make(chan struct{})
+	go s.purge()
+}
+
+// purge removes the expired tokens and lockouts periodically until the subsystem is closed
+func (s *Subsystem) purge() {
+	ticker := time.NewTicker(tokenPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeTokens()
+			s.purgeLockouts()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops removing expired tokens and lockouts in the background
+func (s *Subsystem) Close() error {
+	if s.done == nil {
+		return nil
 	}
+	close(s.done)
+	return nil
 }
 
 // Enabled returns true if the subsystem is enabled
@@ -157,6 +244,18 @@ func (s *Subsystem) loginHandler(in *endpoint.Request) (out *endpoint.Response,
 		// Usernames are always worked with in lowercase
 		inputUser.Username = strings.ToLower(inputUser.Username)
 
+		// Logins are refused while the username or the address they come from is locked. Usernames are tracked whether
+		// they exist or not so that a lockout doesn't reveal which users exist.
+		now := time.Now()
+		policy := s.lockoutPolicy()
+		var lockoutKeys []string
+		if policy != nil {
+			lockoutKeys = policy.keys(inputUser.Username, in.Metadata[types.ContextRemoteAddr.String()])
+			if err := s.checkLockout(lockoutKeys, now); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// Convert the users credentials into sha256 hashes
 		userHash := fmt.Sprintf("%x", sha256.Sum256([]byte(inputUser.Username)))
 
@@ -199,7 +298,20 @@ func (s *Subsystem) loginHandler(in *endpoint.Request) (out *endpoint.Response,
 
 		// check the users credentials
 		if !(userExists) || !(passwordMatch) {
-			return nil, nil, errors.New("invalid username or password")
+			if policy != nil {
+				if err := s.recordLoginFailure(policy, lockoutKeys, now); err != nil {
+					s.Logger.Error("failed to record failed login", zap.Error(err))
+				}
+			}
+			return nil, nil, endpoint.UnauthenticatedError("invalid username or password")
+		}
+
+		// Users with mfa complete the login with a code, the lockout is only reset once they have
+		if s.Controller.AuthDB.MFAEnabled(matchUser.ID) {
+			return s.mfaChallenge(matchUser)
+		}
+		if policy != nil {
+			s.resetLockout(inputUser.Username)
 		}
 
 		token, err := s.createToken(matchUser.ID)
@@ -209,33 +321,42 @@ func (s *Subsystem) loginHandler(in *endpoint.Request) (out *endpoint.Response,
 
 		saveErr := s.createAuth(matchUser.ID, token)
 		if saveErr != nil {
-			return nil, nil, err
-		}
-
-		tokens := AuthOutput{
-			AccessToken:  token.AccessToken,
-			RefreshToken: token.RefreshToken,
+			return nil, nil, saveErr
 		}
 
-		// TODO: Should also package and transfer the refresh_token as a cookie here? (probably better to handle in the REST API)
-		headers := map[string][]string{
-			"Authorization": {fmt.Sprintf("Bearer %s", token.AccessToken)},
-		}
-		tokensJSON, err := json.Marshal(tokens)
-		return headers, tokensJSON, err
+		return tokenResponse(token, s.mfaSetupRequired(matchUser))
 	}, "authentication tokens")
 }
 
+// tokenResponse returns the headers and body of a response carrying the tokens
+func tokenResponse(token *authndb.TokenDetails, mfaSetupRequired bool) (map[string][]string, []byte, error) {
+	tokens := AuthOutput{
+		AccessToken:      token.AccessToken,
+		RefreshToken:     token.RefreshToken,
+		MFASetupRequired: mfaSetupRequired,
+	}
+
+	// TODO: Should also package and transfer the refresh_token as a cookie here? (probably better to handle in the REST API)
+	headers := map[string][]string{
+		"Authorization": {fmt.Sprintf("Bearer %s", token.AccessToken)},
+	}
+	tokensJSON, err := json.Marshal(tokens)
+	return headers, tokensJSON, err
+}
+
 func (s *Subsystem) createToken(userid int) (token *authndb.TokenDetails, err error) {
 
 	// Parse token expiration times from config
-	accessExpiration, err := s.parseTokenExpiration(s.Controller.Config.Auth.AccessTokenExpiration)
+	s.Controller.Config.RLock()
+	access, refresh := s.Controller.Config.Auth.AccessTokenExpiration, s.Controller.Config.Auth.RefreshTokenExpiration
+	s.Controller.Config.RUnlock()
+	accessExpiration, err := s.parseTokenExpiration(access)
 	if err != nil {
 		s.Logger.Error("failed to parse access token expiration, using default 15m", zap.Error(err))
 		accessExpiration = time.Minute * 15
 	}
 
-	refreshExpiration, err := s.parseTokenExpiration(s.Controller.Config.Auth.RefreshTokenExpiration)
+	refreshExpiration, err := s.parseTokenExpiration(refresh)
 	if err != nil {
 		s.Logger.Error("failed to parse refresh token expiration, using default 168h", zap.Error(err))
 		refreshExpiration = time.Hour * 24 * 7
@@ -303,6 +424,23 @@ func (s *Subsystem) createToken(userid int) (token *authndb.TokenDetails, err er
 	return td, nil
 }
 
+// ReloadKeys returns the settings the subsystem applies live
+func (s *Subsystem) ReloadKeys() []string {
+	return []string{"auth.access_token_expiration", "auth.refresh_token_expiration", "auth.password_policy.*", "auth.mfa.*", "lockout.*"}
+}
+
+// Reload checks the token expirations, they are read from the configuration whenever a token is created. The lockout
+// settings and password policy are read whenever they are applied.
+func (s *Subsystem) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	if _, err := s.parseTokenExpiration(cfg.Auth.AccessTokenExpiration); err != nil {
+		return nil, err
+	}
+	if _, err := s.parseTokenExpiration(cfg.Auth.RefreshTokenExpiration); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 // parseTokenExpiration parses a duration string and returns the corresponding time.Duration.
 // It supports standard Go duration format (e.g., "15m", "1h", "24h") and a special "never" value.
 // If "never" is specified, it returns 0 to indicate no expiration.
@@ -327,17 +465,17 @@ func (s *Subsystem) parseTokenExpiration(expirationStr string) (time.Duration, e
 	return duration, nil
 }
 
+// createAuth starts a new session for the tokens, expired entries are removed by purgeTokens
 func (s *Subsystem) createAuth(userid int, td *authndb.TokenDetails) (err error) {
-	errAccess := s.Controller.AuthDB.UpdateToken(td.AccessUUID, strconv.Itoa(userid)) //todo: need to look into how to time-expire these entries
-	if errAccess != nil {
-		return errAccess
-	}
-
-	errRefresh := s.Controller.AuthDB.UpdateToken(td.RefreshUUID, strconv.Itoa(userid))
-	if errRefresh != nil {
-		return errRefresh
-	}
-	return nil
+	return s.Controller.AuthDB.CreateSession(&authndb.Session{
+		ID:          uuid.NewV4().String(),
+		UserID:      userid,
+		AccessUUID:  td.AccessUUID,
+		RefreshUUID: td.RefreshUUID,
+		CreatedAt:   time.Now(),
+		AtExpires:   td.AtExpires,
+		RtExpires:   td.RtExpires,
+	})
 }
 
 // START OF AuthenticationMiddleware portion of code
@@ -357,14 +495,39 @@ func (s *Subsystem) AuthenticationHandler(next endpoint.Func) endpoint.Func {
 		var ok bool
 		var auth string
 		if auth, ok = in.Metadata[types.ContextAuthHeader.String()]; !ok {
+			// Callers that were identified by the transport, such as unix socket peers, don't need a token
+			if peer, ok := in.Metadata[types.ContextAuthPeer.String()]; ok {
+				in.Metadata[types.ContextAuthUser.String()] = peer
+				return next(in)
+			}
 			// Return error, API adapter should do a check to provide user with a more specific error
-			return nil, errors.New("unable to authenticate user")
+			return nil, endpoint.UnauthenticatedError("unable to authenticate user")
 		}
 
-		user, err := s.authorizeUser(auth)
+		// API keys are sent the same way as JWTs and are told apart by their prefix. Only access tokens belong to a
+		// session, the caller can't supply one.
+		var user *authndb.User
+		var session string
+		token := s.extractToken(auth)
+		apiKey := strings.HasPrefix(token, APIKeyPrefix)
+		if apiKey {
+			user, err = s.authorizeAPIKey(token, in)
+		} else {
+			user, session, err = s.authorizeUser(auth)
+		}
 		if err != nil {
 			return nil, err
 		}
+		delete(in.Metadata, types.ContextAuthSession.String())
+		if session != "" {
+			in.Metadata[types.ContextAuthSession.String()] = session
+		}
+
+		// Users whose groups require mfa can only set it up until they have enrolled, including through api keys they
+		// created before it was required
+		if (session != "" || apiKey) && s.mfaSetupRequired(user) && !s.mfaSetupAllowed(in.Metadata[types.ContextResourcePath.String()]) {
+			return nil, endpoint.PermissionDeniedError("mfa is required for user %s, enroll at %s/mfa/enroll", user.Username, s.name)
+		}
 
 		userJSON, err := json.Marshal(user)
 		if err != nil {
@@ -375,10 +538,10 @@ func (s *Subsystem) AuthenticationHandler(next endpoint.Func) endpoint.Func {
 	}
 }
 
-func (s *Subsystem) authorizeUser(bearerToken string) (user *authndb.User, err error) {
+func (s *Subsystem) authorizeUser(bearerToken string) (user *authndb.User, session string, err error) {
 	tokenStr := s.extractToken(bearerToken)
 	if tokenStr == "" {
-		return nil, errors.New("invalid authorization header")
+		return nil, "", endpoint.UnauthenticatedError("invalid authorization header")
 	}
 
 	// Check if static testing token is configured and matches
@@ -391,30 +554,31 @@ func (s *Subsystem) authorizeUser(bearerToken string) (user *authndb.User, err e
 		user, err := s.Controller.AuthDB.ViewUser(adminID)
 		if err != nil {
 			s.Logger.Error("failed to get admin user for static testing token", zap.Error(err))
-			return nil, errors.New("unable to authorize token")
+			return nil, "", endpoint.UnauthenticatedError("unable to authorize token")
 		}
-		return user, nil
+		return user, "", nil
 	}
 
 	token, err := s.verifyToken(tokenStr)
 	if err != nil {
 		s.Logger.Error("failed to verify token", zap.Error(err))
-		return nil, errors.New("unable to authorize token")
+		return nil, "", endpoint.UnauthenticatedError("unable to authorize token")
 	}
 
 	tokenAuth, err := s.extractTokenMetadata(token)
 	if err != nil {
 		s.Logger.Error("failed to get token metadata", zap.Error(err))
-		return nil, errors.New("unable to authorize token")
+		return nil, "", endpoint.UnauthenticatedError("unable to authorize token")
 	}
 
-	userID, err := s.fetchAuth(tokenAuth)
+	sess, err := s.fetchAuth(tokenAuth)
 	if err != nil {
 		s.Logger.Error("failed to fetch authn", zap.Error(err))
-		return nil, errors.New("unable to authorize token")
+		return nil, "", endpoint.UnauthenticatedError("unable to authorize token")
 	}
 
-	return s.Controller.AuthDB.ViewUser(userID)
+	user, err = s.Controller.AuthDB.ViewUser(sess.UserID)
+	return user, sess.ID, err
 }
 
 func (s *Subsystem) extractToken(bearerToken string) string {
@@ -445,16 +609,13 @@ func (s *Subsystem) verifyToken(tokenStr string) (*jwt.Token, error) {
 	return token, nil
 }
 
-func (s *Subsystem) fetchAuth(authD *authndb.AccessDetails) (userID int, err error) {
-	userIDStr, err := s.Controller.AuthDB.ViewToken(authD.AccessUUID)
-	if userIDStr == "" || err != nil {
-		return 0, fmt.Errorf("unable to find %s authn details in database", authD.AccessUUID)
+// fetchAuth returns the session the access token belongs to, tokens that were revoked or replaced have no session
+func (s *Subsystem) fetchAuth(authD *authndb.AccessDetails) (session *authndb.Session, err error) {
+	session, err = s.Controller.AuthDB.ViewSessionByToken(authD.AccessUUID)
+	if err != nil || session.AccessUUID != authD.AccessUUID {
+		return nil, fmt.Errorf("unable to find %s authn details in database", authD.AccessUUID)
 	}
-	userID, err = strconv.Atoi(userIDStr)
-	if err != nil {
-		return 0, fmt.Errorf("unable to convert %s to int", userIDStr)
-	}
-	return userID, nil
+	return session, nil
 }
 
 func (s *Subsystem) extractTokenMetadata(token *jwt.Token) (*authndb.AccessDetails, error) {
@@ -493,7 +654,7 @@ func (s *Subsystem) getUser(in *endpoint.Request) (out *endpoint.Response, err e
 			id := m[0]
 			uid, err := strconv.Atoi(id)
 			if err != nil {
-				return nil, err
+				return nil, endpoint.InvalidArgumentError("invalid parameter 'id': %w", err)
 			}
 			user, err := s.Controller.AuthDB.SafeViewUser(uid)
 			if err != nil {
@@ -501,7 +662,7 @@ func (s *Subsystem) getUser(in *endpoint.Request) (out *endpoint.Response, err e
 			}
 			return json.Marshal(user)
 		}
-		return nil, errors.New("missing parameter 'id'")
+		return nil, endpoint.InvalidArgumentError("missing parameter 'id'")
 
 	}, "information for the specified user")
 }
@@ -510,7 +671,7 @@ func (s *Subsystem) createUser(in *endpoint.Request) (out *endpoint.Response, er
 	return helpers.HandleWrapper(in, func() ([]byte, error) {
 		var user authndb.User
 		if in.Body == nil || len(in.Body) == 0 {
-			return nil, errors.New("missing body")
+			return nil, endpoint.InvalidArgumentError("missing body")
 		}
 
 		// Transform the body into a user
@@ -520,16 +681,16 @@ func (s *Subsystem) createUser(in *endpoint.Request) (out *endpoint.Response, er
 
 		// Check to see if the user already exists (this is not secure against timing attacks because you need to be an admin already to do it)
 		if s.Controller.AuthDB.UserExistsByUsername(user.Username) {
-			return nil, errors.New("user already exists")
+			return nil, endpoint.ConflictError("user already exists")
 		}
 
-		// Hash the password
-		var hash []byte
-		hash, err = bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-		if err != nil {
+		// Check the password against the policy and hash it, the history can't be supplied
+		password := user.Password
+		user.Password = ""
+		user.PasswordHistory = nil
+		if err := s.setPassword(&user, password); err != nil {
 			return nil, err
 		}
-		user.Password = string(hash)
 
 		// Add to database
 		err = s.Controller.AuthDB.CreateUser(&user)
@@ -553,7 +714,7 @@ func (s *Subsystem) updateUser(in *endpoint.Request) (out *endpoint.Response, er
 
 		if m, ok := in.Parameters["id"]; ok && len(m) > 0 && m[0] != "" {
 			if in.Body == nil || len(in.Body) == 0 {
-				return nil, errors.New("missing body")
+				return nil, endpoint.InvalidArgumentError("missing body")
 			}
 
 			// Transform the body into a user
@@ -565,7 +726,7 @@ func (s *Subsystem) updateUser(in *endpoint.Request) (out *endpoint.Response, er
 			id := m[0]
 			uid, err := strconv.Atoi(id)
 			if err != nil {
-				return nil, err
+				return nil, endpoint.InvalidArgumentError("invalid parameter 'id': %w", err)
 			}
 			dbUser, err := s.Controller.AuthDB.ViewUser(uid)
 			if err != nil {
@@ -579,21 +740,24 @@ func (s *Subsystem) updateUser(in *endpoint.Request) (out *endpoint.Response, er
 
 			// Verify
 			if dbUser.ID != user.ID {
-				return nil, errors.New("user id mismatch, you cannot change the user id")
+				return nil, endpoint.InvalidArgumentError("user id mismatch, you cannot change the user id")
 			}
 			if dbUser.Username != user.Username {
-				return nil, errors.New("user username mismatch, you cannot change the username")
+				return nil, endpoint.InvalidArgumentError("user username mismatch, you cannot change the username")
 			}
 
-			// If password changed then rehash it
-			if (user.Password != "") && (fmt.Sprintf("%x", sha256.Sum256([]byte(user.Password))) != dbUser.Password) {
-				s.Logger.Info("password changed, rehashing", zap.String("username", user.Username), zap.Int("id", user.ID))
-				var hash []byte
-				hash, err = bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-				if err != nil {
+			// The password is kept unless a new one is supplied, which is checked against the policy and hashed. The
+			// password history can't be changed.
+			password := user.Password
+			user.Password = dbUser.Password
+			user.PasswordHistory = dbUser.PasswordHistory
+			user.PasswordChangedAt = dbUser.PasswordChangedAt
+			changed := password != "" && password != authndb.MaskedPassword
+			if changed {
+				if err := s.setPassword(&user, password); err != nil {
 					return nil, err
 				}
-				user.Password = string(hash)
+				s.Logger.Info("password changed", zap.String("username", user.Username), zap.Int("id", user.ID))
 			}
 
 			// Add to database
@@ -601,6 +765,16 @@ func (s *Subsystem) updateUser(in *endpoint.Request) (out *endpoint.Response, er
 			if err != nil {
 				return nil, err
 			}
+			if changed && user.ID == -1 {
+				s.markAdminPassword(true)
+			}
+
+			// Sessions started with the old password are signed out
+			if changed {
+				if _, err := s.Controller.AuthDB.DeleteUserSessions(user.ID); err != nil {
+					return nil, err
+				}
+			}
 
 			// Return safe view of updated user
 			safeUser, err := s.Controller.AuthDB.SafeViewUser(user.ID)
@@ -610,7 +784,7 @@ func (s *Subsystem) updateUser(in *endpoint.Request) (out *endpoint.Response, er
 
 			return json.Marshal(safeUser)
 		}
-		return nil, errors.New("missing parameter 'id'")
+		return nil, endpoint.InvalidArgumentError("missing parameter 'id'")
 
 	}, "information for the user that has been updated")
 }
@@ -621,15 +795,21 @@ func (s *Subsystem) deleteUser(in *endpoint.Request) (out *endpoint.Response, er
 			id := m[0]
 			uid, err := strconv.Atoi(id)
 			if err != nil {
-				return nil, err
+				return nil, endpoint.InvalidArgumentError("invalid parameter 'id': %w", err)
 			}
 			err = s.Controller.AuthDB.DeleteUser(uid)
 			if err != nil {
 				return nil, err
 			}
+			if _, err = s.Controller.AuthDB.DeleteUserSessions(uid); err != nil {
+				return nil, err
+			}
+			if err = s.Controller.AuthDB.DeleteMFA(uid); err != nil && endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeNotFound {
+				return nil, err
+			}
 			return json.Marshal(map[string]int{"deleted_uid": uid})
 		}
-		return nil, errors.New("missing parameter 'id'")
+		return nil, endpoint.InvalidArgumentError("missing parameter 'id'")
 
 	}, "no information is returned by this endpoint")
 }
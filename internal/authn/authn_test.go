@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
 )
 
@@ -249,3 +251,58 @@ func TestExtractToken(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticationHandlerPeer(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	s := &Subsystem{
+		Logger: logger,
+	}
+
+	peer := `{"username":"unix:operator","groups":["operators"]}`
+	tests := []struct {
+		name      string
+		metadata  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "Peer identified by transport",
+			metadata: map[string]string{types.ContextAuthPeer.String(): peer},
+		},
+		{
+			name:      "No credentials",
+			metadata:  map[string]string{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user string
+			next := func(in *endpoint.Request) (*endpoint.Response, error) {
+				user = in.Metadata[types.ContextAuthUser.String()]
+				return &endpoint.Response{}, nil
+			}
+			_, err := s.AuthenticationHandler(next)(&endpoint.Request{Metadata: tt.metadata})
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if user != peer {
+				t.Errorf("AuthenticationHandler set user %q, want %q", user, peer)
+			}
+		})
+	}
+}
+
+func TestCloseDisabled(t *testing.T) {
+	s := &Subsystem{Logger: zap.NewNop(), name: "auth"}
+	s.register()
+	if err := s.Close(); err != nil {
+		t.Errorf("Expected closing a disabled subsystem to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package authn
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+const (
+	// LockoutUserPrefix is the prefix of the lockout keys of usernames
+	LockoutUserPrefix = "user:"
+	// LockoutAddressPrefix is the prefix of the lockout keys of the addresses logins come from
+	LockoutAddressPrefix = "address:"
+)
+
+// LockoutArgs is the struct for the arguments of requests about a single lockout
+type LockoutArgs struct {
+	Key string `json:"-" param:"key,required"`
+}
+
+// ClearedLockouts is the result of clearing every lockout
+type ClearedLockouts struct {
+	Cleared int `json:"cleared"`
+}
+
+// lockoutPolicy is the lockout configuration at the time of a login
+type lockoutPolicy struct {
+	threshold        int
+	addressThreshold int
+	unlock           time.Duration
+	maxUnlock        time.Duration
+}
+
+// lockoutPolicy returns the lockout configuration, nil is returned when lockouts are disabled. The settings are read
+// for every login so they can be changed while the agent is running.
+func (s *Subsystem) lockoutPolicy() *lockoutPolicy {
+	s.Controller.Config.RLock()
+	cfg := s.Controller.Config.Lockout
+	s.Controller.Config.RUnlock()
+	if !cfg.Enabled {
+		return nil
+	}
+	policy := &lockoutPolicy{threshold: cfg.Threshold, addressThreshold: cfg.AddressThreshold}
+	policy.unlock, _ = time.ParseDuration(cfg.AutoUnlockTime)
+	policy.maxUnlock, _ = time.ParseDuration(cfg.MaxUnlockTime)
+	if policy.unlock <= 0 {
+		policy.unlock = 10 * time.Second
+	}
+	if policy.maxUnlock < policy.unlock {
+		policy.maxUnlock = policy.unlock
+	}
+	return policy
+}
+
+// keys returns the lockout keys tracked for a login of the username from the address
+func (p *lockoutPolicy) keys(username string, remote string) []string {
+	var keys []string
+	if p.threshold > 0 {
+		keys = append(keys, LockoutUserPrefix+username)
+	}
+	if p.addressThreshold > 0 && remote != "" {
+		keys = append(keys, LockoutAddressPrefix+remote)
+	}
+	return keys
+}
+
+// lockDuration returns how long a key is locked for once it has the number of failures. The first lockout lasts the
+// auto unlock time and every further failure doubles it up to the maximum.
+func (p *lockoutPolicy) lockDuration(key string, failures int) time.Duration {
+	threshold := p.threshold
+	if strings.HasPrefix(key, LockoutAddressPrefix) {
+		threshold = p.addressThreshold
+	}
+	if failures < threshold {
+		return 0
+	}
+	d := p.unlock
+	for i := threshold; i < failures && d < p.maxUnlock; i++ {
+		d *= 2
+	}
+	return min(d, p.maxUnlock)
+}
+
+// checkLockout returns an error if logins of any of the keys are locked
+func (s *Subsystem) checkLockout(keys []string, now time.Time) error {
+	var until *time.Time
+	for _, key := range keys {
+		lockout, err := s.Controller.AuthDB.ViewLockout(key)
+		if endpoint.ErrorCodeOf(err) == endpoint.ErrorCodeNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if lockout.Locked(now) && (until == nil || lockout.LockedUntil.After(*until)) {
+			until = lockout.LockedUntil
+		}
+	}
+	if until == nil {
+		return nil
+	}
+	return endpoint.UnauthenticatedError("too many failed logins, try again later").
+		WithDetail("locked_until", until.UTC().Format(time.RFC3339)).
+		WithRetryable(true)
+}
+
+// recordLoginFailure counts a failed login against the keys and locks those that reached their threshold. Failures
+// are forgotten once the maximum unlock time has passed without another one.
+func (s *Subsystem) recordLoginFailure(policy *lockoutPolicy, keys []string, now time.Time) error {
+	lockouts, err := s.Controller.AuthDB.UpdateLockouts(keys, func(lockout *authndb.Lockout) {
+		if !lockout.Locked(now) && now.Sub(lockout.LastFailure) > policy.maxUnlock {
+			lockout.Failures = 0
+			lockout.LockedUntil = nil
+		}
+		lockout.Failures++
+		lockout.LastFailure = now
+		if d := policy.lockDuration(lockout.Key, lockout.Failures); d > 0 {
+			until := now.Add(d)
+			lockout.LockedUntil = &until
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, lockout := range lockouts {
+		if lockout.Locked(now) {
+			s.Logger.Warn("login locked", zap.String("key", lockout.Key), zap.Int("failures", lockout.Failures), zap.Time("locked_until", *lockout.LockedUntil))
+		}
+	}
+	return nil
+}
+
+// resetLockout forgets the failed logins of the username. The record of the address is kept, otherwise a valid login
+// could be used to reset the count between guesses at other accounts.
+func (s *Subsystem) resetLockout(username string) {
+	err := s.Controller.AuthDB.DeleteLockout(LockoutUserPrefix + username)
+	if err != nil && endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeNotFound {
+		s.Logger.Warn("failed to reset lockout", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// purgeLockouts removes the records that are no longer locked and whose failures would be forgotten
+func (s *Subsystem) purgeLockouts() {
+	policy := s.lockoutPolicy()
+	if policy == nil {
+		return
+	}
+	now := time.Now()
+	removed, err := s.Controller.AuthDB.DeleteLockouts(func(lockout *authndb.Lockout) bool {
+		return !lockout.Locked(now) && now.Sub(lockout.LastFailure) > policy.maxUnlock
+	})
+	if err != nil {
+		s.Logger.Warn("failed to purge lockouts", zap.Error(err))
+	} else if removed > 0 {
+		s.Logger.Debug("purged lockouts", zap.Int("count", removed))
+	}
+}
+
+func (s *Subsystem) listLockouts(ctx context.Context, _ endpoint.Empty) ([]*authndb.Lockout, error) {
+	return s.Controller.AuthDB.ViewLockouts()
+}
+
+func (s *Subsystem) clearLockout(ctx context.Context, args LockoutArgs) (*authndb.Lockout, error) {
+	lockout, err := s.Controller.AuthDB.ViewLockout(args.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.DeleteLockout(args.Key); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("lockout cleared", zap.String("key", args.Key))
+	return lockout, nil
+}
+
+func (s *Subsystem) clearLockouts(ctx context.Context, _ endpoint.Empty) (*ClearedLockouts, error) {
+	removed, err := s.Controller.AuthDB.DeleteLockouts(func(*authndb.Lockout) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	s.Logger.Info("lockouts cleared", zap.Int("count", removed))
+	return &ClearedLockouts{Cleared: removed}, nil
+}
@@ -0,0 +1,143 @@
+package authn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+)
+
+// loginFrom logs in as the user from the address
+func loginFrom(s *Subsystem, username string, password string, remote string) error {
+	body, _ := json.Marshal(authndb.UserArgs{Username: username, Password: password})
+	_, err := s.loginHandler(&endpoint.Request{Metadata: map[string]string{types.ContextRemoteAddr.String(): remote}, Body: body})
+	return err
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestSubsystem(t)
+	s.Controller.Config.Lockout = config.LockoutEntry{Enabled: true, Threshold: 3, AddressThreshold: 5, AutoUnlockTime: "1m", MaxUnlockTime: "4m"}
+
+	// A successful login forgets the failures of the username but not of the address
+	for i := 0; i < 2; i++ {
+		if err := loginFrom(s, "ci", "wrong", "10.0.0.1"); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+			t.Fatalf("Expected the login to fail, got %v", err)
+		}
+	}
+	if err := loginFrom(s, "ci", "secret", "10.0.0.1"); err != nil {
+		t.Fatalf("Expected the login to succeed below the threshold, got %v", err)
+	}
+	if _, err := s.Controller.AuthDB.ViewLockout(LockoutUserPrefix + "ci"); err == nil {
+		t.Errorf("Expected the failures of the username to be reset")
+	}
+	if lockout, err := s.Controller.AuthDB.ViewLockout(LockoutAddressPrefix + "10.0.0.1"); err != nil || lockout.Failures != 2 {
+		t.Errorf("Expected the failures of the address to be kept, got %+v (%v)", lockout, err)
+	}
+
+	// Reaching the threshold locks the username from every address, unknown usernames are locked the same way
+	for username, remote := range map[string]string{"ci": "10.0.0.2", "ghost": "10.0.0.4"} {
+		for i := 0; i < 3; i++ {
+			_ = loginFrom(s, username, "wrong", remote)
+		}
+		err := loginFrom(s, username, "secret", "10.0.0.3")
+		lockErr := endpoint.AsError(err)
+		if lockErr.Code != endpoint.ErrorCodeUnauthenticated || lockErr.Details["locked_until"] == "" || !lockErr.Retryable {
+			t.Errorf("Expected %s to be locked, got %v", username, err)
+		}
+	}
+
+	// The address is locked once enough logins from it failed, whichever usernames they were for
+	for i := 0; i < 2; i++ {
+		_ = loginFrom(s, "other", "wrong", "10.0.0.2")
+	}
+	if err := loginFrom(s, "other", "secret", "10.0.0.2"); endpoint.AsError(err).Details["locked_until"] == "" {
+		t.Errorf("Expected the address to be locked, got %v", err)
+	}
+	if err := loginFrom(s, "other", "secret", "10.0.0.3"); err != nil {
+		t.Errorf("Expected logins from other addresses to succeed, got %v", err)
+	}
+
+	// Further failures after a lockout expired double its duration
+	now := time.Now()
+	if _, err := s.Controller.AuthDB.UpdateLockouts([]string{LockoutUserPrefix + "ghost"}, func(lockout *authndb.Lockout) {
+		expired := now.Add(-time.Second)
+		lockout.LockedUntil = &expired
+	}); err != nil {
+		t.Fatalf("Failed to update lockout: %v", err)
+	}
+	_ = loginFrom(s, "ghost", "wrong", "10.0.0.3")
+	if lockout, _ := s.Controller.AuthDB.ViewLockout(LockoutUserPrefix + "ghost"); lockout.Failures != 4 || lockout.LockedUntil.Sub(now) < 2*time.Minute {
+		t.Errorf("Expected the lockout to last two minutes, got %+v", lockout)
+	}
+
+	// Admins can list and clear the lockouts
+	out, err := callAs(t, s, -1, "admin", "auth/lockouts", endpoint.ActionRead, nil)
+	if err != nil {
+		t.Fatalf("Failed to list lockouts: %v", err)
+	}
+	var lockouts []*authndb.Lockout
+	if err := json.Unmarshal(out.Value, &lockouts); err != nil {
+		t.Fatalf("Failed to decode lockouts: %v", err)
+	}
+	if len(lockouts) != 6 || lockouts[0].Key != LockoutAddressPrefix+"10.0.0.1" {
+		t.Errorf("Expected the lockouts ordered by key, got %+v", lockouts)
+	}
+	if _, err := callAs(t, s, -1, "admin", "auth/lockouts/"+LockoutUserPrefix+"ci", endpoint.ActionDelete, nil); err != nil {
+		t.Fatalf("Failed to clear lockout: %v", err)
+	}
+	if err := loginFrom(s, "ci", "secret", "10.0.0.3"); err != nil {
+		t.Errorf("Expected the login to succeed once the lockout was cleared, got %v", err)
+	}
+	if _, err := callAs(t, s, -1, "admin", "auth/lockouts/"+LockoutUserPrefix+"ci", endpoint.ActionDelete, nil); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeNotFound {
+		t.Errorf("Expected clearing a missing lockout to be not found, got %v", err)
+	}
+	out, err = callAs(t, s, -1, "admin", "auth/lockouts", endpoint.ActionDelete, nil)
+	if err != nil {
+		t.Fatalf("Failed to clear lockouts: %v", err)
+	}
+	var cleared ClearedLockouts
+	if err := json.Unmarshal(out.Value, &cleared); err != nil || cleared.Cleared != 5 {
+		t.Errorf("Expected five lockouts to be cleared, got %+v (%v)", cleared, err)
+	}
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	s := newTestSubsystem(t)
+	for i := 0; i < 10; i++ {
+		_ = loginFrom(s, "ci", "wrong", "10.0.0.1")
+	}
+	if err := loginFrom(s, "ci", "secret", "10.0.0.1"); err != nil {
+		t.Errorf("Expected the login to succeed with lockouts disabled, got %v", err)
+	}
+	if lockouts, _ := s.Controller.AuthDB.ViewLockouts(); len(lockouts) != 0 {
+		t.Errorf("Expected no failures to be recorded, got %+v", lockouts)
+	}
+}
+
+func TestLockDuration(t *testing.T) {
+	policy := &lockoutPolicy{threshold: 3, addressThreshold: 5, unlock: time.Minute, maxUnlock: 4 * time.Minute}
+	tests := []struct {
+		name     string
+		key      string
+		failures int
+		expected time.Duration
+	}{
+		{name: "below threshold", key: LockoutUserPrefix + "ci", failures: 2, expected: 0},
+		{name: "threshold", key: LockoutUserPrefix + "ci", failures: 3, expected: time.Minute},
+		{name: "doubled", key: LockoutUserPrefix + "ci", failures: 4, expected: 2 * time.Minute},
+		{name: "capped", key: LockoutUserPrefix + "ci", failures: 9, expected: 4 * time.Minute},
+		{name: "address below threshold", key: LockoutAddressPrefix + "10.0.0.1", failures: 4, expected: 0},
+		{name: "address threshold", key: LockoutAddressPrefix + "10.0.0.1", failures: 5, expected: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := policy.lockDuration(tt.key, tt.failures); d != tt.expected {
+				t.Errorf("lockDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/totp"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+const (
+	// mfaChallengeTTL is how long a user has to enter a code after logging in with a password
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is the number of invalid codes after which the login has to be started again
+	mfaMaxAttempts = 5
+	// recoveryCodeCount is the number of recovery codes generated for a user
+	recoveryCodeCount = 10
+)
+
+// errInvalidCode is returned when a code doesn't match the TOTP secret or any unused recovery code
+var errInvalidCode = errors.New("invalid code")
+
+// MFALoginArgs is the struct for the arguments of the second step of a login
+type MFALoginArgs struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFACodeArgs is the struct for the arguments of requests that are confirmed with a code
+type MFACodeArgs struct {
+	Code string `json:"code"`
+}
+
+// UserMFAArgs is the struct for the arguments of requests about the multi-factor authentication of a user
+type UserMFAArgs struct {
+	ID int `json:"-" param:"id,required"`
+}
+
+// MFAChallengeOutput is the response to a password login of a user with multi-factor authentication. The login is
+// completed by sending the token and a code to auth/login/mfa.
+type MFAChallengeOutput struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MFAStatus is the multi-factor authentication status of a user
+type MFAStatus struct {
+	Enabled       bool `json:"enabled"`        // A code has been verified, logins need a code
+	Pending       bool `json:"pending"`        // Enrollment was started but hasn't been verified
+	Required      bool `json:"required"`       // The groups of the user require multi-factor authentication
+	RecoveryCodes int  `json:"recovery_codes"` // Number of unused recovery codes
+}
+
+// MFAEnrollment is the secret for an authenticator app, enrollment is completed by verifying a code from the app
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+// MFARecoveryCodes are the recovery codes of a user, they are only shown when they are generated
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaChallenge starts the second step of the login of the user
+func (s *Subsystem) mfaChallenge(user *authndb.User) (map[string][]string, []byte, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	challenge := &authndb.MFAChallenge{UserID: user.ID, ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	if err := s.Controller.AuthDB.CreateMFAChallenge(hashToken(token), challenge); err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(MFAChallengeOutput{MFARequired: true, MFAToken: token, ExpiresAt: challenge.ExpiresAt})
+	return nil, body, err
+}
+
+func (s *Subsystem) loginMFAHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
+	return helpers.HandleWrapperWithHeaders(in, func() (map[string][]string, []byte, error) {
+		var args MFALoginArgs
+		if err := endpoint.DecodeRequest(in, &args); err != nil {
+			return nil, nil, err
+		}
+		now := time.Now()
+		hash := hashToken(args.MFAToken)
+		challenge, err := s.Controller.AuthDB.ViewMFAChallenge(hash, now)
+		if err != nil {
+			return nil, nil, endpoint.UnauthenticatedError("mfa token is not valid")
+		}
+		user, err := s.Controller.AuthDB.ViewUser(challenge.UserID)
+		if err != nil {
+			return nil, nil, endpoint.UnauthenticatedError("mfa token is not valid")
+		}
+
+		// Invalid codes count towards the lockout of the user like invalid passwords
+		policy := s.lockoutPolicy()
+		var lockoutKeys []string
+		if policy != nil {
+			lockoutKeys = policy.keys(strings.ToLower(user.Username), in.Metadata[types.ContextRemoteAddr.String()])
+			if err := s.checkLockout(lockoutKeys, now); err != nil {
+				return nil, nil, err
+			}
+		}
+		_, err = s.Controller.AuthDB.UpdateMFA(user.ID, func(mfa *authndb.MFA) error {
+			if !mfa.Enabled {
+				return errInvalidCode
+			}
+			return useMFACode(mfa, args.Code, now, true)
+		})
+		if err != nil {
+			if err := s.Controller.AuthDB.FailMFAChallenge(hash, mfaMaxAttempts); err != nil {
+				s.Logger.Error("failed to record invalid code", zap.Error(err))
+			}
+			if policy != nil {
+				if err := s.recordLoginFailure(policy, lockoutKeys, now); err != nil {
+					s.Logger.Error("failed to record failed login", zap.Error(err))
+				}
+			}
+			return nil, nil, endpoint.UnauthenticatedError("invalid code")
+		}
+
+		// The challenge can only complete one login
+		if _, err := s.Controller.AuthDB.DeleteMFAChallenge(hash); err != nil {
+			return nil, nil, endpoint.UnauthenticatedError("mfa token is not valid")
+		}
+		if policy != nil {
+			s.resetLockout(strings.ToLower(user.Username))
+		}
+
+		token, err := s.createToken(user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.createAuth(user.ID, token); err != nil {
+			return nil, nil, err
+		}
+		return tokenResponse(token, false)
+	}, "authentication tokens")
+}
+
+func (s *Subsystem) mfaStatus(ctx context.Context, _ endpoint.Empty) (*MFAStatus, error) {
+	user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Required: s.mfaRequired(user)}
+	if mfa, err := s.Controller.AuthDB.ViewMFA(user.ID); err == nil {
+		status.Enabled = mfa.Enabled
+		status.Pending = !mfa.Enabled
+		status.RecoveryCodes = len(mfa.RecoveryCodes)
+	}
+	return status, nil
+}
+
+func (s *Subsystem) enrollMFA(ctx context.Context, _ endpoint.Empty) (*MFAEnrollment, error) {
+	user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Controller.AuthDB.MFAEnabled(user.ID) {
+		return nil, endpoint.ConflictError("mfa is already enabled, disable it before enrolling again")
+	}
+
+	// Enrolling again before verifying replaces the secret
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.PutMFA(&authndb.MFA{UserID: user.ID, Secret: secret, CreatedAt: time.Now()}); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("mfa enrollment started", zap.String("username", user.Username))
+	s.Controller.Config.RLock()
+	issuer := s.Controller.Config.Auth.MFA.Issuer
+	s.Controller.Config.RUnlock()
+	return &MFAEnrollment{Secret: secret, URL: totp.URL(issuer, user.Username, secret)}, nil
+}
+
+func (s *Subsystem) verifyMFA(ctx context.Context, args MFACodeArgs) (*MFARecoveryCodes, error) {
+	user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Controller.AuthDB.UpdateMFA(user.ID, func(mfa *authndb.MFA) error {
+		if mfa.Enabled {
+			return endpoint.ConflictError("mfa is already enabled")
+		}
+		if err := useMFACode(mfa, args.Code, time.Now(), false); err != nil {
+			return endpoint.InvalidArgumentError("invalid code").WithDetail("field", "code")
+		}
+		enabled := time.Now()
+		mfa.Enabled = true
+		mfa.EnabledAt = &enabled
+		mfa.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions that were started with only a password are signed out, the current one is kept
+	in, _ := endpoint.RequestFromContext(ctx)
+	var keep []string
+	if session := in.Metadata[types.ContextAuthSession.String()]; session != "" {
+		keep = append(keep, session)
+	}
+	revoked, err := s.Controller.AuthDB.DeleteUserSessions(user.ID, keep...)
+	if err != nil {
+		return nil, err
+	}
+	s.Logger.Info("mfa enabled", zap.String("username", user.Username), zap.Int("revoked_sessions", revoked))
+	return &MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (s *Subsystem) regenerateRecoveryCodes(ctx context.Context, args MFACodeArgs) (*MFARecoveryCodes, error) {
+	user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Controller.AuthDB.UpdateMFA(user.ID, func(mfa *authndb.MFA) error {
+		if !mfa.Enabled {
+			return endpoint.NotFoundError("mfa is not enabled")
+		}
+		if err := useMFACode(mfa, args.Code, time.Now(), true); err != nil {
+			return endpoint.InvalidArgumentError("invalid code").WithDetail("field", "code")
+		}
+		mfa.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Logger.Info("mfa recovery codes regenerated", zap.String("username", user.Username))
+	return &MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (s *Subsystem) disableMFA(ctx context.Context, args MFACodeArgs) (*MFAStatus, error) {
+	user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.mfaRequired(user) && s.Controller.AuthDB.MFAEnabled(user.ID) {
+		return nil, endpoint.PermissionDeniedError("mfa is required for the groups of user %s", user.Username)
+	}
+
+	// An enrollment that hasn't been verified can be canceled without a code
+	_, err = s.Controller.AuthDB.UpdateMFA(user.ID, func(mfa *authndb.MFA) error {
+		if mfa.Enabled && useMFACode(mfa, args.Code, time.Now(), true) != nil {
+			return endpoint.InvalidArgumentError("invalid code").WithDetail("field", "code")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.DeleteMFA(user.ID); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("mfa disabled", zap.String("username", user.Username))
+	return &MFAStatus{Required: s.mfaRequired(user)}, nil
+}
+
+func (s *Subsystem) resetUserMFA(ctx context.Context, args UserMFAArgs) (*MFAStatus, error) {
+	user, err := s.Controller.AuthDB.ViewUser(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.DeleteMFA(user.ID); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("mfa reset", zap.String("username", user.Username))
+	return &MFAStatus{Required: s.mfaRequired(user)}, nil
+}
+
+// mfaRequired returns true if any of the groups of the user require multi-factor authentication
+func (s *Subsystem) mfaRequired(user *authndb.User) bool {
+	s.Controller.Config.RLock()
+	required := s.Controller.Config.Auth.MFA.RequiredGroups
+	s.Controller.Config.RUnlock()
+	for _, group := range user.Groups {
+		if slices.Contains(required, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaSetupRequired returns true if the user has to enroll in multi-factor authentication before using anything but
+// the mfa endpoints
+func (s *Subsystem) mfaSetupRequired(user *authndb.User) bool {
+	return s.mfaRequired(user) && !s.Controller.AuthDB.MFAEnabled(user.ID)
+}
+
+// mfaSetupAllowed returns true if the endpoint can be used by users that still have to enroll
+func (s *Subsystem) mfaSetupAllowed(path string) bool {
+	return path == s.name+"/mfa" || strings.HasPrefix(path, s.name+"/mfa/") || path == s.name+"/logout"
+}
+
+// callerUser returns the user that made the request from the database, callers that aren't users in the database
+// such as certificate peers are refused
+func (s *Subsystem) callerUser(ctx context.Context) (*authndb.User, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	caller, _ := requestCaller(in)
+	user, err := s.Controller.AuthDB.ViewUser(caller.ID)
+	if err != nil || !strings.EqualFold(user.Username, caller.Username) {
+		return nil, endpoint.InvalidArgumentError("user %s isn't a local user", caller.Username)
+	}
+	return user, nil
+}
+
+// useMFACode checks the code against the TOTP secret and, when allowed, the recovery codes. Codes can only be used
+// once: the time step of a TOTP code is recorded and recovery codes are removed.
+func useMFACode(mfa *authndb.MFA, code string, now time.Time, recovery bool) error {
+	if counter, ok := totp.Validate(mfa.Secret, code, now); ok && counter > mfa.LastCounter {
+		mfa.LastCounter = counter
+		return nil
+	}
+	if recovery {
+		hash := hashRecoveryCode(code)
+		for i, h := range mfa.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				mfa.RecoveryCodes = slices.Delete(mfa.RecoveryCodes, i, i+1)
+				return nil
+			}
+		}
+	}
+	return errInvalidCode
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = alphabet[n.Int64()]
+		}
+		code := fmt.Sprintf("%s-%s", b[:5], b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the hash a recovery code is stored as, case, spaces and dashes are ignored
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+}
+
+// randomToken returns a random token for a login challenge
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
@@ -0,0 +1,212 @@
+package authn
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/totp"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+)
+
+// enrollMFAFor enables mfa for the user and returns the secret and recovery codes
+func enrollMFAFor(t *testing.T, s *Subsystem, userID int) (string, []string) {
+	t.Helper()
+	out, err := callAs(t, s, userID, "user", "auth/mfa/enroll", endpoint.ActionCreate, nil)
+	if err != nil {
+		t.Fatalf("Failed to enroll: %v", err)
+	}
+	var enrollment MFAEnrollment
+	if err := json.Unmarshal(out.Value, &enrollment); err != nil {
+		t.Fatalf("Failed to decode enrollment: %v", err)
+	}
+	if _, err := callAs(t, s, userID, "user", "auth/mfa/verify", endpoint.ActionCreate, MFACodeArgs{Code: "000000"}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+		t.Errorf("Expected an invalid code to be rejected, got %v", err)
+	}
+	out, err = callAs(t, s, userID, "user", "auth/mfa/verify", endpoint.ActionCreate, MFACodeArgs{Code: codeAt(t, enrollment.Secret, 0)})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	var codes MFARecoveryCodes
+	if err := json.Unmarshal(out.Value, &codes); err != nil {
+		t.Fatalf("Failed to decode recovery codes: %v", err)
+	}
+	return enrollment.Secret, codes.RecoveryCodes
+}
+
+// codeAt returns the code of the secret the number of periods away from now
+func codeAt(t *testing.T, secret string, periods int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Counter(time.Now())+periods)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	return code
+}
+
+// startMFALogin logs in with a password and returns the mfa token
+func startMFALogin(t *testing.T, s *Subsystem, username string) string {
+	t.Helper()
+	out, err := callAs(t, s, 0, "", "auth/login", endpoint.ActionCreate, authndb.UserArgs{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	var challenge MFAChallengeOutput
+	if err := json.Unmarshal(out.Value, &challenge); err != nil || !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("Expected an mfa challenge, got %s", out.Value)
+	}
+	return challenge.MFAToken
+}
+
+func loginMFA(t *testing.T, s *Subsystem, token string, code string) (AuthOutput, error) {
+	t.Helper()
+	var tokens AuthOutput
+	out, err := callAs(t, s, 0, "", "auth/login/mfa", endpoint.ActionCreate, MFALoginArgs{MFAToken: token, Code: code})
+	if err == nil {
+		err = json.Unmarshal(out.Value, &tokens)
+	}
+	return tokens, err
+}
+
+func TestMFALogin(t *testing.T) {
+	s := newTestSubsystem(t)
+	tokens := login(t, s, "ci")
+	secret, recovery := enrollMFAFor(t, s, 1)
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %v", recoveryCodeCount, recovery)
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); err == nil {
+		t.Errorf("Expected the password session to be revoked once mfa is enabled")
+	}
+	if _, err := callAs(t, s, 1, "user", "auth/mfa/enroll", endpoint.ActionCreate, nil); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeConflict {
+		t.Errorf("Expected enrolling again to conflict, got %v", err)
+	}
+
+	// The code used to verify enrollment can't be used again
+	mfa, _ := s.Controller.AuthDB.ViewMFA(1)
+	used, _ := totp.Code(secret, mfa.LastCounter)
+	token := startMFALogin(t, s, "ci")
+	tests := []struct {
+		name string
+		code string
+	}{
+		{name: "invalid code", code: "000000"},
+		{name: "reused code", code: used},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loginMFA(t, s, token, tt.code); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+				t.Errorf("Expected %s, got %v", endpoint.ErrorCodeUnauthenticated, err)
+			}
+		})
+	}
+	tokens, err := loginMFA(t, s, token, codeAt(t, secret, 1))
+	if err != nil {
+		t.Fatalf("Failed to complete login: %v", err)
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); err != nil {
+		t.Errorf("Expected the tokens to be valid, got %v", err)
+	}
+	if _, err := loginMFA(t, s, token, codeAt(t, secret, 1)); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected the mfa token to complete only one login, got %v", err)
+	}
+
+	// Recovery codes work once, in any case and without the dash
+	token = startMFALogin(t, s, "ci")
+	if _, err := loginMFA(t, s, token, " "+strings.ToUpper(recovery[0][:5])+recovery[0][6:]); err != nil {
+		t.Errorf("Expected the recovery code to be accepted, got %v", err)
+	}
+	token = startMFALogin(t, s, "ci")
+	if _, err := loginMFA(t, s, token, recovery[0]); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected the used recovery code to be rejected, got %v", err)
+	}
+	mfa, _ = s.Controller.AuthDB.ViewMFA(1)
+	if len(mfa.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("Expected one recovery code to be used, got %d left", len(mfa.RecoveryCodes))
+	}
+
+	// The challenge is dropped after too many invalid codes
+	for i := 1; i < mfaMaxAttempts; i++ {
+		loginMFA(t, s, token, "000000")
+	}
+	if _, err := loginMFA(t, s, token, recovery[1]); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected the challenge to be dropped, got %v", err)
+	}
+
+	// Disabling needs a code and makes the password enough again
+	if _, err := callAs(t, s, 1, "user", "auth/mfa/disable", endpoint.ActionCreate, MFACodeArgs{Code: "000000"}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+		t.Errorf("Expected disabling with an invalid code to fail, got %v", err)
+	}
+	if _, err := callAs(t, s, 1, "user", "auth/mfa/disable", endpoint.ActionCreate, MFACodeArgs{Code: recovery[2]}); err != nil {
+		t.Fatalf("Failed to disable mfa: %v", err)
+	}
+	if tokens := login(t, s, "ci"); tokens.AccessToken == "" {
+		t.Errorf("Expected the password login to return tokens")
+	}
+}
+
+func TestMFARequired(t *testing.T) {
+	s := newTestSubsystem(t)
+	out, err := callAs(t, s, 1, "user", "auth/apikeys", endpoint.ActionCreate, APIKeyArgs{Name: "ci"})
+	if err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+	var key APIKeyOutput
+	if err := json.Unmarshal(out.Value, &key); err != nil {
+		t.Fatalf("Failed to decode api key: %v", err)
+	}
+	s.Controller.Config.Auth.MFA = config.MFAEntry{Issuer: "DTAC Agent", RequiredGroups: []string{"user"}}
+
+	// Api keys made before mfa was required don't get around it
+	if _, err := authenticate(s, key.Key, "system/info", endpoint.ActionRead); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodePermissionDenied {
+		t.Errorf("Expected the api key to be denied, got %v", err)
+	}
+
+	// Until they have enrolled, users of the group can only use the mfa endpoints
+	tokens := login(t, s, "ci")
+	if !tokens.MFASetupRequired {
+		t.Errorf("Expected the login to require mfa setup")
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodePermissionDenied {
+		t.Errorf("Expected %s, got %v", endpoint.ErrorCodePermissionDenied, err)
+	}
+	for _, path := range []string{"auth/mfa", "auth/mfa/enroll", "auth/logout"} {
+		in := &endpoint.Request{Metadata: map[string]string{
+			types.ContextAuthHeader.String():   "Bearer " + tokens.AccessToken,
+			types.ContextResourcePath.String(): path,
+		}}
+		if _, err := s.AuthenticationHandler(func(in *endpoint.Request) (*endpoint.Response, error) {
+			return &endpoint.Response{}, nil
+		})(in); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", path, err)
+		}
+	}
+
+	secret, _ := enrollMFAFor(t, s, 1)
+	if _, err := callAs(t, s, 1, "user", "auth/mfa/disable", endpoint.ActionCreate, MFACodeArgs{Code: codeAt(t, secret, 1)}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodePermissionDenied {
+		t.Errorf("Expected disabling required mfa to be denied, got %v", err)
+	}
+	token := startMFALogin(t, s, "ci")
+	tokens, err = loginMFA(t, s, token, codeAt(t, secret, 1))
+	if err != nil {
+		t.Fatalf("Failed to complete login: %v", err)
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); err != nil {
+		t.Errorf("Expected the enrolled user to be allowed, got %v", err)
+	}
+	if _, err := authenticate(s, key.Key, "system/info", endpoint.ActionRead); err != nil {
+		t.Errorf("Expected the api key of the enrolled user to be allowed, got %v", err)
+	}
+
+	// Admins can reset the mfa of a user that lost their device
+	if _, err := callAs(t, s, -1, "admin", "auth/users/1/mfa", endpoint.ActionDelete, nil); err != nil {
+		t.Fatalf("Failed to reset mfa: %v", err)
+	}
+	if s.Controller.AuthDB.MFAEnabled(1) {
+		t.Errorf("Expected mfa to be reset")
+	}
+}
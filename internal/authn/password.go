@@ -0,0 +1,298 @@
+package authn
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxPasswordLength is the longest password, in bytes, that bcrypt can hash
+	maxPasswordLength = 72
+	// generatedPasswordLength is the length of the password generated for the admin on the first run
+	generatedPasswordLength = 20
+)
+
+// PasswordArgs is the struct for the arguments of a password change
+type PasswordArgs struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (s *Subsystem) changePassword(ctx context.Context, args PasswordArgs) (*authndb.User, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	caller, _ := requestCaller(in)
+	user, err := s.Controller.AuthDB.ViewUser(caller.ID)
+	if err != nil || !strings.EqualFold(user.Username, caller.Username) {
+		return nil, endpoint.InvalidArgumentError("user %s doesn't have a password", caller.Username)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(args.OldPassword)) != nil {
+		return nil, endpoint.InvalidArgumentError("old password is incorrect").WithDetail("field", "old_password")
+	}
+	if err := s.setPassword(user, args.NewPassword); err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	// Other sessions are signed out, the session used to change the password is kept
+	var keep []string
+	if session := in.Metadata[types.ContextAuthSession.String()]; session != "" {
+		keep = append(keep, session)
+	}
+	revoked, err := s.Controller.AuthDB.DeleteUserSessions(user.ID, keep...)
+	if err != nil {
+		return nil, err
+	}
+	s.Logger.Info("password changed", zap.String("username", user.Username), zap.Int("revoked_sessions", revoked))
+
+	if user.ID == -1 {
+		s.markAdminPassword(true)
+	}
+	return s.Controller.AuthDB.SafeViewUser(user.ID)
+}
+
+// setPassword checks the password against the policy and sets it on the user. The previous password is added to the
+// history of the user, it isn't saved to the database.
+func (s *Subsystem) setPassword(user *authndb.User, password string) error {
+	if err := s.checkPassword(user, password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.Controller.Config.RLock()
+	history := s.Controller.Config.Auth.PasswordPolicy.History
+	s.Controller.Config.RUnlock()
+	if user.Password != "" && history > 1 {
+		user.PasswordHistory = append([]string{user.Password}, user.PasswordHistory...)
+	}
+	if len(user.PasswordHistory) > max(history-1, 0) {
+		user.PasswordHistory = user.PasswordHistory[:max(history-1, 0)]
+	}
+	changed := time.Now()
+	user.Password = string(hash)
+	user.PasswordChangedAt = &changed
+	return nil
+}
+
+// checkPassword returns an error describing why the password doesn't meet the policy. The history counts the current
+// password of the user as one of the passwords that can't be reused.
+func (s *Subsystem) checkPassword(user *authndb.User, password string) error {
+	s.Controller.Config.RLock()
+	policy := s.Controller.Config.Auth.PasswordPolicy
+	s.Controller.Config.RUnlock()
+	invalid := func(format string, args ...interface{}) error {
+		return endpoint.InvalidArgumentError(format, args...).WithDetail("field", "password")
+	}
+
+	switch {
+	case password == "":
+		return invalid("password must not be empty")
+	case len([]rune(password)) < policy.MinLength:
+		return invalid("password must be at least %d characters long", policy.MinLength)
+	case len(password) > maxPasswordLength:
+		return invalid("password must not be longer than %d bytes", maxPasswordLength)
+	case passwordClasses(password) < policy.MinClasses:
+		return invalid("password must contain at least %d of lowercase letters, uppercase letters, digits and symbols", policy.MinClasses)
+	}
+
+	if policy.BreachedList != "" {
+		breached, err := s.breached.contains(policy.BreachedList, password)
+		if err != nil {
+			s.Logger.Error("failed to read breached password list", zap.String("file", policy.BreachedList), zap.Error(err))
+			return endpoint.UnavailableError("unable to check the password against the breached password list")
+		}
+		if breached {
+			return invalid("password appears in a list of breached passwords")
+		}
+	}
+
+	if policy.History > 0 && user.Password != "" {
+		previous := append([]string{user.Password}, user.PasswordHistory...)
+		for _, hash := range previous[:min(policy.History, len(previous))] {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				return invalid("password must not be one of the last %d passwords", policy.History)
+			}
+		}
+	}
+	return nil
+}
+
+// passwordClasses returns how many of lowercase letters, uppercase letters, digits and symbols the password contains
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// breachedList is the set of breached passwords read from a file. The file is read again when it changes.
+type breachedList struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	hashes  map[string]struct{}
+}
+
+// contains returns true if the password is in the list in the file. Lines are passwords in plain text or their SHA-1
+// hashes, the hashes can be followed by a count as in the Have I Been Pwned downloads.
+func (b *breachedList) contains(path string, password string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if b.hashes == nil || b.path != path || !info.ModTime().Equal(b.modTime) {
+		hashes, err := readBreachedList(path)
+		if err != nil {
+			return false, err
+		}
+		b.path, b.modTime, b.hashes = path, info.ModTime(), hashes
+	}
+	_, ok := b.hashes[sha1Hex(password)]
+	return ok, nil
+}
+
+func readBreachedList(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); len(hash) == sha1.Size*2 && isHex(hash) {
+			hashes[strings.ToUpper(hash)] = struct{}{}
+		} else {
+			hashes[sha1Hex(line)] = struct{}{}
+		}
+	}
+	return hashes, scanner.Err()
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// adminPassword returns the password to set for the admin from the configuration. A random password is generated
+// when auth.pass hasn't been set, it is written to a file next to the database that only the owner can read so it can
+// be looked up. The configuration file is left alone and the password is never logged.
+func (s *Subsystem) adminPassword() (string, error) {
+	cfg := s.Controller.Config
+	if cfg.Auth.Pass != "" && cfg.Auth.Pass != config.GeneratePasswordMarker {
+		return cfg.Auth.Pass, nil
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return "", err
+	}
+	filename := s.adminPasswordFile()
+	if err := writeAdminPassword(filename, password); err != nil {
+		return "", fmt.Errorf("failed to save generated password: %v", err)
+	}
+	s.Logger.Warn("generated an admin password, read it from the file and change it", zap.String("file", filename))
+	return password, nil
+}
+
+// adminPasswordFile returns the name of the file the generated admin password is written to
+func (s *Subsystem) adminPasswordFile() string {
+	return filepath.Join(filepath.Dir(s.Controller.AuthDB.DB.Path()), config.AdminPasswordFile)
+}
+
+// markAdminPassword records whether the admin password has been changed through the API, which the cli checks
+// before logging in with auth.pass. Once it has been changed the generated password isn't needed anymore.
+func (s *Subsystem) markAdminPassword(changed bool) {
+	marker := filepath.Join(filepath.Dir(s.Controller.AuthDB.DB.Path()), config.AdminPasswordChangedFile)
+	if !changed {
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			s.Logger.Warn("failed to remove the admin password marker", zap.Error(err))
+		}
+		return
+	}
+	if err := os.Remove(s.adminPasswordFile()); err != nil && !os.IsNotExist(err) {
+		s.Logger.Warn("failed to remove the generated admin password", zap.Error(err))
+	}
+	if err := os.WriteFile(marker, nil, 0o600); err != nil {
+		s.Logger.Warn("failed to mark the admin password as changed", zap.Error(err))
+	}
+}
+
+// generatePassword returns a random password containing lowercase letters, uppercase letters and digits
+func generatePassword() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	for {
+		b := make([]byte, generatedPasswordLength)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = alphabet[n.Int64()]
+		}
+		if password := string(b); passwordClasses(password) == 3 {
+			return password, nil
+		}
+	}
+}
+
+// writeAdminPassword writes the password to a new file that only the owner can read, a file left from an earlier
+// run is replaced
+func writeAdminPassword(filename string, password string) error {
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(password + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,228 @@
+package authn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// changePasswordWith changes the password with the request metadata of an authenticated user
+func changePasswordWith(t *testing.T, s *Subsystem, metadata map[string]string, args PasswordArgs) error {
+	t.Helper()
+	body, _ := json.Marshal(args)
+	for _, ep := range s.endpoints {
+		if ep.Path == "auth/password" {
+			_, err := ep.Function(&endpoint.Request{Metadata: metadata, Body: body})
+			return err
+		}
+	}
+	t.Fatalf("No endpoint for auth/password")
+	return nil
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestSubsystem(t)
+	s.Controller.Config.Auth.PasswordPolicy = config.PasswordPolicyEntry{MinLength: 8, MinClasses: 3, History: 2}
+
+	current := login(t, s, "ci")
+	other := login(t, s, "ci")
+	metadata, err := authenticateToken(s, current.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args PasswordArgs
+	}{
+		{name: "wrong old password", args: PasswordArgs{OldPassword: "wrong", NewPassword: "Passw0rd-1"}},
+		{name: "weak new password", args: PasswordArgs{OldPassword: "secret", NewPassword: "password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := changePasswordWith(t, s, metadata, tt.args); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+				t.Errorf("Expected %s, got %v", endpoint.ErrorCodeInvalidArgument, err)
+			}
+		})
+	}
+
+	// Changing the password signs out every other session of the user
+	if err := changePasswordWith(t, s, metadata, PasswordArgs{OldPassword: "secret", NewPassword: "Passw0rd-1"}); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+	if _, err := authenticateToken(s, current.AccessToken); err != nil {
+		t.Errorf("Expected the session used to change the password to be kept, got %v", err)
+	}
+	if _, err := authenticateToken(s, other.AccessToken); err == nil {
+		t.Errorf("Expected the other session to be revoked")
+	}
+	if err := loginFrom(s, "ci", "secret", ""); err == nil {
+		t.Errorf("Expected the old password to be rejected")
+	}
+	if err := loginFrom(s, "ci", "Passw0rd-1", ""); err != nil {
+		t.Errorf("Expected the new password to be accepted, got %v", err)
+	}
+
+	// Recent passwords can't be reused
+	metadata, _ = authenticateToken(s, current.AccessToken)
+	if err := changePasswordWith(t, s, metadata, PasswordArgs{OldPassword: "Passw0rd-1", NewPassword: "Passw0rd-2"}); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+	err = changePasswordWith(t, s, metadata, PasswordArgs{OldPassword: "Passw0rd-2", NewPassword: "Passw0rd-1"})
+	if endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument || !strings.Contains(err.Error(), "last 2 passwords") {
+		t.Errorf("Expected the previous password to be rejected, got %v", err)
+	}
+	user, _ := s.Controller.AuthDB.ViewUser(1)
+	if len(user.PasswordHistory) != 1 || user.PasswordChangedAt == nil {
+		t.Errorf("Expected one previous password to be kept, got %+v", user)
+	}
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	s := newTestSubsystem(t)
+	s.Controller.Config.Auth.PasswordPolicy = config.PasswordPolicyEntry{MinLength: 8, MinClasses: 3, History: 5}
+	tokens := login(t, s, "ci")
+
+	// The masked password returned by the safe view keeps the password and sessions
+	update := func(password string) error {
+		_, err := callAs(t, s, -1, "admin", "auth/users/1", endpoint.ActionWrite, map[string]interface{}{
+			"username":         "ci",
+			"password":         password,
+			"groups":           []string{"user"},
+			"password_history": []string{"injected"},
+		})
+		return err
+	}
+	if err := update(authndb.MaskedPassword); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if err := loginFrom(s, "ci", "secret", ""); err != nil {
+		t.Errorf("Expected the password to be kept, got %v", err)
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); err != nil {
+		t.Errorf("Expected the session to be kept, got %v", err)
+	}
+	if err := update("weak"); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+		t.Errorf("Expected the weak password to be rejected, got %v", err)
+	}
+
+	// A new password is hashed and signs out the user
+	if err := update("Passw0rd-1"); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, err := authenticateToken(s, tokens.AccessToken); err == nil {
+		t.Errorf("Expected the session to be revoked")
+	}
+	user, _ := s.Controller.AuthDB.ViewUser(1)
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Passw0rd-1")) != nil {
+		t.Errorf("Expected the new password to be hashed")
+	}
+	if len(user.PasswordHistory) != 1 || user.PasswordHistory[0] == "injected" {
+		t.Errorf("Expected the history to hold the previous password, got %v", user.PasswordHistory)
+	}
+
+	out, err := callAs(t, s, -1, "admin", "auth/users", endpoint.ActionRead, nil)
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if strings.Contains(string(out.Value), "password_history") {
+		t.Errorf("Expected the password history to be hidden, got %s", out.Value)
+	}
+	if _, err := callAs(t, s, -1, "admin", "auth/users", endpoint.ActionCreate, authndb.User{Username: "weak", Password: "password"}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+		t.Errorf("Expected creating a user with a weak password to be rejected, got %v", err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(list, []byte("Password123!\n"+sha1Hex("Summer2024!!")+":42\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write breached list: %v", err)
+	}
+	s := newTestSubsystem(t)
+	s.Controller.Config.Auth.PasswordPolicy = config.PasswordPolicyEntry{MinLength: 10, MinClasses: 3, BreachedList: list, History: 3}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Previous-pw1"), bcrypt.MinCost)
+	user := &authndb.User{Password: string(hash)}
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{name: "valid", password: "Correct-horse1", valid: true},
+		{name: "empty", password: ""},
+		{name: "too short", password: "Short-1"},
+		{name: "too long", password: "Long-1" + strings.Repeat("x", maxPasswordLength)},
+		{name: "too few classes", password: "alllowercase1"},
+		{name: "breached plain text", password: "Password123!"},
+		{name: "breached hash", password: "Summer2024!!"},
+		{name: "current password", password: "Previous-pw1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkPassword(user, tt.password)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkPassword() = %v, want valid=%v", err, tt.valid)
+			}
+		})
+	}
+
+	s.Controller.Config.Auth.PasswordPolicy.BreachedList = filepath.Join(t.TempDir(), "missing.txt")
+	if err := s.checkPassword(user, "Correct-horse1"); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnavailable {
+		t.Errorf("Expected a missing breached list to fail the check, got %v", err)
+	}
+}
+
+func TestAdminPassword(t *testing.T) {
+	password, err := generatePassword()
+	if err != nil {
+		t.Fatalf("Failed to generate password: %v", err)
+	}
+	if len(password) != generatedPasswordLength || passwordClasses(password) != 3 {
+		t.Errorf("Unexpected generated password %s", password)
+	}
+
+	s := newTestSubsystem(t)
+	s.Controller.Config.Auth.Pass = config.GeneratePasswordMarker
+	generated, err := s.adminPassword()
+	if err != nil || generated == config.GeneratePasswordMarker {
+		t.Fatalf("Expected a generated password, got %s (%v)", generated, err)
+	}
+	if s.Controller.Config.Auth.Pass != config.GeneratePasswordMarker {
+		t.Errorf("Expected the configuration to be left alone, got %s", s.Controller.Config.Auth.Pass)
+	}
+	info, err := os.Stat(s.adminPasswordFile())
+	if err != nil {
+		t.Fatalf("Expected the password to be written to a file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the password file to be readable by the owner only, got %v", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(s.adminPasswordFile()); string(data) != generated+"\n" {
+		t.Errorf("Expected the file to hold the generated password, got %s", data)
+	}
+	s.Controller.Config.Auth.Pass = "configured"
+	if configured, _ := s.adminPassword(); configured != "configured" {
+		t.Errorf("Expected the configured password, got %s", configured)
+	}
+
+	// Changing the password through the api drops the generated one and marks auth.pass as no longer applied
+	marker := filepath.Join(filepath.Dir(s.adminPasswordFile()), config.AdminPasswordChangedFile)
+	s.markAdminPassword(true)
+	if _, err := os.Stat(s.adminPasswordFile()); !os.IsNotExist(err) {
+		t.Errorf("Expected the generated password to be removed, got %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected the password to be marked as changed: %v", err)
+	}
+	s.markAdminPassword(false)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("Expected the marker to be removed, got %v", err)
+	}
+}
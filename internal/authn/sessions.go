@@ -0,0 +1,187 @@
+package authn
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// tokenPurgeInterval is the time between removing expired sessions and token entries from the database
+const tokenPurgeInterval = 10 * time.Minute
+
+// RefreshArgs is the struct for the refresh arguments validation
+type RefreshArgs struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionArgs is the struct for the arguments of requests about a single session
+type SessionArgs struct {
+	ID string `json:"-" param:"id,required"`
+}
+
+// UserSessionsArgs is the struct for the arguments of requests about the sessions of a user
+type UserSessionsArgs struct {
+	ID int `json:"-" param:"id,required"`
+}
+
+// RevokedSessions is the result of revoking the sessions of a user
+type RevokedSessions struct {
+	UserID  int `json:"user_id"`
+	Revoked int `json:"revoked"`
+}
+
+func (s *Subsystem) refreshHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
+	return helpers.HandleWrapperWithHeaders(in, func() (map[string][]string, []byte, error) {
+		var args RefreshArgs
+		if err := endpoint.DecodeRequest(in, &args); err != nil {
+			return nil, nil, err
+		}
+		if args.RefreshToken == "" {
+			return nil, nil, endpoint.InvalidArgumentError("missing refresh_token")
+		}
+
+		refreshUUID, userID, err := s.verifyRefreshToken(args.RefreshToken)
+		if err != nil {
+			s.Logger.Error("failed to verify refresh token", zap.Error(err))
+			return nil, nil, endpoint.UnauthenticatedError("unable to authorize refresh token")
+		}
+
+		// The session keeps its ID, the refresh token that was used is replaced so it can't be used again
+		var token *authndb.TokenDetails
+		session, err := s.Controller.AuthDB.RefreshSession(refreshUUID, func(session *authndb.Session) error {
+			if session.UserID != userID {
+				return endpoint.UnauthenticatedError("unable to authorize refresh token")
+			}
+			created, err := s.createToken(session.UserID)
+			if err != nil {
+				return err
+			}
+			token = created
+			refreshed := time.Now()
+			session.AccessUUID = token.AccessUUID
+			session.RefreshUUID = token.RefreshUUID
+			session.AtExpires = token.AtExpires
+			session.RtExpires = token.RtExpires
+			session.RefreshedAt = &refreshed
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		s.Logger.Debug("session refreshed", zap.String("session", session.ID), zap.Int("user_id", session.UserID))
+
+		return tokenResponse(token, false)
+	}, "authentication tokens")
+}
+
+func (s *Subsystem) logoutHandler(ctx context.Context, _ endpoint.Empty) (*authndb.Session, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	if in == nil || in.Metadata[types.ContextAuthSession.String()] == "" {
+		return nil, endpoint.InvalidArgumentError("request was not authenticated with an access token")
+	}
+	return s.revokeSession(in.Metadata[types.ContextAuthSession.String()])
+}
+
+func (s *Subsystem) listSessions(ctx context.Context, _ endpoint.Empty) ([]*authndb.Session, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	caller, admin := requestCaller(in)
+
+	all, err := s.Controller.AuthDB.SafeViewSessions()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*authndb.Session, 0, len(all))
+	for _, session := range all {
+		if admin || session.UserID == caller.ID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *Subsystem) deleteSession(ctx context.Context, args SessionArgs) (*authndb.Session, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	session, err := s.Controller.AuthDB.ViewSession(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if caller, admin := requestCaller(in); !admin && session.UserID != caller.ID {
+		return nil, endpoint.NotFoundError("session %s not found", args.ID)
+	}
+	return s.revokeSession(session.ID)
+}
+
+func (s *Subsystem) deleteUserSessions(ctx context.Context, args UserSessionsArgs) (*RevokedSessions, error) {
+	removed, err := s.Controller.AuthDB.DeleteUserSessions(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.Logger.Info("user sessions revoked", zap.Int("user_id", args.ID), zap.Int("count", removed))
+	return &RevokedSessions{UserID: args.ID, Revoked: removed}, nil
+}
+
+// revokeSession deletes the session and its tokens and returns it without the token UUIDs
+func (s *Subsystem) revokeSession(id string) (*authndb.Session, error) {
+	session, err := s.Controller.AuthDB.ViewSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Controller.AuthDB.DeleteSession(id); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("session revoked", zap.String("session", session.ID), zap.Int("user_id", session.UserID))
+	session.AccessUUID = ""
+	session.RefreshUUID = ""
+	return session, nil
+}
+
+// verifyRefreshToken verifies the refresh token and returns its UUID and user ID
+func (s *Subsystem) verifyRefreshToken(tokenStr string) (refreshUUID string, userID int, err error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(base64.URLEncoding.EncodeToString([]byte(os.Getenv("REFRESH_SECRET")))), nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", 0, errors.New("failed to get claims from token")
+	}
+	refreshUUID, ok = claims["refresh_uuid"].(string)
+	if !ok {
+		return "", 0, errors.New("unable to extract refresh id from token")
+	}
+	id, ok := claims["user_id"].(float64)
+	if !ok {
+		return "", 0, errors.New("unable to extract user id from token")
+	}
+	return refreshUUID, int(id), nil
+}
+
+// purgeTokens removes the sessions, token entries and mfa challenges that have expired
+func (s *Subsystem) purgeTokens() {
+	if removed, err := s.Controller.AuthDB.PurgeExpiredTokens(time.Now()); err != nil {
+		s.Logger.Warn("failed to purge expired tokens", zap.Error(err))
+	} else if removed > 0 {
+		s.Logger.Debug("purged expired tokens", zap.Int("count", removed))
+	}
+	if removed, err := s.Controller.AuthDB.PurgeMFAChallenges(time.Now()); err != nil {
+		s.Logger.Warn("failed to purge expired mfa challenges", zap.Error(err))
+	} else if removed > 0 {
+		s.Logger.Debug("purged expired mfa challenges", zap.Int("count", removed))
+	}
+}
@@ -0,0 +1,185 @@
+package authn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// login logs in as the user and returns the tokens
+func login(t *testing.T, s *Subsystem, username string) AuthOutput {
+	t.Helper()
+	out, err := callAs(t, s, 0, "", "auth/login", endpoint.ActionCreate, authndb.UserArgs{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	var tokens AuthOutput
+	if err := json.Unmarshal(out.Value, &tokens); err != nil {
+		t.Fatalf("Failed to decode tokens: %v", err)
+	}
+	return tokens
+}
+
+// authenticateToken runs the authentication middleware with the access token and returns the request metadata
+func authenticateToken(s *Subsystem, token string) (map[string]string, error) {
+	in := &endpoint.Request{Metadata: map[string]string{
+		types.ContextAuthHeader.String():  "Bearer " + token,
+		types.ContextAuthSession.String(): "injected",
+	}}
+	_, err := s.AuthenticationHandler(func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{}, nil
+	})(in)
+	return in.Metadata, err
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestSubsystem(t)
+
+	first := login(t, s, "ci")
+	metadata, err := authenticateToken(s, first.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected the access token to authenticate, got %v", err)
+	}
+	session := metadata[types.ContextAuthSession.String()]
+	if session == "" || session == "injected" {
+		t.Errorf("Expected the session of the access token, got '%s'", session)
+	}
+
+	// Refreshing replaces both tokens, the refresh token can only be used once
+	out, err := callAs(t, s, 0, "", "auth/refresh", endpoint.ActionCreate, RefreshArgs{RefreshToken: first.RefreshToken})
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	var refreshed AuthOutput
+	if err := json.Unmarshal(out.Value, &refreshed); err != nil {
+		t.Fatalf("Failed to decode tokens: %v", err)
+	}
+	if _, err := authenticateToken(s, first.AccessToken); err == nil {
+		t.Errorf("Expected the replaced access token to be rejected")
+	}
+	if metadata, err := authenticateToken(s, refreshed.AccessToken); err != nil || metadata[types.ContextAuthSession.String()] != session {
+		t.Errorf("Expected the refreshed access token to belong to session %s, got %v", session, err)
+	}
+	if _, err := callAs(t, s, 0, "", "auth/refresh", endpoint.ActionCreate, RefreshArgs{RefreshToken: first.RefreshToken}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected the used refresh token to be rejected, got %v", err)
+	}
+	if _, err := callAs(t, s, 0, "", "auth/refresh", endpoint.ActionCreate, RefreshArgs{RefreshToken: first.AccessToken}); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeUnauthenticated {
+		t.Errorf("Expected an access token to be rejected as a refresh token, got %v", err)
+	}
+
+	// Sessions are only visible to their owner and admins
+	second := login(t, s, "ci")
+	other := login(t, s, "other")
+	for _, tt := range []struct {
+		userID int
+		roles  string
+		count  int
+	}{{1, "user", 2}, {2, "user", 1}, {-1, "admin", 3}} {
+		out, err := callAs(t, s, tt.userID, tt.roles, "auth/sessions", endpoint.ActionRead, nil)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		var sessions []*authndb.Session
+		if err := json.Unmarshal(out.Value, &sessions); err != nil {
+			t.Fatalf("Failed to decode sessions: %v", err)
+		}
+		if len(sessions) != tt.count || sessions[0].AccessUUID != "" || sessions[0].RefreshUUID != "" {
+			t.Errorf("User %d expected %d sessions without token ids, got %+v", tt.userID, tt.count, sessions)
+		}
+		if tt.userID == 1 && (sessions[0].ID != session || sessions[0].RefreshedAt == nil) {
+			t.Errorf("Expected the refreshed session first, got %+v", sessions[0])
+		}
+	}
+	if _, err := callAs(t, s, 2, "user", "auth/sessions/"+session, endpoint.ActionDelete, nil); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeNotFound {
+		t.Errorf("Expected another user's session to be not found, got %v", err)
+	}
+
+	// Logging out revokes the tokens of the session the request was authenticated with
+	metadata, _ = authenticateToken(s, refreshed.AccessToken)
+	if _, err := callAs(t, s, 1, "user", "auth/logout", endpoint.ActionCreate, nil); endpoint.ErrorCodeOf(err) != endpoint.ErrorCodeInvalidArgument {
+		t.Errorf("Expected logging out without a session to fail, got %v", err)
+	}
+	logout := s.endpoints[0]
+	for _, ep := range s.endpoints {
+		if ep.Path == "auth/logout" {
+			logout = ep
+		}
+	}
+	if _, err := logout.Function(&endpoint.Request{Metadata: metadata}); err != nil {
+		t.Fatalf("Failed to logout: %v", err)
+	}
+	if _, err := authenticateToken(s, refreshed.AccessToken); err == nil {
+		t.Errorf("Expected the access token to be rejected after logout")
+	}
+	if _, err := callAs(t, s, 0, "", "auth/refresh", endpoint.ActionCreate, RefreshArgs{RefreshToken: refreshed.RefreshToken}); err == nil {
+		t.Errorf("Expected the refresh token to be rejected after logout")
+	}
+
+	// Admins can revoke every session of a user
+	out, err = callAs(t, s, -1, "admin", "auth/users/1/sessions", endpoint.ActionDelete, nil)
+	if err != nil {
+		t.Fatalf("Failed to revoke sessions: %v", err)
+	}
+	var revoked RevokedSessions
+	if err := json.Unmarshal(out.Value, &revoked); err != nil || revoked.Revoked != 1 {
+		t.Errorf("Expected one session to be revoked, got %+v (%v)", revoked, err)
+	}
+	if _, err := authenticateToken(s, second.AccessToken); err == nil {
+		t.Errorf("Expected the access token to be rejected after its sessions were revoked")
+	}
+	if _, err := authenticateToken(s, other.AccessToken); err != nil {
+		t.Errorf("Expected the other user's session to be kept, got %v", err)
+	}
+}
+
+func TestPurgeExpiredTokens(t *testing.T) {
+	s := newTestSubsystem(t)
+	db := s.Controller.AuthDB
+	now := time.Now()
+
+	sessions := []*authndb.Session{
+		{ID: "active", UserID: 1, AccessUUID: "active-access", RefreshUUID: "active-refresh", AtExpires: now.Add(time.Minute).Unix(), RtExpires: now.Add(time.Hour).Unix()},
+		{ID: "idle", UserID: 1, AccessUUID: "idle-access", RefreshUUID: "idle-refresh", AtExpires: now.Add(-time.Minute).Unix(), RtExpires: now.Add(time.Hour).Unix()},
+		{ID: "expired", UserID: 1, AccessUUID: "expired-access", RefreshUUID: "expired-refresh", AtExpires: now.Add(-time.Hour).Unix(), RtExpires: now.Add(-time.Minute).Unix()},
+	}
+	for _, session := range sessions {
+		if err := db.CreateSession(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	// A token entry left without its session
+	if err := db.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("tokens")).Put([]byte("orphan"), []byte("1"))
+	}); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	removed, err := db.PurgeExpiredTokens(now)
+	if err != nil {
+		t.Fatalf("Failed to purge tokens: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected the expired session, the idle access token and the orphan to be removed, got %d", removed)
+	}
+	for uuid, kept := range map[string]bool{
+		"active-access": true, "active-refresh": true, "idle-access": false, "idle-refresh": true,
+		"expired-access": false, "expired-refresh": false, "orphan": false,
+	} {
+		var found bool
+		db.DB.View(func(tx *bolt.Tx) error {
+			found = tx.Bucket([]byte("tokens")).Get([]byte(uuid)) != nil
+			return nil
+		})
+		if found != kept {
+			t.Errorf("Token %s: expected kept=%v", uuid, kept)
+		}
+	}
+	if _, err := db.ViewSession("expired"); err == nil {
+		t.Errorf("Expected the expired session to be deleted")
+	}
+}
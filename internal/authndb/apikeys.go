@@ -0,0 +1,122 @@
+package authndb
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// APIKey is the struct for an API key. Only the hash of the secret is stored, the key itself is shown once when it is
+// created or rotated.
+type APIKey struct {
+	ID        string     `json:"id"`                   // Key ID, the public part of the key
+	Name      string     `json:"name"`                 // Name describing what the key is used for
+	UserID    int        `json:"user_id"`              // ID of the user that owns the key
+	Hash      string     `json:"hash,omitempty"`       // Secret stored as sha256 hash
+	Paths     []string   `json:"paths,omitempty"`      // Endpoint paths the key is restricted to
+	Actions   []string   `json:"actions,omitempty"`    // Endpoint actions the key is restricted to
+	CreatedAt time.Time  `json:"created_at"`           // When the key was created
+	RotatedAt *time.Time `json:"rotated_at,omitempty"` // When the secret was last replaced
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the key expires, keys without one never expire
+	LastUsed  *time.Time `json:"last_used,omitempty"`  // When the key was last used to authenticate
+}
+
+// UpdateAPIKey creates or updates the API key in the authn database
+func (db *AuthDB) UpdateAPIKey(key *APIKey) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.apiKeyBucket))
+
+		buf, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key.ID), buf)
+	})
+}
+
+// TouchAPIKey records that the API key was used. The key is read and written in a single transaction so a concurrent
+// rotation isn't undone.
+func (db *AuthDB) TouchAPIKey(id string, used time.Time) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.apiKeyBucket))
+
+		v := b.Get([]byte(id))
+		if v == nil {
+			return endpoint.NotFoundError("api key %s not found", id)
+		}
+		var key APIKey
+		if err := json.Unmarshal(v, &key); err != nil {
+			return err
+		}
+		key.LastUsed = &used
+
+		buf, err := json.Marshal(&key)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), buf)
+	})
+}
+
+// DeleteAPIKey deletes the API key from the authn database
+func (db *AuthDB) DeleteAPIKey(id string) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.apiKeyBucket))
+		if b.Get([]byte(id)) == nil {
+			return endpoint.NotFoundError("api key %s not found", id)
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// ViewAPIKey views the specified API key in the authn database
+func (db *AuthDB) ViewAPIKey(id string) (key *APIKey, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.apiKeyBucket))
+
+		v := b.Get([]byte(id))
+		if v == nil {
+			return endpoint.NotFoundError("api key %s not found", id)
+		}
+
+		return json.Unmarshal(v, &key)
+	})
+	return key, err
+}
+
+// ViewAPIKeys views the API keys in the authn database ordered from oldest to newest
+func (db *AuthDB) ViewAPIKeys() (keys []*APIKey, err error) {
+	keys = make([]*APIKey, 0)
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.apiKeyBucket))
+
+		return b.ForEach(func(k, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+			keys = append(keys, &key)
+			return nil
+		})
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, err
+}
+
+// SafeViewAPIKeys views the API keys in the authn database without the secret hashes
+func (db *AuthDB) SafeViewAPIKeys() (keys []*APIKey, err error) {
+	keys, err = db.ViewAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		key.Hash = ""
+	}
+	return keys, nil
+}
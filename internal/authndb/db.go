@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"github.com/boltdb/bolt"
 	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
 	"os"
 	"strings"
 	"time"
 )
 
+// MaskedPassword is the password shown in place of the hash by the safe views of users
+const MaskedPassword = "**********"
+
 // UserArgs is the struct for the user arguments validation
 type UserArgs struct {
 	Username string `json:"username"`
@@ -20,10 +24,12 @@ type UserArgs struct {
 
 // User is the struct for a user
 type User struct {
-	ID       int      `json:"id,omitempty"` // User ID
-	Username string   `json:"username"`     // Username
-	Password string   `json:"password"`     // Password stored as sha256 hash
-	Groups   []string `json:"groups"`       // Groups user belongs to
+	ID                int        `json:"id,omitempty"`                  // User ID
+	Username          string     `json:"username"`                      // Username
+	Password          string     `json:"password"`                      // Password stored as bcrypt hash
+	Groups            []string   `json:"groups"`                        // Groups user belongs to
+	PasswordHistory   []string   `json:"password_history,omitempty"`    // Hashes of previous passwords, newest first
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"` // When the password was last set through the API
 }
 
 // TokenDetails is the struct for the token details
@@ -44,27 +50,49 @@ type AccessDetails struct {
 
 // NewAuthDB creates a new authn database
 func NewAuthDB(log *zap.Logger) *AuthDB {
-	userBucketName := "users"
-	tokenBucketName := "tokens"
-	db := AuthDB{
-		Logger:      log.With(zap.String("module", userBucketName)),
-		userBucket:  userBucketName,
-		tokenBucket: tokenBucketName,
-	}
+	db := newAuthDB(log)
 	err := db.Initialize()
 	if err != nil {
-		db.Logger.Error("failed to initialize authn database", zap.String("subsystem", userBucketName), zap.Error(err))
+		db.Logger.Error("failed to initialize authn database", zap.String("subsystem", db.userBucket), zap.Error(err))
 		return nil
 	}
-	return &db
+	return db
+}
+
+// OpenAuthDB opens the authn database in the specified file rather than the system wide location
+func OpenAuthDB(filename string, log *zap.Logger) (*AuthDB, error) {
+	db := newAuthDB(log)
+	if err := db.open(filename); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func newAuthDB(log *zap.Logger) *AuthDB {
+	userBucketName := "users"
+	return &AuthDB{
+		Logger:          log.With(zap.String("module", userBucketName)),
+		userBucket:      userBucketName,
+		tokenBucket:     "tokens",
+		apiKeyBucket:    "apikeys",
+		sessionBucket:   "sessions",
+		lockoutBucket:   "lockouts",
+		mfaBucket:       "mfa",
+		challengeBucket: "mfa_challenges",
+	}
 }
 
 // AuthDB is the struct for the authn database
 type AuthDB struct {
-	Logger      *zap.Logger
-	DB          *bolt.DB
-	userBucket  string
-	tokenBucket string
+	Logger          *zap.Logger
+	DB              *bolt.DB
+	userBucket      string
+	tokenBucket     string
+	apiKeyBucket    string
+	sessionBucket   string
+	lockoutBucket   string
+	mfaBucket       string
+	challengeBucket string
 }
 
 // Initialize initializes the authn database
@@ -77,58 +105,24 @@ func (db *AuthDB) Initialize() error {
 		}
 	}
 
-	// Initialize Database
-	var err error
-	db.DB, err = bolt.Open(config.DBName, 0600, &bolt.Options{Timeout: 1 * time.Second})
-	if err != nil {
-		return fmt.Errorf("failed to open authentication database: %v", err)
-	}
+	return db.open(config.DBName)
+}
 
-	// Ensure that the user bucket exists
-	err = db.DB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(db.userBucket))
-		if err != nil {
-			return fmt.Errorf("failed to create userBucket: %s", err)
-		}
-		return nil
-	})
+// open opens the database file and ensures that the buckets exist
+func (db *AuthDB) open(filename string) (err error) {
+	db.DB, err = bolt.Open(filename, 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
-		return fmt.Errorf("failed to create userBucket: %s", err)
+		return fmt.Errorf("failed to open authentication database: %v", err)
 	}
 
-	// Ensure that the token bucket exists
 	return db.DB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(db.tokenBucket))
-		if err != nil {
-			return fmt.Errorf("failed to create tokenBucket: %s", err)
-		}
-		return nil
-	})
-}
-
-// UpdateToken updates the token in the authn database
-func (db *AuthDB) UpdateToken(key string, value string) error {
-	return db.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.tokenBucket))
-		err := b.Put([]byte(key), []byte(value))
-		return err
-	})
-}
-
-// ViewToken views the token in the authn database
-func (db *AuthDB) ViewToken(key string) (value string, err error) {
-	err = db.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.tokenBucket))
-		v := b.Get([]byte(key))
-		if v == nil {
-			return fmt.Errorf("key %s not found in bucket", key)
+		for _, bucket := range []string{db.userBucket, db.tokenBucket, db.apiKeyBucket, db.sessionBucket, db.lockoutBucket, db.mfaBucket, db.challengeBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return fmt.Errorf("failed to create %s bucket: %s", bucket, err)
+			}
 		}
-		// Set value to the string representation of v
-		value = string(v)
-		// Return no error
 		return nil
 	})
-	return value, err
 }
 
 // CreateUser creates a new user in the authn database
@@ -247,7 +241,7 @@ func (db *AuthDB) ViewUser(userID int) (user *User, err error) {
 
 		v := b.Get(key)
 		if v == nil {
-			return fmt.Errorf("key %s not found in userBucket", key)
+			return endpoint.NotFoundError("user %d not found", userID)
 		}
 
 		// Unmarshal the user
@@ -256,6 +250,20 @@ func (db *AuthDB) ViewUser(userID int) (user *User, err error) {
 	return &u, err
 }
 
+// ViewUserByUsername views the user with the specified username in the authn database
+func (db *AuthDB) ViewUserByUsername(username string) (user *User, err error) {
+	users, err := db.ViewUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Username, username) {
+			return u, nil
+		}
+	}
+	return nil, endpoint.NotFoundError("user '%s' not found", username)
+}
+
 // ViewUsers views the users in the authn database
 func (db *AuthDB) ViewUsers() (users []*User, err error) {
 	users = make([]*User, 0)
@@ -283,7 +291,8 @@ func (db *AuthDB) SafeViewUser(userID int) (user *User, err error) {
 	if err != nil {
 		return nil, err
 	}
-	u.Password = "**********"
+	u.Password = MaskedPassword
+	u.PasswordHistory = nil
 	return u, nil
 }
 
@@ -294,7 +303,8 @@ func (db *AuthDB) SafeViewUsers() (users []*User, err error) {
 		return nil, err
 	}
 	for _, u := range users {
-		u.Password = "**********"
+		u.Password = MaskedPassword
+		u.PasswordHistory = nil
 	}
 	return users, nil
 }
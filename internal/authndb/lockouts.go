@@ -0,0 +1,124 @@
+package authndb
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// Lockout is the struct for the failed logins of a username or of an address logins came from. The record is
+// removed when the user logs in or once it is no longer needed.
+type Lockout struct {
+	Key         string     `json:"key"`                    // user:<username> or address:<address>
+	Failures    int        `json:"failures"`               // Number of failed logins
+	LastFailure time.Time  `json:"last_failure"`           // When the last login failed
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // When logins are allowed again
+}
+
+// Locked returns true if logins are refused at the time
+func (l *Lockout) Locked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
+
+// UpdateLockouts calls the update function with the record of each key and stores the result, records that don't
+// exist yet are created. The records are changed in a single transaction so concurrent failures aren't lost.
+func (db *AuthDB) UpdateLockouts(keys []string, update func(lockout *Lockout)) (lockouts []*Lockout, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.lockoutBucket))
+		lockouts = make([]*Lockout, 0, len(keys))
+		for _, key := range keys {
+			lockout := &Lockout{Key: key}
+			if v := b.Get([]byte(key)); v != nil {
+				if err := json.Unmarshal(v, lockout); err != nil {
+					return err
+				}
+			}
+			update(lockout)
+			buf, err := json.Marshal(lockout)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), buf); err != nil {
+				return err
+			}
+			lockouts = append(lockouts, lockout)
+		}
+		return nil
+	})
+	return lockouts, err
+}
+
+// ViewLockout views the record of the key in the authn database
+func (db *AuthDB) ViewLockout(key string) (lockout *Lockout, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(db.lockoutBucket)).Get([]byte(key))
+		if v == nil {
+			return endpoint.NotFoundError("lockout %s not found", key)
+		}
+		lockout = &Lockout{}
+		return json.Unmarshal(v, lockout)
+	})
+	return lockout, err
+}
+
+// ViewLockouts views the records in the authn database ordered by key
+func (db *AuthDB) ViewLockouts() (lockouts []*Lockout, err error) {
+	lockouts = make([]*Lockout, 0)
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.lockoutBucket)).ForEach(func(k, v []byte) error {
+			var lockout Lockout
+			if err := json.Unmarshal(v, &lockout); err != nil {
+				return err
+			}
+			lockouts = append(lockouts, &lockout)
+			return nil
+		})
+	})
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].Key < lockouts[j].Key
+	})
+	return lockouts, err
+}
+
+// DeleteLockout deletes the record of the key from the authn database
+func (db *AuthDB) DeleteLockout(key string) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.lockoutBucket))
+		if b.Get([]byte(key)) == nil {
+			return endpoint.NotFoundError("lockout %s not found", key)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// DeleteLockouts deletes the records that match from the authn database. Records that can't be decoded are deleted as
+// well. The number of records deleted is returned.
+func (db *AuthDB) DeleteLockouts(match func(lockout *Lockout) bool) (removed int, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.lockoutBucket))
+
+		// Collect the keys first, bolt doesn't allow deleting while iterating
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var lockout Lockout
+			if err := json.Unmarshal(v, &lockout); err != nil || match(&lockout) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,188 @@
+package authndb
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// MFA is the struct for the TOTP multi-factor authentication of a user. It is kept apart from the user so the secret
+// isn't carried around with it.
+type MFA struct {
+	UserID        int        `json:"user_id"`                  // ID of the user
+	Secret        string     `json:"secret,omitempty"`         // TOTP secret encoded as base32
+	Enabled       bool       `json:"enabled"`                  // Set once a code from the secret has been verified
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"` // sha256 hashes of the unused recovery codes
+	LastCounter   int64      `json:"last_counter,omitempty"`   // Time step of the last code used, codes can't be reused
+	CreatedAt     time.Time  `json:"created_at"`               // When enrollment started
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`     // When enrollment was verified
+}
+
+// MFAChallenge is the struct for a login that is waiting for the second factor. It is stored by the sha256 hash of
+// the token returned to the client.
+type MFAChallenge struct {
+	UserID    int       `json:"user_id"`    // ID of the user that logged in
+	ExpiresAt time.Time `json:"expires_at"` // When the login has to be completed by
+	Attempts  int       `json:"attempts"`   // Number of invalid codes entered
+}
+
+// PutMFA stores the multi-factor authentication of the user, replacing any that exists
+func (db *AuthDB) PutMFA(mfa *MFA) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket([]byte(db.mfaBucket)), itob(mfa.UserID), mfa)
+	})
+}
+
+// UpdateMFA calls the update function with the multi-factor authentication of the user and stores the result, nothing
+// is changed if it returns an error. The update is done in a single transaction so a code can only be used once.
+func (db *AuthDB) UpdateMFA(userID int, update func(mfa *MFA) error) (mfa *MFA, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.mfaBucket))
+		v := b.Get(itob(userID))
+		if v == nil {
+			return endpoint.NotFoundError("mfa for user %d not found", userID)
+		}
+		mfa = &MFA{}
+		if err := json.Unmarshal(v, mfa); err != nil {
+			return err
+		}
+		if err := update(mfa); err != nil {
+			return err
+		}
+		return putJSON(b, itob(userID), mfa)
+	})
+	return mfa, err
+}
+
+// ViewMFA views the multi-factor authentication of the user
+func (db *AuthDB) ViewMFA(userID int) (mfa *MFA, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(db.mfaBucket)).Get(itob(userID))
+		if v == nil {
+			return endpoint.NotFoundError("mfa for user %d not found", userID)
+		}
+		mfa = &MFA{}
+		return json.Unmarshal(v, mfa)
+	})
+	return mfa, err
+}
+
+// MFAEnabled returns true if the user has verified multi-factor authentication
+func (db *AuthDB) MFAEnabled(userID int) bool {
+	mfa, err := db.ViewMFA(userID)
+	return err == nil && mfa.Enabled
+}
+
+// DeleteMFA deletes the multi-factor authentication of the user
+func (db *AuthDB) DeleteMFA(userID int) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.mfaBucket))
+		if b.Get(itob(userID)) == nil {
+			return endpoint.NotFoundError("mfa for user %d not found", userID)
+		}
+		return b.Delete(itob(userID))
+	})
+}
+
+// CreateMFAChallenge stores the challenge under the hash of its token
+func (db *AuthDB) CreateMFAChallenge(hash string, challenge *MFAChallenge) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket([]byte(db.challengeBucket)), []byte(hash), challenge)
+	})
+}
+
+// ViewMFAChallenge views the challenge with the hash of its token, challenges that have expired aren't returned
+func (db *AuthDB) ViewMFAChallenge(hash string, now time.Time) (challenge *MFAChallenge, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(db.challengeBucket)).Get([]byte(hash))
+		if v == nil {
+			return endpoint.NotFoundError("mfa challenge not found")
+		}
+		challenge = &MFAChallenge{}
+		if err := json.Unmarshal(v, challenge); err != nil {
+			return err
+		}
+		if !now.Before(challenge.ExpiresAt) {
+			return endpoint.NotFoundError("mfa challenge not found")
+		}
+		return nil
+	})
+	return challenge, err
+}
+
+// FailMFAChallenge counts an invalid code against the challenge, it is deleted once the maximum number of attempts
+// has been reached
+func (db *AuthDB) FailMFAChallenge(hash string, maxAttempts int) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.challengeBucket))
+		v := b.Get([]byte(hash))
+		if v == nil {
+			return nil
+		}
+		var challenge MFAChallenge
+		if err := json.Unmarshal(v, &challenge); err != nil {
+			return b.Delete([]byte(hash))
+		}
+		challenge.Attempts++
+		if challenge.Attempts >= maxAttempts {
+			return b.Delete([]byte(hash))
+		}
+		return putJSON(b, []byte(hash), &challenge)
+	})
+}
+
+// DeleteMFAChallenge deletes the challenge with the hash of its token, the challenge is returned so that a token can
+// only complete one login
+func (db *AuthDB) DeleteMFAChallenge(hash string) (challenge *MFAChallenge, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.challengeBucket))
+		v := b.Get([]byte(hash))
+		if v == nil {
+			return endpoint.NotFoundError("mfa challenge not found")
+		}
+		challenge = &MFAChallenge{}
+		if err := json.Unmarshal(v, challenge); err != nil {
+			return err
+		}
+		return b.Delete([]byte(hash))
+	})
+	return challenge, err
+}
+
+// PurgeMFAChallenges deletes the challenges that have expired, the number of challenges deleted is returned
+func (db *AuthDB) PurgeMFAChallenges(now time.Time) (removed int, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.challengeBucket))
+
+		// Collect the keys first, bolt doesn't allow deleting while iterating
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var challenge MFAChallenge
+			if err := json.Unmarshal(v, &challenge); err != nil || !now.Before(challenge.ExpiresAt) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
+
+func putJSON(b *bolt.Bucket, key []byte, value interface{}) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, buf)
+}
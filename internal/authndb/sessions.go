@@ -0,0 +1,236 @@
+package authndb
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// Session is the struct for a login session. A session is created at login and keeps its ID while its access and
+// refresh tokens are replaced by refreshing it. The token UUIDs map to the session ID in the token bucket.
+type Session struct {
+	ID          string     `json:"id"`                     // Session ID
+	UserID      int        `json:"user_id"`                // ID of the user that logged in
+	AccessUUID  string     `json:"access_uuid,omitempty"`  // UUID of the current access token
+	RefreshUUID string     `json:"refresh_uuid,omitempty"` // UUID of the current refresh token
+	CreatedAt   time.Time  `json:"created_at"`             // When the user logged in
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"` // When the tokens were last refreshed
+	AtExpires   int64      `json:"at_expires"`             // When the access token expires
+	RtExpires   int64      `json:"rt_expires"`             // When the refresh token, and so the session, expires
+}
+
+// CreateSession stores the session and maps its token UUIDs to it
+func (db *AuthDB) CreateSession(session *Session) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		return db.putSession(tx, session)
+	})
+}
+
+// RefreshSession replaces the tokens of the session that the refresh token belongs to. The update function sets the
+// new tokens on the session, nothing is changed if it returns an error. The refresh token can only be used once, the
+// old tokens stop working immediately.
+func (db *AuthDB) RefreshSession(refreshUUID string, update func(session *Session) error) (session *Session, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		id := tx.Bucket([]byte(db.tokenBucket)).Get([]byte(refreshUUID))
+		if id == nil {
+			return endpoint.UnauthenticatedError("refresh token is not valid")
+		}
+		session, err = db.getSession(tx, string(id))
+		if err != nil || session.RefreshUUID != refreshUUID {
+			return endpoint.UnauthenticatedError("refresh token is not valid")
+		}
+
+		if err := db.deleteSessionTokens(tx, session); err != nil {
+			return err
+		}
+		if err := update(session); err != nil {
+			return err
+		}
+		return db.putSession(tx, session)
+	})
+	return session, err
+}
+
+// ViewSessionByToken views the session that the access or refresh token UUID belongs to
+func (db *AuthDB) ViewSessionByToken(uuid string) (session *Session, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket([]byte(db.tokenBucket)).Get([]byte(uuid))
+		if id == nil {
+			return endpoint.NotFoundError("token %s not found", uuid)
+		}
+		session, err = db.getSession(tx, string(id))
+		return err
+	})
+	return session, err
+}
+
+// ViewSession views the specified session in the authn database
+func (db *AuthDB) ViewSession(id string) (session *Session, err error) {
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		session, err = db.getSession(tx, id)
+		return err
+	})
+	return session, err
+}
+
+// ViewSessions views the sessions in the authn database ordered from oldest to newest
+func (db *AuthDB) ViewSessions() (sessions []*Session, err error) {
+	sessions = make([]*Session, 0)
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.sessionBucket)).ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			sessions = append(sessions, &session)
+			return nil
+		})
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, err
+}
+
+// SafeViewSessions views the sessions in the authn database without the token UUIDs
+func (db *AuthDB) SafeViewSessions() (sessions []*Session, err error) {
+	sessions, err = db.ViewSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.AccessUUID = ""
+		session.RefreshUUID = ""
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes the session and revokes its tokens
+func (db *AuthDB) DeleteSession(id string) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		session, err := db.getSession(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := db.deleteSessionTokens(tx, session); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(db.sessionBucket)).Delete([]byte(id))
+	})
+}
+
+// DeleteUserSessions deletes every session of the user, except the sessions listed, and revokes their tokens. The
+// number of sessions deleted is returned.
+func (db *AuthDB) DeleteUserSessions(userID int, except ...string) (removed int, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		removed, err = db.deleteSessions(tx, func(session *Session) bool {
+			return session.UserID == userID && !slices.Contains(except, session.ID)
+		})
+		return err
+	})
+	return removed, err
+}
+
+// PurgeExpiredTokens deletes the sessions whose refresh tokens have expired and the entries of access tokens that
+// have expired. Token entries that don't belong to a session are deleted as well. The number of sessions and token
+// entries deleted is returned, not counting the tokens of the deleted sessions.
+func (db *AuthDB) PurgeExpiredTokens(now time.Time) (removed int, err error) {
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		tokens := tx.Bucket([]byte(db.tokenBucket))
+		expired, err := db.deleteSessions(tx, func(session *Session) bool {
+			return session.RtExpires <= now.Unix()
+		})
+		if err != nil {
+			return err
+		}
+
+		// Collect the entries first, bolt doesn't allow deleting while iterating
+		var keys [][]byte
+		err = tokens.ForEach(func(k, v []byte) error {
+			session, err := db.getSession(tx, string(v))
+			if err != nil || (session.AccessUUID == string(k) && session.AtExpires <= now.Unix()) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tokens.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = expired + len(keys)
+		return nil
+	})
+	return removed, err
+}
+
+// deleteSessions deletes the sessions that match and revokes their tokens, the number of sessions deleted is returned
+func (db *AuthDB) deleteSessions(tx *bolt.Tx, match func(session *Session) bool) (int, error) {
+	sessions := tx.Bucket([]byte(db.sessionBucket))
+	var matched []*Session
+	err := sessions.ForEach(func(k, v []byte) error {
+		var session Session
+		if err := json.Unmarshal(v, &session); err != nil {
+			return err
+		}
+		if match(&session) {
+			matched = append(matched, &session)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, session := range matched {
+		if err := db.deleteSessionTokens(tx, session); err != nil {
+			return 0, err
+		}
+		if err := sessions.Delete([]byte(session.ID)); err != nil {
+			return 0, err
+		}
+	}
+	return len(matched), nil
+}
+
+func (db *AuthDB) getSession(tx *bolt.Tx, id string) (*Session, error) {
+	v := tx.Bucket([]byte(db.sessionBucket)).Get([]byte(id))
+	if v == nil {
+		return nil, endpoint.NotFoundError("session %s not found", id)
+	}
+	var session Session
+	if err := json.Unmarshal(v, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (db *AuthDB) putSession(tx *bolt.Tx, session *Session) error {
+	buf, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tokens := tx.Bucket([]byte(db.tokenBucket))
+	for _, uuid := range []string{session.AccessUUID, session.RefreshUUID} {
+		if err := tokens.Put([]byte(uuid), []byte(session.ID)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket([]byte(db.sessionBucket)).Put([]byte(session.ID), buf)
+}
+
+func (db *AuthDB) deleteSessionTokens(tx *bolt.Tx, session *Session) error {
+	tokens := tx.Bucket([]byte(db.tokenBucket))
+	for _, uuid := range []string{session.AccessUUID, session.RefreshUUID} {
+		if err := tokens.Delete([]byte(uuid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/bgrewell/dtac-agent/internal/types"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
+	"slices"
 	"strings"
 )
 
@@ -101,7 +102,7 @@ func (s *Subsystem) AuthorizationHandler(next endpoint.Func) endpoint.Func {
 
 		// Check for metadata that is needed for authorization
 		if _, ok := in.Metadata[types.ContextAuthUser.String()]; !ok {
-			return nil, errors.New("user is not logged in")
+			return nil, endpoint.UnauthenticatedError("user is not logged in")
 		}
 		if _, ok := in.Metadata[types.ContextResourceAction.String()]; !ok {
 			return nil, errors.New("resource action is not specified")
@@ -123,11 +124,17 @@ func (s *Subsystem) AuthorizationHandler(next endpoint.Func) endpoint.Func {
 
 		s.Logger.Debug("Username", zap.String("username", user.Username))
 
-		// Get users roles
+		// Get users roles. Users identified by the transport, such as unix socket peers mapped to a group, aren't in the
+		// policy so the groups they carry are used as well.
 		roles, err := s.enforcer.GetRolesForUser(user.Username)
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving roles for user: %v", err)
 		}
+		for _, group := range user.Groups {
+			if !slices.Contains(roles, group) {
+				roles = append(roles, group)
+			}
+		}
 
 		// Check if user has access to the resource
 		for _, role := range roles {
@@ -141,7 +148,7 @@ func (s *Subsystem) AuthorizationHandler(next endpoint.Func) endpoint.Func {
 			}
 		}
 
-		return nil, errors.New("user not authorized to access this resource")
+		return nil, endpoint.PermissionDeniedError("user not authorized to access this resource")
 	}
 }
 
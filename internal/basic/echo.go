@@ -1,11 +1,9 @@
 package basic
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"github.com/bgrewell/dtac-agent/internal/controller"
-	"github.com/bgrewell/dtac-agent/internal/helpers"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"go.uber.org/zap"
@@ -13,7 +11,7 @@ import (
 
 // EchoArgs is a struct to assist with validating the input arguments
 type EchoArgs struct {
-	Message []string `json:"msg"`
+	Message string `json:"-" param:"msg,required"`
 }
 
 // EchoOutput is a struct to assist with validating the output
@@ -57,7 +55,7 @@ func (es *EchoSubsystem) register() {
 	secure := es.Controller.Config.Auth.DefaultSecure
 	authz := endpoint.AuthGroupGuest.String()
 	es.endpoints = []*endpoint.Endpoint{
-		endpoint.NewEndpoint(fmt.Sprintf("%s/", base), endpoint.ActionRead, "echo test endpoint", es.rootHandler, secure, authz, endpoint.WithParameters(EchoArgs{}), endpoint.WithOutput(EchoOutput{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/", base), endpoint.ActionRead, "echo test endpoint", es.rootHandler, secure, authz),
 	}
 }
 
@@ -76,13 +74,6 @@ func (es *EchoSubsystem) Endpoints() []*endpoint.Endpoint {
 	return es.endpoints
 }
 
-func (es *EchoSubsystem) rootHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return helpers.HandleWrapper(in, func() ([]byte, error) {
-		if m, ok := in.Parameters["msg"]; ok && len(m) > 0 && m[0] != "" {
-			return json.Marshal(EchoOutput{Message: m[0]})
-		}
-
-		return nil, errors.New("missing parameter 'msg'")
-
-	}, "diagnostic information")
+func (es *EchoSubsystem) rootHandler(ctx context.Context, in EchoArgs) (out EchoOutput, err error) {
+	return EchoOutput{Message: in.Message}, nil
 }
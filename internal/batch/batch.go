@@ -0,0 +1,158 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+// Path is the path of the batch endpoint
+const Path = "batch"
+
+// CallArgs is a single call in a batch request
+type CallArgs struct {
+	Action  string       `json:"action"`
+	Path    string       `json:"path"`
+	Request *RequestArgs `json:"request,omitempty"`
+}
+
+// RequestArgs is the request passed to an endpoint in a batch request. The body is passed to the endpoint as is.
+type RequestArgs struct {
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Parameters map[string][]string `json:"parameters,omitempty"`
+	Body       json.RawMessage     `json:"body,omitempty"`
+}
+
+// Args is the body of a batch request
+type Args struct {
+	Calls       []CallArgs `json:"calls"`
+	Parallel    bool       `json:"parallel,omitempty"`
+	StopOnError bool       `json:"stop_on_error,omitempty"`
+}
+
+// ResultOutput is the result of a single call in a batch response
+type ResultOutput struct {
+	Index    int                 `json:"index"`
+	Action   string              `json:"action"`
+	Path     string              `json:"path"`
+	Headers  map[string][]string `json:"headers,omitempty"`
+	Value    json.RawMessage     `json:"value,omitempty"`
+	Error    *endpoint.Error     `json:"error,omitempty"`
+	Skipped  bool                `json:"skipped,omitempty"`
+	Duration string              `json:"duration,omitempty"`
+}
+
+// NewSubsystem creates a new batch subsystem
+func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
+	name := "batch"
+	bs := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		enabled:    c.Config.Subsystems.Batch,
+		name:       name,
+	}
+	bs.register()
+	return &bs
+}
+
+// Subsystem is the subsystem that runs multiple endpoint calls in a single request
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	enabled    bool
+	name       string
+	endpoints  []*endpoint.Endpoint
+	executor   *Executor
+	once       sync.Once
+}
+
+// register registers the endpoints that this subsystem handles
+func (s *Subsystem) register() {
+	if !s.Enabled() {
+		s.Logger.Info("subsystem is disabled", zap.String("subsystem", s.Name()))
+		return
+	}
+
+	// Calls are authorized individually so any user can submit a batch
+	secure := s.Controller.Config.Auth.DefaultSecure
+	authz := endpoint.AuthGroupGuest.String()
+	s.endpoints = []*endpoint.Endpoint{
+		endpoint.NewTypedEndpoint(Path, endpoint.ActionCreate, "make multiple endpoint calls in a single request", s.batchHandler, secure, authz),
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *Subsystem) Enabled() bool {
+	return s.enabled
+}
+
+// Name returns the name of the subsystem
+func (s *Subsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns the endpoints that this subsystem handles
+func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// batchHandler runs the calls in the batch. The executor is created on first use since the endpoint list isn't
+// complete until all subsystems have been registered.
+func (s *Subsystem) batchHandler(ctx context.Context, args Args) ([]ResultOutput, error) {
+	s.once.Do(func() {
+		s.executor = NewExecutor(MethodMap(s.Controller.EndpointList.Endpoints))
+	})
+
+	calls := make([]Call, len(args.Calls))
+	for idx, c := range args.Calls {
+		calls[idx] = Call{Action: c.Action, Path: c.Path}
+		if c.Request != nil {
+			calls[idx].Request = &endpoint.Request{Headers: c.Request.Headers, Parameters: c.Request.Parameters, Body: c.Request.Body}
+		}
+	}
+
+	var metadata map[string]string
+	if in, ok := endpoint.RequestFromContext(ctx); ok {
+		metadata = in.Metadata
+	}
+	results, err := s.executor.Run(ctx, calls, metadata, Options{Parallel: args.Parallel, StopOnError: args.StopOnError})
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]ResultOutput, len(results))
+	for idx, result := range results {
+		outputs[idx] = ResultOutput{
+			Index:   result.Index,
+			Action:  args.Calls[idx].Action,
+			Path:    args.Calls[idx].Path,
+			Error:   result.Error,
+			Skipped: result.Skipped,
+		}
+		if !result.Skipped {
+			outputs[idx].Duration = result.Duration.String()
+		}
+		if result.Response != nil {
+			outputs[idx].Headers = result.Response.Headers
+			outputs[idx].Value = jsonValue(result.Response.Value)
+		}
+	}
+	return outputs, nil
+}
+
+// jsonValue returns the value as is if it is valid JSON otherwise it is returned as a JSON string
+func jsonValue(value []byte) json.RawMessage {
+	if len(value) == 0 {
+		return nil
+	}
+	if json.Valid(value) {
+		return value
+	}
+	encoded, _ := json.Marshal(string(value))
+	return encoded
+}
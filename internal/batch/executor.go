@@ -0,0 +1,191 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+)
+
+const (
+	// MaxCalls is the maximum number of calls accepted in a single batch
+	MaxCalls = 100
+	// DefaultMaxParallel is the number of calls run at the same time when a batch is run in parallel
+	DefaultMaxParallel = 8
+)
+
+// Call is a single call in a batch
+type Call struct {
+	Action  string
+	Path    string
+	Request *endpoint.Request
+}
+
+// Method returns the method name of the call in the same 'action:path' form used by the gRPC API
+func (c Call) Method() string {
+	return fmt.Sprintf("%s:%s", c.Action, strings.Trim(c.Path, "/"))
+}
+
+// Options controls how a batch is run
+type Options struct {
+	// Parallel runs the calls at the same time instead of one after another
+	Parallel bool
+	// StopOnError skips any calls that haven't started once a call fails. When running in parallel the calls that are
+	// already running are canceled.
+	StopOnError bool
+	// MaxParallel is the maximum number of calls run at the same time. Zero uses DefaultMaxParallel.
+	MaxParallel int
+}
+
+// Result is the outcome of a single call in a batch
+type Result struct {
+	Index    int
+	Method   string
+	Response *endpoint.Response
+	Error    *endpoint.Error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// MethodMap returns the endpoints keyed by their 'action:path' method name
+func MethodMap(eps []*endpoint.Endpoint) map[string]*endpoint.Endpoint {
+	methods := make(map[string]*endpoint.Endpoint, len(eps))
+	for _, ep := range eps {
+		methods[fmt.Sprintf("%s:%s", ep.Action, ep.Path)] = ep
+	}
+	return methods
+}
+
+// NewExecutor creates a new executor that runs batches of calls against the given endpoints. The endpoint functions
+// are expected to already be wrapped by the middleware chain so that every call is authenticated and authorized.
+func NewExecutor(endpoints map[string]*endpoint.Endpoint) *Executor {
+	return &Executor{endpoints: endpoints}
+}
+
+// Executor runs batches of endpoint calls
+type Executor struct {
+	endpoints map[string]*endpoint.Endpoint
+}
+
+// Run runs the calls and returns a result for each of them in the same order. The auth header and peer identity from
+// metadata are passed on to every call, all other metadata is set per call.
+func (e *Executor) Run(ctx context.Context, calls []Call, metadata map[string]string, opts Options) ([]Result, error) {
+	if len(calls) == 0 {
+		return nil, endpoint.InvalidArgumentError("batch must contain at least one call")
+	}
+	if len(calls) > MaxCalls {
+		return nil, endpoint.InvalidArgumentError("batch contains %d calls, the maximum is %d", len(calls), MaxCalls)
+	}
+
+	results := make([]Result, len(calls))
+	for idx, call := range calls {
+		results[idx] = Result{Index: idx, Method: call.Method(), Skipped: true}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if !opts.Parallel {
+		for idx, call := range calls {
+			if ctx.Err() != nil {
+				break
+			}
+			results[idx] = e.call(ctx, idx, call, metadata)
+			if results[idx].Error != nil && opts.StopOnError {
+				break
+			}
+		}
+		return results, nil
+	}
+
+	limit := opts.MaxParallel
+	if limit <= 0 {
+		limit = DefaultMaxParallel
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for idx, call := range calls {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(idx int, call Call) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[idx] = e.call(ctx, idx, call, metadata)
+			if results[idx].Error != nil && opts.StopOnError {
+				cancel()
+			}
+		}(idx, call)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// call runs a single call from the batch
+func (e *Executor) call(ctx context.Context, idx int, call Call, metadata map[string]string) (result Result) {
+	result = Result{Index: idx, Method: call.Method()}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	key, params, ok := endpoint.MatchMethod(e.endpoints, result.Method)
+	if !ok {
+		result.Error = endpoint.NotFoundError("method %s not found", result.Method)
+		return result
+	}
+	ep := e.endpoints[key]
+	if ep.Path == Path {
+		result.Error = endpoint.InvalidArgumentError("batches can't be nested")
+		return result
+	}
+	if ep.Streaming {
+		result.Error = endpoint.InvalidArgumentError("%s", endpoint.ErrStreamingEndpoint.Error())
+		return result
+	}
+
+	// Each call gets its own request so that the middleware can't leak state between calls
+	in := &endpoint.Request{Metadata: make(map[string]string)}
+	if call.Request != nil {
+		in.Headers = call.Request.Headers
+		in.Parameters = make(map[string][]string, len(call.Request.Parameters))
+		for k, v := range call.Request.Parameters {
+			in.Parameters[k] = v
+		}
+		in.Body = call.Request.Body
+	}
+	in.SetPathParameters(params)
+	for _, key := range []types.ContextKey{types.ContextAuthHeader, types.ContextAuthPeer, types.ContextRemoteAddr} {
+		if auth, ok := metadata[key.String()]; ok {
+			in.Metadata[key.String()] = auth
+		}
+	}
+	in.Metadata[types.ContextResourceAction.String()] = ep.Action.String()
+	in.Metadata[types.ContextResourcePath.String()] = ep.Path
+
+	callCtx, cancel := ep.CallContext(ctx, 0)
+	defer cancel()
+
+	out, err := ep.Function(in.WithContext(callCtx))
+	if err != nil {
+		if ctxErr := callCtx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		result.Error = endpoint.AsError(err)
+		return result
+	}
+	result.Response = out
+	return result
+}
@@ -0,0 +1,120 @@
+package batch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecutor(calls *int32) *Executor {
+	ok := func(in *endpoint.Request) (*endpoint.Response, error) {
+		atomic.AddInt32(calls, 1)
+		if in.Metadata[types.ContextAuthHeader.String()] != "Bearer token" {
+			return nil, endpoint.UnauthenticatedError("missing token")
+		}
+		return &endpoint.Response{Value: []byte(in.Metadata[types.ContextResourcePath.String()] + ":" + in.Parameters["id"][0])}, nil
+	}
+	fail := func(in *endpoint.Request) (*endpoint.Response, error) {
+		atomic.AddInt32(calls, 1)
+		return nil, endpoint.PermissionDeniedError("not authorized")
+	}
+
+	eps := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("items/{id}", endpoint.ActionRead, "item", ok, false, endpoint.AuthGroupUser.String()),
+		endpoint.NewEndpoint("items/{id}", endpoint.ActionDelete, "delete item", fail, false, endpoint.AuthGroupUser.String()),
+		endpoint.NewEndpoint(Path, endpoint.ActionCreate, "batch", ok, false, endpoint.AuthGroupUser.String()),
+		endpoint.NewStreamEndpoint("items/live", endpoint.ActionRead, "live items", func(in *endpoint.Request, send endpoint.StreamSender) error {
+			return nil
+		}, false, endpoint.AuthGroupUser.String()),
+	}
+	return NewExecutor(MethodMap(eps))
+}
+
+func errorCode(err *endpoint.Error) endpoint.ErrorCode {
+	if err == nil {
+		return ""
+	}
+	return err.Code
+}
+
+func TestExecutorRun(t *testing.T) {
+	metadata := map[string]string{types.ContextAuthHeader.String(): "Bearer token", types.ContextAuthUser.String(): "{}"}
+	calls := []Call{
+		{Action: "read", Path: "items/1"},
+		{Action: "delete", Path: "items/1"},
+		{Action: "read", Path: "/items/2/", Request: &endpoint.Request{Parameters: map[string][]string{"id": {"ignored"}}}},
+		{Action: "read", Path: "missing"},
+		{Action: "create", Path: Path},
+		{Action: "read", Path: "items/live"},
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		expectCalls  int32
+		expectErrors []endpoint.ErrorCode
+		expectSkip   []bool
+	}{
+		{
+			name:         "sequential",
+			expectCalls:  3,
+			expectErrors: []endpoint.ErrorCode{"", endpoint.ErrorCodePermissionDenied, "", endpoint.ErrorCodeNotFound, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeInvalidArgument},
+			expectSkip:   []bool{false, false, false, false, false, false},
+		},
+		{
+			name:         "parallel",
+			opts:         Options{Parallel: true, MaxParallel: 2},
+			expectCalls:  3,
+			expectErrors: []endpoint.ErrorCode{"", endpoint.ErrorCodePermissionDenied, "", endpoint.ErrorCodeNotFound, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeInvalidArgument},
+			expectSkip:   []bool{false, false, false, false, false, false},
+		},
+		{
+			name:         "stop on error",
+			opts:         Options{StopOnError: true},
+			expectCalls:  2,
+			expectErrors: []endpoint.ErrorCode{"", endpoint.ErrorCodePermissionDenied, "", "", "", ""},
+			expectSkip:   []bool{false, false, true, true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int32
+			results, err := newTestExecutor(&count).Run(context.Background(), calls, metadata, tt.opts)
+			require.NoError(t, err)
+			require.Len(t, results, len(calls))
+			assert.Equal(t, tt.expectCalls, count)
+			for idx, result := range results {
+				assert.Equal(t, idx, result.Index)
+				assert.Equal(t, calls[idx].Method(), result.Method)
+				assert.Equal(t, tt.expectErrors[idx], errorCode(result.Error), result.Method)
+				assert.Equal(t, tt.expectSkip[idx], result.Skipped, result.Method)
+			}
+			assert.Equal(t, "items/{id}:1", string(results[0].Response.Value))
+			if !tt.opts.StopOnError {
+				assert.Equal(t, "items/{id}:2", string(results[2].Response.Value))
+			}
+		})
+	}
+}
+
+func TestExecutorRunLimits(t *testing.T) {
+	var count int32
+	e := newTestExecutor(&count)
+
+	_, err := e.Run(context.Background(), nil, nil, Options{})
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeOf(err))
+
+	_, err = e.Run(context.Background(), make([]Call, MaxCalls+1), nil, Options{})
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeOf(err))
+
+	// Calls are authenticated individually so a missing token fails each call rather than the batch
+	results, err := e.Run(context.Background(), []Call{{Action: "read", Path: "items/1"}}, nil, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, endpoint.ErrorCodeUnauthenticated, errorCode(results[0].Error))
+}
@@ -9,15 +9,26 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
-	"sort"
 	"strings"
+	"sync"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// GeneratePasswordMarker is the placeholder for auth.pass that is replaced by a random password on install. When the
+// agent finds it on its first run it generates the admin password itself and writes it to AdminPasswordFile.
+const GeneratePasswordMarker = "need_to_generate_a_random_password_on_install_or_first_run"
+
+// AdminPasswordFile is the name of the file, next to the authentication database, that holds the admin password the
+// agent generated until the admin changes it
+const AdminPasswordFile = "admin_password"
+
+// AdminPasswordChangedFile is the name of the file, next to the authentication database, that marks that the admin
+// password has been changed through the API and auth.pass is no longer applied
+const AdminPasswordChangedFile = "admin_password_changed"
+
 // InternalSettings are never written out to the configuration file
 type InternalSettings struct {
 	ProductName string `json:"-" yaml:"-" mapstructure:"product_name"`
@@ -44,10 +55,34 @@ type TLSConfigurationEntry struct {
 	CAFile          string   `json:"ca" yaml:"ca" mapstructure:"ca"`
 }
 
+// HealthEntry is the struct for the health entry. ReadinessChecks lists the checks that must be up for the agent to be
+// ready, entries are matched against the check names and may contain wildcards such as 'plugin/*'.
+type HealthEntry struct {
+	ReadinessChecks []string `json:"readiness_checks" yaml:"readiness_checks" mapstructure:"readiness_checks"`
+	Timeout         string   `json:"timeout" yaml:"timeout" mapstructure:"timeout"`
+	Interval        string   `json:"interval" yaml:"interval" mapstructure:"interval"`
+}
+
+// IdempotencyEntry is the struct for the idempotency key entry
+type IdempotencyEntry struct {
+	Enabled bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Window  string `json:"window" yaml:"window" mapstructure:"window"`
+}
+
+// JobsEntry is the struct for the asynchronous jobs entry
+type JobsEntry struct {
+	Enabled   bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Retention string `json:"retention" yaml:"retention" mapstructure:"retention"`
+	MaxJobs   int    `json:"max_jobs" yaml:"max_jobs" mapstructure:"max_jobs"`
+}
+
 // LockoutEntry is the struct for a lockout entry
 type LockoutEntry struct {
-	Enabled        bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
-	AutoUnlockTime string `json:"auto_unlock_time" yaml:"auto_unlock_time" mapstructure:"auto_unlock_time"`
+	Enabled          bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Threshold        int    `json:"threshold" yaml:"threshold" mapstructure:"threshold"`
+	AddressThreshold int    `json:"address_threshold" yaml:"address_threshold" mapstructure:"address_threshold"`
+	AutoUnlockTime   string `json:"auto_unlock_time" yaml:"auto_unlock_time" mapstructure:"auto_unlock_time"`
+	MaxUnlockTime    string `json:"max_unlock_time" yaml:"max_unlock_time" mapstructure:"max_unlock_time"`
 }
 
 // PluginEntry is the struct for a plugin entry
@@ -92,13 +127,20 @@ type SourceEntry struct {
 // SubsystemEntry is the struct for a subsystem entry
 type SubsystemEntry struct {
 	Auth       bool `json:"auth" yaml:"auth" mapstructure:"auth"`
+	Batch      bool `json:"batch" yaml:"batch" mapstructure:"batch"`
 	Diag       bool `json:"diag" yaml:"diag" mapstructure:"diag"`
 	Echo       bool `json:"echo" yaml:"echo" mapstructure:"echo"`
 	Hardware   bool `json:"hardware" yaml:"hardware" mapstructure:"hardware"`
 	Network    bool `json:"network" yaml:"network" mapstructure:"network"`
+	Query      bool `json:"query" yaml:"query" mapstructure:"query"`
 	Validation bool `json:"validation" yaml:"validation" mapstructure:"validation"`
 }
 
+// ValidationEntry is the struct for the validation entry
+type ValidationEntry struct {
+	Output string `json:"output" yaml:"output" mapstructure:"output"`
+}
+
 // UpdaterEntry is the struct for an updater entry
 type UpdaterEntry struct {
 	Enabled         bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
@@ -126,12 +168,28 @@ type AuthEntry struct {
 	Policy                 string `json:"policy" yaml:"policy" mapstructure:"policy"`
 	AccessTokenExpiration  string `json:"access_token_expiration" yaml:"access_token_expiration" mapstructure:"access_token_expiration"`
 	RefreshTokenExpiration string `json:"refresh_token_expiration" yaml:"refresh_token_expiration" mapstructure:"refresh_token_expiration"`
+	PasswordPolicy         PasswordPolicyEntry `json:"password_policy" yaml:"password_policy" mapstructure:"password_policy"`
+	MFA                    MFAEntry            `json:"mfa" yaml:"mfa" mapstructure:"mfa"`
 	// StaticTestingToken is a static token for testing/development purposes only.
 	// When set, this token bypasses normal JWT authentication and grants admin access.
 	// Should be empty in production environments. Example: "my-test-token-DO-NOT-USE-IN-PROD"
 	StaticTestingToken     string `json:"static_testing_token" yaml:"static_testing_token" mapstructure:"static_testing_token"`
 }
 
+// PasswordPolicyEntry is the struct for the password policy entry
+type PasswordPolicyEntry struct {
+	MinLength    int    `json:"min_length" yaml:"min_length" mapstructure:"min_length"`
+	MinClasses   int    `json:"min_classes" yaml:"min_classes" mapstructure:"min_classes"`
+	BreachedList string `json:"breached_list" yaml:"breached_list" mapstructure:"breached_list"`
+	History      int    `json:"history" yaml:"history" mapstructure:"history"`
+}
+
+// MFAEntry is the struct for the multi-factor authentication entry
+type MFAEntry struct {
+	Issuer         string   `json:"issuer" yaml:"issuer" mapstructure:"issuer"`
+	RequiredGroups []string `json:"required_groups" yaml:"required_groups" mapstructure:"required_groups"`
+}
+
 // OutputEntry is the struct for an output entry
 type OutputEntry struct {
 	LogLevel       string `json:"log_level" yaml:"log_level" mapstructure:"log_level"`
@@ -141,8 +199,33 @@ type OutputEntry struct {
 
 // TLSSelection is the struct for a tls selection
 type TLSSelection struct {
-	Enabled bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
-	Profile string `json:"profile" yaml:"profile" mapstructure:"profile"`
+	Enabled    bool            `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Profile    string          `json:"profile" yaml:"profile" mapstructure:"profile"`
+	ClientAuth ClientAuthEntry `json:"client_auth" yaml:"client_auth" mapstructure:"client_auth"`
+}
+
+// ClientAuthEntry is the struct for mutual TLS client authentication, it is supported by the REST and gRPC APIs and
+// the other APIs fail to start when it is enabled. Client certificates are verified against the CA bundle and the CRL,
+// if set. When Required is false clients without a certificate can still authenticate with a token. A verified
+// certificate authenticates the request as the user of the first mapping that matches it.
+type ClientAuthEntry struct {
+	Enabled  bool                `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Required bool                `json:"required" yaml:"required" mapstructure:"required"`
+	CA       string              `json:"ca" yaml:"ca" mapstructure:"ca"`
+	CRL      string              `json:"crl" yaml:"crl" mapstructure:"crl"`
+	Mappings []ClientCertMapping `json:"mappings" yaml:"mappings" mapstructure:"mappings"`
+}
+
+// ClientCertMapping maps client certificates to a DTAC user or group. Subject matches the common name or the
+// distinguished name of the certificate, SAN matches any of its DNS names, email addresses, URIs or IP addresses and
+// OU matches any of its organizational units, each can use wildcards and the ones that are set must all match.
+// Certificates mapped to a group authenticate as a user named after their common name that is only in that group.
+type ClientCertMapping struct {
+	Subject string `json:"subject" yaml:"subject" mapstructure:"subject"`
+	SAN     string `json:"san" yaml:"san" mapstructure:"san"`
+	OU      string `json:"ou" yaml:"ou" mapstructure:"ou"`
+	User    string `json:"user" yaml:"user" mapstructure:"user"`
+	Group   string `json:"group" yaml:"group" mapstructure:"group"`
 }
 
 // CORSConfig is the struct for CORS configuration
@@ -158,9 +241,13 @@ type CORSConfig struct {
 
 // APIEntries is the struct for a api entries
 type APIEntries struct {
-	REST RESTAPIEntry `json:"rest" yaml:"rest" mapstructure:"rest"`
-	GRPC GRPCAPIEntry `json:"grpc" yaml:"grpc" mapstructure:"grpc"`
-	JSON JSONAPIEntry `json:"json" yaml:"json" mapstructure:"json"`
+	REST      RESTAPIEntry      `json:"rest" yaml:"rest" mapstructure:"rest"`
+	GRPC      GRPCAPIEntry      `json:"grpc" yaml:"grpc" mapstructure:"grpc"`
+	JSON      JSONAPIEntry      `json:"json" yaml:"json" mapstructure:"json"`
+	WebSocket WebSocketAPIEntry `json:"websocket" yaml:"websocket" mapstructure:"websocket"`
+	Unix      UnixAPIEntry      `json:"unix" yaml:"unix" mapstructure:"unix"`
+	MQTT      MQTTAPIEntry      `json:"mqtt" yaml:"mqtt" mapstructure:"mqtt"`
+	GraphQL   GraphQLAPIEntry   `json:"graphql" yaml:"graphql" mapstructure:"graphql"`
 }
 
 // RESTAPIEntry is the struct for an api entry
@@ -178,6 +265,66 @@ type JSONAPIEntry struct {
 	TLS     TLSSelection `json:"tls" yaml:"tls" mapstructure:"tls"`
 }
 
+// WebSocketAPIEntry is the struct for the websocket api entry. AllowedOrigins lists the origins browsers may connect
+// from, when empty only same origin connections are allowed. MinInterval is the shortest interval clients can use
+// when subscribing to a read endpoint.
+type WebSocketAPIEntry struct {
+	Enabled        bool         `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Port           int          `json:"port" yaml:"port" mapstructure:"port"`
+	TLS            TLSSelection `json:"tls" yaml:"tls" mapstructure:"tls"`
+	AllowedOrigins []string     `json:"allowed_origins" yaml:"allowed_origins" mapstructure:"allowed_origins"`
+	MinInterval    string       `json:"min_interval" yaml:"min_interval" mapstructure:"min_interval"`
+}
+
+// UnixAPIEntry is the struct for the unix socket api entry. Callers are identified by the uid and gid of the
+// connecting process. Users maps OS users to DTAC users and Groups maps OS groups to DTAC groups, both are keyed by
+// name or numeric id. Mode is the octal file mode of the socket and Group, if set, is the OS group that owns it.
+type UnixAPIEntry struct {
+	Enabled bool              `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Path    string            `json:"path" yaml:"path" mapstructure:"path"`
+	Mode    string            `json:"mode" yaml:"mode" mapstructure:"mode"`
+	Group   string            `json:"group" yaml:"group" mapstructure:"group"`
+	Users   map[string]string `json:"users" yaml:"users" mapstructure:"users"`
+	Groups  map[string]string `json:"groups" yaml:"groups" mapstructure:"groups"`
+}
+
+// MQTTAPIEntry is the struct for the mqtt api entry. The agent connects out to the broker and serves requests
+// published under <topic_prefix>/<agent_id>/req/. TLS selects the profile whose certificate is presented to the broker
+// and whose CA is trusted along with the system roots, the scheme of the broker url (ssl://, wss://) decides if TLS is
+// used. Publish lists the read endpoints whose values are published on a schedule, they are called as PublishUser.
+type MQTTAPIEntry struct {
+	Enabled     bool               `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Broker      string             `json:"broker" yaml:"broker" mapstructure:"broker"`
+	ClientID    string             `json:"client_id" yaml:"client_id" mapstructure:"client_id"`
+	AgentID     string             `json:"agent_id" yaml:"agent_id" mapstructure:"agent_id"`
+	Username    string             `json:"username" yaml:"username" mapstructure:"username"`
+	Password    string             `json:"password" yaml:"password" mapstructure:"password"`
+	TopicPrefix string             `json:"topic_prefix" yaml:"topic_prefix" mapstructure:"topic_prefix"`
+	QoS         int                `json:"qos" yaml:"qos" mapstructure:"qos"`
+	TLS         TLSSelection       `json:"tls" yaml:"tls" mapstructure:"tls"`
+	PublishUser string             `json:"publish_user" yaml:"publish_user" mapstructure:"publish_user"`
+	Publish     []MQTTPublishEntry `json:"publish" yaml:"publish" mapstructure:"publish"`
+}
+
+// MQTTPublishEntry is the struct for an endpoint published on a schedule. Method is the endpoint to call, such as
+// read:hardware/cpu, and Topic defaults to <topic_prefix>/<agent_id>/telemetry/<endpoint path>. Streaming endpoints
+// publish each value as it is produced and ignore the interval.
+type MQTTPublishEntry struct {
+	Method     string              `json:"method" yaml:"method" mapstructure:"method"`
+	Interval   string              `json:"interval" yaml:"interval" mapstructure:"interval"`
+	Topic      string              `json:"topic" yaml:"topic" mapstructure:"topic"`
+	Parameters map[string][]string `json:"parameters" yaml:"parameters" mapstructure:"parameters"`
+}
+
+// GraphQLAPIEntry is the struct for the graphql api entry. AllowedOrigins lists the origins browsers may call the API
+// from, when empty cross origin requests aren't allowed.
+type GraphQLAPIEntry struct {
+	Enabled        bool         `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Port           int          `json:"port" yaml:"port" mapstructure:"port"`
+	TLS            TLSSelection `json:"tls" yaml:"tls" mapstructure:"tls"`
+	AllowedOrigins []string     `json:"allowed_origins" yaml:"allowed_origins" mapstructure:"allowed_origins"`
+}
+
 // GRPCAPIEntry is the struct for an api entry
 type GRPCAPIEntry struct {
 	Enabled    bool         `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
@@ -191,17 +338,23 @@ type Configuration struct {
 	Include         []string                         `json:"include" yaml:"include" mapstructure:"include"`
 	APIs            APIEntries                       `json:"apis" yaml:"apis" mapstructure:"apis"`
 	Auth            AuthEntry                        `json:"auth" yaml:"auth" mapstructure:"auth"`
+	Health          HealthEntry                      `json:"health" yaml:"health" mapstructure:"health"`
+	Idempotency     IdempotencyEntry                 `json:"idempotency" yaml:"idempotency" mapstructure:"idempotency"`
 	Internal        InternalSettings                 `json:"-" yaml:"-" mapstructure:"internal"`
+	Jobs            JobsEntry                        `json:"jobs" yaml:"jobs" mapstructure:"jobs"`
 	Lockout         LockoutEntry                     `json:"lockout" yaml:"lockout" mapstructure:"lockout"`
 	Subsystems      SubsystemEntry                   `json:"subsystems" yaml:"subsystems" mapstructure:"subsystems"`
 	TLS             map[string]TLSConfigurationEntry `json:"tls" yaml:"tls" mapstructure:"tls"`
 	Updater         UpdaterEntry                     `json:"updater" yaml:"updater" mapstructure:"updater"`
+	Validation      ValidationEntry                  `json:"validation" yaml:"validation" mapstructure:"validation"`
 	WifiWatchdog    WatchdogEntry                    `json:"wifi_watchdog" yaml:"wifi_watchdog" mapstructure:"wifi_watchdog"`
 	Plugins         PluginEntry                      `json:"plugins" yaml:"plugins" mapstructure:"plugins"`
 	Modules         ModuleEntry                      `json:"modules" yaml:"modules" mapstructure:"modules"`
 	CustomEndpoints []map[string]*RouteEntry         `json:"custom_endpoints" yaml:"custom_endpoints" mapstructure:"custom_endpoints"` //TODO: Needs to be updated for new architecture
 	Output          OutputEntry                      `json:"output" yaml:"output" mapstructure:"output"`
 	logger          *zap.Logger
+	filename        string
+	mu              sync.RWMutex
 }
 
 func NewConfiguration(log *zap.Logger) (*Configuration, error) {
@@ -248,57 +401,17 @@ func NewConfiguration(log *zap.Logger) (*Configuration, error) {
 		}
 	}
 
-	// === NEW: merge include fragments (SSH-like: last wins) ===
-	merged := viper.AllSettings()
-
-	// Pull include list (from the already-read base settings or defaults)
-	includes := viper.GetStringSlice("include")
-	for _, pattern := range includes {
-		// Expand env + ~
-		expanded := os.ExpandEnv(expandUser(pattern))
-
-		// Glob (ignore non-matches)
-		matches, _ := filepath.Glob(expanded)
-		if len(matches) == 0 {
-			continue
-		}
-
-		// Deterministic order (like ssh: lexicographic)
-		sort.Strings(matches)
-
-		// For each file: read via a fresh viper and deep-merge into merged
-		for _, f := range matches {
-			vf := viper.New()
-			vf.SetConfigFile(f)
-			if err := vf.ReadInConfig(); err != nil {
-				log.Warn("failed to read include fragment", zap.String("file", f), zap.Error(err))
-				continue
-			}
-			merged = deepMergeMaps(merged, vf.AllSettings())
-		}
-	}
-
-	// Unmarshal once into final struct
-	v := viper.New()
-	for k, val := range merged {
-		v.Set(k, val)
-	}
-	var c Configuration
-	if err := v.Unmarshal(&c); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal configuration: %v", err)
+	// Merge the include fragments and unmarshal into the final struct
+	c, err := load(viper.ConfigFileUsed(), log)
+	if err != nil {
+		return nil, err
 	}
 
 	// Logger + route registration (existing)
 	c.logger = log
 	c.register()
 
-	// Optional: keep watching the main file (fragments won’t auto-reload unless you add a custom watcher)
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		log.Info("config file changed", zap.String("filename", e.Name))
-	})
-	viper.WatchConfig()
-
-	return &c, nil
+	return c, nil
 }
 
 // DefaultConfig returns the default configuration
@@ -313,13 +426,19 @@ func DefaultConfig() map[string]interface{} {
 			"/etc/dtac/config.d/*.yaml",
 		},
 		"auth.admin":                    "admin",
-		"auth.pass":                     "need_to_generate_a_random_password_on_install_or_first_run",
+		"auth.pass":                     GeneratePasswordMarker,
 		"auth.default_secure":           true,
 		"auth.model":                    DefaultAuthModelName,
 		"auth.policy":                   DefaultAuthPolicyName,
 		"auth.access_token_expiration":  "15m",
 		"auth.refresh_token_expiration": "168h",
 		"auth.static_testing_token":     "",
+		"auth.password_policy.min_length": 12,
+		"auth.password_policy.min_classes": 3,
+		"auth.password_policy.breached_list": "",
+		"auth.password_policy.history":  5,
+		"auth.mfa.issuer":               "DTAC Agent",
+		"auth.mfa.required_groups":      []string{},
 		"internal.product_name":         "DTAC Agent",
 		"internal.short_name":           "dtac",
 		"internal.file_name":            "dtac-agentd",
@@ -327,11 +446,13 @@ func DefaultConfig() map[string]interface{} {
 		"apis.rest.port":                8180,
 		"apis.rest.tls.enabled":         true,
 		"apis.rest.tls.profile":         "default",
+		"apis.rest.tls.client_auth.enabled": false,
+		"apis.rest.tls.client_auth.required": false,
 		"apis.rest.cors.enabled":        false,
 		"apis.rest.cors.allowed_origins": []string{"*"},
 		"apis.rest.cors.allowed_methods": []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		"apis.rest.cors.allowed_headers": []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		"apis.rest.cors.exposed_headers": []string{"Content-Length"},
+		"apis.rest.cors.exposed_headers": []string{"Content-Length", "X-Total-Count", "X-Offset", "X-Limit", "X-Next-Cursor"},
 		"apis.rest.cors.allow_credentials": false,
 		"apis.rest.cors.max_age":        3600,
 		"apis.grpc.enabled":             true,
@@ -339,10 +460,41 @@ func DefaultConfig() map[string]interface{} {
 		"apis.grpc.reflection":          false,
 		"apis.grpc.tls.enabled":         true,
 		"apis.grpc.tls.profile":         "default",
+		"apis.grpc.tls.client_auth.enabled": false,
+		"apis.grpc.tls.client_auth.required": false,
 		"apis.json.enabled":             false,
 		"apis.json.port":                8182,
 		"apis.json.tls.enabled":         true,
 		"apis.json.tls.profile":         "default",
+		"apis.websocket.enabled":        false,
+		"apis.websocket.port":           8183,
+		"apis.websocket.tls.enabled":    true,
+		"apis.websocket.tls.profile":    "default",
+		"apis.websocket.allowed_origins": []string{},
+		"apis.websocket.min_interval":   "1s",
+		"apis.unix.enabled":             false,
+		"apis.unix.path":                "/run/dtac/agent.sock",
+		"apis.unix.mode":                "0660",
+		"apis.unix.group":               "",
+		"apis.unix.users":               map[string]string{"root": "admin"},
+		"apis.unix.groups":              map[string]string{},
+		"apis.mqtt.enabled":             false,
+		"apis.mqtt.broker":              "tcp://localhost:1883",
+		"apis.mqtt.client_id":           "",
+		"apis.mqtt.agent_id":            hostname,
+		"apis.mqtt.username":            "",
+		"apis.mqtt.password":            "",
+		"apis.mqtt.topic_prefix":        "dtac",
+		"apis.mqtt.qos":                 1,
+		"apis.mqtt.tls.enabled":         false,
+		"apis.mqtt.tls.profile":         "default",
+		"apis.mqtt.publish_user":        "",
+		"apis.mqtt.publish":             []MQTTPublishEntry{},
+		"apis.graphql.enabled":          false,
+		"apis.graphql.port":             8184,
+		"apis.graphql.tls.enabled":      true,
+		"apis.graphql.tls.profile":      "default",
+		"apis.graphql.allowed_origins":  []string{},
 		"tls.default.enabled":           true,
 		"tls.default.type":              "self-signed",
 		"tls.default.ca":                DefaultTLSCACertName,
@@ -350,8 +502,19 @@ func DefaultConfig() map[string]interface{} {
 		"tls.default.key":               DefaultTLSKeyName,
 		"tls.default.create_if_missing": true,
 		"tls.default.domains":           []string{"localhost", hostname},
+		"health.readiness_checks":       []string{"authdb", "tls/*"},
+		"health.timeout":                "5s",
+		"health.interval":               "10s",
+		"idempotency.enabled":           true,
+		"idempotency.window":            "24h",
+		"jobs.enabled":                  true,
+		"jobs.retention":                "24h",
+		"jobs.max_jobs":                 1000,
 		"lockout.enabled":               true,
+		"lockout.threshold":             5,
+		"lockout.address_threshold":     20,
 		"lockout.auto_unlock_time":      "10s",
+		"lockout.max_unlock_time":       "1h",
 		"wifi_watchdog.enabled":         false,
 		"wifi_watchdog.poll_interval":   "10s",
 		"wifi_watchdog.profile":         "",
@@ -362,6 +525,7 @@ func DefaultConfig() map[string]interface{} {
 		"updater.interval":              "1m",
 		"updater.error_fallback":        "1h",
 		"updater.restart_on_update":     true,
+		"validation.output":             "log",
 		"plugins.enabled":               true,
 		"plugins.dir":                   DefaultPluginLocation,
 		"plugins.group":                 "plugins",
@@ -369,10 +533,12 @@ func DefaultConfig() map[string]interface{} {
 		"plugins.tls.enabled":           true,
 		"plugins.tls.profile":           "default",
 		"subsystems.auth":               true,
+		"subsystems.batch":              true,
 		"subsystems.diag":               true,
 		"subsystems.echo":               true,
 		"subsystems.network":            true,
 		"subsystems.hardware":           true,
+		"subsystems.query":              true,
 		"subsystems.validation":         true,
 		"custom_endpoints":              []map[string]*RouteEntry{},
 		"output.log_level":              "debug",
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Load reads the configuration file and its include fragments again and validates the result. It is used to reload
+// the configuration of a running agent, the file is the one found by NewConfiguration.
+func Load(filename string, log *zap.Logger) (*Configuration, error) {
+	c, err := load(filename, log)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c.logger = log
+	return c, nil
+}
+
+// load reads the configuration file, merges the include fragments in lexicographic order (last wins) and unmarshals
+// the result
+func load(filename string, log *zap.Logger) (*Configuration, error) {
+	base := viper.New()
+	for k, v := range DefaultConfig() {
+		base.SetDefault(k, v)
+	}
+	base.SetConfigFile(filename)
+	base.SetConfigType("yaml")
+	if err := base.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %v", err)
+	}
+
+	merged := base.AllSettings()
+	for _, pattern := range base.GetStringSlice("include") {
+		// Glob (ignore non-matches)
+		matches, _ := filepath.Glob(expandPattern(pattern))
+		if len(matches) == 0 {
+			continue
+		}
+
+		// Deterministic order (like ssh: lexicographic)
+		sort.Strings(matches)
+
+		// For each file: read via a fresh viper and deep-merge into merged
+		for _, f := range matches {
+			vf := viper.New()
+			vf.SetConfigFile(f)
+			if err := vf.ReadInConfig(); err != nil {
+				log.Warn("failed to read include fragment", zap.String("file", f), zap.Error(err))
+				continue
+			}
+			merged = deepMergeMaps(merged, vf.AllSettings())
+		}
+	}
+
+	// Unmarshal once into final struct
+	v := viper.New()
+	for k, val := range merged {
+		v.Set(k, val)
+	}
+	var c Configuration
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration: %v", err)
+	}
+	c.filename = filename
+	return &c, nil
+}
+
+// expandPattern expands the environment variables and a leading "~" in an include pattern
+func expandPattern(pattern string) string {
+	return os.ExpandEnv(expandUser(pattern))
+}
+
+// Filename returns the name of the configuration file that was read
+func (c *Configuration) Filename() string {
+	return c.filename
+}
+
+// Sources returns the configuration file followed by the expanded include patterns, these are the files that are
+// watched for changes
+func (c *Configuration) Sources() []string {
+	sources := []string{c.filename}
+	for _, pattern := range c.Include {
+		sources = append(sources, expandPattern(pattern))
+	}
+	return sources
+}
+
+// Validate checks the settings that are parsed by the subsystems and adapters, every problem found is returned
+func (c *Configuration) Validate() error {
+	var errs []error
+	duration := func(key, value string, never bool) {
+		if value == "" || (never && strings.EqualFold(strings.TrimSpace(value), "never")) {
+			return
+		}
+		if d, err := time.ParseDuration(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid duration '%s'", key, value))
+		} else if d < 0 {
+			errs = append(errs, fmt.Errorf("%s: duration must be positive, got: %s", key, value))
+		}
+	}
+	duration("auth.access_token_expiration", c.Auth.AccessTokenExpiration, true)
+	duration("auth.refresh_token_expiration", c.Auth.RefreshTokenExpiration, true)
+	duration("health.timeout", c.Health.Timeout, false)
+	duration("health.interval", c.Health.Interval, false)
+	duration("idempotency.window", c.Idempotency.Window, false)
+	duration("jobs.retention", c.Jobs.Retention, false)
+	duration("lockout.auto_unlock_time", c.Lockout.AutoUnlockTime, false)
+	duration("lockout.max_unlock_time", c.Lockout.MaxUnlockTime, false)
+	duration("apis.websocket.min_interval", c.APIs.WebSocket.MinInterval, false)
+	for i, publish := range c.APIs.MQTT.Publish {
+		duration(fmt.Sprintf("apis.mqtt.publish.%d.interval", i), publish.Interval, false)
+	}
+
+	if policy := c.Auth.PasswordPolicy; policy.MinLength < 0 {
+		errs = append(errs, fmt.Errorf("auth.password_policy.min_length: must not be negative, got: %d", policy.MinLength))
+	}
+	if policy := c.Auth.PasswordPolicy; policy.MinClasses < 0 || policy.MinClasses > 4 {
+		errs = append(errs, fmt.Errorf("auth.password_policy.min_classes: must be between 0 and 4, got: %d", policy.MinClasses))
+	}
+	if policy := c.Auth.PasswordPolicy; policy.History < 0 {
+		errs = append(errs, fmt.Errorf("auth.password_policy.history: must not be negative, got: %d", policy.History))
+	}
+	if c.Lockout.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("lockout.threshold: must not be negative, got: %d", c.Lockout.Threshold))
+	}
+	if c.Lockout.AddressThreshold < 0 {
+		errs = append(errs, fmt.Errorf("lockout.address_threshold: must not be negative, got: %d", c.Lockout.AddressThreshold))
+	}
+
+	if c.Output.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(c.Output.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("output.log_level: %v", err))
+		}
+	}
+
+	ports := map[string]int{
+		"apis.rest.port":      c.APIs.REST.Port,
+		"apis.grpc.port":      c.APIs.GRPC.Port,
+		"apis.json.port":      c.APIs.JSON.Port,
+		"apis.websocket.port": c.APIs.WebSocket.Port,
+		"apis.graphql.port":   c.APIs.GraphQL.Port,
+	}
+	selections := map[string]TLSSelection{
+		"apis.rest.tls":      c.APIs.REST.TLS,
+		"apis.grpc.tls":      c.APIs.GRPC.TLS,
+		"apis.json.tls":      c.APIs.JSON.TLS,
+		"apis.websocket.tls": c.APIs.WebSocket.TLS,
+		"apis.graphql.tls":   c.APIs.GraphQL.TLS,
+		"apis.mqtt.tls":      c.APIs.MQTT.TLS,
+		"plugins.tls":        c.Plugins.TLS,
+		"modules.tls":        c.Modules.TLS,
+	}
+	for _, key := range sortedKeys(ports) {
+		if port := ports[key]; port < 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s: invalid port %d", key, port))
+		}
+	}
+	for _, key := range sortedKeys(selections) {
+		selection := selections[key]
+		if _, ok := c.TLS[selection.Profile]; selection.Enabled && !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown tls profile '%s'", key, selection.Profile))
+		}
+		if !selection.ClientAuth.Enabled {
+			continue
+		}
+		if selection.ClientAuth.CA == "" {
+			errs = append(errs, fmt.Errorf("%s.client_auth.ca: a client CA bundle is required", key))
+		}
+		for i, mapping := range selection.ClientAuth.Mappings {
+			if (mapping.User == "") == (mapping.Group == "") {
+				errs = append(errs, fmt.Errorf("%s.client_auth.mappings.%d: exactly one of user or group must be set", key, i))
+			}
+			if mapping.Subject == "" && mapping.SAN == "" && mapping.OU == "" {
+				errs = append(errs, fmt.Errorf("%s.client_auth.mappings.%d: at least one of subject, san or ou must be set", key, i))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Diff returns the keys of the settings that differ between the configurations, such as apis.rest.cors.max_age.
+// Maps are compared entry by entry so an entry that was added or removed is reported as the key of the entry.
+func Diff(a, b *Configuration) []string {
+	keys := make([]string, 0)
+	diff(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", &keys)
+	sort.Strings(keys)
+	return keys
+}
+
+func diff(a, b reflect.Value, key string, keys *[]string) {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*keys = append(*keys, key)
+			}
+			return
+		}
+		diff(a.Elem(), b.Elem(), key, keys)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if name, ok := settingName(a.Type().Field(i)); ok {
+				diff(a.Field(i), b.Field(i), joinKey(key, name), keys)
+			}
+		}
+	case reflect.Map:
+		names := make(map[string]reflect.Value)
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			names[fmt.Sprint(k.Interface())] = k
+		}
+		for _, name := range sortedKeys(names) {
+			av, bv := a.MapIndex(names[name]), b.MapIndex(names[name])
+			if !av.IsValid() || !bv.IsValid() {
+				*keys = append(*keys, joinKey(key, name))
+				continue
+			}
+			diff(av, bv, joinKey(key, name), keys)
+		}
+	case reflect.Slice:
+		if a.Len() == 0 && b.Len() == 0 {
+			return
+		}
+		fallthrough
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// Apply copies the settings of the keys, as returned by Diff, from src into the configuration. The configuration is
+// locked while the settings are written, components read the settings they apply live with RLock held.
+func (c *Configuration) Apply(src *Configuration, keys []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if err := apply(reflect.ValueOf(c).Elem(), reflect.ValueOf(src).Elem(), strings.Split(key, ".")); err != nil {
+			return fmt.Errorf("failed to apply %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func apply(dst, src reflect.Value, segments []string) error {
+	if len(segments) == 0 {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() || src.IsNil() {
+			return fmt.Errorf("%s not found", segments[0])
+		}
+		return apply(dst.Elem(), src.Elem(), segments)
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			if name, ok := settingName(dst.Type().Field(i)); ok && name == segments[0] {
+				return apply(dst.Field(i), src.Field(i), segments[1:])
+			}
+		}
+	case reflect.Map:
+		k := reflect.ValueOf(segments[0]).Convert(dst.Type().Key())
+		sv := src.MapIndex(k)
+		if len(segments) == 1 {
+			if dst.IsNil() {
+				dst.Set(reflect.MakeMap(dst.Type()))
+			}
+			// A zero value removes the entry
+			dst.SetMapIndex(k, sv)
+			return nil
+		}
+		dv := dst.MapIndex(k)
+		if !dv.IsValid() || !sv.IsValid() {
+			return fmt.Errorf("%s not found", segments[0])
+		}
+		// Map values aren't addressable so the copy is updated and stored back
+		entry := reflect.New(dv.Type()).Elem()
+		entry.Set(dv)
+		if err := apply(entry, sv, segments[1:]); err != nil {
+			return err
+		}
+		dst.SetMapIndex(k, entry)
+		return nil
+	}
+	return fmt.Errorf("%s not found", segments[0])
+}
+
+// RLock locks the configuration for reading, a reload can't apply new settings until RUnlock is called
+func (c *Configuration) RLock() {
+	c.mu.RLock()
+}
+
+// RUnlock undoes a single RLock call
+func (c *Configuration) RUnlock() {
+	c.mu.RUnlock()
+}
+
+// MatchKey returns true if the key is covered by the pattern. A '*' in the pattern matches any single segment and a
+// pattern covers the keys below it, so apis.rest.cors matches apis.rest.cors.max_age.
+func MatchKey(pattern, key string) bool {
+	ps, ks := strings.Split(pattern, "."), strings.Split(key, ".")
+	if len(ks) < len(ps) {
+		return false
+	}
+	for i, p := range ps {
+		if p != "*" && p != ks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// settingName returns the key of a configuration field, fields that are unexported or never written out are skipped
+func settingName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(field.Name), true
+	}
+	return name, true
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
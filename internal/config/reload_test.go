@@ -0,0 +1,252 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/plugins"
+	"go.uber.org/zap"
+)
+
+func writeFile(t *testing.T, filename string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", filename, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "config.d"), 0700); err != nil {
+		t.Fatalf("Failed to create include directory: %v", err)
+	}
+	filename := filepath.Join(dir, "config.yaml")
+	writeFile(t, filename, `
+include:
+  - `+filepath.Join(dir, "config.d", "*.yaml")+`
+auth:
+  access_token_expiration: 30m
+output:
+  log_level: info
+`)
+	writeFile(t, filepath.Join(dir, "config.d", "10-auth.yaml"), "auth:\n  access_token_expiration: 1h\n")
+	writeFile(t, filepath.Join(dir, "config.d", "20-auth.yaml"), "auth:\n  access_token_expiration: 2h\n")
+
+	cfg, err := Load(filename, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Auth.AccessTokenExpiration != "2h" {
+		t.Errorf("Expected the last include fragment to win, got '%s'", cfg.Auth.AccessTokenExpiration)
+	}
+	if cfg.Auth.RefreshTokenExpiration != "168h" {
+		t.Errorf("Expected the default refresh_token_expiration, got '%s'", cfg.Auth.RefreshTokenExpiration)
+	}
+	if cfg.Filename() != filename {
+		t.Errorf("Expected filename '%s', got '%s'", filename, cfg.Filename())
+	}
+	sources := cfg.Sources()
+	if len(sources) != 2 || sources[0] != filename || sources[1] != filepath.Join(dir, "config.d", "*.yaml") {
+		t.Errorf("Unexpected sources %v", sources)
+	}
+
+	writeFile(t, filename, "output:\n  log_level: loud\n")
+	if _, err := Load(filename, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "output.log_level") {
+		t.Errorf("Expected an invalid log level error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Configuration)
+		errors []string
+	}{
+		{name: "valid", modify: func(c *Configuration) {}},
+		{name: "never expires", modify: func(c *Configuration) { c.Auth.RefreshTokenExpiration = "never" }},
+		{
+			name: "invalid durations",
+			modify: func(c *Configuration) {
+				c.Auth.AccessTokenExpiration = "soon"
+				c.Health.Timeout = "-1s"
+			},
+			errors: []string{"auth.access_token_expiration", "health.timeout"},
+		},
+		{
+			name: "invalid password policy",
+			modify: func(c *Configuration) {
+				c.Auth.PasswordPolicy.MinClasses = 5
+				c.Auth.PasswordPolicy.History = -1
+			},
+			errors: []string{"auth.password_policy.min_classes", "auth.password_policy.history"},
+		},
+		{
+			name: "invalid lockout",
+			modify: func(c *Configuration) {
+				c.Lockout.MaxUnlockTime = "forever"
+				c.Lockout.Threshold = -1
+			},
+			errors: []string{"lockout.max_unlock_time", "lockout.threshold"},
+		},
+		{name: "invalid port", modify: func(c *Configuration) { c.APIs.REST.Port = 70000 }, errors: []string{"apis.rest.port"}},
+		{
+			name:   "unknown tls profile",
+			modify: func(c *Configuration) { c.APIs.GRPC.TLS = TLSSelection{Enabled: true, Profile: "missing"} },
+			errors: []string{"apis.grpc.tls"},
+		},
+		{
+			name: "client auth",
+			modify: func(c *Configuration) {
+				c.APIs.REST.TLS.ClientAuth = ClientAuthEntry{Enabled: true, CA: "ca.crt", Mappings: []ClientCertMapping{
+					{OU: "operations", Group: "operators"},
+				}}
+			},
+		},
+		{
+			name: "invalid client auth",
+			modify: func(c *Configuration) {
+				c.APIs.REST.TLS.ClientAuth = ClientAuthEntry{Enabled: true, Mappings: []ClientCertMapping{
+					{Subject: "monitor", User: "admin", Group: "operators"},
+					{User: "admin"},
+				}}
+			},
+			errors: []string{"apis.rest.tls.client_auth.ca", "apis.rest.tls.client_auth.mappings.0", "apis.rest.tls.client_auth.mappings.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Configuration{
+				Auth:   AuthEntry{AccessTokenExpiration: "15m", RefreshTokenExpiration: "168h"},
+				Health: HealthEntry{Timeout: "5s"},
+				Output: OutputEntry{LogLevel: "debug"},
+				TLS:    map[string]TLSConfigurationEntry{"default": {}},
+			}
+			c.APIs.REST.TLS = TLSSelection{Enabled: true, Profile: "default"}
+			tt.modify(c)
+			err := c.Validate()
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected errors for %v", tt.errors)
+			}
+			for _, key := range tt.errors {
+				if !strings.Contains(err.Error(), key) {
+					t.Errorf("Expected an error for %s, got %v", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffAndApply(t *testing.T) {
+	newConfig := func() *Configuration {
+		c := &Configuration{
+			Output: OutputEntry{LogLevel: "debug"},
+			TLS:    map[string]TLSConfigurationEntry{"default": {Enabled: true}},
+		}
+		c.APIs.REST.CORS.AllowedOrigins = []string{}
+		c.Plugins.Entries = map[string]*plugins.PluginConfig{
+			"hello": {Enabled: true, Config: map[string]interface{}{"message": "hello"}},
+			"iperf": {Enabled: true},
+		}
+		return c
+	}
+
+	running, next := newConfig(), newConfig()
+	running.APIs.REST.CORS.AllowedOrigins = nil
+	if keys := Diff(running, next); len(keys) != 0 {
+		t.Fatalf("Expected no differences, got %v", keys)
+	}
+
+	next.Output.LogLevel = "info"
+	next.APIs.REST.CORS.AllowedOrigins = []string{"https://example.com"}
+	next.Plugins.Entries["hello"].Enabled = false
+	next.Plugins.Entries["hello"].Config["message"] = "goodbye"
+	delete(next.Plugins.Entries, "iperf")
+	next.TLS["default"] = TLSConfigurationEntry{Enabled: false}
+	next.Internal.ProductName = "ignored"
+
+	expected := []string{
+		"apis.rest.cors.allowed_origins",
+		"output.log_level",
+		"plugins.entries.hello.config.message",
+		"plugins.entries.hello.enabled",
+		"plugins.entries.iperf",
+		"tls.default.enabled",
+	}
+	keys := Diff(running, next)
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+
+	if err := running.Apply(next, keys); err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if keys := Diff(running, next); len(keys) != 0 {
+		t.Errorf("Expected no differences after applying, got %v", keys)
+	}
+	if _, ok := running.Plugins.Entries["iperf"]; ok {
+		t.Errorf("Expected the iperf entry to be removed")
+	}
+	if err := running.Apply(next, []string{"plugins.entries.missing.enabled"}); err == nil {
+		t.Errorf("Expected an error applying a missing entry")
+	}
+}
+
+func TestApplyWaitsForReaders(t *testing.T) {
+	running, next := &Configuration{}, &Configuration{}
+	next.Lockout.Threshold = 5
+
+	running.RLock()
+	done := make(chan error)
+	go func() {
+		done <- running.Apply(next, []string{"lockout.threshold"})
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Expected the settings not to be applied while they are being read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	threshold := running.Lockout.Threshold
+	running.RUnlock()
+	if threshold != 0 {
+		t.Errorf("Expected the threshold to be unchanged while reading, got %d", threshold)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if running.Lockout.Threshold != 5 {
+		t.Errorf("Expected the threshold to be applied, got %d", running.Lockout.Threshold)
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{pattern: "output.log_level", key: "output.log_level", match: true},
+		{pattern: "apis.rest.cors", key: "apis.rest.cors.max_age", match: true},
+		{pattern: "apis.rest.cors", key: "apis.rest.port", match: false},
+		{pattern: "plugins.entries.*.enabled", key: "plugins.entries.hello.enabled", match: true},
+		{pattern: "plugins.entries.*.enabled", key: "plugins.entries.hello", match: false},
+		{pattern: "subsystems.*", key: "subsystems.diag", match: true},
+	}
+
+	for _, tt := range tests {
+		if match := MatchKey(tt.pattern, tt.key); match != tt.match {
+			t.Errorf("MatchKey(%s, %s) = %v, expected %v", tt.pattern, tt.key, match, tt.match)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/bgrewell/dtac-agent/internal/endpoints"
 	"github.com/bgrewell/dtac-agent/internal/helpers"
 	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/openapi"
 	"github.com/bgrewell/dtac-agent/internal/types"
 	"github.com/bgrewell/dtac-agent/internal/version"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
@@ -54,6 +55,7 @@ func (s *Subsystem) register() {
 	s.endpoints = []*endpoint.Endpoint{
 		endpoint.NewEndpoint(fmt.Sprintf("%s/", base), endpoint.ActionRead, "general diagnostic information", s.rootHandler, secure, authzGuest, endpoint.WithOutput(version.Info{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/endpoints", base), endpoint.ActionRead, "list of endpoints", s.endpointListPrintHandler, secure, authzGuest, endpoint.WithOutput(endpoints.EndpointList{})),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/openapi", base), endpoint.ActionRead, "openapi document for the endpoints", s.openAPIHandler, secure, authzGuest),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/runningas", base), endpoint.ActionRead, "information on current execution context", s.runningAsHandler, secure, authzAdmin, endpoint.WithOutput(types.UserGroup{})),
 	}
 
@@ -93,6 +95,17 @@ func (s *Subsystem) endpointListPrintHandler(in *endpoint.Request) (out *endpoin
 	}, "endpoints visible to the user")
 }
 
+// openAPIHandler returns the OpenAPI document describing the endpoints that are visible to the user
+func (s *Subsystem) openAPIHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
+	return helpers.HandleWrapper(in, func() ([]byte, error) {
+		doc, err := openapi.Generate(s.Controller.EndpointList.GetVisibleEndpoints(in))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	}, "openapi document")
+}
+
 // runningAsHandler returns information about the user and group context the application is running as
 func (s *Subsystem) runningAsHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
 	return helpers.HandleWrapper(in, func() ([]byte, error) {
@@ -0,0 +1,239 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout is used when the configured timeout can't be parsed
+const DefaultTimeout = 5 * time.Second
+
+// Report is the health of the agent along with the result of each check
+type Report struct {
+	Status interfaces.HealthStatus  `json:"status"`
+	Ready  bool                     `json:"ready"`
+	Checks []interfaces.HealthCheck `json:"checks"`
+}
+
+// NewSubsystem creates a new health subsystem
+func NewSubsystem(c *controller.Controller, tls *map[string]basic.TLSInfo) interfaces.Subsystem {
+	name := "health"
+	hs := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		tls:        tls,
+		name:       name,
+		timeout:    DefaultTimeout,
+		checkers:   make(map[string]interfaces.HealthChecker),
+	}
+	hs.register()
+	return &hs
+}
+
+// Subsystem serves the liveness and readiness endpoints. The health of the agent is made up of the checks reported by
+// every subsystem that implements interfaces.HealthChecker, which are added with AddChecker when the agent is set up.
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	tls        *map[string]basic.TLSInfo
+	name       string
+	endpoints  []*endpoint.Endpoint
+	timeout    time.Duration
+	checkers   map[string]interfaces.HealthChecker
+	mu         sync.RWMutex
+}
+
+// register registers the endpoints that this subsystem handles
+func (s *Subsystem) register() {
+	if cfg := s.Controller.Config.Health.Timeout; cfg != "" {
+		timeout, err := time.ParseDuration(cfg)
+		if err != nil {
+			s.Logger.Error("invalid health check timeout, using default", zap.String("timeout", cfg), zap.Error(err))
+		} else {
+			s.timeout = timeout
+		}
+	}
+
+	// The endpoints are never secured so load balancers and supervisors can use them without credentials
+	authz := endpoint.AuthGroupGuest.String()
+	s.endpoints = []*endpoint.Endpoint{
+		endpoint.NewTypedEndpoint("healthz", endpoint.ActionRead, "agent liveness and the result of each health check", s.healthHandler, false, authz),
+		endpoint.NewTypedEndpoint("readyz", endpoint.ActionRead, "agent readiness, fails if any of the configured readiness checks are down", s.readyHandler, false, authz),
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *Subsystem) Enabled() bool {
+	return true
+}
+
+// Name returns the name of the subsystem
+func (s *Subsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns an array of endpoints that this Subsystem handles
+func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// AddChecker adds the health checks of a subsystem to the health of the agent
+func (s *Subsystem) AddChecker(name string, checker interfaces.HealthChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkers[name] = checker
+}
+
+// Check runs every health check. Checkers are run concurrently and a checker that doesn't finish before the timeout
+// is reported as down.
+func (s *Subsystem) Check(ctx context.Context) *Report {
+	s.mu.RLock()
+	checkers := make(map[string]interfaces.HealthChecker, len(s.checkers))
+	for name, checker := range s.checkers {
+		checkers[name] = checker
+	}
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checks := make([]interfaces.HealthCheck, 0)
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results := make(chan []interfaces.HealthCheck, 1)
+			go func() { results <- checker.HealthChecks(ctx) }()
+			var result []interfaces.HealthCheck
+			select {
+			case result = <-results:
+			case <-ctx.Done():
+				result = []interfaces.HealthCheck{{Name: name, Status: interfaces.HealthStatusDown, Message: "health check timed out"}}
+			}
+			mu.Lock()
+			checks = append(checks, result...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	report := &Report{Status: interfaces.HealthStatusUp, Ready: true, Checks: checks}
+	for _, check := range checks {
+		if check.Status != interfaces.HealthStatusUp {
+			report.Status = interfaces.HealthStatusDown
+			if s.required(check.Name) {
+				report.Ready = false
+			}
+		}
+	}
+	return report
+}
+
+// Ready runs the health checks and returns whether all the readiness checks are up
+func (s *Subsystem) Ready(ctx context.Context) (ready bool, checks []interfaces.HealthCheck) {
+	report := s.Check(ctx)
+	return report.Ready, report.Checks
+}
+
+// HealthChecks reports the health of the authentication database and the TLS profiles
+func (s *Subsystem) HealthChecks(ctx context.Context) []interfaces.HealthCheck {
+	checks := []interfaces.HealthCheck{s.checkAuthDB()}
+	if s.tls != nil {
+		for name, info := range *s.tls {
+			if info.Enabled {
+				checks = append(checks, checkTLS(name, info))
+			}
+		}
+	}
+	return checks
+}
+
+// required returns true if the check is one of the configured readiness checks
+func (s *Subsystem) required(name string) bool {
+	for _, pattern := range s.Controller.Config.Health.ReadinessChecks {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subsystem) checkAuthDB() interfaces.HealthCheck {
+	check := interfaces.HealthCheck{Name: "authdb", Status: interfaces.HealthStatusUp}
+	db := s.Controller.AuthDB
+	if db == nil || db.DB == nil {
+		check.Status = interfaces.HealthStatusDown
+		check.Message = "authentication database failed to open"
+		return check
+	}
+	if err := db.DB.View(func(tx *bolt.Tx) error { return nil }); err != nil {
+		check.Status = interfaces.HealthStatusDown
+		check.Message = err.Error()
+	}
+	return check
+}
+
+// checkTLS checks that the certificate of the profile can be loaded and hasn't expired
+func checkTLS(name string, info basic.TLSInfo) interfaces.HealthCheck {
+	check := interfaces.HealthCheck{Name: "tls/" + name, Status: interfaces.HealthStatusDown}
+	cert, err := tls.LoadX509KeyPair(info.CertFilename, info.KeyFilename)
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to load TLS keys: %v", err)
+		return check
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to parse certificate: %v", err)
+		return check
+	}
+	check.Details = map[string]string{"expires": leaf.NotAfter.UTC().Format(time.RFC3339)}
+	if now := time.Now(); now.After(leaf.NotAfter) {
+		check.Message = "certificate has expired"
+		return check
+	} else if now.Before(leaf.NotBefore) {
+		check.Message = "certificate is not valid yet"
+		return check
+	}
+	check.Status = interfaces.HealthStatusUp
+	return check
+}
+
+func (s *Subsystem) healthHandler(ctx context.Context, _ endpoint.Empty) (*Report, error) {
+	return s.Check(ctx), nil
+}
+
+// readyHandler returns the report if the agent is ready, otherwise an unavailable error with the failed readiness
+// checks in its details so the protocols report it as not ready
+func (s *Subsystem) readyHandler(ctx context.Context, _ endpoint.Empty) (*Report, error) {
+	report := s.Check(ctx)
+	if report.Ready {
+		return report, nil
+	}
+	err := endpoint.UnavailableError("agent is not ready")
+	for _, check := range report.Checks {
+		if check.Status != interfaces.HealthStatusUp && s.required(check.Name) {
+			message := check.Message
+			if message == "" {
+				message = string(check.Status)
+			}
+			err = err.WithDetail(check.Name, message)
+		}
+	}
+	return nil, err
+}
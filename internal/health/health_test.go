@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// checkerFunc adapts a function to the interfaces.HealthChecker interface
+type checkerFunc func(ctx context.Context) []interfaces.HealthCheck
+
+func (f checkerFunc) HealthChecks(ctx context.Context) []interfaces.HealthCheck {
+	return f(ctx)
+}
+
+func staticChecker(checks ...interfaces.HealthCheck) interfaces.HealthChecker {
+	return checkerFunc(func(ctx context.Context) []interfaces.HealthCheck { return checks })
+}
+
+func newTestSubsystem(t *testing.T, readiness []string, tls map[string]basic.TLSInfo) *Subsystem {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "health.db"), 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Configuration{}
+	cfg.Health = config.HealthEntry{ReadinessChecks: readiness, Timeout: "100ms"}
+	c := &controller.Controller{
+		Logger: zap.NewNop(),
+		Config: cfg,
+		AuthDB: &authndb.AuthDB{DB: db},
+	}
+	s := NewSubsystem(c, &tls).(*Subsystem)
+	s.AddChecker(s.Name(), s)
+	return s
+}
+
+// writeCertificate writes a self-signed certificate valid between the times and returns the TLS profile for it
+func writeCertificate(t *testing.T, notBefore, notAfter time.Time) basic.TLSInfo {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	info := basic.TLSInfo{Enabled: true, CertFilename: filepath.Join(dir, "cert.pem"), KeyFilename: filepath.Join(dir, "key.pem")}
+	require.NoError(t, os.WriteFile(info.CertFilename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(info.KeyFilename, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return info
+}
+
+func TestCheck(t *testing.T) {
+	up := interfaces.HealthCheck{Name: "plugin/up", Status: interfaces.HealthStatusUp}
+	down := interfaces.HealthCheck{Name: "plugin/down", Status: interfaces.HealthStatusDown, Message: "plugin has exited with code 1"}
+
+	tests := []struct {
+		name      string
+		readiness []string
+		checker   interfaces.HealthChecker
+		status    interfaces.HealthStatus
+		ready     bool
+	}{
+		{name: "all up", readiness: []string{"authdb", "plugin/*"}, checker: staticChecker(up), status: interfaces.HealthStatusUp, ready: true},
+		{name: "required check down", readiness: []string{"authdb", "plugin/*"}, checker: staticChecker(up, down), status: interfaces.HealthStatusDown, ready: false},
+		{name: "optional check down", readiness: []string{"authdb", "plugin/up"}, checker: staticChecker(up, down), status: interfaces.HealthStatusDown, ready: true},
+		{name: "no readiness checks", checker: staticChecker(down), status: interfaces.HealthStatusDown, ready: true},
+		{
+			name:      "timeout",
+			readiness: []string{"slow"},
+			checker: checkerFunc(func(ctx context.Context) []interfaces.HealthCheck {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return []interfaces.HealthCheck{{Name: "slow", Status: interfaces.HealthStatusUp}}
+			}),
+			status: interfaces.HealthStatusDown,
+			ready:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSubsystem(t, tt.readiness, nil)
+			s.AddChecker("slow", tt.checker)
+			report := s.Check(context.Background())
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, tt.ready, report.Ready)
+			assert.Equal(t, "authdb", report.Checks[0].Name)
+		})
+	}
+}
+
+func TestCheckAuthDB(t *testing.T) {
+	s := newTestSubsystem(t, []string{"authdb"}, nil)
+	assert.Equal(t, interfaces.HealthStatusUp, s.checkAuthDB().Status)
+
+	s.Controller.AuthDB = nil
+	check := s.checkAuthDB()
+	assert.Equal(t, interfaces.HealthStatusDown, check.Status)
+	assert.NotEmpty(t, check.Message)
+	ready, _ := s.Ready(context.Background())
+	assert.False(t, ready)
+}
+
+func TestCheckTLS(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		info   basic.TLSInfo
+		status interfaces.HealthStatus
+	}{
+		{name: "valid", info: writeCertificate(t, now.Add(-time.Hour), now.Add(time.Hour)), status: interfaces.HealthStatusUp},
+		{name: "expired", info: writeCertificate(t, now.Add(-2*time.Hour), now.Add(-time.Hour)), status: interfaces.HealthStatusDown},
+		{name: "not valid yet", info: writeCertificate(t, now.Add(time.Hour), now.Add(2*time.Hour)), status: interfaces.HealthStatusDown},
+		{name: "missing", info: basic.TLSInfo{Enabled: true, CertFilename: "missing.pem", KeyFilename: "missing.key"}, status: interfaces.HealthStatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSubsystem(t, []string{"tls/*"}, map[string]basic.TLSInfo{"default": tt.info})
+			report := s.Check(context.Background())
+			require.Len(t, report.Checks, 2)
+			check := report.Checks[1]
+			assert.Equal(t, "tls/default", check.Name)
+			assert.Equal(t, tt.status, check.Status, check.Message)
+			assert.Equal(t, tt.status == interfaces.HealthStatusUp, report.Ready)
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	s := newTestSubsystem(t, []string{"plugin/*"}, nil)
+	s.AddChecker("plugin", staticChecker(interfaces.HealthCheck{Name: "plugin/iperf", Status: interfaces.HealthStatusDown, Message: "plugin has exited with code 1"}))
+
+	eps := make(map[string]*endpoint.Endpoint)
+	for _, ep := range s.Endpoints() {
+		assert.False(t, ep.Secure)
+		eps[ep.Path] = ep
+	}
+
+	out, err := eps["healthz"].Function(&endpoint.Request{})
+	require.NoError(t, err)
+	var report Report
+	require.NoError(t, json.Unmarshal(out.Value, &report))
+	assert.Equal(t, interfaces.HealthStatusDown, report.Status)
+	assert.False(t, report.Ready)
+	assert.Len(t, report.Checks, 2)
+
+	_, err = eps["readyz"].Function(&endpoint.Request{})
+	require.Error(t, err)
+	e := endpoint.AsError(err)
+	assert.Equal(t, endpoint.ErrorCodeUnavailable, e.Code)
+	assert.Equal(t, map[string]string{"plugin/iperf": "plugin has exited with code 1"}, e.Details)
+}
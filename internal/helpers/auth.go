@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"net"
+)
+
+// AuthUsername returns the username of the authenticated user that made the request. An empty string is returned if
+// the request wasn't authenticated.
+func AuthUsername(in *endpoint.Request) string {
+	userJSON, ok := in.Metadata[types.ContextAuthUser.String()]
+	if !ok {
+		return ""
+	}
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal([]byte(userJSON), &user); err != nil {
+		return ""
+	}
+	return user.Username
+}
+
+// HasAuthScheme returns true if the token already includes an authorization scheme such as 'Bearer'
+func HasAuthScheme(token string) bool {
+	for idx, r := range token {
+		if r == ' ' {
+			return idx > 0
+		}
+	}
+	return false
+}
+
+// RemoteHost returns the host of the network address without its port. An empty string is returned for addresses
+// that don't have a host, such as those of unix sockets.
+func RemoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
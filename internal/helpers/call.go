@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"time"
+)
+
+// CallEndpoint calls the endpoint with a context limited by the timeout, or by the endpoint's timeout when it is zero.
+// Errors caused by the context ending are returned as deadline exceeded or canceled errors and a nil response is
+// returned as an empty one.
+func CallEndpoint(ctx context.Context, ep *endpoint.Endpoint, in *endpoint.Request, timeout time.Duration) (*endpoint.Response, error) {
+	ctx, cancel := ep.CallContext(ctx, timeout)
+	defer cancel()
+
+	out, err := ep.Function(in.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, endpoint.Errorf(endpoint.ErrorCodeDeadlineExceeded, "%s", ctxErr.Error())
+		} else if ctxErr != nil {
+			return nil, endpoint.Errorf(endpoint.ErrorCodeCanceled, "%s", ctxErr.Error())
+		}
+		return nil, err
+	}
+	if out == nil {
+		out = &endpoint.Response{}
+	}
+	return out, nil
+}
+
+// ResponseValue returns the value of the response as JSON. Values that aren't JSON are returned as a string.
+func ResponseValue(out *endpoint.Response) json.RawMessage {
+	if len(out.Value) == 0 {
+		return nil
+	}
+	if json.Valid(out.Value) {
+		return out.Value
+	}
+	encoded, _ := json.Marshal(string(out.Value))
+	return encoded
+}
@@ -0,0 +1,233 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderIdempotencyKey is the header clients use to make create and write calls safe to retry
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on responses that were replayed from a previous call with the same key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// MaxKeyLength is the maximum length of an idempotency key
+	MaxKeyLength = 255
+	// DefaultWindow is used when the configured window can't be parsed
+	DefaultWindow = 24 * time.Hour
+	// pruneInterval is the minimum time between removing expired keys
+	pruneInterval = time.Minute
+)
+
+// NewSubsystem creates a new idempotency subsystem
+func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
+	name := "idempotency"
+	is := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		enabled:    c.Config.Idempotency.Enabled,
+		name:       name,
+		endpoints:  []*endpoint.Endpoint{},
+		window:     DefaultWindow,
+	}
+	is.register()
+	return &is
+}
+
+// Subsystem is the middleware that replays the response of create and write calls that are retried with the same
+// idempotency key
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	enabled    bool
+	name       string
+	endpoints  []*endpoint.Endpoint
+	store      *Store
+	window     time.Duration
+	lastPrune  time.Time
+	mu         sync.Mutex
+}
+
+// register sets up the key store
+func (s *Subsystem) register() {
+	if !s.Enabled() {
+		s.Logger.Info("subsystem is disabled", zap.String("subsystem", s.Name()))
+		return
+	}
+
+	if s.Controller.AuthDB == nil || s.Controller.AuthDB.DB == nil {
+		s.Logger.Error("database is not available, disabling subsystem", zap.String("subsystem", s.Name()))
+		s.enabled = false
+		return
+	}
+
+	var err error
+	s.store, err = NewStore(s.Controller.AuthDB.DB, s.name)
+	if err != nil {
+		s.Logger.Error("failed to initialize idempotency key store, disabling subsystem", zap.Error(err))
+		s.enabled = false
+		return
+	}
+
+	if s.Controller.Config.Idempotency.Window != "" {
+		window, err := time.ParseDuration(s.Controller.Config.Idempotency.Window)
+		if err != nil || window <= 0 {
+			s.Logger.Error("invalid idempotency window, using default", zap.String("window", s.Controller.Config.Idempotency.Window), zap.Error(err))
+		} else {
+			s.window = window
+		}
+	}
+
+	// Requests that were in progress when the agent stopped never completed so their keys can be used again
+	if _, err := s.store.Prune(true); err != nil {
+		s.Logger.Error("failed to prune idempotency keys", zap.Error(err))
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *Subsystem) Enabled() bool {
+	return s.enabled
+}
+
+// Name returns the name of the subsystem
+func (s *Subsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns the endpoints that this subsystem handles
+func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// Priority returns the priority of the middleware
+func (s *Subsystem) Priority() middleware.Priority {
+	return middleware.PriorityIdempotency
+}
+
+// Handler returns the handler for the middleware
+func (s *Subsystem) Handler(ep endpoint.Endpoint) endpoint.Func {
+	// Only calls that change state need to be protected against being applied twice
+	if !s.enabled || ep.Streaming || (ep.Action != endpoint.ActionCreate && ep.Action != endpoint.ActionWrite) {
+		return ep.Function
+	}
+	return s.IdempotentHandler(ep, ep.Function)
+}
+
+// IdempotentHandler replays the stored response when a call is repeated with the same idempotency key. Keys are scoped
+// to the authenticated user. Reusing a key for a different request, or while the first request is still in progress,
+// returns a conflict error. Failed calls aren't stored so they can be retried with the same key.
+func (s *Subsystem) IdempotentHandler(ep endpoint.Endpoint, next endpoint.Func) endpoint.Func {
+	return func(in *endpoint.Request) (out *endpoint.Response, err error) {
+		key := headerValue(in.Headers, HeaderIdempotencyKey)
+		if key == "" {
+			return next(in)
+		}
+		if len(key) > MaxKeyLength {
+			return nil, endpoint.InvalidArgumentError("idempotency key must not be longer than %d characters", MaxKeyLength).WithDetail("header", HeaderIdempotencyKey)
+		}
+
+		s.prune()
+
+		storeKey := fmt.Sprintf("%s:%s", helpers.AuthUsername(in), key)
+		fp, err := fingerprint(ep, in)
+		if err != nil {
+			return nil, err
+		}
+		existing, err := s.store.Reserve(storeKey, fp, s.window)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return s.replay(key, fp, existing)
+		}
+
+		out, err = next(in)
+		if err != nil {
+			if releaseErr := s.store.Release(storeKey); releaseErr != nil {
+				s.Logger.Error("failed to release idempotency key", zap.String("key", key), zap.Error(releaseErr))
+			}
+			return nil, err
+		}
+		if err := s.store.Complete(storeKey, out); err != nil {
+			s.Logger.Error("failed to store idempotent response", zap.String("key", key), zap.Error(err))
+		}
+		return out, nil
+	}
+}
+
+// replay returns the stored response for a repeated call
+func (s *Subsystem) replay(key, fp string, record *Record) (*endpoint.Response, error) {
+	if record.Fingerprint != fp {
+		return nil, endpoint.ConflictError("idempotency key was already used for a different request").WithDetail("idempotency_key", key)
+	}
+	if !record.Completed {
+		return nil, endpoint.ConflictError("a request with this idempotency key is still in progress").WithDetail("idempotency_key", key).WithRetryable(true)
+	}
+
+	s.Logger.Debug("replaying idempotent response", zap.String("key", key))
+	out := record.Response
+	if out == nil {
+		out = &endpoint.Response{}
+	}
+	headers := make(map[string][]string, len(out.Headers)+1)
+	for k, v := range out.Headers {
+		headers[k] = v
+	}
+	headers[HeaderIdempotentReplayed] = []string{"true"}
+	out.Headers = headers
+	return out, nil
+}
+
+// prune removes expired keys at most once per prune interval
+func (s *Subsystem) prune() {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < pruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	if removed, err := s.store.Prune(false); err != nil {
+		s.Logger.Warn("failed to prune idempotency keys", zap.Error(err))
+	} else if removed > 0 {
+		s.Logger.Debug("pruned idempotency keys", zap.Int("count", removed))
+	}
+}
+
+// fingerprint returns a hash that identifies the request. Two requests with the same endpoint, parameters and body
+// have the same fingerprint.
+func fingerprint(ep endpoint.Endpoint, in *endpoint.Request) (string, error) {
+	// Map keys are sorted when marshalled so the parameter order doesn't matter
+	params, err := json.Marshal(in.Parameters)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(ep.Action.String()), []byte(ep.Path), params, in.Body} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// headerValue returns the first value of the header ignoring the case of the header name
+func headerValue(headers map[string][]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+	}
+	return ""
+}
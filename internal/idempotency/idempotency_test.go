@@ -0,0 +1,145 @@
+package idempotency
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestSubsystem(t *testing.T) *Subsystem {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "idempotency.db"), 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Configuration{}
+	cfg.Idempotency = config.IdempotencyEntry{Enabled: true, Window: "1h"}
+	c := &controller.Controller{
+		Logger: zap.NewNop(),
+		Config: cfg,
+		AuthDB: &authndb.AuthDB{DB: db},
+	}
+	return NewSubsystem(c).(*Subsystem)
+}
+
+func newRequest(key string, user string, body string) *endpoint.Request {
+	in := &endpoint.Request{
+		Metadata: map[string]string{types.ContextAuthUser.String(): `{"username":"` + user + `"}`},
+		Headers:  map[string][]string{},
+		Body:     []byte(body),
+	}
+	if key != "" {
+		in.Headers["idempotency-key"] = []string{key}
+	}
+	return in
+}
+
+func TestIdempotentHandler(t *testing.T) {
+	s := newTestSubsystem(t)
+	calls := 0
+	fail := false
+	ep := endpoint.NewEndpoint("network/route", endpoint.ActionCreate, "create route", func(in *endpoint.Request) (*endpoint.Response, error) {
+		calls++
+		if fail {
+			return nil, endpoint.UnavailableError("try again")
+		}
+		return &endpoint.Response{Value: in.Body, Headers: map[string][]string{"X-Call": {"1"}}}, nil
+	}, false, endpoint.AuthGroupAdmin.String())
+	handler := s.Handler(*ep)
+
+	tests := []struct {
+		name         string
+		in           *endpoint.Request
+		fail         bool
+		expectCalls  int
+		expectCode   endpoint.ErrorCode
+		expectReplay bool
+	}{
+		{name: "first call", in: newRequest("key-1", "alice", `{"a":1}`), expectCalls: 1},
+		{name: "replayed", in: newRequest("key-1", "alice", `{"a":1}`), expectCalls: 1, expectReplay: true},
+		{name: "different payload", in: newRequest("key-1", "alice", `{"a":2}`), expectCalls: 1, expectCode: endpoint.ErrorCodeConflict},
+		{name: "different user", in: newRequest("key-1", "bob", `{"a":2}`), expectCalls: 2},
+		{name: "no key", in: newRequest("", "alice", `{"a":1}`), expectCalls: 3},
+		{name: "failed call", in: newRequest("key-2", "alice", `{"b":1}`), fail: true, expectCalls: 4, expectCode: endpoint.ErrorCodeUnavailable},
+		{name: "retry after failure", in: newRequest("key-2", "alice", `{"b":1}`), expectCalls: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fail = tt.fail
+			out, err := handler(tt.in)
+			assert.Equal(t, tt.expectCalls, calls)
+			if tt.expectCode != "" {
+				assert.Equal(t, tt.expectCode, endpoint.ErrorCodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.in.Body), string(out.Value))
+			assert.Equal(t, []string{"1"}, out.Headers["X-Call"])
+			if tt.expectReplay {
+				assert.Equal(t, []string{"true"}, out.Headers[HeaderIdempotentReplayed])
+			} else {
+				assert.Empty(t, out.Headers[HeaderIdempotentReplayed])
+			}
+		})
+	}
+}
+
+func TestIdempotentHandlerBypass(t *testing.T) {
+	s := newTestSubsystem(t)
+	read := endpoint.NewEndpoint("network/routes", endpoint.ActionRead, "routes", func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{}, nil
+	}, false, endpoint.AuthGroupUser.String())
+
+	// Only create and write actions are wrapped
+	out, err := s.Handler(*read)(newRequest("key", "alice", ""))
+	require.NoError(t, err)
+	assert.Empty(t, out.Headers)
+	out, err = s.Handler(*read)(newRequest("key", "alice", ""))
+	require.NoError(t, err)
+	assert.Empty(t, out.Headers)
+}
+
+func TestStore(t *testing.T) {
+	s := newTestSubsystem(t)
+
+	existing, err := s.store.Reserve("alice:key", "fp", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	existing, err = s.store.Reserve("alice:key", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.False(t, existing.Completed)
+
+	// Expired keys can be reserved again
+	_, err = s.store.Reserve("alice:expired", "fp", -time.Second)
+	require.NoError(t, err)
+	existing, err = s.store.Reserve("alice:expired", "other", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	require.NoError(t, s.store.Complete("alice:key", &endpoint.Response{Value: []byte("ok")}))
+	existing, err = s.store.Reserve("alice:key", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.True(t, existing.Completed)
+	assert.Equal(t, "ok", string(existing.Response.Value))
+
+	// Incomplete records are only removed when asked for
+	removed, err := s.store.Prune(false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	removed, err = s.store.Prune(true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
@@ -0,0 +1,135 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// Record is a stored idempotency key along with the fingerprint of the request that used it and, once the request has
+// completed, its response
+type Record struct {
+	Key         string             `json:"key"`
+	Fingerprint string             `json:"fingerprint"`
+	Completed   bool               `json:"completed"`
+	Response    *endpoint.Response `json:"response,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+}
+
+// Expired returns true if the record is no longer valid at the given time
+func (r *Record) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// NewStore creates a new idempotency key store backed by a bucket in the bolt database
+func NewStore(db *bolt.DB, bucket string) (*Store, error) {
+	s := &Store{db: db, bucket: []byte(bucket)}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return fmt.Errorf("failed to create %s bucket: %s", bucket, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Store persists idempotency key records
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// Reserve stores a new in progress record for the key unless an unexpired record already exists, in which case the
+// existing record is returned instead. The check and the write happen in a single transaction so only one request can
+// reserve a key.
+func (s *Store) Reserve(key, fingerprint string, window time.Duration) (existing *Record, err error) {
+	now := time.Now()
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if v := b.Get([]byte(key)); v != nil {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if !record.Expired(now) {
+				existing = &record
+				return nil
+			}
+		}
+
+		value, err := json.Marshal(Record{Key: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(window)})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+	return existing, err
+}
+
+// Complete stores the response for the key
+func (s *Store) Complete(key string, response *endpoint.Response) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("idempotency key %s not found", key)
+		}
+		var record Record
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		record.Completed = true
+		record.Response = response
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+// Release removes the record for the key so that it can be used again
+func (s *Store) Release(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(key))
+	})
+}
+
+// Prune removes expired records. If incomplete is true records for requests that never completed are also removed.
+// The number of removed records is returned.
+func (s *Store) Prune(incomplete bool) (removed int, err error) {
+	now := time.Now()
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if record.Expired(now) || (incomplete && !record.Completed) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
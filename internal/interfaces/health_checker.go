@@ -0,0 +1,33 @@
+package interfaces
+
+import "context"
+
+// HealthStatus is the state reported by a health check
+type HealthStatus string
+
+const (
+	// HealthStatusUp means the component is working
+	HealthStatusUp HealthStatus = "up"
+	// HealthStatusDown means the component has failed or isn't available
+	HealthStatusDown HealthStatus = "down"
+)
+
+// HealthCheck is the result of checking a single component. Names are namespaced by the subsystem that reports them,
+// for example 'plugin/iperf', so they can be matched by the readiness checks in the configuration.
+type HealthCheck struct {
+	Name    string            `json:"name"`
+	Status  HealthStatus      `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// HealthChecker is implemented by subsystems that can report the health of the components they manage
+type HealthChecker interface {
+	HealthChecks(ctx context.Context) []HealthCheck
+}
+
+// HealthReporter is implemented by the subsystem that aggregates the health checks so adapters can report the
+// readiness of the agent in their own protocol
+type HealthReporter interface {
+	Ready(ctx context.Context) (ready bool, checks []HealthCheck)
+}
@@ -0,0 +1,14 @@
+package interfaces
+
+import "github.com/bgrewell/dtac-agent/internal/config"
+
+// Reloadable is implemented by subsystems and adapters that can apply configuration changes while the agent is
+// running. Changed settings that aren't covered by the ReloadKeys of any component need a restart to take effect.
+type Reloadable interface {
+	// ReloadKeys returns the configuration keys the component applies live, see config.MatchKey for the syntax
+	ReloadKeys() []string
+	// Reload is called with the new configuration and the changed keys that match ReloadKeys before they are copied
+	// to the running configuration. Keys that are returned, or all the keys if an error is returned, are left
+	// unchanged in the running configuration and reported as needing a restart.
+	Reload(cfg *config.Configuration, keys []string) (restart []string, err error)
+}
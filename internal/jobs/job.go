@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+)
+
+// Status is the state of a job
+type Status string
+
+// String returns the string representation of the status
+func (s Status) String() string {
+	return string(s)
+}
+
+// Done returns true if the job has finished running
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+const (
+	// StatusPending is the status of a job that has been created but has not started running
+	StatusPending Status = "pending"
+	// StatusRunning is the status of a job that is running
+	StatusRunning Status = "running"
+	// StatusSucceeded is the status of a job that completed without an error
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed is the status of a job that returned an error
+	StatusFailed Status = "failed"
+	// StatusCanceled is the status of a job that was canceled before it completed
+	StatusCanceled Status = "canceled"
+)
+
+// Job is the record of an asynchronous endpoint call
+type Job struct {
+	ID          string              `json:"id"`
+	Action      string              `json:"action"`
+	Path        string              `json:"path"`
+	Status      Status              `json:"status"`
+	Owner       string              `json:"owner,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	StartedAt   *time.Time          `json:"started_at,omitempty"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	Error       *endpoint.Error     `json:"error,omitempty"`
+	Result      []byte              `json:"result,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+}
+
+// Summary returns a copy of the job without the result so it can be returned by status and list requests
+func (j *Job) Summary() *Job {
+	summary := *j
+	summary.Result = nil
+	summary.Headers = nil
+	return &summary
+}
@@ -0,0 +1,395 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/helpers"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/twinj/uuid"
+	"go.uber.org/zap"
+)
+
+// AsyncParameter is the request parameter used to ask for any endpoint to be run asynchronously as a job
+const AsyncParameter = "async"
+
+// DefaultRetention is used when the configured retention can't be parsed
+const DefaultRetention = 24 * time.Hour
+
+// JobArgs is a struct to assist with validating the input arguments for requests about a single job
+type JobArgs struct {
+	ID string `json:"-" param:"id,required"`
+}
+
+// ListArgs is a struct to assist with validating the input arguments for listing jobs
+type ListArgs struct {
+	Status string `json:"-" param:"status"`
+}
+
+// NewSubsystem creates a new jobs subsystem
+func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
+	name := "jobs"
+	js := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		enabled:    c.Config.Jobs.Enabled,
+		name:       name,
+		maxJobs:    c.Config.Jobs.MaxJobs,
+		retention:  DefaultRetention,
+		running:    make(map[string]context.CancelFunc),
+	}
+	js.register()
+	return &js
+}
+
+// Subsystem is the subsystem that runs endpoint calls asynchronously and tracks them as jobs
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	enabled    bool
+	name       string
+	endpoints  []*endpoint.Endpoint
+	store      *Store
+	retention  time.Duration
+	maxJobs    int
+	running    map[string]context.CancelFunc
+	mu         sync.Mutex
+}
+
+// register registers the endpoints that this subsystem handles
+func (s *Subsystem) register() {
+	if !s.Enabled() {
+		s.Logger.Info("subsystem is disabled", zap.String("subsystem", s.Name()))
+		return
+	}
+
+	if s.Controller.AuthDB == nil || s.Controller.AuthDB.DB == nil {
+		s.Logger.Error("database is not available, disabling subsystem", zap.String("subsystem", s.Name()))
+		s.enabled = false
+		return
+	}
+
+	var err error
+	s.store, err = NewStore(s.Controller.AuthDB.DB, s.name)
+	if err != nil {
+		s.Logger.Error("failed to initialize job store, disabling subsystem", zap.Error(err))
+		s.enabled = false
+		return
+	}
+
+	if s.Controller.Config.Jobs.Retention != "" {
+		retention, err := time.ParseDuration(s.Controller.Config.Jobs.Retention)
+		if err != nil {
+			s.Logger.Error("invalid job retention, using default", zap.String("retention", s.Controller.Config.Jobs.Retention), zap.Error(err))
+		} else {
+			s.retention = retention
+		}
+	}
+
+	// Jobs that were running when the agent stopped can never complete
+	s.abandonJobs()
+
+	// Endpoints
+	base := s.name
+	secure := s.Controller.Config.Auth.DefaultSecure
+	authz := endpoint.AuthGroupUser.String()
+	s.endpoints = []*endpoint.Endpoint{
+		endpoint.NewTypedEndpoint(base, endpoint.ActionRead, "list jobs", s.listHandler, secure, authz),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/{id}", base), endpoint.ActionRead, "job status", s.statusHandler, secure, authz),
+		endpoint.NewEndpoint(fmt.Sprintf("%s/{id}/result", base), endpoint.ActionRead, "job result", s.resultHandler, secure, authz, endpoint.WithParameters(JobArgs{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/{id}", base), endpoint.ActionDelete, "cancel a running job or delete a finished job", s.deleteHandler, secure, authz),
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *Subsystem) Enabled() bool {
+	return s.enabled
+}
+
+// Name returns the name of the subsystem
+func (s *Subsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns the endpoints that this subsystem handles
+func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// Priority returns the priority of the middleware
+func (s *Subsystem) Priority() middleware.Priority {
+	return middleware.PriorityAsync
+}
+
+// Handler returns the handler for the middleware
+func (s *Subsystem) Handler(ep endpoint.Endpoint) endpoint.Func {
+	// Streaming endpoints and the job endpoints themselves are always called directly
+	if !s.enabled || ep.Streaming || ep.Path == s.name || strings.HasPrefix(ep.Path, s.name+"/") {
+		return ep.Function
+	}
+	return s.AsyncHandler(ep, ep.Function)
+}
+
+// AsyncHandler runs the call as a job if the endpoint is asynchronous or the caller asked for it using the async
+// parameter. The job is returned to the caller immediately and the result can be retrieved once it completes.
+func (s *Subsystem) AsyncHandler(ep endpoint.Endpoint, next endpoint.Func) endpoint.Func {
+	return func(in *endpoint.Request) (out *endpoint.Response, err error) {
+		async := ep.Async
+		if values, ok := in.Parameters[AsyncParameter]; ok && len(values) > 0 && values[0] != "" {
+			if async, err = strconv.ParseBool(values[0]); err != nil {
+				return nil, endpoint.InvalidArgumentError("invalid parameter '%s': %w", AsyncParameter, err).WithDetail("parameter", AsyncParameter)
+			}
+		}
+		if !async {
+			return next(in)
+		}
+
+		job, err := s.Start(ep, next, in)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(job)
+		if err != nil {
+			return nil, err
+		}
+		return &endpoint.Response{
+			Headers: map[string][]string{"Location": {fmt.Sprintf("/%s/%s", s.name, job.ID)}},
+			Value:   value,
+		}, nil
+	}
+}
+
+// Start creates a job for the call and runs it in the background. The job runs with a context that is detached from
+// the caller so that it continues after the caller disconnects, although the endpoint's timeout still applies.
+func (s *Subsystem) Start(ep endpoint.Endpoint, next endpoint.Func, in *endpoint.Request) (*Job, error) {
+	if removed, err := s.store.Prune(s.retention, s.maxJobs); err != nil {
+		s.Logger.Warn("failed to prune jobs", zap.Error(err))
+	} else if removed > 0 {
+		s.Logger.Debug("pruned jobs", zap.Int("count", removed))
+	}
+
+	job := &Job{
+		ID:        uuid.NewV4().String(),
+		Action:    ep.Action.String(),
+		Path:      ep.Path,
+		Status:    StatusPending,
+		Owner:     helpers.AuthUsername(in),
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.Put(job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	// The async parameter is consumed here and isn't passed on to the endpoint
+	call := in.WithContext(in.Context())
+	call.Parameters = make(map[string][]string, len(in.Parameters))
+	for k, v := range in.Parameters {
+		if k != AsyncParameter {
+			call.Parameters[k] = v
+		}
+	}
+
+	ctx, cancel := ep.CallContext(context.WithoutCancel(in.Context()), 0)
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+
+	record := *job
+	go s.run(ctx, &record, next, call.WithContext(ctx))
+
+	s.Logger.Info("job started", zap.String("id", job.ID), zap.String("action", job.Action), zap.String("path", job.Path))
+	return job, nil
+}
+
+// Cancel cancels the job if it is running. It returns false if the job is not running.
+func (s *Subsystem) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.running[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// run calls the endpoint and records the outcome of the job
+func (s *Subsystem) run(ctx context.Context, job *Job, next endpoint.Func, in *endpoint.Request) {
+	defer func() {
+		s.mu.Lock()
+		if cancel, ok := s.running[job.ID]; ok {
+			cancel()
+			delete(s.running, job.ID)
+		}
+		s.mu.Unlock()
+	}()
+
+	started := time.Now()
+	job.Status = StatusRunning
+	job.StartedAt = &started
+	s.save(job)
+
+	out, err := s.call(next, in)
+
+	completed := time.Now()
+	job.CompletedAt = &completed
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		job.Status = StatusCanceled
+		job.Error = endpoint.AsError(ctx.Err())
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = endpoint.AsError(err)
+	default:
+		job.Status = StatusSucceeded
+		if out != nil {
+			job.Result = out.Value
+			job.Headers = out.Headers
+		}
+	}
+	s.save(job)
+
+	s.Logger.Info("job completed", zap.String("id", job.ID), zap.String("status", job.Status.String()), zap.Duration("duration", completed.Sub(started)))
+}
+
+// call calls the endpoint converting any panic into an error so a failing job can't take down the agent
+func (s *Subsystem) call(next endpoint.Func, in *endpoint.Request) (out *endpoint.Response, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return next(in)
+}
+
+// save persists the job logging any failure
+func (s *Subsystem) save(job *Job) {
+	if err := s.store.Put(job); err != nil {
+		s.Logger.Error("failed to save job", zap.String("id", job.ID), zap.Error(err))
+	}
+}
+
+// abandonJobs marks any jobs that were left running by a previous instance of the agent as failed
+func (s *Subsystem) abandonJobs() {
+	jobs, err := s.store.List()
+	if err != nil {
+		s.Logger.Error("failed to list jobs", zap.Error(err))
+		return
+	}
+	for _, job := range jobs {
+		if job.Status.Done() {
+			continue
+		}
+		completed := time.Now()
+		job.Status = StatusFailed
+		job.CompletedAt = &completed
+		job.Error = endpoint.UnavailableError("the agent stopped before the job completed").WithRetryable(false)
+		s.save(job)
+	}
+}
+
+// lookup returns the job if it exists and is visible to the caller
+func (s *Subsystem) lookup(in *endpoint.Request, id string) (*Job, error) {
+	job, err := s.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil && !visible(job, in) {
+		return nil, endpoint.NotFoundError("job %s not found", id)
+	}
+	return job, nil
+}
+
+func (s *Subsystem) listHandler(ctx context.Context, args ListArgs) (jobs []*Job, err error) {
+	all, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	in, _ := endpoint.RequestFromContext(ctx)
+
+	jobs = make([]*Job, 0, len(all))
+	for _, job := range all {
+		if args.Status != "" && job.Status.String() != args.Status {
+			continue
+		}
+		if in != nil && !visible(job, in) {
+			continue
+		}
+		jobs = append(jobs, job.Summary())
+	}
+	return jobs, nil
+}
+
+func (s *Subsystem) statusHandler(ctx context.Context, args JobArgs) (*Job, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	job, err := s.lookup(in, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return job.Summary(), nil
+}
+
+func (s *Subsystem) resultHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
+	var args JobArgs
+	if err = endpoint.DecodeRequest(in, &args); err != nil {
+		return nil, err
+	}
+	job, err := s.lookup(in, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Status {
+	case StatusSucceeded:
+		return &endpoint.Response{Headers: job.Headers, Value: job.Result}, nil
+	case StatusFailed, StatusCanceled:
+		return nil, job.Error
+	default:
+		return nil, endpoint.UnavailableError("job %s has not completed", job.ID).WithDetail("status", job.Status.String())
+	}
+}
+
+func (s *Subsystem) deleteHandler(ctx context.Context, args JobArgs) (*Job, error) {
+	in, _ := endpoint.RequestFromContext(ctx)
+	job, err := s.lookup(in, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Running jobs are canceled, the record is kept so the caller can see the outcome
+	if !job.Status.Done() {
+		if !s.Cancel(job.ID) {
+			return nil, endpoint.ConflictError("job %s is not running", job.ID)
+		}
+		return job.Summary(), nil
+	}
+
+	if err := s.store.Delete(job.ID); err != nil {
+		return nil, err
+	}
+	return job.Summary(), nil
+}
+
+// visible returns true if the job can be seen by the caller. Jobs are visible to the user that created them and to
+// admins. Jobs created without authentication are visible to everyone.
+func visible(job *Job, in *endpoint.Request) bool {
+	if job.Owner == "" {
+		return true
+	}
+	for _, role := range strings.Split(in.Metadata[types.ContextAuthRoles.String()], ",") {
+		if role == endpoint.AuthGroupAdmin.String() {
+			return true
+		}
+	}
+	return job.Owner == helpers.AuthUsername(in)
+}
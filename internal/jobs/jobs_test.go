@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/types"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestSubsystem(t *testing.T) *Subsystem {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "jobs.db"), 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Configuration{}
+	cfg.Jobs = config.JobsEntry{Enabled: true, Retention: "1h", MaxJobs: 10}
+	c := &controller.Controller{
+		Logger: zap.NewNop(),
+		Config: cfg,
+		AuthDB: &authndb.AuthDB{DB: db},
+	}
+	return NewSubsystem(c).(*Subsystem)
+}
+
+func waitForJob(t *testing.T, s *Subsystem, id string) *Job {
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = s.store.Get(id)
+		return err == nil && job.Status.Done()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func userRequest(username string, roles string, params map[string][]string) *endpoint.Request {
+	user, _ := json.Marshal(authndb.User{Username: username})
+	return &endpoint.Request{
+		Metadata: map[string]string{
+			types.ContextAuthUser.String():  string(user),
+			types.ContextAuthRoles.String(): roles,
+		},
+		Parameters: params,
+	}
+}
+
+func TestAsyncHandler(t *testing.T) {
+	s := newTestSubsystem(t)
+	var received map[string][]string
+	ep := endpoint.NewEndpoint("test/run", endpoint.ActionCreate, "test", func(in *endpoint.Request) (*endpoint.Response, error) {
+		received = in.Parameters
+		return &endpoint.Response{Value: []byte(`{"ok":true}`), Headers: map[string][]string{"X-Test": {"1"}}}, nil
+	}, false, endpoint.AuthGroupUser.String())
+
+	// Synchronous unless requested
+	out, err := s.Handler(*ep)(&endpoint.Request{Parameters: map[string][]string{}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(out.Value))
+
+	// Asynchronous when requested
+	out, err = s.Handler(*ep)(userRequest("alice", "user", map[string][]string{"async": {"true"}, "name": {"x"}}))
+	require.NoError(t, err)
+	var job Job
+	require.NoError(t, json.Unmarshal(out.Value, &job))
+	assert.Equal(t, []string{"/jobs/" + job.ID}, out.Headers["Location"])
+	assert.Equal(t, "alice", job.Owner)
+
+	done := waitForJob(t, s, job.ID)
+	assert.Equal(t, StatusSucceeded, done.Status)
+	assert.Equal(t, map[string][]string{"name": {"x"}}, received)
+
+	result, err := s.resultHandler(userRequest("alice", "user", map[string][]string{"id": {job.ID}}))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(result.Value))
+	assert.Equal(t, []string{"1"}, result.Headers["X-Test"])
+
+	// Other users can't see the job but admins can
+	_, err = s.resultHandler(userRequest("bob", "user", map[string][]string{"id": {job.ID}}))
+	assert.Equal(t, endpoint.ErrorCodeNotFound, endpoint.ErrorCodeOf(err))
+	_, err = s.resultHandler(userRequest("carol", "user,admin", map[string][]string{"id": {job.ID}}))
+	assert.NoError(t, err)
+
+	// Invalid async parameter
+	_, err = s.Handler(*ep)(&endpoint.Request{Parameters: map[string][]string{"async": {"maybe"}}})
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeOf(err))
+}
+
+func TestAsyncHandlerFailureAndCancel(t *testing.T) {
+	s := newTestSubsystem(t)
+	failing := endpoint.NewEndpoint("test/fail", endpoint.ActionCreate, "test", func(in *endpoint.Request) (*endpoint.Response, error) {
+		return nil, endpoint.ConflictError("already running")
+	}, false, endpoint.AuthGroupUser.String(), endpoint.WithAsync())
+	blocking := endpoint.NewEndpoint("test/block", endpoint.ActionCreate, "test", func(in *endpoint.Request) (*endpoint.Response, error) {
+		<-in.Context().Done()
+		return nil, in.Context().Err()
+	}, false, endpoint.AuthGroupUser.String(), endpoint.WithAsync())
+
+	start := func(ep *endpoint.Endpoint) *Job {
+		out, err := s.Handler(*ep)(&endpoint.Request{Parameters: map[string][]string{}})
+		require.NoError(t, err)
+		var job Job
+		require.NoError(t, json.Unmarshal(out.Value, &job))
+		return &job
+	}
+
+	job := waitForJob(t, s, start(failing).ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, endpoint.ErrorCodeConflict, job.Error.Code)
+	_, err := s.resultHandler(&endpoint.Request{Parameters: map[string][]string{"id": {job.ID}}})
+	assert.Equal(t, endpoint.ErrorCodeConflict, endpoint.ErrorCodeOf(err))
+
+	job = start(blocking)
+	_, err = s.resultHandler(&endpoint.Request{Parameters: map[string][]string{"id": {job.ID}}})
+	assert.Equal(t, endpoint.ErrorCodeUnavailable, endpoint.ErrorCodeOf(err))
+	require.Eventually(t, func() bool { return s.Cancel(job.ID) }, 5*time.Second, 10*time.Millisecond)
+	job = waitForJob(t, s, job.ID)
+	assert.Equal(t, StatusCanceled, job.Status)
+
+	jobs, err := s.store.List()
+	require.NoError(t, err)
+	assert.Len(t, jobs, 2)
+}
+
+func TestStorePrune(t *testing.T) {
+	s := newTestSubsystem(t)
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+
+	tests := []struct {
+		job    Job
+		remove bool
+	}{
+		{job: Job{ID: "expired", Status: StatusSucceeded, CreatedAt: old, CompletedAt: &old}, remove: true},
+		{job: Job{ID: "running", Status: StatusRunning, CreatedAt: old}},
+		{job: Job{ID: "recent", Status: StatusFailed, CreatedAt: recent, CompletedAt: &recent}},
+	}
+	for _, tt := range tests {
+		job := tt.job
+		require.NoError(t, s.store.Put(&job))
+	}
+
+	removed, err := s.store.Prune(time.Hour, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	for _, tt := range tests {
+		_, err := s.store.Get(tt.job.ID)
+		assert.Equal(t, tt.remove, err != nil, tt.job.ID)
+	}
+
+	// Only finished jobs count against the limit
+	removed, err = s.store.Prune(0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = s.store.Get("running")
+	assert.NoError(t, err)
+}
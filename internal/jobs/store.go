@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/boltdb/bolt"
+)
+
+// NewStore creates a new job store backed by a bucket in the bolt database
+func NewStore(db *bolt.DB, bucket string) (*Store, error) {
+	s := &Store{db: db, bucket: []byte(bucket)}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return fmt.Errorf("failed to create %s bucket: %s", bucket, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Store persists job records
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// Put creates or updates the job record
+func (s *Store) Put(job *Job) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(job.ID), value)
+	})
+}
+
+// Get returns the job record with the given id
+func (s *Store) Get(id string) (job *Job, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(s.bucket).Get([]byte(id))
+		if v == nil {
+			return endpoint.NotFoundError("job %s not found", id)
+		}
+		return json.Unmarshal(v, &job)
+	})
+	return job, err
+}
+
+// Delete removes the job record with the given id
+func (s *Store) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(id))
+	})
+}
+
+// List returns all job records ordered from newest to oldest
+func (s *Store) List() (jobs []*Job, err error) {
+	jobs = make([]*Job, 0)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, err
+}
+
+// Prune removes finished jobs that completed before the retention period, then removes the oldest finished jobs
+// until no more than maxJobs records remain. Jobs that are still running are never removed. A zero retention or
+// maxJobs disables that limit. The number of removed records is returned.
+func (s *Store) Prune(retention time.Duration, maxJobs int) (removed int, err error) {
+	jobs, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	remaining := len(jobs)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		// Oldest jobs are at the end of the list
+		for idx := len(jobs) - 1; idx >= 0; idx-- {
+			job := jobs[idx]
+			if !job.Status.Done() {
+				continue
+			}
+			expired := retention > 0 && job.CompletedAt != nil && job.CompletedAt.Before(cutoff)
+			overLimit := maxJobs > 0 && remaining > maxJobs
+			if !expired && !overLimit {
+				continue
+			}
+			if err := b.Delete([]byte(job.ID)); err != nil {
+				return err
+			}
+			removed++
+			remaining--
+		}
+		return nil
+	})
+
+	return removed, err
+}
@@ -16,4 +16,13 @@ const (
 	PriorityLow Priority = 200
 	// PriorityValidation is for validation middleware which is one of the last to run
 	PriorityValidation = 300
+	// PriorityIdempotency is for the idempotency middleware which runs after validation and before requests are
+	// handed off to a job so that a retried asynchronous call returns the original job
+	PriorityIdempotency Priority = 350
+	// PriorityAsync is for the async job middleware which runs after the request middleware so requests are
+	// authorized and validated before they are handed off to a job
+	PriorityAsync Priority = 400
+	// PriorityOutputValidation is for the output validation middleware which runs closest to the endpoint so that
+	// the output is checked before it is stored for replay or as the result of a job
+	PriorityOutputValidation Priority = 500
 )
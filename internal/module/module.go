@@ -59,6 +59,10 @@ func (s *Subsystem) register() {
 			s.Logger.Error("bad module entry", zap.String("name", k))
 			continue
 		}
+
+		// The loader gets its own copy so the runtime paths don't end up in the configuration
+		entry := *v
+		v = &entry
 		full := path.Join(s.Config.Modules.ModuleDir, fmt.Sprintf("%s.module", k))
 		if runtime.GOOS == "windows" {
 			full = strings.Replace(full, "/", "", -1)
@@ -139,6 +143,13 @@ func (s *Subsystem) register() {
 		ep.Function = func(in *endpoint.Request) (out *endpoint.Response, err error) {
 			return loader.CallShim(ep, in)
 		}
+
+		// Streaming endpoints are relayed through the loaders streaming shim
+		if ep.Streaming {
+			ep.SetStreamFunction(func(in *endpoint.Request, send endpoint.StreamSender) error {
+				return loader.CallStreamShim(ep, in, send)
+			})
+		}
 	}
 
 	s.endpoints = loader.Endpoints()
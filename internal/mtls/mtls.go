@@ -0,0 +1,234 @@
+package mtls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+)
+
+// UserPrefix is the prefix of the username given to clients whose certificate is mapped to a group rather than a DTAC
+// user
+const UserPrefix = "cert:"
+
+// ServerConfig returns the TLS configuration for a server presenting the certificate of the profile. When client
+// authentication is enabled client certificates are verified against the CA bundle and, if one is set, checked
+// against the CRL. The CRL is read again whenever the file changes.
+func ServerConfig(selection config.TLSSelection, profile basic.TLSInfo) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(profile.CertFilename, profile.KeyFilename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS keys: %v", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	clientAuth := selection.ClientAuth
+	if !clientAuth.Enabled {
+		return cfg, nil
+	}
+	bundle, err := os.ReadFile(clientAuth.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", clientAuth.CA)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if clientAuth.Required {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if clientAuth.CRL != "" {
+		crl := &revocationList{filename: clientAuth.CRL}
+		if _, _, err := crl.load(); err != nil {
+			return nil, err
+		}
+		cfg.VerifyPeerCertificate = crl.verify
+	}
+	return cfg, nil
+}
+
+// Unsupported returns an error if client authentication is enabled for an API that doesn't verify client
+// certificates, so the API refuses to start rather than ignoring the setting
+func Unsupported(selection config.TLSSelection, api string) error {
+	if selection.ClientAuth.Enabled {
+		return fmt.Errorf("tls client authentication is not supported by the %s API", api)
+	}
+	return nil
+}
+
+// revocationList is a CRL, in PEM or DER form, that is read again whenever the file is modified
+type revocationList struct {
+	filename string
+	modified time.Time
+	list     *x509.RevocationList
+	revoked  map[string]bool
+	mu       sync.Mutex
+}
+
+// load returns the CRL and the serial numbers it revokes, reading the file if it has changed since it was last read.
+// A CRL past its next update is rejected as certificates may have been revoked since it was issued.
+func (r *revocationList) load() (*x509.RevocationList, map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CRL: %v", err)
+	}
+	if r.list == nil || !info.ModTime().Equal(r.modified) {
+		if err := r.read(info.ModTime()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if next := r.list.NextUpdate; !next.IsZero() && time.Now().After(next) {
+		return nil, nil, fmt.Errorf("CRL %s expired at %s", r.filename, next.Format(time.RFC3339))
+	}
+	return r.list, r.revoked, nil
+}
+
+// read parses the CRL file, modified is the modification time of the file that was read
+func (r *revocationList) read(modified time.Time) error {
+	data, err := os.ReadFile(r.filename)
+	if err != nil {
+		return fmt.Errorf("failed to read CRL: %v", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse CRL: %v", err)
+	}
+
+	r.revoked = make(map[string]bool, len(list.RevokedCertificateEntries))
+	for _, entry := range list.RevokedCertificateEntries {
+		r.revoked[entry.SerialNumber.String()] = true
+	}
+	r.list = list
+	r.modified = modified
+	return nil
+}
+
+// verify rejects the connection if any certificate in the verified chains has been revoked by the CRL. The CRL only
+// applies to certificates of the issuer that signed it, the handshake fails if the CRL can't be read.
+func (r *revocationList) verify(_ [][]byte, chains [][]*x509.Certificate) error {
+	list, revoked, err := r.load()
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		for i := 0; i < len(chain)-1; i++ {
+			cert, issuer := chain[i], chain[i+1]
+			if !bytes.Equal(cert.RawIssuer, list.RawIssuer) || list.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			if revoked[cert.SerialNumber.String()] {
+				return fmt.Errorf("certificate '%s' has been revoked", cert.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// Mapper maps verified client certificates to DTAC users
+type Mapper struct {
+	mappings   []config.ClientCertMapping
+	lookupUser func(username string) (*authndb.User, error)
+}
+
+// NewMapper creates a new mapper, lookupUser returns the DTAC user with the username
+func NewMapper(mappings []config.ClientCertMapping, lookupUser func(username string) (*authndb.User, error)) *Mapper {
+	return &Mapper{mappings: mappings, lookupUser: lookupUser}
+}
+
+// Identify returns the DTAC user for the verified client certificate of the connection. Nil is returned if the client
+// didn't present a certificate or none of the mappings match it.
+func (m *Mapper) Identify(state *tls.ConnectionState) (*authndb.User, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := state.VerifiedChains[0][0]
+	for _, mapping := range m.mappings {
+		if !matches(mapping, cert) {
+			continue
+		}
+		if mapping.User != "" {
+			return m.lookupUser(mapping.User)
+		}
+		return &authndb.User{Username: UserPrefix + cert.Subject.CommonName, Groups: []string{mapping.Group}}, nil
+	}
+	return nil, nil
+}
+
+// Peer returns the user for the connection encoded as JSON, the form used for types.ContextAuthPeer. An empty string
+// is returned if the client isn't identified, in which case it can still authenticate with a token.
+func (m *Mapper) Peer(state *tls.ConnectionState) (string, error) {
+	u, err := m.Identify(state)
+	if err != nil || u == nil {
+		return "", err
+	}
+
+	// The password isn't needed, and shouldn't be carried around, to authorize the user
+	u.Password = ""
+	data, err := json.Marshal(u)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// matches returns true if every criteria set in the mapping matches the certificate, mappings without any criteria
+// never match
+func matches(mapping config.ClientCertMapping, cert *x509.Certificate) bool {
+	if mapping.Subject == "" && mapping.SAN == "" && mapping.OU == "" {
+		return false
+	}
+	if mapping.Subject != "" && !match(mapping.Subject, cert.Subject.CommonName, cert.Subject.String()) {
+		return false
+	}
+	if mapping.SAN != "" && !match(mapping.SAN, subjectAltNames(cert)...) {
+		return false
+	}
+	if mapping.OU != "" && !match(mapping.OU, cert.Subject.OrganizationalUnit...) {
+		return false
+	}
+	return true
+}
+
+// match returns true if any of the values match the pattern, ignoring case
+func match(pattern string, values ...string) bool {
+	pattern = strings.ToLower(pattern)
+	for _, value := range values {
+		if matched, err := path.Match(pattern, strings.ToLower(value)); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectAltNames returns the DNS names, email addresses, URIs and IP addresses of the certificate
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs)+len(cert.IPAddresses))
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
@@ -0,0 +1,304 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/authndb"
+	"github.com/bgrewell/dtac-agent/internal/basic"
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a certificate authority that issues certificates and CRLs for the tests
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+// issue returns a certificate signed by the CA, the template sets the subject and SANs
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCRL writes a CRL revoking the certificates to the file
+func (ca *testCA) writeCRL(t *testing.T, filename string, revoked ...tls.Certificate) {
+	t.Helper()
+	ca.writeCRLUntil(t, filename, time.Now().Add(time.Hour), revoked...)
+}
+
+// writeCRLUntil writes a CRL revoking the certificates to the file with the next update at the time
+func (ca *testCA) writeCRLUntil(t *testing.T, filename string, nextUpdate time.Time, revoked ...tls.Certificate) {
+	t.Helper()
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, cert := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: cert.Leaf.SerialNumber, RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                nextUpdate.Add(-2 * time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600))
+}
+
+// writeServer writes the server certificate, key and the CA bundle and returns the TLS profile and CA filename
+func (ca *testCA) writeServer(t *testing.T, dir string) (basic.TLSInfo, string) {
+	t.Helper()
+	server := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}}, x509.ExtKeyUsageServerAuth)
+	keyDER, err := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	info := basic.TLSInfo{Enabled: true, CertFilename: filepath.Join(dir, "tls.crt"), KeyFilename: filepath.Join(dir, "tls.key")}
+	require.NoError(t, os.WriteFile(info.CertFilename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(info.KeyFilename, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	caFilename := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFilename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+	return info, caFilename
+}
+
+// handshake connects to a server using the configuration and returns the server's view of the connection
+func handshake(t *testing.T, ca *testCA, cfg *tls.Config, client *tls.Certificate) (tls.ConnectionState, error) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if client != nil {
+		clientConfig.Certificates = []tls.Certificate{*client}
+	}
+	go func() {
+		c := tls.Client(clientConn, clientConfig)
+		if c.Handshake() == nil {
+			// Reading lets the client process the server's response to its certificate
+			_, _ = c.Read(make([]byte, 1))
+		}
+		c.Close()
+	}()
+
+	server := tls.Server(serverConn, cfg)
+	err := server.Handshake()
+	return server.ConnectionState(), err
+}
+
+func TestServerConfig(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	profile, caFilename := ca.writeServer(t, dir)
+	crlFilename := filepath.Join(dir, "ca.crl")
+	client := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}, x509.ExtKeyUsageClientAuth)
+	revoked := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "revoked"}}, x509.ExtKeyUsageClientAuth)
+	other := newTestCA(t).issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, x509.ExtKeyUsageClientAuth)
+	ca.writeCRL(t, crlFilename, revoked)
+
+	tests := []struct {
+		name       string
+		clientAuth config.ClientAuthEntry
+		client     *tls.Certificate
+		verified   bool
+		fail       bool
+	}{
+		{name: "client auth disabled", client: &client},
+		{name: "verified", clientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename}, client: &client, verified: true},
+		{name: "optional certificate", clientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename}},
+		{name: "required certificate", clientAuth: config.ClientAuthEntry{Enabled: true, Required: true, CA: caFilename}, fail: true},
+		{name: "unknown issuer", clientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename}, client: &other, fail: true},
+		{name: "not revoked", clientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename, CRL: crlFilename}, client: &client, verified: true},
+		{name: "revoked", clientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename, CRL: crlFilename}, client: &revoked, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ServerConfig(config.TLSSelection{Enabled: true, ClientAuth: tt.clientAuth}, profile)
+			require.NoError(t, err)
+			state, err := handshake(t, ca, cfg, tt.client)
+			if tt.fail {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.verified, len(state.VerifiedChains) > 0)
+		})
+	}
+}
+
+func TestServerConfigCRLReload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	profile, caFilename := ca.writeServer(t, dir)
+	crlFilename := filepath.Join(dir, "ca.crl")
+	client := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}, x509.ExtKeyUsageClientAuth)
+	ca.writeCRL(t, crlFilename)
+
+	cfg, err := ServerConfig(config.TLSSelection{Enabled: true, ClientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename, CRL: crlFilename}}, profile)
+	require.NoError(t, err)
+	_, err = handshake(t, ca, cfg, &client)
+	require.NoError(t, err)
+
+	// The CRL is read again once it is modified
+	ca.writeCRL(t, crlFilename, client)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(crlFilename, later, later))
+	_, err = handshake(t, ca, cfg, &client)
+	require.Error(t, err)
+
+	// A CRL that can't be read fails the handshake rather than letting revoked certificates through
+	require.NoError(t, os.Remove(crlFilename))
+	_, err = handshake(t, ca, cfg, &client)
+	require.Error(t, err)
+
+	_, err = ServerConfig(config.TLSSelection{Enabled: true, ClientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename, CRL: crlFilename}}, profile)
+	require.Error(t, err)
+	_, err = ServerConfig(config.TLSSelection{Enabled: true, ClientAuth: config.ClientAuthEntry{Enabled: true, CA: profile.KeyFilename}}, profile)
+	require.Error(t, err)
+}
+
+func TestServerConfigCRLExpired(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	profile, caFilename := ca.writeServer(t, dir)
+	crlFilename := filepath.Join(dir, "ca.crl")
+	ca.writeCRLUntil(t, crlFilename, time.Now().Add(-time.Minute))
+	_, err := ServerConfig(config.TLSSelection{Enabled: true, ClientAuth: config.ClientAuthEntry{Enabled: true, CA: caFilename, CRL: crlFilename}}, profile)
+	require.ErrorContains(t, err, "expired")
+
+	// A CRL that expires after it was read is rejected without the file changing
+	ca.writeCRLUntil(t, crlFilename, time.Now().Add(time.Hour))
+	crl := &revocationList{filename: crlFilename}
+	_, _, err = crl.load()
+	require.NoError(t, err)
+	crl.list.NextUpdate = time.Now().Add(-time.Minute)
+	_, _, err = crl.load()
+	require.ErrorContains(t, err, "expired")
+}
+
+func TestUnsupported(t *testing.T) {
+	assert.NoError(t, Unsupported(config.TLSSelection{Enabled: true}, "JSON-RPC"))
+	err := Unsupported(config.TLSSelection{Enabled: true, ClientAuth: config.ClientAuthEntry{Enabled: true}}, "JSON-RPC")
+	assert.EqualError(t, err, "tls client authentication is not supported by the JSON-RPC API")
+}
+
+func TestMapper(t *testing.T) {
+	ca := newTestCA(t)
+	spiffe, _ := url.Parse("spiffe://example.com/agent/monitor")
+	cert := ca.issue(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "monitor", OrganizationalUnit: []string{"Operations"}},
+		DNSNames: []string{"monitor.example.com"},
+		URIs:     []*url.URL{spiffe},
+	}, x509.ExtKeyUsageClientAuth)
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert.Leaf, ca.cert}}}
+
+	users := map[string]*authndb.User{"operator": {ID: 2, Username: "operator", Password: "hash", Groups: []string{"operators"}}}
+	lookupUser := func(username string) (*authndb.User, error) {
+		if u, ok := users[username]; ok {
+			return u, nil
+		}
+		return nil, errors.New("user not found")
+	}
+
+	tests := []struct {
+		name     string
+		mappings []config.ClientCertMapping
+		state    *tls.ConnectionState
+		username string
+		groups   []string
+		fail     bool
+	}{
+		{name: "common name to user", mappings: []config.ClientCertMapping{{Subject: "monitor", User: "operator"}}, username: "operator", groups: []string{"operators"}},
+		{name: "distinguished name", mappings: []config.ClientCertMapping{{Subject: "CN=monitor,OU=Operations", User: "operator"}}, username: "operator", groups: []string{"operators"}},
+		{name: "ou to group", mappings: []config.ClientCertMapping{{OU: "operations", Group: "readers"}}, username: UserPrefix + "monitor", groups: []string{"readers"}},
+		{name: "san wildcard", mappings: []config.ClientCertMapping{{SAN: "*.example.com", Group: "readers"}}, username: UserPrefix + "monitor", groups: []string{"readers"}},
+		{name: "uri san", mappings: []config.ClientCertMapping{{SAN: "spiffe://example.com/agent/*", Group: "agents"}}, username: UserPrefix + "monitor", groups: []string{"agents"}},
+		{
+			name: "first match wins",
+			mappings: []config.ClientCertMapping{
+				{Subject: "backup", User: "operator"},
+				{Subject: "monitor", OU: "Operations", Group: "monitors"},
+				{Subject: "*", Group: "readers"},
+			},
+			username: UserPrefix + "monitor",
+			groups:   []string{"monitors"},
+		},
+		{name: "all criteria must match", mappings: []config.ClientCertMapping{{Subject: "monitor", OU: "Engineering", Group: "readers"}}},
+		{name: "no criteria", mappings: []config.ClientCertMapping{{Group: "readers"}}},
+		{name: "no certificate", mappings: []config.ClientCertMapping{{Subject: "*", Group: "readers"}}, state: &tls.ConnectionState{}},
+		{name: "unknown user", mappings: []config.ClientCertMapping{{Subject: "monitor", User: "missing"}}, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state
+			if tt.state != nil {
+				s = tt.state
+			}
+			u, err := NewMapper(tt.mappings, lookupUser).Identify(s)
+			if tt.fail {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.username == "" {
+				assert.Nil(t, u)
+				return
+			}
+			require.NotNil(t, u)
+			assert.Equal(t, tt.username, u.Username)
+			assert.Equal(t, tt.groups, u.Groups)
+		})
+	}
+
+	peer, err := NewMapper([]config.ClientCertMapping{{Subject: "monitor", User: "operator"}}, lookupUser).Peer(state)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":2,"username":"operator","password":"","groups":["operators"]}`, peer)
+}
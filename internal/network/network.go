@@ -56,9 +56,9 @@ func (s *Subsystem) register() {
 		endpoint.NewEndpoint(fmt.Sprintf("%s/arp", base), endpoint.ActionRead, "arp table information", s.arpTableHandler, secure, authzUser, endpoint.WithOutput([]ArpEntry{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/routes", base), endpoint.ActionRead, "route table information", s.getRoutesHandler, secure, authzUser, endpoint.WithOutput([]RouteTableRow{})),
 		endpoint.NewEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionRead, "route information", s.getRouteHandler, secure, authzUser),
-		endpoint.NewEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionWrite, "update existing route", s.updateRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
-		endpoint.NewEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionCreate, "create new route", s.createRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
-		endpoint.NewEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionDelete, "delete route", s.deleteRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionWrite, "update existing route", s.updateRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionCreate, "create new route", s.createRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
+		endpoint.NewTypedEndpoint(fmt.Sprintf("%s/route", base), endpoint.ActionDelete, "delete route", s.deleteRouteHandler, secure, authzAdmin, endpoint.WithBody(RouteTableRowArgs{}), endpoint.WithOutput([]RouteTableRow{})),
 
 		// Unified Endpoints
 		endpoint.NewEndpoint(fmt.Sprintf("%s/routes", unified), endpoint.ActionRead, "os agnostic route table information", s.getRoutesUnifiedHandler, secure, authzUser),
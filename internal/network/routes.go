@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/bgrewell/dtac-agent/internal/helpers"
@@ -24,75 +25,34 @@ func (s *Subsystem) getRouteHandler(in *endpoint.Request) (out *endpoint.Respons
 	}, "")
 }
 
-func (s *Subsystem) createRouteHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return helpers.HandleWrapper(in, func() ([]byte, error) {
-		var row RouteTableRow
-
-		// Transform the body into a RouteTableRow
-		if err = json.Unmarshal(in.Body, &row); err != nil {
-			return nil, err
-		}
-
-		// Create the route
-		if err = CreateRoute(row); err != nil {
-			return nil, err
-		}
-
-		// Return the route table
-		rt, err := GetRouteTable()
-		if err != nil {
-			return nil, err
-		}
+func (s *Subsystem) createRouteHandler(ctx context.Context, row RouteTableRow) (rt []RouteTableRow, err error) {
+	// Create the route
+	if err = CreateRoute(row); err != nil {
+		return nil, err
+	}
 
-		return json.Marshal(rt)
-	}, "route has been created")
+	// Return the route table
+	return GetRouteTable()
 }
 
-func (s *Subsystem) updateRouteHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return helpers.HandleWrapper(in, func() ([]byte, error) {
-		var row RouteTableRow
-
-		// Transform the body into a RouteTableRow
-		if err = json.Unmarshal(in.Body, &row); err != nil {
-			return nil, err
-		}
-
-		// Update the route
-		if err = UpdateRoute(row); err != nil {
-			return nil, err
-		}
+func (s *Subsystem) updateRouteHandler(ctx context.Context, row RouteTableRow) (rt []RouteTableRow, err error) {
+	// Update the route
+	if err = UpdateRoute(row); err != nil {
+		return nil, err
+	}
 
-		// Return the route table
-		rt, err := GetRouteTable()
-		if err != nil {
-			return nil, err
-		}
-
-		return json.Marshal(rt)
-	}, "route has been updated")
+	// Return the route table
+	return GetRouteTable()
 }
 
-func (s *Subsystem) deleteRouteHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
-	return helpers.HandleWrapper(in, func() ([]byte, error) {
-		var row RouteTableRow
-
-		// Transform the body into a RouteTableRow
-		if err = json.Unmarshal(in.Body, &row); err != nil {
-			return nil, err
-		}
+func (s *Subsystem) deleteRouteHandler(ctx context.Context, row RouteTableRow) (rt []RouteTableRow, err error) {
+	// Delete the route
+	if err = DeleteRoute(row); err != nil {
+		return nil, err
+	}
 
-		// Delete the route
-		if err = DeleteRoute(row); err != nil {
-			return nil, err
-		}
-
-		rt, err := GetRouteTable()
-		if err != nil {
-			return nil, err
-		}
-
-		return json.Marshal(rt)
-	}, "route has been deleted")
+	// Return the route table
+	return GetRouteTable()
 }
 
 func (s *Subsystem) getRoutesUnifiedHandler(in *endpoint.Request) (out *endpoint.Response, err error) {
@@ -0,0 +1,233 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bgrewell/dtac-agent/internal/version"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// Version is the version of the OpenAPI specification used for generated documents
+	Version = "3.1.0"
+	// Title is the title of generated documents
+	Title = "DTAC Agent Dynamic API"
+	// SecuritySchemeBearer is the name of the security scheme used by secure endpoints
+	SecuritySchemeBearer = "bearerAuth"
+	// ExtensionAuthGroup is the operation extension containing the auth group required to call a secure endpoint
+	ExtensionAuthGroup = "x-dtac-auth-group"
+	// errorSchema is the name of the component describing error responses
+	errorSchema = "ErrorResponse"
+)
+
+// Generate generates an OpenAPI document describing the REST API for the endpoints. Every action registered for a
+// path is included as an operation on that path, with the parameter, body and output schemas taken from the
+// endpoint's expected schemas.
+func Generate(endpoints []*endpoint.Endpoint) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: Version,
+		Info: &openapi3.Info{
+			Title:   Title,
+			Version: version.Current().Version,
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: openapi3.Schemas{
+				errorSchema: errorResponseSchema().NewRef(),
+			},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				SecuritySchemeBearer: &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+			},
+		},
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "dev"
+	}
+
+	registry := newSchemaRegistry(doc.Components.Schemas)
+	operationIDs := make(map[string]bool)
+	for _, ep := range endpoints {
+		method, err := httpMethod(ep.Action)
+		if err != nil {
+			return nil, err
+		}
+		operation, err := newOperation(ep, registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s %s: %w", ep.Action, ep.Path, err)
+		}
+
+		operation.OperationID = operationID(ep)
+		for idx := 2; operationIDs[operation.OperationID]; idx++ {
+			operation.OperationID = fmt.Sprintf("%s%d", operationID(ep), idx)
+		}
+		operationIDs[operation.OperationID] = true
+
+		doc.AddOperation("/"+strings.Trim(ep.Path, "/"), method, operation)
+	}
+
+	return doc, nil
+}
+
+// newOperation creates the operation for the endpoint
+func newOperation(ep *endpoint.Endpoint, registry *schemaRegistry) (*openapi3.Operation, error) {
+	operation := openapi3.NewOperation()
+	operation.Summary = ep.Description
+	operation.Tags = []string{strings.Split(strings.Trim(ep.Path, "/"), "/")[0]}
+
+	parameters, err := newParameters(ep, registry)
+	if err != nil {
+		return nil, err
+	}
+	operation.Parameters = parameters
+
+	if ep.ExpectedBodySchema != "" {
+		schema, err := registry.add(ep.ExpectedBodySchema)
+		if err != nil {
+			return nil, err
+		}
+		operation.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(schema),
+		}
+	}
+
+	output := openapi3.NewSchemaRef("", &openapi3.Schema{})
+	if ep.ExpectedOutputSchema != "" {
+		if output, err = registry.add(ep.ExpectedOutputSchema); err != nil {
+			return nil, err
+		}
+	}
+	errorRef := openapi3.NewSchemaRef(componentsPrefix+errorSchema, nil)
+	operation.Responses = openapi3.NewResponses(
+		openapi3.WithName("default", openapi3.NewResponse().WithDescription("Error").WithJSONSchemaRef(errorRef)),
+		openapi3.WithName("200", successResponse(ep, output)),
+	)
+
+	if ep.Secure {
+		operation.Security = openapi3.NewSecurityRequirements().With(openapi3.NewSecurityRequirement().Authenticate(SecuritySchemeBearer))
+		operation.Extensions = map[string]any{ExtensionAuthGroup: ep.AuthGroup}
+		operation.Description = fmt.Sprintf("Requires the '%s' auth group or higher.", ep.AuthGroup)
+		operation.Responses.Set("401", &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthenticated").WithJSONSchemaRef(errorRef)})
+		operation.Responses.Set("403", &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Permission denied").WithJSONSchemaRef(errorRef)})
+	}
+
+	return operation, nil
+}
+
+// newParameters creates the path and query parameters for the endpoint. Templated path segments are always included
+// as path parameters and the remaining properties of the parameter schema are included as query parameters.
+func newParameters(ep *endpoint.Endpoint, registry *schemaRegistry) (openapi3.Parameters, error) {
+	var properties openapi3.Schemas
+	required := make(map[string]bool)
+	if ep.ExpectedParametersSchema != "" {
+		ref, err := registry.add(ep.ExpectedParametersSchema)
+		if err != nil {
+			return nil, err
+		}
+		if schema := registry.resolve(ref); schema != nil {
+			properties = schema.Properties
+			for _, name := range schema.Required {
+				required[name] = true
+			}
+		}
+	}
+
+	parameters := openapi3.Parameters{}
+	pathParams := make(map[string]bool)
+	for _, name := range ep.PathParameterNames() {
+		pathParams[name] = true
+		parameter := openapi3.NewPathParameter(name)
+		parameter.Schema = parameterSchema(properties[name])
+		parameters = append(parameters, &openapi3.ParameterRef{Value: parameter})
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		if !pathParams[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parameter := openapi3.NewQueryParameter(name).WithRequired(required[name])
+		parameter.Schema = parameterSchema(properties[name])
+		parameters = append(parameters, &openapi3.ParameterRef{Value: parameter})
+	}
+
+	return parameters, nil
+}
+
+// parameterSchema returns the schema of a single parameter value. Parameters are described as arrays of strings
+// since they can be repeated, however only the first value is used unless the parameter is decoded into a slice.
+func parameterSchema(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref == nil {
+		return openapi3.NewStringSchema().NewRef()
+	}
+	if ref.Value != nil && ref.Value.Type.Is(openapi3.TypeArray) && ref.Value.Items != nil {
+		return ref.Value.Items
+	}
+	return ref
+}
+
+// successResponse creates the response returned when the endpoint succeeds. The REST adapter wraps values in a
+// response object while streaming endpoints write each value on its own.
+func successResponse(ep *endpoint.Endpoint, output *openapi3.SchemaRef) *openapi3.Response {
+	if ep.Streaming {
+		content := openapi3.NewContentWithSchemaRef(output, []string{"application/x-ndjson"})
+		content["text/event-stream"] = openapi3.NewMediaType().WithSchema(openapi3.NewStringSchema())
+		return openapi3.NewResponse().WithDescription("Stream of values").WithContent(content)
+	}
+	wrapper := openapi3.NewObjectSchema().WithPropertyRef("response", output).WithRequired([]string{"response"})
+	return openapi3.NewResponse().WithDescription("OK").WithJSONSchema(wrapper)
+}
+
+// errorResponseSchema returns the schema of the error responses written by the REST adapter
+func errorResponseSchema() *openapi3.Schema {
+	return openapi3.NewObjectSchema().
+		WithProperty("time", openapi3.NewDateTimeSchema()).
+		WithProperty("error", openapi3.NewStringSchema()).
+		WithProperty("code", openapi3.NewStringSchema()).
+		WithProperty("details", openapi3.NewObjectSchema().WithAdditionalProperties(openapi3.NewStringSchema())).
+		WithProperty("retryable", openapi3.NewBoolSchema()).
+		WithRequired([]string{"time", "error"})
+}
+
+// httpMethod returns the HTTP method used by the REST adapter for the action
+func httpMethod(action endpoint.Action) (string, error) {
+	switch action {
+	case endpoint.ActionRead:
+		return "GET", nil
+	case endpoint.ActionWrite:
+		return "PUT", nil
+	case endpoint.ActionCreate:
+		return "POST", nil
+	case endpoint.ActionDelete:
+		return "DELETE", nil
+	default:
+		return "", fmt.Errorf("unsupported action '%s'", action)
+	}
+}
+
+// operationID returns the operation id for the endpoint which is made up of the action followed by the path in camel
+// case, for example 'read network/routes/{id}' becomes 'readNetworkRoutesById'
+func operationID(ep *endpoint.Endpoint) string {
+	var b strings.Builder
+	b.WriteString(ep.Action.String())
+	for _, segment := range strings.Split(strings.Trim(ep.Path, "/"), "/") {
+		if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			b.WriteString("By")
+			segment = segment[1 : len(segment)-1]
+		}
+		words := strings.FieldsFunc(segment, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			runes := []rune(word)
+			b.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Route struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+}
+
+type routeArgs struct {
+	ID    string `json:"-" param:"id,required"`
+	Table string `json:"-" param:"table"`
+	Route
+}
+
+type routeList struct {
+	Routes []Route `json:"routes"`
+}
+
+func TestGenerate(t *testing.T) {
+	fn := func(in *endpoint.Request) (*endpoint.Response, error) { return &endpoint.Response{}, nil }
+	create := func(ctx context.Context, in routeArgs) (*Route, error) { return &in.Route, nil }
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("network/routes", endpoint.ActionRead, "list routes", fn, false, "", endpoint.WithOutput(routeList{})),
+		endpoint.NewEndpoint("network/routes", endpoint.ActionCreate, "create route", fn, true, endpoint.AuthGroupAdmin.String(), endpoint.WithBody(Route{})),
+		endpoint.NewTypedEndpoint("network/routes/{id}", endpoint.ActionWrite, "update route", create, true, endpoint.AuthGroupOperator.String()),
+		endpoint.NewEndpoint("network/routes/{id}", endpoint.ActionDelete, "delete route", fn, true, endpoint.AuthGroupAdmin.String()),
+	}
+
+	doc, err := Generate(endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, Version, doc.OpenAPI)
+
+	// All the actions for a path are kept
+	routes := doc.Paths.Value("/network/routes")
+	require.NotNil(t, routes)
+	require.NotNil(t, routes.Get)
+	require.NotNil(t, routes.Post)
+	route := doc.Paths.Value("/network/routes/{id}")
+	require.NotNil(t, route)
+	require.NotNil(t, route.Put)
+	require.NotNil(t, route.Delete)
+
+	assert.Equal(t, "readNetworkRoutes", routes.Get.OperationID)
+	assert.Equal(t, "writeNetworkRoutesById", route.Put.OperationID)
+	assert.Equal(t, []string{"network"}, routes.Get.Tags)
+
+	// Security is only required for secure endpoints
+	assert.Nil(t, routes.Get.Security)
+	require.NotNil(t, routes.Post.Security)
+	assert.Contains(t, (*routes.Post.Security)[0], SecuritySchemeBearer)
+	assert.Equal(t, endpoint.AuthGroupAdmin.String(), routes.Post.Extensions[ExtensionAuthGroup])
+	assert.NotNil(t, routes.Post.Responses.Value("401"))
+
+	// Path and query parameters come from the parameter schema
+	require.Len(t, route.Put.Parameters, 2)
+	assert.Equal(t, "id", route.Put.Parameters[0].Value.Name)
+	assert.Equal(t, "path", route.Put.Parameters[0].Value.In)
+	assert.Equal(t, "table", route.Put.Parameters[1].Value.Name)
+	assert.Equal(t, "query", route.Put.Parameters[1].Value.In)
+	assert.True(t, route.Put.Parameters[1].Value.Schema.Value.Type.Is("string"))
+	require.Len(t, route.Delete.Parameters, 1)
+
+	// Body and output schemas reference shared components
+	require.NotNil(t, routes.Post.RequestBody)
+	assert.Equal(t, "#/components/schemas/Route", routes.Post.RequestBody.Value.Content.Get("application/json").Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas, "Route")
+	assert.Contains(t, doc.Components.Schemas, "routeList")
+	output := routes.Get.Responses.Value("200").Value.Content.Get("application/json").Schema.Value
+	assert.Equal(t, "#/components/schemas/routeList", output.Properties["response"].Ref)
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "#/$defs/")
+}
+
+func TestSchemaRegistryConflicts(t *testing.T) {
+	registry := newSchemaRegistry(openapi3.Schemas{})
+
+	first, err := registry.add(`{"$ref":"#/$defs/Args","$defs":{"Args":{"type":"object","properties":{"name":{"type":"string"}}}}}`)
+	require.NoError(t, err)
+	same, err := registry.add(`{"$ref":"#/$defs/Args","$defs":{"Args":{"type":"object","properties":{"name":{"type":"string"}}}}}`)
+	require.NoError(t, err)
+	other, err := registry.add(`{"$ref":"#/$defs/Args","$defs":{"Args":{"type":"object","properties":{"id":{"type":"integer"}}}}}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "#/components/schemas/Args", first.Ref)
+	assert.Equal(t, "#/components/schemas/Args", same.Ref)
+	assert.Equal(t, "#/components/schemas/Args2", other.Ref)
+	assert.Len(t, registry.components, 2)
+}
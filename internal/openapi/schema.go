@@ -0,0 +1,138 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// definitionsPrefix is the prefix of references to definitions within a generated JSON schema
+	definitionsPrefix = "#/$defs/"
+	// componentsPrefix is the prefix of references to schemas in the document components
+	componentsPrefix = "#/components/schemas/"
+)
+
+// schemaRegistry converts the JSON schemas generated for endpoints into OpenAPI schemas. Definitions are moved into
+// the document's components so they are only included once and can be referenced from any operation.
+type schemaRegistry struct {
+	components openapi3.Schemas
+	raw        map[string]interface{}
+}
+
+// newSchemaRegistry creates a new schema registry that adds definitions to the components
+func newSchemaRegistry(components openapi3.Schemas) *schemaRegistry {
+	return &schemaRegistry{
+		components: components,
+		raw:        make(map[string]interface{}),
+	}
+}
+
+// add converts the JSON schema into an OpenAPI schema. Definitions that have the same name as a different component
+// that was already added are renamed by appending a number.
+func (r *schemaRegistry) add(schema string) (*openapi3.SchemaRef, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return nil, err
+	}
+	definitions, _ := root["$defs"].(map[string]interface{})
+	delete(root, "$defs")
+	delete(root, "$schema")
+	delete(root, "$id")
+
+	// Choose a component name for each definition
+	names := make(map[string]string, len(definitions))
+	keys := make([]string, 0, len(definitions))
+	for name := range definitions {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		definition := rewriteRefs(definitions[name], nil)
+		component := name
+		for idx := 2; ; idx++ {
+			existing, found := r.raw[component]
+			if !found || reflect.DeepEqual(existing, definition) {
+				break
+			}
+			component = fmt.Sprintf("%s%d", name, idx)
+		}
+		names[name] = component
+	}
+
+	// Add the definitions using the chosen names
+	for _, name := range keys {
+		component := names[name]
+		if _, found := r.raw[component]; found {
+			continue
+		}
+		definition := rewriteRefs(definitions[name], names)
+		ref, err := toSchemaRef(definition)
+		if err != nil {
+			return nil, err
+		}
+		r.raw[component] = rewriteRefs(definitions[name], nil)
+		r.components[component] = ref
+	}
+
+	return toSchemaRef(rewriteRefs(root, names))
+}
+
+// resolve returns the schema that is referenced by the schema ref
+func (r *schemaRegistry) resolve(ref *openapi3.SchemaRef) *openapi3.Schema {
+	if ref == nil {
+		return nil
+	}
+	if name := strings.TrimPrefix(ref.Ref, componentsPrefix); name != ref.Ref {
+		if component, ok := r.components[name]; ok {
+			return component.Value
+		}
+		return nil
+	}
+	return ref.Value
+}
+
+// rewriteRefs returns a copy of the value with references to definitions replaced by references to the renamed
+// components
+func rewriteRefs(value interface{}, names map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" && strings.HasPrefix(ref, definitionsPrefix) {
+				name := strings.TrimPrefix(ref, definitionsPrefix)
+				if renamed, ok := names[name]; ok {
+					name = renamed
+				}
+				out[key] = componentsPrefix + name
+				continue
+			}
+			out[key] = rewriteRefs(item, names)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for idx, item := range v {
+			out[idx] = rewriteRefs(item, names)
+		}
+		return out
+	}
+	return value
+}
+
+// toSchemaRef converts a generic JSON schema value into an OpenAPI schema
+func toSchemaRef(value interface{}) (*openapi3.SchemaRef, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	ref := &openapi3.SchemaRef{}
+	if err := json.Unmarshal(data, ref); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
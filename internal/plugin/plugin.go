@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 // NewSubsystem creates a new instance of the Subsystem struct
@@ -26,6 +28,9 @@ func NewSubsystem(log *zap.Logger, cfg *config.Configuration, tls *map[string]ba
 		tls:     tls,
 		enabled: cfg.Plugins.Enabled,
 		name:    name,
+		plugins: make(map[string]*plugins.PluginInfo),
+		stopped: make(map[string]*plugins.PluginInfo),
+		failed:  make(map[string]string),
 	}
 	ps.register()
 	return &ps
@@ -39,6 +44,11 @@ type Subsystem struct {
 	enabled   bool
 	name      string // Subsystem name
 	endpoints []*endpoint.Endpoint
+	loader    plugins.PluginLoader
+	plugins   map[string]*plugins.PluginInfo
+	stopped   map[string]*plugins.PluginInfo
+	failed    map[string]string
+	mu        sync.RWMutex
 }
 
 // register registers the routes that this module handles.
@@ -52,6 +62,7 @@ func (s *Subsystem) register() {
 
 	// Remap the plugin configs to use full path for key
 	cm := make(map[string]*plugins.PluginConfig)
+	names := make(map[string]string)
 	for k, v := range s.Config.Plugins.Entries {
 
 		// Deal with any poorly formed entries
@@ -59,6 +70,10 @@ func (s *Subsystem) register() {
 			s.Logger.Error("bad plugin entry", zap.String("name", k))
 			continue
 		}
+
+		// The loader gets its own copy so the runtime paths don't end up in the configuration
+		entry := *v
+		v = &entry
 		full := path.Join(s.Config.Plugins.PluginDir, fmt.Sprintf("%s.plugin", k))
 		if runtime.GOOS == "windows" {
 			full = strings.Replace(full, "/", "", -1)
@@ -86,6 +101,7 @@ func (s *Subsystem) register() {
 					zap.String("path", v.PluginPath))
 			}
 			if ph != v.Hash {
+				s.failed[k] = "hash check failed"
 				s.Logger.Warn("plugin not loaded hash check failed",
 					zap.String("name", v.Name()),
 					zap.String("path", v.PluginPath),
@@ -95,6 +111,7 @@ func (s *Subsystem) register() {
 			}
 		}
 		cm[full] = v
+		names[full] = k
 	}
 
 	// Check for TLS config
@@ -109,12 +126,33 @@ func (s *Subsystem) register() {
 	}
 
 	loader := plugins.NewPluginLoader(s.Config.Plugins.PluginDir, group, cm, s.Config.Plugins.LoadUnconfigured, tlsCert, tlsKey, tlsCACert, s.Logger)
+	s.loader = loader
 	active, err := loader.Initialize(s.Config.Auth.DefaultSecure)
 	if err != nil {
 		s.Logger.Error("failed to initialize plugins", zap.Error(err))
+		for full, v := range cm {
+			if v.Enabled {
+				s.failed[names[full]] = fmt.Sprintf("failed to initialize plugins: %v", err)
+			}
+		}
 		return
 	}
 
+	// Keep track of the plugins by their configured name so their health can be reported, enabled plugins that aren't
+	// active failed to launch
+	for _, plug := range active {
+		name, ok := names[plug.Path]
+		if !ok {
+			name = plug.Name
+		}
+		s.plugins[name] = plug
+	}
+	for full, v := range cm {
+		if _, ok := s.plugins[names[full]]; v.Enabled && !ok {
+			s.failed[names[full]] = "plugin failed to launch"
+		}
+	}
+
 	s.Logger.Info("loaded plugins", zap.Int("count", len(active)))
 	for idx, plug := range active {
 		s.Logger.Info("plugin activated",
@@ -137,6 +175,13 @@ func (s *Subsystem) register() {
 		ep.Function = func(in *endpoint.Request) (out *endpoint.Response, err error) {
 			return loader.CallShim(ep, in)
 		}
+
+		// Streaming endpoints are relayed through the loaders streaming shim
+		if ep.Streaming {
+			ep.SetStreamFunction(func(in *endpoint.Request, send endpoint.StreamSender) error {
+				return loader.CallStreamShim(ep, in, send)
+			})
+		}
 	}
 
 	s.endpoints = loader.Endpoints()
@@ -157,6 +202,79 @@ func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
 	return s.endpoints
 }
 
+// HealthChecks reports the state of each plugin. Plugins that failed to load or have exited are reported as down.
+func (s *Subsystem) HealthChecks(ctx context.Context) []interfaces.HealthCheck {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	checks := make([]interfaces.HealthCheck, 0, len(s.plugins)+len(s.failed))
+	for name, reason := range s.failed {
+		checks = append(checks, interfaces.HealthCheck{Name: "plugin/" + name, Status: interfaces.HealthStatusDown, Message: reason})
+	}
+	for name, plug := range s.plugins {
+		check := interfaces.HealthCheck{
+			Name:    "plugin/" + name,
+			Status:  interfaces.HealthStatusUp,
+			Details: map[string]string{"path": plug.Path},
+		}
+		if plug.HasExited {
+			check.Status = interfaces.HealthStatusDown
+			check.Message = fmt.Sprintf("plugin has exited with code %d", plug.ExitCode)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// ReloadKeys returns the settings the subsystem applies live
+func (s *Subsystem) ReloadKeys() []string {
+	return []string{"plugins.entries.*.enabled"}
+}
+
+// Reload stops the plugins that have been disabled and launches the ones that have been enabled again. Plugins that
+// weren't loaded when the agent started have no endpoints registered with the adapters and need a restart, as do the
+// ones that fail to start or stop.
+func (s *Subsystem) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		name := strings.Split(key, ".")[2]
+		entry := cfg.Plugins.Entries[name]
+		running, active := s.plugins[name]
+		stopped, inactive := s.stopped[name]
+		switch {
+		case entry == nil || (!active && !inactive):
+			restart = append(restart, key)
+		case entry.Enabled && inactive:
+			info, err := s.loader.LaunchPlugin(stopped.PluginConfig)
+			if err == nil {
+				err = s.loader.RegisterPlugin(info.Name)
+			}
+			if err != nil {
+				s.Logger.Error("failed to enable plugin", zap.String("name", name), zap.Error(err))
+				restart = append(restart, key)
+				continue
+			}
+			delete(s.stopped, name)
+			s.plugins[name] = info
+			s.Logger.Info("plugin enabled", zap.String("name", name))
+		case !entry.Enabled && active:
+			err := s.loader.UnregisterPlugin(running.Name)
+			if err == nil {
+				err = s.loader.ClosePlugin(running.Name)
+			}
+			if err != nil {
+				s.Logger.Error("failed to disable plugin", zap.String("name", name), zap.Error(err))
+				restart = append(restart, key)
+				continue
+			}
+			delete(s.plugins, name)
+			s.stopped[name] = running
+			s.Logger.Info("plugin disabled", zap.String("name", name))
+		}
+	}
+	return restart, nil
+}
+
 // ComputeSHA256 computes the SHA-256 hash of a file specified by its path.
 func ComputeSHA256(filePath string) (string, error) {
 	// Open the file for reading
@@ -0,0 +1,371 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/jmespath/go-jmespath"
+)
+
+const (
+	// ParameterFilter is the parameter used to filter items, e.g. 'filter=iface==eth0'. It can be repeated and all
+	// filters must match for an item to be kept.
+	ParameterFilter = "filter"
+	// ParameterSort is the parameter used to sort items by one or more comma separated fields. A field prefixed with
+	// '-' is sorted in descending order, e.g. 'sort=-metric,destination'.
+	ParameterSort = "sort"
+	// ParameterLimit is the parameter used to limit the number of items returned
+	ParameterLimit = "limit"
+	// ParameterOffset is the parameter used to skip items
+	ParameterOffset = "offset"
+	// ParameterCursor is the parameter used to continue from the cursor returned with the previous page
+	ParameterCursor = "cursor"
+	// ParameterQuery is the parameter used to apply a JMESPath expression to the page of items, e.g.
+	// 'query=[].{name: name, mtu: mtu}'
+	ParameterQuery = "query"
+)
+
+const (
+	// HeaderTotalCount is the response header containing the number of items that matched the filters
+	HeaderTotalCount = "X-Total-Count"
+	// HeaderOffset is the response header containing the offset of the first item returned
+	HeaderOffset = "X-Offset"
+	// HeaderLimit is the response header containing the limit used for the page
+	HeaderLimit = "X-Limit"
+	// HeaderNextCursor is the response header containing the cursor for the next page if there is one
+	HeaderNextCursor = "X-Next-Cursor"
+)
+
+// filterOperators are the supported filter operators. Longer operators are listed first so that '>=' is matched
+// before '>' at the same position.
+var filterOperators = []string{"==", "!=", ">=", "<=", "~=", ">", "<"}
+
+// Filter is a single field comparison
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// SortKey is a single field used to sort items
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Options are the query options requested by the caller
+type Options struct {
+	Filters []Filter
+	Sort    []SortKey
+	Limit   int
+	Offset  int
+	Query   *jmespath.JMESPath
+}
+
+// Empty returns true if no query options were requested
+func (o *Options) Empty() bool {
+	return len(o.Filters) == 0 && len(o.Sort) == 0 && o.Limit == 0 && o.Offset == 0 && o.Query == nil
+}
+
+// ParseOptions parses the query options from the request parameters
+func ParseOptions(params map[string][]string) (*Options, error) {
+	opts := &Options{}
+
+	for _, value := range params[ParameterFilter] {
+		if value == "" {
+			continue
+		}
+		filter, err := parseFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		opts.Filters = append(opts.Filters, filter)
+	}
+
+	if value := first(params, ParameterSort); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			key := SortKey{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			if key.Field == "" {
+				return nil, invalidParameter(ParameterSort, "invalid sort field '%s'", field)
+			}
+			opts.Sort = append(opts.Sort, key)
+		}
+	}
+
+	var err error
+	if opts.Limit, err = parseCount(params, ParameterLimit); err != nil {
+		return nil, err
+	}
+	if opts.Offset, err = parseCount(params, ParameterOffset); err != nil {
+		return nil, err
+	}
+	if cursor := first(params, ParameterCursor); cursor != "" {
+		if opts.Offset, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	if expression := first(params, ParameterQuery); expression != "" {
+		if opts.Query, err = jmespath.Compile(expression); err != nil {
+			return nil, invalidParameter(ParameterQuery, "invalid query: %v", err)
+		}
+	}
+
+	return opts, nil
+}
+
+// Apply filters, sorts and paginates the items and then applies the query expression to the page. The headers
+// describing the page are returned along with the encoded result.
+func (o *Options) Apply(items []interface{}) (value []byte, headers map[string][]string, err error) {
+	matched := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if o.matches(item) {
+			matched = append(matched, item)
+		}
+	}
+
+	if len(o.Sort) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, key := range o.Sort {
+				c := compare(lookup(matched[i], key.Field), lookup(matched[j], key.Field))
+				if c == 0 {
+					continue
+				}
+				if key.Descending {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	headers = map[string][]string{
+		HeaderTotalCount: {strconv.Itoa(len(matched))},
+		HeaderOffset:     {strconv.Itoa(o.Offset)},
+	}
+	start := min(o.Offset, len(matched))
+	end := len(matched)
+	if o.Limit > 0 {
+		headers[HeaderLimit] = []string{strconv.Itoa(o.Limit)}
+		end = min(start+o.Limit, len(matched))
+		if end < len(matched) {
+			headers[HeaderNextCursor] = []string{encodeCursor(end)}
+		}
+	}
+	var result interface{} = matched[start:end]
+
+	if o.Query != nil {
+		if result, err = o.Query.Search(toFloats(result)); err != nil {
+			return nil, nil, invalidParameter(ParameterQuery, "query failed: %v", err)
+		}
+	}
+
+	value, err = json.Marshal(result)
+	return value, headers, err
+}
+
+// matches returns true if the item matches all the filters
+func (o *Options) matches(item interface{}) bool {
+	for _, filter := range o.Filters {
+		if !filter.matches(lookup(item, filter.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns true if the value satisfies the filter
+func (f Filter) matches(value interface{}) bool {
+	if f.Operator == "~=" {
+		return value != nil && strings.Contains(strings.ToLower(fmt.Sprint(value)), strings.ToLower(f.Value))
+	}
+
+	c := compare(value, parseValue(f.Value, value))
+	switch f.Operator {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+// parseFilter parses a filter in the 'field<op>value' form. The filter is split at the first operator so that the
+// value can contain operator characters.
+func parseFilter(value string) (Filter, error) {
+	for i := range value {
+		for _, op := range filterOperators {
+			if !strings.HasPrefix(value[i:], op) {
+				continue
+			}
+			field := strings.TrimSpace(value[:i])
+			if field == "" {
+				return Filter{}, invalidParameter(ParameterFilter, "invalid filter '%s', the field is missing", value)
+			}
+			return Filter{Field: field, Operator: op, Value: strings.TrimSpace(value[i+len(op):])}, nil
+		}
+	}
+	return Filter{}, invalidParameter(ParameterFilter, "invalid filter '%s', expected field<op>value where op is one of %s", value, strings.Join(filterOperators, " "))
+}
+
+// parseValue converts the filter value to the type of the value it is compared with
+func parseValue(s string, like interface{}) interface{} {
+	switch like.(type) {
+	case json.Number, float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case nil:
+		if s == "null" {
+			return nil
+		}
+	}
+	return s
+}
+
+// lookup returns the value of the dotted field path in the item or nil if it doesn't exist
+func lookup(item interface{}, field string) interface{} {
+	value := item
+	for _, name := range strings.Split(field, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if value, ok = m[name]; !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// compare orders two values. Numbers, strings and booleans are compared by value, nil sorts before everything else
+// and values of different types are compared using their string representation.
+func compare(a, b interface{}) int {
+	if n, ok := a.(json.Number); ok {
+		a, _ = n.Float64()
+	}
+	if n, ok := b.(json.Number); ok {
+		b, _ = n.Float64()
+	}
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0
+			case !av:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloats converts json.Number values to float64 since that is what JMESPath expects for numbers
+func toFloats(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for idx, item := range v {
+			out[idx] = toFloats(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = toFloats(item)
+		}
+		return out
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// parseCount parses a non-negative integer parameter
+func parseCount(params map[string][]string, name string) (int, error) {
+	value := first(params, name)
+	if value == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, invalidParameter(name, "invalid %s '%s', must be a non-negative integer", name, value)
+	}
+	return count, nil
+}
+
+// encodeCursor returns the opaque cursor for the offset
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset for the opaque cursor
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		var offset int
+		if offset, err = strconv.Atoi(string(decoded)); err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, invalidParameter(ParameterCursor, "invalid cursor '%s'", cursor)
+}
+
+// first returns the first value of the parameter
+func first(params map[string][]string, name string) string {
+	if values := params[name]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// invalidParameter returns an invalid argument error for the parameter
+func invalidParameter(name string, format string, args ...interface{}) error {
+	return endpoint.InvalidArgumentError(format, args...).WithDetail("parameter", name)
+}
@@ -0,0 +1,127 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+// NewSubsystem creates a new query subsystem
+func NewSubsystem(c *controller.Controller) interfaces.Subsystem {
+	name := "query"
+	qs := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		enabled:    c.Config.Subsystems.Query,
+		name:       name,
+		endpoints:  []*endpoint.Endpoint{},
+	}
+
+	return &qs
+}
+
+// Subsystem is the middleware that filters, sorts, paginates and projects the output of list endpoints
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	enabled    bool
+	name       string
+	endpoints  []*endpoint.Endpoint
+}
+
+// Handler returns the handler for the middleware
+func (s Subsystem) Handler(ep endpoint.Endpoint) endpoint.Func {
+	// Only read endpoints that can return a list are queried
+	if !s.enabled || ep.Streaming || ep.Action != endpoint.ActionRead || !mayReturnList(ep) {
+		return ep.Function
+	}
+	return s.Query(ep.Function)
+}
+
+// Priority returns the priority of the middleware
+func (s Subsystem) Priority() middleware.Priority {
+	return middleware.PriorityLow
+}
+
+// Query applies the query options in the request parameters to the list returned by the next handler. Responses that
+// don't contain a list are returned unchanged.
+func (s Subsystem) Query(next endpoint.Func) endpoint.Func {
+	return func(in *endpoint.Request) (out *endpoint.Response, err error) {
+		opts, err := ParseOptions(in.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		out, err = next(in)
+		if err != nil || out == nil || opts.Empty() {
+			return out, err
+		}
+
+		items, ok := decodeList(out.Value)
+		if !ok {
+			return out, nil
+		}
+		value, headers, err := opts.Apply(items)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Value = value
+		if out.Headers == nil {
+			out.Headers = make(map[string][]string)
+		}
+		for key, values := range headers {
+			out.Headers[key] = values
+		}
+		return out, nil
+	}
+}
+
+// Endpoints returns the endpoints that this subsystem handles
+func (s Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s Subsystem) Enabled() bool {
+	return s.enabled
+}
+
+// Name returns the name of the subsystem
+func (s Subsystem) Name() string {
+	return s.name
+}
+
+// mayReturnList returns true if the endpoint's output schema is an array or if it doesn't declare an output schema, in
+// which case the response is checked when the endpoint is called
+func mayReturnList(ep endpoint.Endpoint) bool {
+	if len(ep.ExpectedOutputDescription) == 0 {
+		return true
+	}
+	var schema struct {
+		Type interface{} `json:"type"`
+	}
+	if err := json.Unmarshal(ep.ExpectedOutputDescription, &schema); err != nil {
+		return false
+	}
+	return schema.Type == "array"
+}
+
+// decodeList decodes the response value if it is a JSON array
+func decodeList(value []byte) ([]interface{}, bool) {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || value[0] != '[' {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var items []interface{}
+	if err := decoder.Decode(&items); err != nil {
+		return nil, false
+	}
+	return items, true
+}
@@ -0,0 +1,151 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type route struct {
+	Destination string `json:"destination"`
+	Iface       string `json:"iface"`
+	Metric      int    `json:"metric"`
+	Flags       struct {
+		Up bool `json:"up"`
+	} `json:"flags"`
+}
+
+const routes = `[
+	{"destination":"0.0.0.0","iface":"eth0","metric":100,"flags":{"up":true}},
+	{"destination":"10.0.0.0","iface":"eth1","metric":10,"flags":{"up":true}},
+	{"destination":"172.16.0.0","iface":"eth1","metric":50,"flags":{"up":false}},
+	{"destination":"192.168.1.0","iface":"wlan0","metric":600,"flags":{"up":true}}
+]`
+
+func TestQuery(t *testing.T) {
+	s := Subsystem{Logger: zap.NewNop(), enabled: true}
+	list := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: []byte(routes)}, nil
+	}
+	ep := endpoint.NewEndpoint("routes", endpoint.ActionRead, "list routes", list, false, "", endpoint.WithOutput([]route{}))
+
+	tests := []struct {
+		name         string
+		params       map[string][]string
+		expected     string
+		expectedErr  bool
+		expectedHead map[string]string
+	}{
+		{name: "no options", params: nil, expected: routes},
+		{name: "filter string", params: map[string][]string{"filter": {"iface==eth1"}}, expected: `["10.0.0.0","172.16.0.0"]`},
+		{name: "filter number", params: map[string][]string{"filter": {"metric>=50"}}, expected: `["0.0.0.0","172.16.0.0","192.168.1.0"]`},
+		{name: "filter nested bool", params: map[string][]string{"filter": {"flags.up==false"}}, expected: `["172.16.0.0"]`},
+		{name: "filter contains", params: map[string][]string{"filter": {"iface~=ETH"}}, expected: `["0.0.0.0","10.0.0.0","172.16.0.0"]`},
+		{name: "multiple filters", params: map[string][]string{"filter": {"iface!=wlan0", "metric<100"}}, expected: `["10.0.0.0","172.16.0.0"]`},
+		{name: "sort", params: map[string][]string{"sort": {"metric"}}, expected: `["10.0.0.0","172.16.0.0","0.0.0.0","192.168.1.0"]`},
+		{name: "sort descending", params: map[string][]string{"sort": {"iface,-metric"}}, expected: `["0.0.0.0","172.16.0.0","10.0.0.0","192.168.1.0"]`},
+		{
+			name:         "limit",
+			params:       map[string][]string{"sort": {"metric"}, "limit": {"2"}},
+			expected:     `["10.0.0.0","172.16.0.0"]`,
+			expectedHead: map[string]string{HeaderTotalCount: "4", HeaderOffset: "0", HeaderLimit: "2", HeaderNextCursor: encodeCursor(2)},
+		},
+		{
+			name:         "cursor",
+			params:       map[string][]string{"sort": {"metric"}, "limit": {"2"}, "cursor": {encodeCursor(2)}},
+			expected:     `["0.0.0.0","192.168.1.0"]`,
+			expectedHead: map[string]string{HeaderTotalCount: "4", HeaderOffset: "2", HeaderLimit: "2", HeaderNextCursor: ""},
+		},
+		{name: "offset past end", params: map[string][]string{"offset": {"10"}}, expected: `[]`},
+		{name: "invalid filter", params: map[string][]string{"filter": {"iface"}}, expectedErr: true},
+		{name: "invalid limit", params: map[string][]string{"limit": {"-1"}}, expectedErr: true},
+		{name: "invalid cursor", params: map[string][]string{"cursor": {"!!"}}, expectedErr: true},
+		{name: "invalid query", params: map[string][]string{"query": {"[?"}}, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string][]string{"query": {"[].destination"}}
+			for key, values := range tt.params {
+				params[key] = values
+			}
+			if tt.params == nil {
+				params = nil
+			}
+
+			out, err := s.Handler(*ep)(&endpoint.Request{Parameters: params})
+			if tt.expectedErr {
+				require.Error(t, err)
+				assert.Equal(t, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(out.Value))
+			for key, value := range tt.expectedHead {
+				assert.Equal(t, value, first(out.Headers, key), key)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Filter
+		err      bool
+	}{
+		{value: "metric>=50", expected: Filter{Field: "metric", Operator: ">=", Value: "50"}},
+		{value: "metric > 50", expected: Filter{Field: "metric", Operator: ">", Value: "50"}},
+		{value: "name==a>b", expected: Filter{Field: "name", Operator: "==", Value: "a>b"}},
+		{value: "name>a==b", expected: Filter{Field: "name", Operator: ">", Value: "a==b"}},
+		{value: "name~=<=x", expected: Filter{Field: "name", Operator: "~=", Value: "<=x"}},
+		{value: "==value", err: true},
+		{value: "name", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			filter, err := parseFilter(tt.value)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter)
+		})
+	}
+}
+
+func TestQueryProjection(t *testing.T) {
+	opts, err := ParseOptions(map[string][]string{"query": {"[?flags.up].{dst: destination, metric: metric}"}, "limit": {"1"}})
+	require.NoError(t, err)
+
+	var items []interface{}
+	require.NoError(t, json.Unmarshal([]byte(routes), &items))
+	value, headers, err := opts.Apply(items)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"dst":"0.0.0.0","metric":100}]`, string(value))
+	assert.Equal(t, "4", first(headers, HeaderTotalCount))
+}
+
+func TestHandlerBypass(t *testing.T) {
+	s := Subsystem{Logger: zap.NewNop(), enabled: true}
+	object := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: []byte(`{"destination":"0.0.0.0"}`)}, nil
+	}
+	params := map[string][]string{"limit": {"1"}}
+
+	// Endpoints declaring an output that isn't a list aren't wrapped
+	ep := endpoint.NewEndpoint("route", endpoint.ActionRead, "get route", object, false, "", endpoint.WithOutput(route{}))
+	assert.False(t, mayReturnList(*ep))
+
+	// Endpoints without an output schema are checked at runtime
+	ep = endpoint.NewEndpoint("route", endpoint.ActionRead, "get route", object, false, "")
+	out, err := s.Handler(*ep)(&endpoint.Request{Parameters: params})
+	require.NoError(t, err)
+	assert.Equal(t, `{"destination":"0.0.0.0"}`, string(out.Value))
+	assert.Empty(t, out.Headers)
+}
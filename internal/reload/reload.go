@@ -0,0 +1,385 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultDebounce is how long the watcher waits for changes to the configuration files to settle before reloading
+const DefaultDebounce = 500 * time.Millisecond
+
+// Triggers that started a reload
+const (
+	TriggerFile     = "file"
+	TriggerSignal   = "signal"
+	TriggerEndpoint = "endpoint"
+)
+
+// Result is the outcome of a reload. Changed holds every setting that differs from the running configuration, the
+// ones that were applied live are in Applied and the rest are in RestartRequired.
+type Result struct {
+	Trigger         string            `json:"trigger"`
+	Changed         []string          `json:"changed"`
+	Applied         []string          `json:"applied"`
+	RestartRequired []string          `json:"restart_required"`
+	Errors          map[string]string `json:"errors,omitempty"`
+}
+
+// NewSubsystem creates a new reload subsystem. The level is the one the agent logs at, it is set from the
+// configuration here and whenever output.log_level is reloaded.
+func NewSubsystem(c *controller.Controller, level zap.AtomicLevel) interfaces.Subsystem {
+	name := "reload"
+	rs := Subsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		name:       name,
+		level:      level,
+		debounce:   DefaultDebounce,
+		components: make(map[string]interfaces.Reloadable),
+		toggles:    make(map[string]bool),
+		watched:    make(map[string]bool),
+	}
+	rs.register()
+	return &rs
+}
+
+// Subsystem reloads the configuration when the configuration files change, on SIGHUP and when requested through
+// its endpoint. The new configuration is validated and compared with the running one, changes are passed to the
+// interfaces.Reloadable components that handle them and anything left over is reported as needing a restart.
+type Subsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	name       string
+	endpoints  []*endpoint.Endpoint
+	level      zap.AtomicLevel
+	debounce   time.Duration
+	components map[string]interfaces.Reloadable
+	toggles    map[string]bool
+	togglesMu  sync.RWMutex
+	mu         sync.Mutex
+	watcher    *fsnotify.Watcher
+	watched    map[string]bool
+	signals    chan os.Signal
+	done       chan struct{}
+}
+
+// register registers the endpoints that this subsystem handles
+func (s *Subsystem) register() {
+	if level, err := zapcore.ParseLevel(s.Controller.Config.Output.LogLevel); err != nil {
+		s.Logger.Error("invalid log level", zap.String("log_level", s.Controller.Config.Output.LogLevel), zap.Error(err))
+	} else {
+		s.level.SetLevel(level)
+	}
+
+	secure := s.Controller.Config.Auth.DefaultSecure
+	authz := endpoint.AuthGroupAdmin.String()
+	s.endpoints = []*endpoint.Endpoint{
+		endpoint.NewTypedEndpoint("config/reload", endpoint.ActionCreate, "reload the configuration and report the changes that were applied and the ones that need a restart", s.reloadHandler, secure, authz),
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *Subsystem) Enabled() bool {
+	return true
+}
+
+// Name returns the name of the subsystem
+func (s *Subsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns an array of endpoints that this Subsystem handles
+func (s *Subsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// Add adds a component that applies configuration changes live
+func (s *Subsystem) Add(name string, r interfaces.Reloadable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.components[name] = r
+}
+
+// Gate lets the subsystem be disabled and enabled again by its subsystems.<name> setting. Its endpoints return an
+// unavailable error while it is disabled. Subsystems that are disabled when the agent starts never registered their
+// endpoints and middleware can't be bypassed this way, changing their setting needs a restart.
+func (s *Subsystem) Gate(sub interfaces.Subsystem) {
+	if !sub.Enabled() {
+		return
+	}
+	if _, ok := sub.(middleware.Middleware); ok {
+		return
+	}
+	enabled, err := config.GetConfigValue(s.Controller.Config, "subsystems."+sub.Name())
+	if on, ok := enabled.(bool); err != nil || !ok || !on {
+		return
+	}
+
+	name := sub.Name()
+	s.togglesMu.Lock()
+	s.toggles[name] = true
+	s.togglesMu.Unlock()
+	for _, ep := range sub.Endpoints() {
+		next := ep.Function
+		if next == nil {
+			continue
+		}
+		ep.Function = func(in *endpoint.Request) (out *endpoint.Response, err error) {
+			if !s.enabled(name) {
+				return nil, endpoint.UnavailableError("subsystem %s is disabled", name)
+			}
+			return next(in)
+		}
+	}
+}
+
+func (s *Subsystem) enabled(name string) bool {
+	s.togglesMu.RLock()
+	defer s.togglesMu.RUnlock()
+	return s.toggles[name]
+}
+
+// ReloadKeys returns the settings applied by the reload subsystem itself
+func (s *Subsystem) ReloadKeys() []string {
+	return []string{"include", "output.log_level", "subsystems.*"}
+}
+
+// Reload sets the log level and enables or disables the gated subsystems. Include patterns are picked up by the
+// watcher once they have been applied.
+func (s *Subsystem) Reload(cfg *config.Configuration, keys []string) (restart []string, err error) {
+	for _, key := range keys {
+		switch {
+		case key == "output.log_level":
+			level, err := zapcore.ParseLevel(cfg.Output.LogLevel)
+			if err != nil {
+				return nil, err
+			}
+			s.level.SetLevel(level)
+		case strings.HasPrefix(key, "subsystems."):
+			name := strings.TrimPrefix(key, "subsystems.")
+			value, _ := config.GetConfigValue(cfg, key)
+			enabled, _ := value.(bool)
+			s.togglesMu.Lock()
+			if _, ok := s.toggles[name]; ok {
+				s.toggles[name] = enabled
+			} else {
+				restart = append(restart, key)
+			}
+			s.togglesMu.Unlock()
+		}
+	}
+	return restart, nil
+}
+
+// ReloadConfig reads the configuration again and applies the changes to the running agent. An error is returned if
+// the configuration can't be read or isn't valid, in which case nothing is changed.
+func (s *Subsystem) ReloadConfig(trigger string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := s.Controller.Config
+	next, err := config.Load(running.Filename(), s.Logger)
+	if err != nil {
+		s.Logger.Error("configuration reload failed", zap.String("trigger", trigger), zap.Error(err))
+		return nil, err
+	}
+
+	result := &Result{
+		Trigger:         trigger,
+		Changed:         config.Diff(running, next),
+		Applied:         make([]string, 0),
+		RestartRequired: make([]string, 0),
+		Errors:          make(map[string]string),
+	}
+	handled := make(map[string]bool)
+	names := make([]string, 0, len(s.components))
+	for name := range s.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		component := s.components[name]
+		keys := matching(result.Changed, component.ReloadKeys())
+		if len(keys) == 0 {
+			continue
+		}
+		for _, key := range keys {
+			handled[key] = true
+		}
+
+		restart, err := component.Reload(next, keys)
+		if err != nil {
+			s.Logger.Error("failed to reload component", zap.String("component", name), zap.Error(err))
+			result.Errors[name] = err.Error()
+			restart = keys
+		}
+		applied := without(keys, restart)
+		if err := running.Apply(next, applied); err != nil {
+			result.Errors[name] = err.Error()
+			restart, applied = keys, nil
+		}
+		result.Applied = append(result.Applied, applied...)
+		result.RestartRequired = append(result.RestartRequired, restart...)
+	}
+	for _, key := range result.Changed {
+		if !handled[key] {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+	sort.Strings(result.Applied)
+	sort.Strings(result.RestartRequired)
+
+	s.Logger.Info("configuration reloaded",
+		zap.String("trigger", trigger),
+		zap.Strings("applied", result.Applied))
+	if len(result.RestartRequired) > 0 {
+		s.Logger.Warn("configuration changes require a restart", zap.Strings("keys", result.RestartRequired))
+	}
+	return result, nil
+}
+
+// Watch starts reloading the configuration when its files change or the agent receives SIGHUP
+func (s *Subsystem) Watch() (err error) {
+	s.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration watcher: %v", err)
+	}
+	s.watch()
+	s.signals = make(chan os.Signal, 1)
+	signal.Notify(s.signals, syscall.SIGHUP)
+	s.done = make(chan struct{})
+	go s.run()
+	return nil
+}
+
+// Close stops watching the configuration
+func (s *Subsystem) Close() error {
+	if s.watcher == nil {
+		return nil
+	}
+	signal.Stop(s.signals)
+	close(s.done)
+	return s.watcher.Close()
+}
+
+func (s *Subsystem) run() {
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 && s.source(event.Name) {
+				s.Logger.Debug("configuration file changed", zap.String("filename", event.Name))
+				pending = time.After(s.debounce)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			s.Logger.Error("configuration watcher error", zap.Error(err))
+		case <-pending:
+			pending = nil
+			s.reload(TriggerFile)
+		case <-s.signals:
+			s.reload(TriggerSignal)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Subsystem) reload(trigger string) {
+	if _, err := s.ReloadConfig(trigger); err == nil {
+		s.watch()
+	}
+}
+
+// watch adds the directories of the configuration file and include patterns to the watcher. Directories are watched
+// instead of the files so fragments that are added later and files replaced by editors are seen.
+func (s *Subsystem) watch() {
+	for _, source := range s.sources() {
+		dirs, _ := filepath.Glob(filepath.Dir(source))
+		for _, dir := range dirs {
+			if s.watched[dir] {
+				continue
+			}
+			if err := s.watcher.Add(dir); err != nil {
+				s.Logger.Debug("failed to watch configuration directory", zap.String("dir", dir), zap.Error(err))
+				continue
+			}
+			s.watched[dir] = true
+		}
+	}
+}
+
+// source returns true if the file is the configuration file or matches one of the include patterns
+func (s *Subsystem) source(filename string) bool {
+	for _, source := range s.sources() {
+		if matched, err := filepath.Match(source, filename); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subsystem) sources() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Controller.Config.Sources()
+}
+
+func (s *Subsystem) reloadHandler(ctx context.Context, _ endpoint.Empty) (*Result, error) {
+	result, err := s.ReloadConfig(TriggerEndpoint)
+	if err != nil {
+		return nil, endpoint.InvalidArgumentError("failed to reload configuration: %v", err)
+	}
+	return result, nil
+}
+
+// matching returns the keys that match any of the patterns
+func matching(keys []string, patterns []string) []string {
+	matches := make([]string, 0)
+	for _, key := range keys {
+		for _, pattern := range patterns {
+			if config.MatchKey(pattern, key) {
+				matches = append(matches, key)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// without returns the keys that aren't in exclude
+func without(keys []string, exclude []string) []string {
+	excluded := make(map[string]bool, len(exclude))
+	for _, key := range exclude {
+		excluded[key] = true
+	}
+	remaining := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !excluded[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,171 @@
+package reload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/config"
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const baseConfig = `
+output:
+  log_level: debug
+apis:
+  rest:
+    port: 8180
+    cors:
+      allowed_origins: ["*"]
+subsystems:
+  auth: true
+  diag: true
+`
+
+// testSubsystem is a subsystem with a single endpoint
+type testSubsystem struct {
+	name string
+	eps  []*endpoint.Endpoint
+}
+
+func (s *testSubsystem) Endpoints() []*endpoint.Endpoint { return s.eps }
+func (s *testSubsystem) Enabled() bool                   { return true }
+func (s *testSubsystem) Name() string                    { return s.name }
+
+// testComponent records the keys it is asked to reload
+type testComponent struct {
+	keys    []string
+	restart []string
+	err     error
+	called  []string
+}
+
+func (c *testComponent) ReloadKeys() []string { return c.keys }
+
+func (c *testComponent) Reload(cfg *config.Configuration, keys []string) ([]string, error) {
+	c.called = append(c.called, keys...)
+	return c.restart, c.err
+}
+
+func newTestSubsystem(t *testing.T) (*Subsystem, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(baseConfig), 0600))
+	cfg, err := config.Load(filename, zap.NewNop())
+	require.NoError(t, err)
+
+	c := &controller.Controller{Logger: zap.NewNop(), Config: cfg}
+	s := NewSubsystem(c, zap.NewAtomicLevel()).(*Subsystem)
+	s.Add(s.Name(), s)
+	return s, filename
+}
+
+func newGatedSubsystem(s *Subsystem, name string) *endpoint.Endpoint {
+	ep := endpoint.NewEndpoint("test", endpoint.ActionRead, "test endpoint", func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: []byte("ok")}, nil
+	}, false, endpoint.AuthGroupGuest.String())
+	s.Gate(&testSubsystem{name: name, eps: []*endpoint.Endpoint{ep}})
+	return ep
+}
+
+func TestReloadConfig(t *testing.T) {
+	s, filename := newTestSubsystem(t)
+	cors := &testComponent{keys: []string{"apis.rest.cors"}}
+	s.Add("api/rest", cors)
+	diag := newGatedSubsystem(s, "diag")
+	assert.Equal(t, zapcore.DebugLevel, s.level.Level())
+
+	require.NoError(t, os.WriteFile(filename, []byte(`
+output:
+  log_level: warn
+apis:
+  rest:
+    port: 9180
+    cors:
+      allowed_origins: ["https://example.com"]
+subsystems:
+  auth: false
+  diag: false
+`), 0600))
+	result, err := s.ReloadConfig(TriggerEndpoint)
+	require.NoError(t, err)
+
+	assert.Equal(t, TriggerEndpoint, result.Trigger)
+	assert.Equal(t, []string{"apis.rest.cors.allowed_origins", "apis.rest.port", "output.log_level", "subsystems.auth", "subsystems.diag"}, result.Changed)
+	assert.Equal(t, []string{"apis.rest.cors.allowed_origins", "output.log_level", "subsystems.diag"}, result.Applied)
+	assert.Equal(t, []string{"apis.rest.port", "subsystems.auth"}, result.RestartRequired)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []string{"apis.rest.cors.allowed_origins"}, cors.called)
+
+	// Applied keys are copied to the running configuration, the rest keep their running values
+	cfg := s.Controller.Config
+	assert.Equal(t, []string{"https://example.com"}, cfg.APIs.REST.CORS.AllowedOrigins)
+	assert.Equal(t, 8180, cfg.APIs.REST.Port)
+	assert.True(t, cfg.Subsystems.Auth)
+	assert.False(t, cfg.Subsystems.Diag)
+	assert.Equal(t, zapcore.WarnLevel, s.level.Level())
+
+	_, err = diag.Function(&endpoint.Request{})
+	require.Error(t, err)
+	assert.Equal(t, endpoint.ErrorCodeUnavailable, endpoint.ErrorCodeOf(err))
+
+	// Reverting the file clears the pending restarts, echo was never gated so it needs one
+	require.NoError(t, os.WriteFile(filename, []byte(baseConfig+"  echo: false\n"), 0600))
+	result, err = s.ReloadConfig(TriggerSignal)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apis.rest.cors.allowed_origins", "output.log_level", "subsystems.diag"}, result.Applied)
+	assert.Equal(t, []string{"subsystems.echo"}, result.RestartRequired)
+	out, err := diag.Function(&endpoint.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(out.Value))
+}
+
+func TestReloadConfigErrors(t *testing.T) {
+	s, filename := newTestSubsystem(t)
+	failing := &testComponent{keys: []string{"apis.rest.cors"}, err: errors.New("invalid cors configuration")}
+	s.Add("api/rest", failing)
+
+	require.NoError(t, os.WriteFile(filename, []byte(`
+output:
+  log_level: info
+apis:
+  rest:
+    cors:
+      allowed_origins: []
+`), 0600))
+	result, err := s.ReloadConfig(TriggerEndpoint)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"output.log_level"}, result.Applied)
+	assert.Equal(t, []string{"apis.rest.cors.allowed_origins"}, result.RestartRequired)
+	assert.Equal(t, map[string]string{"api/rest": "invalid cors configuration"}, result.Errors)
+	assert.Equal(t, []string{"*"}, s.Controller.Config.APIs.REST.CORS.AllowedOrigins)
+
+	// Invalid configurations aren't applied at all
+	require.NoError(t, os.WriteFile(filename, []byte("output:\n  log_level: loud\n"), 0600))
+	_, err = s.ReloadConfig(TriggerEndpoint)
+	require.Error(t, err)
+	assert.Equal(t, "info", s.Controller.Config.Output.LogLevel)
+
+	_, err = s.Endpoints()[0].Function(&endpoint.Request{})
+	require.Error(t, err)
+	assert.Equal(t, endpoint.ErrorCodeInvalidArgument, endpoint.ErrorCodeOf(err))
+}
+
+func TestWatch(t *testing.T) {
+	s, filename := newTestSubsystem(t)
+	s.debounce = 10 * time.Millisecond
+	require.NoError(t, s.Watch())
+	defer s.Close()
+
+	require.NoError(t, os.WriteFile(filename, []byte("output:\n  log_level: error\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return s.level.Level() == zapcore.ErrorLevel
+	}, 5*time.Second, 10*time.Millisecond)
+}
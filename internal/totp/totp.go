@@ -0,0 +1,99 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 as used by authenticator apps: HMAC-SHA1,
+// six digits and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits in a code
+	Digits = 6
+	// Period is how long a code is valid for
+	Period = 30 * time.Second
+	// Skew is the number of periods before and after the current one whose codes are accepted, to allow for clock
+	// drift and the time it takes to enter a code
+	Skew = 1
+	// secretSize is the size of generated secrets in bytes, the size of a SHA-1 hash as recommended by RFC 4226
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random secret encoded as base32 without padding, the form authenticator apps expect
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Counter returns the time step of the time
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of the secret for the time step
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation from RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate checks the code against the codes of the secret around the time. The time step of the matching code is
+// returned so that callers can refuse codes that have already been used.
+func Validate(secret string, code string, t time.Time) (counter int64, ok bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Counter(t)
+	for c := current - Skew; c <= current+Skew; c++ {
+		expected, err := Code(secret, c)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// URL returns the otpauth URL of the secret that authenticator apps import, usually from a QR code
+func URL(issuer string, account string, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	if issuer != "" {
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
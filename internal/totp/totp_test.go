@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC 6238 test vectors are eight digits, the codes are their last six
+	tests := []struct {
+		time     int64
+		expected string
+	}{
+		{time: 59, expected: "287082"},
+		{time: 1111111109, expected: "081804"},
+		{time: 1111111111, expected: "050471"},
+		{time: 1234567890, expected: "005924"},
+		{time: 2000000000, expected: "279037"},
+		{time: 20000000000, expected: "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			code, err := Code(rfcSecret, Counter(time.Unix(tt.time, 0)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+
+	_, err := Code("not base32!", 1)
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Now()
+	current := Counter(now)
+
+	tests := []struct {
+		name    string
+		counter int64
+		ok      bool
+	}{
+		{name: "current", counter: current, ok: true},
+		{name: "previous", counter: current - 1, ok: true},
+		{name: "next", counter: current + 1, ok: true},
+		{name: "expired", counter: current - 2, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(secret, tt.counter)
+			require.NoError(t, err)
+			counter, ok := Validate(secret, code, now)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.counter, counter)
+			}
+		})
+	}
+
+	_, ok := Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURL(t *testing.T) {
+	u, err := url.Parse(URL("DTAC Agent", "admin", "SECRET"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/DTAC Agent:admin", u.Path)
+	assert.Equal(t, "SECRET", u.Query().Get("secret"))
+	assert.Equal(t, "DTAC Agent", u.Query().Get("issuer"))
+}
@@ -1,5 +1,7 @@
 package types
 
+import "github.com/bgrewell/dtac-agent/pkg/endpoint"
+
 // ContextKey is a enum to help manage keys used in passing values in context
 type ContextKey string
 
@@ -9,13 +11,22 @@ func (c ContextKey) String() string {
 
 const (
 	// ContextExecDuration is the key used to store the value of the execution duration
-	ContextExecDuration ContextKey = "exec_duration"
+	ContextExecDuration ContextKey = endpoint.MetadataExecDuration
 	// ContextAuthHeader is the key used to store the value of the auth header
 	ContextAuthHeader ContextKey = "auth_header"
+	// ContextAuthPeer is the key used to store the user identified by the transport, such as the peer credentials of a
+	// unix socket connection, when the caller didn't supply an auth header
+	ContextAuthPeer ContextKey = "auth_peer"
 	// ContextAuthUser is the key used to store the value of the auth user
 	ContextAuthUser ContextKey = "auth_user"
+	// ContextAuthSession is the key used to store the ID of the login session when the user authenticated with an
+	// access token
+	ContextAuthSession ContextKey = "auth_session"
 	// ContextAuthRoles is the key used to store the value of the auth roles
 	ContextAuthRoles ContextKey = "auth_roles"
+	// ContextRemoteAddr is the key used to store the address the request came from, without its port. It isn't set
+	// when the transport has no address such as a unix socket.
+	ContextRemoteAddr ContextKey = "remote_addr"
 	// ContextResourceAction is the key used to store the value of the resource action
 	ContextResourceAction ContextKey = "resource_action"
 	// ContextResourcePath is the key used to store the value of the resource path
@@ -0,0 +1,200 @@
+package validation
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/dtac-agent/internal/controller"
+	"github.com/bgrewell/dtac-agent/internal/interfaces"
+	"github.com/bgrewell/dtac-agent/internal/middleware"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"go.uber.org/zap"
+)
+
+const (
+	// OutputModeOff disables output validation
+	OutputModeOff = "off"
+	// OutputModeLog logs and counts responses that don't match the output schema but still returns them
+	OutputModeLog = "log"
+	// OutputModeEnforce logs and counts responses that don't match the output schema and returns an error instead
+	OutputModeEnforce = "enforce"
+)
+
+// Violation is the summary of the output validation failures for a single endpoint
+type Violation struct {
+	Action    endpoint.Action `json:"action"`
+	Path      string          `json:"path"`
+	Count     uint64          `json:"count"`
+	LastError string          `json:"last_error"`
+	LastSeen  time.Time       `json:"last_seen"`
+}
+
+// Report is the summary of the output validation performed since the agent started
+type Report struct {
+	Mode       string       `json:"mode"`
+	Checked    uint64       `json:"checked"`
+	Violations uint64       `json:"violations"`
+	Endpoints  []*Violation `json:"endpoints"`
+}
+
+// NewOutputSubsystem creates a new output validation subsystem
+func NewOutputSubsystem(c *controller.Controller) interfaces.Subsystem {
+	name := "output_validation"
+	ovs := OutputSubsystem{
+		Controller: c,
+		Logger:     c.Logger.With(zap.String("module", name)),
+		enabled:    c.Config.Subsystems.Validation,
+		name:       name,
+		mode:       c.Config.Validation.Output,
+		violations: make(map[string]*Violation),
+	}
+	ovs.register()
+	return &ovs
+}
+
+// OutputSubsystem is the middleware that validates endpoint responses against their output schema
+type OutputSubsystem struct {
+	Controller *controller.Controller
+	Logger     *zap.Logger
+	enabled    bool
+	name       string
+	endpoints  []*endpoint.Endpoint
+	mode       string
+	checked    uint64
+	violations map[string]*Violation
+	mu         sync.Mutex
+}
+
+// register registers the endpoints that this subsystem handles
+func (s *OutputSubsystem) register() {
+	switch s.mode {
+	case OutputModeLog, OutputModeEnforce:
+	case OutputModeOff, "":
+		s.enabled = false
+	default:
+		s.Logger.Error("invalid output validation mode, using log", zap.String("mode", s.mode))
+		s.mode = OutputModeLog
+	}
+
+	if !s.Enabled() {
+		s.Logger.Info("subsystem is disabled", zap.String("subsystem", s.Name()))
+		return
+	}
+
+	// Endpoints
+	secure := s.Controller.Config.Auth.DefaultSecure
+	authz := endpoint.AuthGroupAdmin.String()
+	s.endpoints = []*endpoint.Endpoint{
+		endpoint.NewTypedEndpoint("diag/validation", endpoint.ActionRead, "output validation violations", s.reportHandler, secure, authz),
+	}
+}
+
+// Enabled returns true if the subsystem is enabled
+func (s *OutputSubsystem) Enabled() bool {
+	return s.enabled
+}
+
+// Name returns the name of the subsystem
+func (s *OutputSubsystem) Name() string {
+	return s.name
+}
+
+// Endpoints returns the endpoints that this subsystem handles
+func (s *OutputSubsystem) Endpoints() []*endpoint.Endpoint {
+	return s.endpoints
+}
+
+// Priority returns the priority of the middleware
+func (s *OutputSubsystem) Priority() middleware.Priority {
+	return middleware.PriorityOutputValidation
+}
+
+// Handler returns the handler for the middleware
+func (s *OutputSubsystem) Handler(ep endpoint.Endpoint) endpoint.Func {
+	// Endpoints without an output schema have nothing to validate against
+	if !s.enabled || ep.Streaming || ep.ExpectedOutputSchema == "" {
+		return ep.Function
+	}
+	return s.ValidateOutput(ep, ep.Function)
+}
+
+// ValidateOutput validates the response returned by the next handler against the endpoint's output schema. In
+// enforce mode a response that fails validation is replaced with an internal error.
+func (s *OutputSubsystem) ValidateOutput(ep endpoint.Endpoint, next endpoint.Func) endpoint.Func {
+	return func(in *endpoint.Request) (out *endpoint.Response, err error) {
+		out, err = next(in)
+		if err != nil {
+			return out, err
+		}
+
+		verr := ep.ValidateResponse(out)
+		s.record(ep, verr)
+		if verr == nil {
+			return out, nil
+		}
+
+		s.Logger.Warn("response does not match output schema",
+			zap.String("action", ep.Action.String()),
+			zap.String("path", ep.Path),
+			zap.Error(verr))
+		if s.mode != OutputModeEnforce {
+			return out, nil
+		}
+
+		oerr := endpoint.Errorf(endpoint.ErrorCodeInternal, "response failed output validation: %s", verr.Error())
+		if e := endpoint.AsError(verr); e != nil {
+			oerr.Details = e.Details
+		}
+		return nil, oerr
+	}
+}
+
+// Report returns the summary of the output validation performed so far
+func (s *OutputSubsystem) Report() *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{
+		Mode:      s.mode,
+		Checked:   s.checked,
+		Endpoints: make([]*Violation, 0, len(s.violations)),
+	}
+	for _, v := range s.violations {
+		copied := *v
+		report.Violations += v.Count
+		report.Endpoints = append(report.Endpoints, &copied)
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		if report.Endpoints[i].Path == report.Endpoints[j].Path {
+			return report.Endpoints[i].Action < report.Endpoints[j].Action
+		}
+		return report.Endpoints[i].Path < report.Endpoints[j].Path
+	})
+	return report
+}
+
+// record counts a validated response and keeps track of the endpoints that failed validation
+func (s *OutputSubsystem) record(ep endpoint.Endpoint, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checked++
+	if err == nil {
+		return
+	}
+	key := ep.Action.String() + ":" + ep.Path
+	v, ok := s.violations[key]
+	if !ok {
+		v = &Violation{Action: ep.Action, Path: ep.Path}
+		s.violations[key] = v
+	}
+	v.Count++
+	v.LastError = err.Error()
+	v.LastSeen = time.Now()
+}
+
+func (s *OutputSubsystem) reportHandler(ctx context.Context, _ endpoint.Empty) (*Report, error) {
+	return s.Report(), nil
+}
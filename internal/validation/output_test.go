@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type output struct {
+	Name string `json:"name"`
+	MTU  int    `json:"mtu"`
+}
+
+func TestValidateOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		value       string
+		expectedErr bool
+		violations  uint64
+	}{
+		{name: "valid", mode: OutputModeLog, value: `{"name":"eth0","mtu":1500}`},
+		{name: "empty", mode: OutputModeEnforce, value: ``},
+		{name: "log wrong type", mode: OutputModeLog, value: `{"name":"eth0","mtu":"1500"}`, violations: 1},
+		{name: "log extra field", mode: OutputModeLog, value: `{"name":"eth0","mtu":1500,"up":true}`, violations: 1},
+		{name: "enforce missing field", mode: OutputModeEnforce, value: `{"name":"eth0"}`, expectedErr: true, violations: 1},
+		{name: "enforce invalid json", mode: OutputModeEnforce, value: `eth0`, expectedErr: true, violations: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &OutputSubsystem{Logger: zap.NewNop(), enabled: true, mode: tt.mode, violations: make(map[string]*Violation)}
+			fn := func(in *endpoint.Request) (*endpoint.Response, error) {
+				return &endpoint.Response{Value: []byte(tt.value)}, nil
+			}
+			ep := endpoint.NewEndpoint("interface", endpoint.ActionRead, "interface", fn, false, "", endpoint.WithOutput(output{}))
+
+			out, err := s.Handler(*ep)(&endpoint.Request{})
+			if tt.expectedErr {
+				require.Error(t, err)
+				assert.Equal(t, endpoint.ErrorCodeInternal, endpoint.ErrorCodeOf(err))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.value, string(out.Value))
+			}
+
+			report := s.Report()
+			assert.Equal(t, uint64(1), report.Checked)
+			assert.Equal(t, tt.violations, report.Violations)
+			if tt.violations > 0 {
+				require.Len(t, report.Endpoints, 1)
+				assert.Equal(t, "interface", report.Endpoints[0].Path)
+				assert.NotEmpty(t, report.Endpoints[0].LastError)
+			}
+		})
+	}
+}
+
+func TestOutputHandlerBypass(t *testing.T) {
+	s := &OutputSubsystem{Logger: zap.NewNop(), enabled: true, mode: OutputModeEnforce, violations: make(map[string]*Violation)}
+	fn := func(in *endpoint.Request) (*endpoint.Response, error) {
+		return &endpoint.Response{Value: []byte(`not json`)}, nil
+	}
+
+	// Endpoints without an output schema are not validated
+	ep := endpoint.NewEndpoint("raw", endpoint.ActionRead, "raw", fn, false, "")
+	_, err := s.Handler(*ep)(&endpoint.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), s.Report().Checked)
+}
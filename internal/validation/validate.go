@@ -45,7 +45,7 @@ func (s Subsystem) Priority() middleware.Priority {
 	return middleware.PriorityValidation
 }
 
-// Validate validates the request and response
+// Validate validates the request. Responses are validated by the OutputSubsystem which runs closer to the endpoint.
 func (s Subsystem) Validate(ep endpoint.Endpoint, next endpoint.Func) endpoint.Func {
 	return func(in *endpoint.Request) (out *endpoint.Response, err error) {
 		s.Logger.Debug("request validation middleware called")
@@ -55,8 +55,6 @@ func (s Subsystem) Validate(ep endpoint.Endpoint, next endpoint.Func) endpoint.F
 			return nil, err
 		}
 		return next(in)
-		// Do output validation
-		//err = ep.ValidateResponse(out)
 	}
 }
 
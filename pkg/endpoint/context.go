@@ -0,0 +1,75 @@
+package endpoint
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderRequestTimeout is the header clients can use to request a deadline for a call. The value is either a duration
+// such as '1.5s' or '250ms', or a whole number of seconds.
+const HeaderRequestTimeout = "X-Request-Timeout"
+
+// WithTimeout sets the default timeout applied to calls to the endpoint
+func WithTimeout(timeout time.Duration) Validators {
+	return func(v *validationOptions) {
+		v.timeout = timeout
+	}
+}
+
+// Context returns the request's context. The context is canceled when the client goes away or the call's deadline is
+// exceeded. If no context has been set the background context is returned.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the request with its context changed to ctx
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
+}
+
+// CallContext returns the context used to call the endpoint. The endpoint's default timeout is applied to the parent
+// context unless the client supplied a shorter timeout, in which case the client's timeout is used instead. Clients
+// can shorten but not extend the endpoint's timeout. Any deadline already set on the parent is always honored.
+func (e *Endpoint) CallContext(parent context.Context, clientTimeout time.Duration) (context.Context, context.CancelFunc) {
+	timeout := e.Timeout
+	if clientTimeout > 0 && (timeout <= 0 || clientTimeout < timeout) {
+		timeout = clientTimeout
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// ParseTimeout parses a client supplied timeout. An empty value returns a zero duration meaning no timeout.
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, InvalidArgumentError("invalid timeout '%s': must not be negative", value)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, InvalidArgumentError("invalid timeout '%s': %w", value, err)
+	}
+	if timeout < 0 {
+		return 0, InvalidArgumentError("invalid timeout '%s': must not be negative", value)
+	}
+	return timeout, nil
+}
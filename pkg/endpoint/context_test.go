@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expect      time.Duration
+		expectError bool
+	}{
+		{name: "empty", value: "", expect: 0},
+		{name: "duration", value: "250ms", expect: 250 * time.Millisecond},
+		{name: "whole seconds", value: "5", expect: 5 * time.Second},
+		{name: "fractional seconds", value: "1.5", expect: 1500 * time.Millisecond},
+		{name: "negative", value: "-1s", expectError: true},
+		{name: "invalid", value: "soon", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout, err := ParseTimeout(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, timeout)
+		})
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	tests := []struct {
+		name           string
+		endpoint       time.Duration
+		client         time.Duration
+		expectDeadline bool
+		expectTimeout  time.Duration
+	}{
+		{name: "no timeouts", expectDeadline: false},
+		{name: "endpoint timeout", endpoint: time.Minute, expectDeadline: true, expectTimeout: time.Minute},
+		{name: "client timeout", client: time.Second, expectDeadline: true, expectTimeout: time.Second},
+		{name: "shorter client timeout", endpoint: time.Minute, client: time.Second, expectDeadline: true, expectTimeout: time.Second},
+		{name: "longer client timeout", endpoint: time.Second, client: time.Minute, expectDeadline: true, expectTimeout: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := NewEndpoint("test", ActionRead, "test", nil, false, "", WithTimeout(tt.endpoint))
+			ctx, cancel := ep.CallContext(context.Background(), tt.client)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			assert.Equal(t, tt.expectDeadline, ok)
+			if tt.expectDeadline {
+				assert.WithinDuration(t, time.Now().Add(tt.expectTimeout), deadline, time.Second)
+			}
+		})
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	in := &Request{Body: []byte("body")}
+	assert.Equal(t, context.Background(), in.Context())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := in.WithContext(ctx)
+	assert.Equal(t, ctx, out.Context())
+	assert.Equal(t, in.Body, out.Body)
+	assert.Equal(t, context.Background(), in.Context())
+
+	cancel()
+	assert.ErrorIs(t, out.Context().Err(), context.Canceled)
+}
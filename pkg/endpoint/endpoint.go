@@ -6,6 +6,7 @@ import (
 	"github.com/invopop/jsonschema"
 	"github.com/xeipuuv/gojsonschema"
 	"strings"
+	"time"
 )
 
 // NewEndpoint creates a new instance of the Endpoint struct
@@ -27,13 +28,16 @@ func NewEndpoint(path string, action Action, description string, function Func,
 
 	// Generate schemas
 	ep.GenerateSchemas(v)
+	ep.Timeout = v.timeout
+	ep.Async = v.async
 
 	return &ep
 }
 
 // Endpoint abstracts API endpoints from concrete API protocols, making it adaptable to different API styles like REST, gRPC, etc.
 type Endpoint struct {
-	// Path specifies the endpoint's unique path or identifier.
+	// Path specifies the endpoint's unique path or identifier. Segments wrapped in braces such as 'users/{id}' are
+	// templated parameters whose values are passed to the endpoint in the request parameters.
 	Path string `json:"path" yaml:"path" toml:"path" mapstructure:"path"`
 
 	// Action represents the type of operation this endpoint performs (e.g., GET, POST for REST).
@@ -42,6 +46,20 @@ type Endpoint struct {
 	// Function is the actual function to be executed when this endpoint is called.
 	Function Func `json:"-" yaml:"-" toml:"-" mapstructure:"-"`
 
+	// StreamFunction is the function executed for server-streaming endpoints. It is only set when Streaming is true.
+	StreamFunction StreamFunc `json:"-" yaml:"-" toml:"-" mapstructure:"-"`
+
+	// Streaming indicates that this endpoint produces a stream of responses instead of a single response.
+	Streaming bool `json:"streaming,omitempty" yaml:"streaming,omitempty" toml:"streaming,omitempty" mapstructure:"streaming,omitempty"`
+
+	// Timeout is the default timeout applied to calls to this endpoint. Clients may request a shorter deadline but
+	// not a longer one. A zero value means calls are only bounded by the client's deadline.
+	Timeout time.Duration `json:"-" yaml:"-" toml:"-" mapstructure:"timeout,omitempty"`
+
+	// Async indicates that calls to this endpoint always run asynchronously as jobs. Any other endpoint can be run
+	// asynchronously by the caller on a per-request basis.
+	Async bool `json:"async,omitempty" yaml:"async,omitempty" toml:"async,omitempty" mapstructure:"async,omitempty"`
+
 	// Description is a text based description of the endpoint that is shown in documentation and help output.
 	Description string `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty" mapstructure:"description,omitempty"`
 
@@ -208,22 +226,13 @@ func (e *Endpoint) ValidateRequest(request *Request) error {
 	return nil
 }
 
-// ValidateResponse validates the response against the expected output schema
+// ValidateResponse validates the response value against the expected output schema. The metadata, headers and
+// parameter schemas describe the request so they aren't used to validate the response.
 func (e *Endpoint) ValidateResponse(response *Response) error {
-	if err := ValidateAgainstSchema(response.Metadata, e.ExpectedMetadataSchema); err != nil {
-		return err
-	}
-	if err := ValidateAgainstSchema(response.Headers, e.ExpectedHeadersSchema); err != nil {
-		return err
+	if response == nil || len(response.Value) == 0 {
+		return nil
 	}
-	if err := ValidateAgainstSchema(response.Parameters, e.ExpectedParametersSchema); err != nil {
-		return err
-	}
-	if err := ValidateAgainstSchema(response.Value, e.ExpectedOutputSchema); err != nil {
-		return err
-	}
-
-	return nil
+	return ValidateAgainstSchema(response.Value, e.ExpectedOutputSchema)
 }
 
 // ValidateAgainstSchema validates the given data against the given schema
@@ -239,7 +248,7 @@ func ValidateAgainstSchema(data interface{}, schemaStr string) error {
 		if err == nil {
 			data = tmp
 		} else {
-			return err
+			return InvalidArgumentError("%w", err)
 		}
 	}
 
@@ -256,10 +265,14 @@ func ValidateAgainstSchema(data interface{}, schemaStr string) error {
 	if !result.Valid() {
 		// Collect and return errors if validation fails
 		var validationErrors []string
+		details := make(map[string]string)
 		for _, err := range result.Errors() {
 			validationErrors = append(validationErrors, err.String())
+			details[err.Field()] = err.Description()
 		}
-		return fmt.Errorf("validation failed: %s", strings.Join(validationErrors, "; "))
+		verr := InvalidArgumentError("validation failed: %s", strings.Join(validationErrors, "; "))
+		verr.Details = details
+		return verr
 	}
 
 	return nil
@@ -0,0 +1,181 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode identifies the category of an endpoint error. The code determines the HTTP status and gRPC code that are
+// returned to the client.
+type ErrorCode string
+
+const (
+	// ErrorCodeInternal is used for unexpected errors and any error that does not carry a code
+	ErrorCodeInternal ErrorCode = "internal"
+	// ErrorCodeInvalidArgument is used when the request is malformed or fails validation
+	ErrorCodeInvalidArgument ErrorCode = "invalid_argument"
+	// ErrorCodeNotFound is used when the requested resource or method does not exist
+	ErrorCodeNotFound ErrorCode = "not_found"
+	// ErrorCodeUnauthenticated is used when the caller could not be authenticated
+	ErrorCodeUnauthenticated ErrorCode = "unauthenticated"
+	// ErrorCodePermissionDenied is used when the caller is authenticated but not allowed to perform the request
+	ErrorCodePermissionDenied ErrorCode = "permission_denied"
+	// ErrorCodeConflict is used when the request conflicts with the current state of the resource
+	ErrorCodeConflict ErrorCode = "conflict"
+	// ErrorCodeUnavailable is used when a dependency such as a plugin or module is temporarily unavailable
+	ErrorCodeUnavailable ErrorCode = "unavailable"
+	// ErrorCodeUnimplemented is used when the requested functionality has not been implemented
+	ErrorCodeUnimplemented ErrorCode = "unimplemented"
+	// ErrorCodeDeadlineExceeded is used when the call did not complete before its deadline
+	ErrorCodeDeadlineExceeded ErrorCode = "deadline_exceeded"
+	// ErrorCodeCanceled is used when the call was canceled by the client
+	ErrorCodeCanceled ErrorCode = "canceled"
+)
+
+// statusClientClosedRequest is the non-standard status used when the client canceled the request
+const statusClientClosedRequest = 499
+
+// String returns the string representation of the error code
+func (c ErrorCode) String() string {
+	return string(c)
+}
+
+// HTTPStatus returns the HTTP status code used for the error code
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case ErrorCodeInvalidArgument:
+		return http.StatusBadRequest
+	case ErrorCodeNotFound:
+		return http.StatusNotFound
+	case ErrorCodeUnauthenticated:
+		return http.StatusUnauthorized
+	case ErrorCodePermissionDenied:
+		return http.StatusForbidden
+	case ErrorCodeConflict:
+		return http.StatusConflict
+	case ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrorCodeUnimplemented:
+		return http.StatusNotImplemented
+	case ErrorCodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case ErrorCodeCanceled:
+		return statusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is a structured error returned by endpoints. It carries a code that adapters map to a protocol specific
+// status, optional details about the failure and whether the client can expect a retry to succeed.
+type Error struct {
+	// Code is the category of the error
+	Code ErrorCode `json:"code"`
+	// Message is a human-readable description of the error
+	Message string `json:"message"`
+	// Details holds additional information about the error such as the name of an invalid field
+	Details map[string]string `json:"details,omitempty"`
+	// Retryable indicates that the request may succeed if it is retried later
+	Retryable bool `json:"retryable,omitempty"`
+
+	cause error
+}
+
+// NewError creates a new error with the given code and message
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf creates a new error with the given code and a formatted message. If the format contains a %w verb the
+// wrapped error can be retrieved using errors.Unwrap, errors.Is and errors.As.
+func Errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), cause: errors.Unwrap(err)}
+}
+
+// InvalidArgumentError creates a new invalid argument error
+func InvalidArgumentError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodeInvalidArgument, format, args...)
+}
+
+// NotFoundError creates a new not found error
+func NotFoundError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodeNotFound, format, args...)
+}
+
+// UnauthenticatedError creates a new unauthenticated error
+func UnauthenticatedError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodeUnauthenticated, format, args...)
+}
+
+// PermissionDeniedError creates a new permission denied error
+func PermissionDeniedError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodePermissionDenied, format, args...)
+}
+
+// ConflictError creates a new conflict error
+func ConflictError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodeConflict, format, args...)
+}
+
+// UnavailableError creates a new unavailable error. Unavailable errors are retryable by default.
+func UnavailableError(format string, args ...interface{}) *Error {
+	return Errorf(ErrorCodeUnavailable, format, args...).WithRetryable(true)
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying cause of the error, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// WithDetail adds a detail to the error and returns the error to allow chaining
+func (e *Error) WithDetail(key string, value string) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithRetryable sets the retryable flag on the error and returns the error to allow chaining
+func (e *Error) WithRetryable(retryable bool) *Error {
+	e.Retryable = retryable
+	return e
+}
+
+// AsError converts any error into an *Error. Errors that already are, or wrap, an *Error are returned as is, context
+// errors are mapped to their matching codes and everything else is treated as an internal error.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: ErrorCodeDeadlineExceeded, Message: err.Error(), Retryable: true, cause: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: ErrorCodeCanceled, Message: err.Error(), cause: err}
+	default:
+		return &Error{Code: ErrorCodeInternal, Message: err.Error(), cause: err}
+	}
+}
+
+// ErrorCodeOf returns the code of the error. Errors without a code are reported as internal errors.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	return AsError(err).Code
+}
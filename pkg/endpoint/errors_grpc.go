@@ -0,0 +1,119 @@
+package endpoint
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain used in the gRPC error info attached to endpoint errors
+const ErrorDomain = "dtac.agent"
+
+// GRPCCode returns the gRPC status code used for the error code
+func (c ErrorCode) GRPCCode() codes.Code {
+	switch c {
+	case ErrorCodeInvalidArgument:
+		return codes.InvalidArgument
+	case ErrorCodeNotFound:
+		return codes.NotFound
+	case ErrorCodeUnauthenticated:
+		return codes.Unauthenticated
+	case ErrorCodePermissionDenied:
+		return codes.PermissionDenied
+	case ErrorCodeConflict:
+		return codes.AlreadyExists
+	case ErrorCodeUnavailable:
+		return codes.Unavailable
+	case ErrorCodeUnimplemented:
+		return codes.Unimplemented
+	case ErrorCodeDeadlineExceeded:
+		return codes.DeadlineExceeded
+	case ErrorCodeCanceled:
+		return codes.Canceled
+	default:
+		return codes.Internal
+	}
+}
+
+// GRPCStatus returns the gRPC status for the error. The code, details and retryable flag are attached to the status
+// so that the error can be reconstructed on the other side of a gRPC call using ErrorFromStatus. This also allows the
+// grpc package to convert the error automatically when it is returned from a service method.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code.GRPCCode(), e.Message)
+	info := &errdetails.ErrorInfo{Reason: e.Code.String(), Domain: ErrorDomain, Metadata: e.Details}
+	var detailed *status.Status
+	var err error
+	if e.Retryable {
+		detailed, err = st.WithDetails(info, &errdetails.RetryInfo{})
+	} else {
+		detailed, err = st.WithDetails(info)
+	}
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// ErrorFromStatus converts an error returned by a gRPC call back into an *Error. Errors that were created from an
+// *Error keep their code, details and retryable flag, other gRPC errors are mapped using their status code. Errors
+// that did not come from gRPC are returned unchanged.
+func ErrorFromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	// Errors that were created from an *Error carry their original code in the error info
+	var info *errdetails.ErrorInfo
+	retryable := false
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.GetDomain() == ErrorDomain {
+				info = d
+			}
+		case *errdetails.RetryInfo:
+			retryable = true
+		}
+	}
+
+	e := &Error{Code: errorCodeFromGRPC(st.Code()), Message: st.Message(), cause: err}
+	if info != nil {
+		e.Code = ErrorCode(info.GetReason())
+		e.Details = info.GetMetadata()
+		e.Retryable = retryable
+	} else {
+		e.Retryable = e.Code == ErrorCodeUnavailable || e.Code == ErrorCodeDeadlineExceeded
+	}
+
+	return e
+}
+
+// errorCodeFromGRPC returns the error code used for a gRPC status code
+func errorCodeFromGRPC(code codes.Code) ErrorCode {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return ErrorCodeInvalidArgument
+	case codes.NotFound:
+		return ErrorCodeNotFound
+	case codes.Unauthenticated:
+		return ErrorCodeUnauthenticated
+	case codes.PermissionDenied:
+		return ErrorCodePermissionDenied
+	case codes.AlreadyExists, codes.Aborted:
+		return ErrorCodeConflict
+	case codes.Unavailable, codes.ResourceExhausted:
+		return ErrorCodeUnavailable
+	case codes.Unimplemented:
+		return ErrorCodeUnimplemented
+	case codes.DeadlineExceeded:
+		return ErrorCodeDeadlineExceeded
+	case codes.Canceled:
+		return ErrorCodeCanceled
+	default:
+		return ErrorCodeInternal
+	}
+}
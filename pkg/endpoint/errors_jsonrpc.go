@@ -0,0 +1,45 @@
+package endpoint
+
+// JSON-RPC 2.0 error codes. The codes from -32700 to -32600 are defined by the specification, the codes from -32099 to
+// -32000 are reserved for implementation defined server errors.
+const (
+	JSONRPCParseError       = -32700
+	JSONRPCInvalidRequest   = -32600
+	JSONRPCMethodNotFound   = -32601
+	JSONRPCInvalidParams    = -32602
+	JSONRPCInternalError    = -32603
+	JSONRPCUnauthenticated  = -32001
+	JSONRPCPermissionDenied = -32002
+	JSONRPCUnavailable      = -32003
+	JSONRPCNotFound         = -32004
+	JSONRPCDeadlineExceeded = -32008
+	JSONRPCConflict         = -32009
+	JSONRPCCanceled         = -32010
+	JSONRPCUnimplemented    = -32011
+)
+
+// JSONRPCCode returns the JSON-RPC error code used for the error code
+func (c ErrorCode) JSONRPCCode() int {
+	switch c {
+	case ErrorCodeInvalidArgument:
+		return JSONRPCInvalidParams
+	case ErrorCodeNotFound:
+		return JSONRPCNotFound
+	case ErrorCodeUnauthenticated:
+		return JSONRPCUnauthenticated
+	case ErrorCodePermissionDenied:
+		return JSONRPCPermissionDenied
+	case ErrorCodeConflict:
+		return JSONRPCConflict
+	case ErrorCodeUnavailable:
+		return JSONRPCUnavailable
+	case ErrorCodeUnimplemented:
+		return JSONRPCUnimplemented
+	case ErrorCodeDeadlineExceeded:
+		return JSONRPCDeadlineExceeded
+	case ErrorCodeCanceled:
+		return JSONRPCCanceled
+	default:
+		return JSONRPCInternalError
+	}
+}
@@ -0,0 +1,123 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCodeMapping(t *testing.T) {
+	tests := []struct {
+		code        ErrorCode
+		httpStatus  int
+		grpcCode    codes.Code
+		jsonrpcCode int
+	}{
+		{code: ErrorCodeInternal, httpStatus: http.StatusInternalServerError, grpcCode: codes.Internal, jsonrpcCode: JSONRPCInternalError},
+		{code: ErrorCodeInvalidArgument, httpStatus: http.StatusBadRequest, grpcCode: codes.InvalidArgument, jsonrpcCode: JSONRPCInvalidParams},
+		{code: ErrorCodeNotFound, httpStatus: http.StatusNotFound, grpcCode: codes.NotFound, jsonrpcCode: JSONRPCNotFound},
+		{code: ErrorCodeUnauthenticated, httpStatus: http.StatusUnauthorized, grpcCode: codes.Unauthenticated, jsonrpcCode: JSONRPCUnauthenticated},
+		{code: ErrorCodePermissionDenied, httpStatus: http.StatusForbidden, grpcCode: codes.PermissionDenied, jsonrpcCode: JSONRPCPermissionDenied},
+		{code: ErrorCodeConflict, httpStatus: http.StatusConflict, grpcCode: codes.AlreadyExists, jsonrpcCode: JSONRPCConflict},
+		{code: ErrorCodeUnavailable, httpStatus: http.StatusServiceUnavailable, grpcCode: codes.Unavailable, jsonrpcCode: JSONRPCUnavailable},
+		{code: ErrorCodeDeadlineExceeded, httpStatus: http.StatusGatewayTimeout, grpcCode: codes.DeadlineExceeded, jsonrpcCode: JSONRPCDeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			assert.Equal(t, tt.httpStatus, tt.code.HTTPStatus())
+			assert.Equal(t, tt.grpcCode, tt.code.GRPCCode())
+			assert.Equal(t, tt.jsonrpcCode, tt.code.JSONRPCCode())
+			assert.Equal(t, tt.code, errorCodeFromGRPC(tt.grpcCode))
+		})
+	}
+}
+
+func TestAsError(t *testing.T) {
+	cause := errors.New("disk full")
+	typed := UnavailableError("storage unavailable: %w", cause).WithDetail("volume", "data")
+
+	tests := []struct {
+		name            string
+		err             error
+		expectCode      ErrorCode
+		expectRetryable bool
+	}{
+		{name: "typed", err: typed, expectCode: ErrorCodeUnavailable, expectRetryable: true},
+		{name: "wrapped typed", err: fmt.Errorf("call failed: %w", typed), expectCode: ErrorCodeUnavailable, expectRetryable: true},
+		{name: "plain", err: cause, expectCode: ErrorCodeInternal},
+		{name: "deadline", err: fmt.Errorf("plugin: %w", context.DeadlineExceeded), expectCode: ErrorCodeDeadlineExceeded, expectRetryable: true},
+		{name: "canceled", err: context.Canceled, expectCode: ErrorCodeCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := AsError(tt.err)
+			assert.Equal(t, tt.expectCode, e.Code)
+			assert.Equal(t, tt.expectRetryable, e.Retryable)
+			assert.Equal(t, tt.expectCode, ErrorCodeOf(tt.err))
+		})
+	}
+
+	assert.Nil(t, AsError(nil))
+	assert.ErrorIs(t, typed, cause)
+	assert.Equal(t, "storage unavailable: disk full", typed.Error())
+}
+
+func TestErrorFromStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectCode      ErrorCode
+		expectDetails   map[string]string
+		expectRetryable bool
+	}{
+		{
+			name:          "endpoint error",
+			err:           NotFoundError("user %d not found", 7).WithDetail("id", "7").GRPCStatus().Err(),
+			expectCode:    ErrorCodeNotFound,
+			expectDetails: map[string]string{"id": "7"},
+		},
+		{
+			name:            "retryable endpoint error",
+			err:             UnavailableError("plugin restarting").GRPCStatus().Err(),
+			expectCode:      ErrorCodeUnavailable,
+			expectRetryable: true,
+		},
+		{
+			name:       "non retryable unavailable error",
+			err:        UnavailableError("plugin exited").WithRetryable(false).GRPCStatus().Err(),
+			expectCode: ErrorCodeUnavailable,
+		},
+		{
+			name:       "plain status",
+			err:        status.Error(codes.PermissionDenied, "denied"),
+			expectCode: ErrorCodePermissionDenied,
+		},
+		{
+			name:            "plain unavailable status",
+			err:             status.Error(codes.Unavailable, "connection refused"),
+			expectCode:      ErrorCodeUnavailable,
+			expectRetryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := AsError(ErrorFromStatus(tt.err))
+			assert.Equal(t, tt.expectCode, e.Code)
+			assert.Equal(t, tt.expectDetails, e.Details)
+			assert.Equal(t, tt.expectRetryable, e.Retryable)
+		})
+	}
+
+	plain := errors.New("not a status")
+	assert.Equal(t, plain, ErrorFromStatus(plain))
+	assert.Nil(t, ErrorFromStatus(nil))
+}
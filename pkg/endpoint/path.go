@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"strings"
+)
+
+// PathParameterNames returns the names of the templated parameters in the path. Templated parameters are path
+// segments wrapped in braces, for example the path 'auth/users/{id}' has a single parameter named 'id'.
+func PathParameterNames(path string) []string {
+	names := make([]string, 0)
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name, ok := pathParameterName(segment); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsTemplatedPath returns true if the path contains one or more templated parameters
+func IsTemplatedPath(path string) bool {
+	return len(PathParameterNames(path)) > 0
+}
+
+// MatchPath checks if the concrete path matches the templated path. If it does, the values of the templated
+// parameters are returned keyed by their names.
+func MatchPath(template string, path string) (params map[string]string, ok bool) {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params = make(map[string]string)
+	for idx, segment := range templateSegments {
+		if name, isParam := pathParameterName(segment); isParam {
+			if pathSegments[idx] == "" {
+				return nil, false
+			}
+			params[name] = pathSegments[idx]
+			continue
+		}
+		if segment != pathSegments[idx] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// MatchMethod finds the entry for the method in a map keyed by 'action:path'. If there is no exact match the method's
+// path is matched against any templated paths with the same action, preferring the template with the fewest
+// parameters when more than one matches. The values of the templated parameters are returned along with the key.
+func MatchMethod[T any](methods map[string]T, method string) (key string, params map[string]string, ok bool) {
+	if _, ok = methods[method]; ok {
+		return method, nil, true
+	}
+
+	action, path, found := strings.Cut(method, ":")
+	if !found {
+		return "", nil, false
+	}
+	for candidate := range methods {
+		candidateAction, candidatePath, _ := strings.Cut(candidate, ":")
+		if candidateAction != action || !IsTemplatedPath(candidatePath) {
+			continue
+		}
+		if candidateParams, matched := MatchPath(candidatePath, path); matched {
+			if !ok || len(candidateParams) < len(params) || (len(candidateParams) == len(params) && candidate < key) {
+				key, params, ok = candidate, candidateParams, true
+			}
+		}
+	}
+
+	return key, params, ok
+}
+
+// SetPathParameters copies the path parameter values into the request parameters. Path parameters take precedence
+// over any query parameters with the same name.
+func (r *Request) SetPathParameters(params map[string]string) {
+	if len(params) == 0 {
+		return
+	}
+	if r.Parameters == nil {
+		r.Parameters = make(map[string][]string)
+	}
+	for name, value := range params {
+		r.Parameters[name] = []string{value}
+	}
+}
+
+// PathParameterNames returns the names of the templated parameters in the endpoint's path
+func (e *Endpoint) PathParameterNames() []string {
+	return PathParameterNames(e.Path)
+}
+
+// pathParameterName returns the parameter name if the segment is a templated parameter
+func pathParameterName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
@@ -0,0 +1,116 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		template     string
+		path         string
+		expectOK     bool
+		expectParams map[string]string
+	}{
+		{
+			name:         "static path",
+			template:     "auth/users",
+			path:         "auth/users",
+			expectOK:     true,
+			expectParams: map[string]string{},
+		},
+		{
+			name:         "single parameter",
+			template:     "auth/users/{id}",
+			path:         "auth/users/42",
+			expectOK:     true,
+			expectParams: map[string]string{"id": "42"},
+		},
+		{
+			name:         "multiple parameters with leading slash",
+			template:     "docker/containers/{name}/logs/{stream}",
+			path:         "/docker/containers/web/logs/stderr",
+			expectOK:     true,
+			expectParams: map[string]string{"name": "web", "stream": "stderr"},
+		},
+		{
+			name:     "segment count mismatch",
+			template: "auth/users/{id}",
+			path:     "auth/users",
+			expectOK: false,
+		},
+		{
+			name:     "static segment mismatch",
+			template: "auth/users/{id}",
+			path:     "auth/groups/42",
+			expectOK: false,
+		},
+		{
+			name:     "empty parameter value",
+			template: "auth/users/{id}",
+			path:     "auth/users/",
+			expectOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, ok := MatchPath(tt.template, tt.path)
+			assert.Equal(t, tt.expectOK, ok)
+			if tt.expectOK {
+				assert.Equal(t, tt.expectParams, params)
+			}
+		})
+	}
+}
+
+func TestMatchMethod(t *testing.T) {
+	methods := map[string]int{
+		"read:auth/users":          1,
+		"read:auth/users/{id}":     2,
+		"delete:auth/users/{id}":   3,
+		"read:auth/users/{id}/{x}": 4,
+		"read:auth/{group}/{id}":   5,
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		expectKey    string
+		expectParams map[string]string
+		expectOK     bool
+	}{
+		{name: "exact match", method: "read:auth/users", expectKey: "read:auth/users", expectOK: true},
+		{name: "exact template", method: "read:auth/users/{id}", expectKey: "read:auth/users/{id}", expectOK: true},
+		{name: "templated match", method: "delete:auth/users/7", expectKey: "delete:auth/users/{id}", expectParams: map[string]string{"id": "7"}, expectOK: true},
+		{name: "most specific template", method: "read:auth/users/7", expectKey: "read:auth/users/{id}", expectParams: map[string]string{"id": "7"}, expectOK: true},
+		{name: "action must match", method: "write:auth/users/7", expectOK: false},
+		{name: "missing action", method: "auth/users/7", expectOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, params, ok := MatchMethod(methods, tt.method)
+			assert.Equal(t, tt.expectOK, ok)
+			if tt.expectOK {
+				assert.Equal(t, tt.expectKey, key)
+				if tt.expectParams != nil {
+					assert.Equal(t, tt.expectParams, params)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPathParameters(t *testing.T) {
+	in := &Request{Parameters: map[string][]string{"id": {"query"}, "verbose": {"true"}}}
+	in.SetPathParameters(map[string]string{"id": "path"})
+	assert.Equal(t, []string{"path"}, in.Parameters["id"])
+	assert.Equal(t, []string{"true"}, in.Parameters["verbose"])
+
+	empty := &Request{}
+	empty.SetPathParameters(map[string]string{"name": "web"})
+	assert.Equal(t, []string{"web"}, empty.Parameters["name"])
+}
@@ -1,5 +1,9 @@
 package endpoint
 
+import (
+	"context"
+)
+
 // Request represents the data structure for a request made to an endpoint in the framework.
 // It encapsulates all the necessary information that an endpoint might need to process a request.
 type Request struct {
@@ -12,10 +16,15 @@ type Request struct {
 	Headers map[string][]string `json:"headers,omitempty"`
 
 	// Parameters are the query or path parameters that may be used by the endpoint to process the request.
-	// These are typically key-value pairs.
+	// These are typically key-value pairs. Values for templated path segments such as '{id}' are stored under
+	// the segment name and take precedence over query parameters of the same name.
 	Parameters map[string][]string `json:"parameters,omitempty"`
 
 	// Body holds the raw data of the request. This could be in any format (binary, JSON, XML, etc.),
 	// and is intended to be interpreted by the endpoint as per its requirements.
 	Body []byte `json:"body,omitempty"`
+
+	// ctx is the context of the call. It is not serialized and is re-created on the far side of an RPC boundary from
+	// the RPC's own context, which carries the deadline and cancellation.
+	ctx context.Context
 }
@@ -1,5 +1,8 @@
 package endpoint
 
+// MetadataExecDuration is the response metadata key used to report how long the endpoint took to execute
+const MetadataExecDuration = "exec_duration"
+
 // Response represents the data structure for the response returned from an endpoint.
 // It contains all the data that an endpoint would return in response to a request.
 type Response struct {
@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"errors"
+)
+
+// StreamSender is the type for the function used by streaming endpoints to send a single message to the caller
+type StreamSender func(out *Response) error
+
+// StreamFunc is the type for a streaming endpoint function. The function should call send once for each message it
+// produces and return when the stream is complete. Returning an error terminates the stream with that error.
+type StreamFunc func(in *Request, send StreamSender) error
+
+// ErrStreamingEndpoint is returned when a streaming endpoint is invoked through a unary call path
+var ErrStreamingEndpoint = errors.New("endpoint is a streaming endpoint and must be called using a streaming transport")
+
+// NewStreamEndpoint creates a new instance of the Endpoint struct for a server-streaming endpoint
+func NewStreamEndpoint(path string, action Action, description string, function StreamFunc, secure bool, authGroup string, validators ...Validators) *Endpoint {
+	ep := NewEndpoint(path, action, description, nil, secure, authGroup, validators...)
+	ep.SetStreamFunction(function)
+	return ep
+}
+
+// SetStreamFunction marks the endpoint as a streaming endpoint and sets the function that produces the stream. The
+// unary Function is replaced with a gate that the middleware chain wraps, which means authentication, authorization
+// and validation are still applied to the request before the stream is opened.
+func (e *Endpoint) SetStreamFunction(function StreamFunc) {
+	e.StreamFunction = function
+	e.Streaming = true
+	e.Function = streamGate
+}
+
+// Stream runs the request through the endpoint's Function (which for streaming endpoints is the middleware wrapped
+// gate) and, if that succeeds, opens the stream by calling StreamFunction.
+func (e *Endpoint) Stream(in *Request, send StreamSender) error {
+	if !e.Streaming || e.StreamFunction == nil {
+		return errors.New("endpoint does not support streaming")
+	}
+	if e.Function != nil {
+		if _, err := e.Function(in); err != nil {
+			return err
+		}
+	}
+	return e.StreamFunction(in, send)
+}
+
+// streamGate is the unary function used for streaming endpoints. It returns an empty response so that the middleware
+// chain can run to completion before the stream is started.
+func streamGate(in *Request) (out *Response, err error) {
+	return &Response{}, nil
+}
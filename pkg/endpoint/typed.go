@@ -0,0 +1,321 @@
+package endpoint
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/invopop/jsonschema"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedFunc is the type for a typed endpoint function. The request is decoded into In before the function is called
+// and the returned Out is marshalled into the response value.
+type TypedFunc[In any, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Empty can be used as the In or Out type of a typed endpoint that takes no input or returns no output
+type Empty struct{}
+
+// requestContextKey is the context key used to store the original request for typed endpoints
+type requestContextKey struct{}
+
+// NewTypedEndpoint creates a new instance of the Endpoint struct from a typed function. The request body is decoded
+// into In as JSON, after which any fields tagged with `param:"name"` are populated from the request parameters (which
+// include templated path parameters). A parameter can be marked as required using `param:"name,required"`. The body,
+// parameter and output schemas are derived from In and Out, although any validators passed in take precedence.
+func NewTypedEndpoint[In any, Out any](path string, action Action, description string, function TypedFunc[In, Out], secure bool, authGroup string, validators ...Validators) *Endpoint {
+	ep := NewEndpoint(path, action, description, typedHandler(function), secure, authGroup, validators...)
+
+	// Derive any schemas that were not explicitly provided from the type parameters
+	if err := ep.setTypedSchemas(reflect.TypeFor[In](), reflect.TypeFor[Out]()); err != nil {
+		//TODO: Need to figure out how to handle logging here
+		fmt.Printf("[!] ERROR: %v\n", err)
+	}
+
+	return ep
+}
+
+// RequestFromContext returns the original request from the context passed to a typed endpoint function
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	in, ok := ctx.Value(requestContextKey{}).(*Request)
+	return in, ok
+}
+
+// DecodeRequest decodes the request body and parameters into the value pointed to by v using the same rules as
+// typed endpoints. It is useful for handlers that have not been converted to typed endpoints.
+func DecodeRequest(in *Request, v interface{}) error {
+	if len(in.Body) > 0 {
+		if err := json.Unmarshal(in.Body, v); err != nil {
+			return InvalidArgumentError("invalid request body: %w", err)
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer, got %T", v)
+	}
+	rv = rv.Elem()
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for idx := 0; idx < rv.NumField(); idx++ {
+		field := rv.Type().Field(idx)
+		name, required, ok := paramTag(field)
+		if !ok {
+			continue
+		}
+		values, found := in.Parameters[name]
+		if !found || len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			if required {
+				return InvalidArgumentError("missing parameter '%s'", name).WithDetail("parameter", name)
+			}
+			continue
+		}
+		if err := setParameter(rv.Field(idx), values); err != nil {
+			return InvalidArgumentError("invalid parameter '%s': %w", name, err).WithDetail("parameter", name)
+		}
+	}
+
+	return nil
+}
+
+// typedHandler adapts a typed function to the Func signature used by endpoints
+func typedHandler[In any, Out any](function TypedFunc[In, Out]) Func {
+	return func(in *Request) (out *Response, err error) {
+		var args In
+		if err = DecodeRequest(in, &args); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		ctx := context.WithValue(in.Context(), requestContextKey{}, in)
+		result, err := function(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		out = &Response{
+			Metadata: map[string]string{MetadataExecDuration: time.Since(start).String()},
+		}
+		if reflect.TypeFor[Out]() == reflect.TypeFor[Empty]() {
+			return out, nil
+		}
+		if out.Value, err = json.Marshal(result); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+}
+
+// setTypedSchemas sets the body, parameter and output schemas from the input and output types. Schemas that have
+// already been set are left unchanged.
+func (e *Endpoint) setTypedSchemas(in reflect.Type, out reflect.Type) error {
+	empty := reflect.TypeFor[Empty]()
+
+	if in != empty {
+		structType := in
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+
+		params := make(map[string]bool)
+		if structType.Kind() == reflect.Struct {
+			if err := e.setTypedParameterSchema(structType, params); err != nil {
+				return err
+			}
+		}
+		if hasBodyFields(structType) && e.ExpectedBodySchema == "" {
+			schema := jsonschema.Reflect(reflect.New(structType).Interface())
+			removeProperties(schema, params)
+			if err := setSchema(schema, &e.ExpectedBodySchema, &e.ExpectedBodyDescription); err != nil {
+				return err
+			}
+		}
+	}
+
+	if out != empty && out.Kind() != reflect.Interface && e.ExpectedOutputSchema == "" {
+		return e.SetExpectedOutputSchema(reflect.New(out).Elem().Interface())
+	}
+
+	return nil
+}
+
+// setTypedParameterSchema sets the parameter schema from the param tagged fields of the struct. The names of the
+// parameters are added to the params map so they can be excluded from the body schema.
+func (e *Endpoint) setTypedParameterSchema(structType reflect.Type, params map[string]bool) error {
+	schema := &jsonschema.Schema{
+		Version:              jsonschema.Version,
+		Type:                 "object",
+		Properties:           jsonschema.NewProperties(),
+		AdditionalProperties: jsonschema.TrueSchema,
+	}
+	for idx := 0; idx < structType.NumField(); idx++ {
+		field := structType.Field(idx)
+		name, required, ok := paramTag(field)
+		if !ok {
+			continue
+		}
+		params[jsonName(field)] = true
+		schema.Properties.Set(name, &jsonschema.Schema{Type: "array", Items: &jsonschema.Schema{Type: "string"}})
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	if schema.Properties.Len() == 0 || e.ExpectedParametersSchema != "" {
+		return nil
+	}
+
+	return setSchema(schema, &e.ExpectedParametersSchema, &e.ExpectedParametersDescription)
+}
+
+// setSchema marshals the schema into the schema string and description
+func setSchema(schema *jsonschema.Schema, target *string, description *json.RawMessage) error {
+	bytes, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	*target = string(bytes)
+	*description = bytes
+	return nil
+}
+
+// removeProperties removes the named properties from the root struct definition of the schema
+func removeProperties(schema *jsonschema.Schema, names map[string]bool) {
+	if len(names) == 0 {
+		return
+	}
+	root := schema
+	if ref := strings.TrimPrefix(schema.Ref, "#/$defs/"); ref != schema.Ref {
+		if definition, ok := schema.Definitions[ref]; ok {
+			root = definition
+		}
+	}
+	if root.Properties == nil {
+		return
+	}
+	for name := range names {
+		root.Properties.Delete(name)
+	}
+	required := make([]string, 0, len(root.Required))
+	for _, name := range root.Required {
+		if !names[name] {
+			required = append(required, name)
+		}
+	}
+	root.Required = required
+}
+
+// hasBodyFields returns true if the type is decoded from the request body. Structs are only decoded from the body
+// when they have at least one exported field that is not a parameter and is not ignored by encoding/json.
+func hasBodyFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if _, _, ok := paramTag(field); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// paramTag parses the param struct tag of the field
+func paramTag(field reflect.StructField) (name string, required bool, ok bool) {
+	tag, ok := field.Tag.Lookup("param")
+	if !ok || tag == "-" || !field.IsExported() {
+		return "", false, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, options == "required", true
+}
+
+// jsonName returns the name used for the field by encoding/json
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// setParameter converts the parameter values and stores them in the field
+func setParameter(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setParameter(field.Elem(), values)
+	}
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(values[0]))
+	}
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for idx, value := range values {
+			if err := setParameter(slice.Index(idx), []string{value}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	value := values[0]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == reflect.TypeFor[time.Duration]() {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported parameter type %s", field.Type())
+	}
+
+	return nil
+}
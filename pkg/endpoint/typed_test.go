@@ -0,0 +1,119 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedTestInput struct {
+	ID      int           `json:"-" param:"id,required"`
+	Verbose bool          `json:"-" param:"verbose"`
+	Tags    []string      `json:"-" param:"tag"`
+	Timeout time.Duration `json:"-" param:"timeout"`
+	Name    string        `json:"name"`
+}
+
+type typedTestOutput struct {
+	ID      int      `json:"id"`
+	Verbose bool     `json:"verbose"`
+	Tags    []string `json:"tags"`
+	Timeout string   `json:"timeout"`
+	Name    string   `json:"name"`
+}
+
+func TestNewTypedEndpoint(t *testing.T) {
+	ep := NewTypedEndpoint("test/items/{id}", ActionWrite, "typed", func(ctx context.Context, in typedTestInput) (typedTestOutput, error) {
+		if _, ok := RequestFromContext(ctx); !ok {
+			return typedTestOutput{}, errors.New("request missing from context")
+		}
+		return typedTestOutput{ID: in.ID, Verbose: in.Verbose, Tags: in.Tags, Timeout: in.Timeout.String(), Name: in.Name}, nil
+	}, false, "")
+
+	tests := []struct {
+		name        string
+		request     *Request
+		expectError string
+		expect      typedTestOutput
+	}{
+		{
+			name: "body and parameters",
+			request: &Request{
+				Parameters: map[string][]string{"id": {"7"}, "verbose": {"true"}, "tag": {"a", "b"}, "timeout": {"5s"}},
+				Body:       []byte(`{"name":"widget"}`),
+			},
+			expect: typedTestOutput{ID: 7, Verbose: true, Tags: []string{"a", "b"}, Timeout: "5s", Name: "widget"},
+		},
+		{
+			name:    "optional parameters and empty body",
+			request: &Request{Parameters: map[string][]string{"id": {"1"}}},
+			expect:  typedTestOutput{ID: 1, Timeout: "0s"},
+		},
+		{
+			name:        "missing required parameter",
+			request:     &Request{Body: []byte(`{"name":"widget"}`)},
+			expectError: "missing parameter 'id'",
+		},
+		{
+			name:        "invalid parameter",
+			request:     &Request{Parameters: map[string][]string{"id": {"seven"}}},
+			expectError: "invalid parameter 'id'",
+		},
+		{
+			name:        "invalid body",
+			request:     &Request{Parameters: map[string][]string{"id": {"1"}}, Body: []byte(`{"name":`)},
+			expectError: "invalid request body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ep.Function(tt.request)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, out.Metadata, MetadataExecDuration)
+
+			var result typedTestOutput
+			assert.NoError(t, json.Unmarshal(out.Value, &result))
+			assert.Equal(t, tt.expect, result)
+		})
+	}
+}
+
+func TestNewTypedEndpointSchemas(t *testing.T) {
+	ep := NewTypedEndpoint("test/items/{id}", ActionWrite, "typed", func(ctx context.Context, in typedTestInput) (typedTestOutput, error) {
+		return typedTestOutput{}, nil
+	}, false, "")
+
+	// Parameters are validated as query values and are not part of the body
+	assert.NoError(t, ValidateAgainstSchema(map[string][]string{"id": {"1"}, "extra": {"x"}}, ep.ExpectedParametersSchema))
+	assert.Error(t, ValidateAgainstSchema(map[string][]string{"verbose": {"true"}}, ep.ExpectedParametersSchema))
+	assert.NoError(t, ValidateAgainstSchema([]byte(`{"name":"widget"}`), ep.ExpectedBodySchema))
+	assert.NotContains(t, ep.ExpectedBodySchema, `"id"`)
+	assert.Contains(t, ep.ExpectedOutputSchema, `"tags"`)
+
+	// Parameter-only inputs and empty outputs don't produce body or output schemas
+	empty := NewTypedEndpoint("test/empty", ActionRead, "empty", func(ctx context.Context, in struct {
+		ID string `param:"id"`
+	}) (Empty, error) {
+		return Empty{}, nil
+	}, false, "")
+	assert.Empty(t, empty.ExpectedBodySchema)
+	assert.Empty(t, empty.ExpectedOutputSchema)
+	out, err := empty.Function(&Request{})
+	assert.NoError(t, err)
+	assert.Nil(t, out.Value)
+
+	// Explicit validators override the derived schemas
+	override := NewTypedEndpoint("test/override", ActionRead, "override", func(ctx context.Context, in Empty) ([]string, error) {
+		return nil, nil
+	}, false, "", WithOutput(typedTestOutput{}))
+	assert.Contains(t, override.ExpectedOutputSchema, `"verbose"`)
+}
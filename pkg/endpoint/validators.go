@@ -1,5 +1,9 @@
 package endpoint
 
+import (
+	"time"
+)
+
 // WithMetadata sets the metadata option for the endpoint
 func WithMetadata(metadata interface{}) Validators {
 	return func(v *validationOptions) {
@@ -35,6 +39,14 @@ func WithOutput(output interface{}) Validators {
 	}
 }
 
+// WithAsync marks the endpoint as always running asynchronously. Calls return a job that can be used to track the
+// call and retrieve its result instead of waiting for the result.
+func WithAsync() Validators {
+	return func(v *validationOptions) {
+		v.async = true
+	}
+}
+
 // Validators is a function that takes a validationOptions struct and sets the options for the endpoint
 type Validators func(validator *validationOptions)
 
@@ -45,4 +57,6 @@ type validationOptions struct {
 	parameters interface{}
 	body       interface{}
 	output     interface{}
+	timeout    time.Duration
+	async      bool
 }
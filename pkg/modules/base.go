@@ -31,6 +31,7 @@ type LogMessage struct {
 type ModuleBase struct {
 	LogChan        chan LogMessage
 	Methods        map[string]endpoint.Func
+	StreamMethods  map[string]endpoint.StreamFunc
 	rootPath       string
 	standaloneMode bool
 }
@@ -42,12 +43,26 @@ func (m *ModuleBase) Register(request *api.ModuleRegisterRequest, reply *api.Mod
 
 // Call is a shim that calls the appropriate method on the module
 func (m *ModuleBase) Call(method string, args *endpoint.Request) (out *endpoint.Response, err error) {
-	key := method
-	if f, exists := m.Methods[key]; exists {
-		return f(args)
+	if key, params, exists := endpoint.MatchMethod(m.Methods, method); exists {
+		args.SetPathParameters(params)
+		return m.Methods[key](args)
 	}
 
-	return nil, fmt.Errorf("method %s not found", method)
+	if _, _, exists := endpoint.MatchMethod(m.StreamMethods, method); exists {
+		return nil, endpoint.ErrStreamingEndpoint
+	}
+
+	return nil, endpoint.NotFoundError("method %s not found", method)
+}
+
+// CallStream is a shim that calls the appropriate streaming method on the module
+func (m *ModuleBase) CallStream(method string, args *endpoint.Request, send endpoint.StreamSender) error {
+	if key, params, exists := endpoint.MatchMethod(m.StreamMethods, method); exists {
+		args.SetPathParameters(params)
+		return m.StreamMethods[key](args, send)
+	}
+
+	return endpoint.NotFoundError("streaming method %s not found", method)
 }
 
 // LoggingStream is a function that sets up the logging channel for modules to use so that they can log messages back
@@ -82,8 +97,16 @@ func (m *ModuleBase) RegisterMethods(endpoints []*endpoint.Endpoint) {
 	if m.Methods == nil {
 		m.Methods = make(map[string]endpoint.Func)
 	}
+	if m.StreamMethods == nil {
+		m.StreamMethods = make(map[string]endpoint.StreamFunc)
+	}
 	for _, ep := range endpoints {
-		m.Methods[fmt.Sprintf("%s:%s", ep.Action, ep.Path)] = ep.Function
+		key := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+		if ep.Streaming {
+			m.StreamMethods[key] = ep.StreamFunction
+			continue
+		}
+		m.Methods[key] = ep.Function
 	}
 }
 
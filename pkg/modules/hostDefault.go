@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	api "github.com/bgrewell/dtac-agent/api/grpc/go"
+	"github.com/bgrewell/dtac-agent/pkg/endpoint"
 	"github.com/bgrewell/dtac-agent/pkg/modules/utility"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -52,10 +53,11 @@ func (mh *DefaultModuleHost) Register(ctx context.Context, request *api.ModuleRe
 // module's Call method.
 func (mh *DefaultModuleHost) Call(ctx context.Context, request *api.EndpointRequestMessage) (*api.EndpointResponseMessage, error) {
 	// Call the module
-	in := utility.APIEndpointRequestToEndpointRequest(request.Request)
+	in := utility.APIEndpointRequestToEndpointRequest(request.Request).WithContext(ctx)
 	ret, err := mh.Module.Call(request.Method, in)
 	if err != nil {
-		return nil, err
+		// Convert to an endpoint error so the code, details and retryable flag survive the gRPC boundary
+		return nil, endpoint.AsError(err)
 	}
 
 	// Return result
@@ -67,6 +69,24 @@ func (mh *DefaultModuleHost) Call(ctx context.Context, request *api.EndpointRequ
 	}, nil
 }
 
+// CallStream acts as a shim between the gRPC interface and the module interface for server-streaming endpoints. Each
+// response produced by the module is converted and sent to the caller as it becomes available.
+func (mh *DefaultModuleHost) CallStream(request *api.EndpointRequestMessage, stream api.ModuleService_CallStreamServer) error {
+	in := utility.APIEndpointRequestToEndpointRequest(request.Request).WithContext(stream.Context())
+	var id int32
+	err := mh.Module.CallStream(request.Method, in, func(out *endpoint.Response) error {
+		id++
+		return stream.Send(&api.EndpointResponseMessage{
+			Id:       id,
+			Response: utility.EndpointResponseToAPIEndpointResponse(out),
+		})
+	})
+	if err != nil {
+		return endpoint.AsError(err)
+	}
+	return nil
+}
+
 // LoggingStream acts as a shim between the gRPC interface and the module interface. It handles setting up the logging
 // channel so the module can send structure logging messages back to the agent.
 func (mh *DefaultModuleHost) LoggingStream(req *api.LoggingArgs, stream api.ModuleService_LoggingStreamServer) error {
@@ -21,6 +21,7 @@ type ModuleLoader interface {
 	CloseModule(moduleName string) (err error)
 	Endpoints() []*endpoint.Endpoint
 	CallShim(ep *endpoint.Endpoint, in *endpoint.Request) (out *endpoint.Response, err error)
+	CallStreamShim(ep *endpoint.Endpoint, in *endpoint.Request, send endpoint.StreamSender) (err error)
 }
 
 // NewModuleLoader takes in the module directory, the sanity cookie and the routeGroup.
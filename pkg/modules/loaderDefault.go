@@ -395,13 +395,13 @@ func (ml *DefaultModuleLoader) CallShim(ep *endpoint.Endpoint, in *endpoint.Requ
 key := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
 entry, ok := ml.routeMap[key]
 if !ok {
-return nil, fmt.Errorf("no route found for %s", key)
+return nil, endpoint.NotFoundError("no route found for %s", key)
 }
 
 // Get the module
 mod, ok := ml.modules[entry.ModuleName]
 if !ok {
-return nil, fmt.Errorf("no module found with name %s", entry.ModuleName)
+return nil, endpoint.UnavailableError("no module found with name %s", entry.ModuleName)
 }
 
 // Build the method key (action:path format)
@@ -411,15 +411,57 @@ methodKey := fmt.Sprintf("%s:%s", ep.Action, entry.HandleFunc)
 apiRequest := utility.EndpointRequestToAPIEndpointRequest(in)
 
 // Call the module
-apiResponse, err := mod.RPC.Call(context.Background(), &api.EndpointRequestMessage{
+apiResponse, err := mod.RPC.Call(in.Context(), &api.EndpointRequestMessage{
 Method:  methodKey,
 Request: apiRequest,
 })
 if err != nil {
-return nil, err
+return nil, endpoint.ErrorFromStatus(err)
 }
 
 // Convert the response
 out = utility.APIEndpointResponseToEndpointResponse(apiResponse.Response)
 return out, nil
 }
+
+// CallStreamShim is a shim that calls the appropriate module streaming method. Each message received from the module
+// is passed to send. If send returns an error the stream is canceled and the error is returned.
+func (ml *DefaultModuleLoader) CallStreamShim(ep *endpoint.Endpoint, in *endpoint.Request, send endpoint.StreamSender) (err error) {
+	// Get the module name and handler function from the route map
+	key := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+	entry, ok := ml.routeMap[key]
+	if !ok {
+		return endpoint.NotFoundError("no route found for %s", key)
+	}
+
+	// Get the module
+	mod, ok := ml.modules[entry.ModuleName]
+	if !ok {
+		return endpoint.UnavailableError("no module found with name %s", entry.ModuleName)
+	}
+
+	// Open the stream
+	ctx, cancel := context.WithCancel(in.Context())
+	defer cancel()
+	stream, err := mod.RPC.CallStream(ctx, &api.EndpointRequestMessage{
+		Method:  fmt.Sprintf("%s:%s", ep.Action, entry.HandleFunc),
+		Request: utility.EndpointRequestToAPIEndpointRequest(in),
+	})
+	if err != nil {
+		return endpoint.ErrorFromStatus(err)
+	}
+
+	// Relay messages until the module closes the stream
+	for {
+		apiResponse, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return endpoint.ErrorFromStatus(err)
+		}
+		if err := send(utility.APIEndpointResponseToEndpointResponse(apiResponse.Response)); err != nil {
+			return err
+		}
+	}
+}
@@ -10,6 +10,7 @@ type Module interface {
 	Name() string
 	Register(args *api.ModuleRegisterRequest, reply *api.ModuleRegisterResponse) error
 	Call(method string, args *endpoint.Request) (out *endpoint.Response, err error)
+	CallStream(method string, args *endpoint.Request, send endpoint.StreamSender) error
 	RootPath() string
 	LoggingStream(stream api.ModuleService_LoggingStreamServer) error
 }
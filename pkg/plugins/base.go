@@ -13,9 +13,10 @@ type PluginMethod func(input *endpoint.Request) (output *endpoint.Response, err
 
 // PluginBase is a base struct that all plugins should embed as it implements the common shared methods
 type PluginBase struct {
-	LogChan  chan LogMessage
-	Methods  map[string]endpoint.Func
-	rootPath string
+	LogChan       chan LogMessage
+	Methods       map[string]endpoint.Func
+	StreamMethods map[string]endpoint.StreamFunc
+	rootPath      string
 }
 
 // Register is a default implementation of the Register method that must be implemented by the plugin therefor this one returns an error
@@ -25,12 +26,26 @@ func (p *PluginBase) Register(request *api.RegisterRequest, reply *api.RegisterR
 
 // Call is a shim that calls the appropriate method on the plugin
 func (p *PluginBase) Call(method string, args *endpoint.Request) (out *endpoint.Response, err error) {
-	key := method
-	if f, exists := p.Methods[key]; exists {
-		return f(args)
+	if key, params, exists := endpoint.MatchMethod(p.Methods, method); exists {
+		args.SetPathParameters(params)
+		return p.Methods[key](args)
 	}
 
-	return nil, fmt.Errorf("method %s not found", method)
+	if _, _, exists := endpoint.MatchMethod(p.StreamMethods, method); exists {
+		return nil, endpoint.ErrStreamingEndpoint
+	}
+
+	return nil, endpoint.NotFoundError("method %s not found", method)
+}
+
+// CallStream is a shim that calls the appropriate streaming method on the plugin
+func (p *PluginBase) CallStream(method string, args *endpoint.Request, send endpoint.StreamSender) error {
+	if key, params, exists := endpoint.MatchMethod(p.StreamMethods, method); exists {
+		args.SetPathParameters(params)
+		return p.StreamMethods[key](args, send)
+	}
+
+	return endpoint.NotFoundError("streaming method %s not found", method)
 }
 
 // LoggingStream is a function that sets up the logging channel for plugins to use so that they can log messages back
@@ -65,8 +80,16 @@ func (p *PluginBase) RegisterMethods(endpoints []*endpoint.Endpoint) {
 	if p.Methods == nil {
 		p.Methods = make(map[string]endpoint.Func)
 	}
+	if p.StreamMethods == nil {
+		p.StreamMethods = make(map[string]endpoint.StreamFunc)
+	}
 	for _, ep := range endpoints {
-		p.Methods[fmt.Sprintf("%s:%s", ep.Action, ep.Path)] = ep.Function
+		key := fmt.Sprintf("%s:%s", ep.Action, ep.Path)
+		if ep.Streaming {
+			p.StreamMethods[key] = ep.StreamFunction
+			continue
+		}
+		p.Methods[key] = ep.Function
 	}
 }
 
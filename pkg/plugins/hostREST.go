@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -179,8 +180,26 @@ func (rh *RESTPluginHost) handlePluginRequest(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Bound the call by the client's deadline if one was supplied
+	timeout, err := endpoint.ParseTimeout(r.Header.Get(endpoint.HeaderRequestTimeout))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
 	// Call the plugin
 	resp, err := rh.Plugin.Call(methodName, req)
+	if errors.Is(err, endpoint.ErrStreamingEndpoint) {
+		rh.streamEndpointResponse(w, methodName, req)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Plugin call failed: %v", err), http.StatusInternalServerError)
 		return
@@ -245,3 +264,27 @@ func (rh *RESTPluginHost) sendEndpointResponse(w http.ResponseWriter, resp *endp
 		w.Write(resp.Value)
 	}
 }
+
+// streamEndpointResponse calls a streaming plugin method and writes each response as a line of JSON
+func (rh *RESTPluginHost) streamEndpointResponse(w http.ResponseWriter, methodName string, req *endpoint.Request) {
+	flusher, _ := w.(http.Flusher)
+	started := false
+	err := rh.Plugin.CallStream(methodName, req, func(resp *endpoint.Response) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := w.Write(append(resp.Value, '\n')); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		http.Error(w, fmt.Sprintf("Plugin call failed: %v", err), http.StatusInternalServerError)
+	}
+}
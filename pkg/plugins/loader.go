@@ -21,6 +21,7 @@ type PluginLoader interface {
 	ClosePlugin(pluginName string) (err error)
 	Endpoints() []*endpoint.Endpoint
 	CallShim(ep *endpoint.Endpoint, in *endpoint.Request) (out *endpoint.Response, err error)
+	CallStreamShim(ep *endpoint.Endpoint, in *endpoint.Request, send endpoint.StreamSender) (err error)
 }
 
 // NewPluginLoader takes in the plugin directory, the sanity cookie and the routeGroup.
@@ -348,39 +348,84 @@ func (pl *DefaultPluginLoader) Endpoints() []*endpoint.Endpoint {
 // plugin.
 func (pl *DefaultPluginLoader) CallShim(ep *endpoint.Endpoint, in *endpoint.Request) (out *endpoint.Response, err error) {
 
+	// Resolve the plugin and request message
+	plug, erm, err := pl.resolve(ep, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make the rpc call
+	ret, err := plug.RPC.Call(in.Context(), erm)
+	if err != nil {
+		return nil, endpoint.ErrorFromStatus(err)
+	}
+	out = utility.APIEndpointResponseToEndpointResponse(ret.Response)
+
+	return out, nil
+}
+
+// CallStreamShim is used to make a call into a plugins streaming function. Each message received from the plugin is
+// passed to send. If send returns an error the stream is canceled and the error is returned.
+func (pl *DefaultPluginLoader) CallStreamShim(ep *endpoint.Endpoint, in *endpoint.Request, send endpoint.StreamSender) (err error) {
+
+	// Resolve the plugin and request message
+	plug, erm, err := pl.resolve(ep, in)
+	if err != nil {
+		return err
+	}
+
+	// Open the stream
+	ctx, cancel := context.WithCancel(in.Context())
+	defer cancel()
+	stream, err := plug.RPC.CallStream(ctx, erm)
+	if err != nil {
+		return endpoint.ErrorFromStatus(err)
+	}
+
+	// Relay messages until the plugin closes the stream
+	for {
+		ret, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return endpoint.ErrorFromStatus(err)
+		}
+		if err := send(utility.APIEndpointResponseToEndpointResponse(ret.Response)); err != nil {
+			return err
+		}
+	}
+}
+
+// resolve looks up the plugin that handles the endpoint and builds the request message to send to it
+func (pl *DefaultPluginLoader) resolve(ep *endpoint.Endpoint, in *endpoint.Request) (plug *PluginInfo, erm *api.EndpointRequestMessage, err error) {
+
 	// Extract the RouteKey
 	keyPath := strings.TrimLeft(strings.Replace(ep.Path, pl.pluginRoot, "", 1), "/")
 	routeKey := fmt.Sprintf("%s:%s", ep.Action, keyPath)
 
 	// Get the HandlerEntry
 	if _, ok := pl.routeMap[routeKey]; !ok {
-		return nil, errors.New("a handler was not found for the requested resource")
+		return nil, nil, endpoint.NotFoundError("a handler was not found for the requested resource")
 	}
 
 	handler := pl.routeMap[routeKey]
 
 	// Make sure plugin isn't canceled
 	if pl.plugins[handler.PluginName].HasExited {
-		return nil, fmt.Errorf("the plugin has exited with code: %d", pl.plugins[handler.PluginName].ExitCode)
+		return nil, nil, endpoint.UnavailableError("the plugin has exited with code: %d", pl.plugins[handler.PluginName].ExitCode).WithRetryable(false)
 	}
 
 	// Get the plugin
-	plug := pl.plugins[handler.PluginName]
+	plug = pl.plugins[handler.PluginName]
 
 	// Setup the request message
-	erm := &api.EndpointRequestMessage{
+	erm = &api.EndpointRequestMessage{
 		Method:  fmt.Sprintf("%s:%s", ep.Action, handler.HandleFunc),
 		Request: utility.EndpointRequestToAPIEndpointRequest(in),
 	}
 
-	// Make the rpc call
-	ret, err := plug.RPC.Call(context.Background(), erm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call plugin function: %s", err)
-	}
-	out = utility.APIEndpointResponseToEndpointResponse(ret.Response)
-
-	return out, nil
+	return plug, erm, nil
 }
 
 // executePlugin is called to launch a plugin
@@ -10,6 +10,7 @@ type Plugin interface {
 	Name() string
 	Register(args *api.RegisterRequest, reply *api.RegisterResponse) error
 	Call(method string, args *endpoint.Request) (out *endpoint.Response, err error)
+	CallStream(method string, args *endpoint.Request, send endpoint.StreamSender) error
 	RootPath() string
 	LoggingStream(stream api.PluginService_LoggingStreamServer) error
 }
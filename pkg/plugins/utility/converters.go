@@ -3,6 +3,7 @@ package utility
 import (
 	api "github.com/bgrewell/dtac-agent/api/grpc/go"
 	"github.com/bgrewell/dtac-agent/pkg/endpoint"
+	"time"
 )
 
 // ConvertPluginEndpointToEndpoint converts an api.PluginEndpoint to an endpoint.Endpoint
@@ -20,6 +21,9 @@ func ConvertPluginEndpointToEndpoint(ep *api.PluginEndpoint) *endpoint.Endpoint
 		ExpectedParametersSchema: ep.ExpectedParametersSchema,
 		ExpectedBodySchema:       ep.ExpectedBodySchema,
 		ExpectedOutputSchema:     ep.ExpectedOutputSchema,
+		Streaming:                ep.Streaming,
+		Timeout:                  time.Duration(ep.TimeoutMs) * time.Millisecond,
+		Async:                    ep.Async,
 	}
 	return eep
 }
@@ -37,6 +41,9 @@ func ConvertEndpointToPluginEndpoint(ep *endpoint.Endpoint) *api.PluginEndpoint
 		ExpectedParametersSchema: ep.ExpectedParametersSchema,
 		ExpectedBodySchema:       ep.ExpectedBodySchema,
 		ExpectedOutputSchema:     ep.ExpectedOutputSchema,
+		Streaming:                ep.Streaming,
+		TimeoutMs:                ep.Timeout.Milliseconds(),
+		Async:                    ep.Async,
 	}
 	return aep
 }